@@ -1,10 +1,29 @@
 package api
 
+import "time"
+
 // Pipeline specifies the schema of a pipeline to be orchestrated.
 type Pipeline struct {
 	Name   string
 	Stages []*Stage
 	Links  []*Link
+	// DeadLetter receives the messages of the stages that fail and skip
+	// them. If nil, the failed messages are discarded.
+	DeadLetter *DeadLetter
+	// PropagateMetadata are the names of the headers and trailers received
+	// from each stage that are sent as request metadata to the next stages.
+	PropagateMetadata []string
+}
+
+// DeadLetter specifies where to send the messages that failed. Exactly one
+// of File or Address is specified.
+type DeadLetter struct {
+	// File is the path of the file where the failed messages are appended,
+	// one json object per line.
+	File string
+	// Address is the method that receives the failed messages, in the
+	// format address/service/method.
+	Address string
 }
 
 // Stage specifies a given step of the Pipeline.
@@ -13,6 +32,146 @@ type Stage struct {
 	Address string
 	Service string
 	Method  string
+	// Timeout for each invocation of the stage method. If zero, a default
+	// timeout is used.
+	Timeout time.Duration
+	// TLS configures a secure connection with the stage server. If nil, the
+	// connection is insecure.
+	TLS *TLS
+	// OnError specifies what happens when the stage method fails, either
+	// "fail" to stop the pipeline or "skip" to send the message to the dead
+	// letter and continue. Defaults to "fail".
+	OnError string
+	// CircuitBreaker stops calling the stage method while it keeps failing.
+	// If nil, the method is always called.
+	CircuitBreaker *CircuitBreaker
+	// Retry retries the failed calls of the stage method and the resolution
+	// of the method. If nil, the calls are not retried and the resolution is
+	// retried while the server is unavailable.
+	Retry *Retry
+	// Metadata are the headers sent with every call of the stage method.
+	Metadata []*Header
+	// Auth authenticates the calls of the stage method and the reflection
+	// requests that resolve it. If nil, the calls are not authenticated.
+	Auth *Auth
+}
+
+// Auth specifies how to obtain the tokens sent with the calls to a server.
+// Exactly one of OAuth2 or JWT is specified.
+type Auth struct {
+	// OAuth2 obtains the tokens from a token endpoint.
+	OAuth2 *OAuth2
+	// JWT signs the tokens with a local key.
+	JWT *JWT
+	// RefreshBefore is how long before expiring the tokens are refreshed. If
+	// zero, a default is used.
+	RefreshBefore time.Duration
+	// Insecure allows sending the tokens over insecure connections.
+	Insecure bool
+}
+
+// OAuth2 specifies a token endpoint with the client credentials grant. At
+// most one of ClientSecret, ClientSecretEnv or ClientSecretFile is
+// specified.
+type OAuth2 struct {
+	TokenURL string
+	ClientID string
+	// ClientSecret is the secret of the client.
+	ClientSecret string
+	// ClientSecretEnv is the name of the environment variable with the
+	// secret.
+	ClientSecretEnv string
+	// ClientSecretFile is the path of the file with the secret. The leading
+	// and trailing whitespace of the file is removed.
+	ClientSecretFile string
+	Scopes           []string
+	Audience         string
+}
+
+// JWT specifies how to sign the tokens.
+type JWT struct {
+	// KeyFile is the path of the PEM private key that signs the tokens.
+	KeyFile string
+	// KeyID is sent in the kid header of the tokens, if not empty.
+	KeyID    string
+	Issuer   string
+	Subject  string
+	Audience string
+	// Lifetime of the tokens. If zero, a default is used.
+	Lifetime time.Duration
+}
+
+// Header is an entry of the metadata sent with the calls to a method.
+// Exactly one of Value, Env or File is specified.
+type Header struct {
+	Name string
+	// Value is the value of the header.
+	Value string
+	// Env is the name of the environment variable with the value.
+	Env string
+	// File is the path of the file with the value. The leading and trailing
+	// whitespace of the file is removed.
+	File string
+}
+
+// Retry specifies how to retry the failed calls to a method.
+type Retry struct {
+	// MaxAttempts is the maximum number of calls for each message,
+	// including the first. If zero, a default is used.
+	MaxAttempts uint
+	// InitialBackoff is the time before the first retry, which doubles after
+	// each retry. If zero, a default is used.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum time between retries. If zero, a default is
+	// used.
+	MaxBackoff time.Duration
+	// Jitter randomizes the time between retries, either "none", "full" or
+	// "decorrelated". Defaults to "full".
+	Jitter string
+	// Codes are the names of the grpc status codes that are retried, such as
+	// "UNAVAILABLE". Defaults to UNAVAILABLE.
+	Codes []string
+}
+
+// CircuitBreaker specifies when to stop calling a failing method. The
+// breaker opens when any of the thresholds is reached, and the calls are
+// then stopped for the open timeout. Afterwards, the breaker is half-open
+// and probes the method, closing once enough calls succeed.
+type CircuitBreaker struct {
+	// ConsecutiveFailures opens the breaker after this number of calls fail
+	// in a row. If zero, the threshold is not used.
+	ConsecutiveFailures uint
+	// ErrorRate opens the breaker when this fraction of the last Window
+	// calls fail. If zero, the threshold is not used.
+	ErrorRate float64
+	// Window is the number of calls used to compute the error rate. If zero,
+	// a default window is used.
+	Window uint
+	// OpenTimeout is how long the breaker stays open. If zero, a default
+	// timeout is used.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of successful calls required to close a
+	// half-open breaker. If zero, a single call is required.
+	HalfOpenProbes uint
+	// WhileOpen specifies what happens to the messages while the breaker is
+	// open, either "wait" to wait for the breaker to be half-open or "fail"
+	// to fail the calls according to the error policy. Defaults to "wait".
+	WhileOpen string
+}
+
+// TLS specifies the settings for a secure connection with a server.
+type TLS struct {
+	// CAFile is the path of the certificate authority used to verify the
+	// server certificate. If empty, the host root certificates are used.
+	CAFile string
+	// CertFile and KeyFile are the paths of the client certificate and key
+	// for mutual authentication. Both must be specified or omitted.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name used to verify the server certificate.
+	ServerName string
+	// InsecureSkipVerify disables the verification of the server certificate.
+	InsecureSkipVerify bool
 }
 
 // Link defines a connection between two Stage objects in a Pipeline.
@@ -25,4 +184,14 @@ type Link struct {
 	Size        uint
 	// Number of empty messages to fill the link with.
 	NumEmptyMessages uint
+	// Strict rejects the link if source fields are dropped or target fields
+	// are never set.
+	Strict bool
+	// Match specifies how the fields of the source and target messages are
+	// matched, either "by_number" or "by_name". Defaults to "by_number".
+	Match string
+	// SourceType is the full name of the message type wrapped in the source
+	// messages, such as google.protobuf.Any messages, that are unwrapped
+	// before they are sent to the target.
+	SourceType string
 }
@@ -0,0 +1,183 @@
+// Package auth authenticates the calls to the stage methods with tokens
+// that are obtained from a token endpoint or signed locally, and refreshed
+// before they expire.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// DefaultRefreshBefore is how long before expiring the tokens are refreshed
+// if not specified.
+const DefaultRefreshBefore = time.Minute
+
+// refreshRetry is how long after a failed refresh the source is called again
+// while the current token has not expired.
+const refreshRetry = 5 * time.Second
+
+// Clock returns the current time to check when the tokens expire, so that
+// tests control its passage.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Token is a credential sent with the calls.
+type Token struct {
+	// Value is the encoded token.
+	Value string
+	// Type is the authorization scheme of the token, such as "Bearer". If
+	// empty, "Bearer" is used.
+	Type string
+	// Expiry is when the token expires. If zero, the token never expires.
+	Expiry time.Time
+}
+
+// TokenSource creates new tokens.
+type TokenSource interface {
+	Token(ctx context.Context) (Token, error)
+}
+
+// Credentials sends the tokens of a source in the authorization header of
+// the calls. The tokens are reused until they are close to expiring. It is
+// safe to use concurrently.
+type Credentials struct {
+	src           TokenSource
+	refreshBefore time.Duration
+	insecure      bool
+	clock         Clock
+
+	mu sync.Mutex
+	// token is the last token of the source, and issued when it was
+	// obtained.
+	token  Token
+	issued time.Time
+	// failed is when the last refresh failed, and zero if it succeeded.
+	failed time.Time
+	// refreshing is closed when the token being obtained from the source is
+	// stored, and nil if no token is being obtained.
+	refreshing chan struct{}
+}
+
+var _ credentials.PerRPCCredentials = (*Credentials)(nil)
+
+// NewCredentials creates credentials that refresh the tokens of src before
+// they expire. If refreshBefore is zero, DefaultRefreshBefore is used. If
+// insecure is true, the tokens are also sent over insecure connections,
+// which should only be used for local testing.
+func NewCredentials(src TokenSource, refreshBefore time.Duration, insecure bool) *Credentials {
+	if refreshBefore == 0 {
+		refreshBefore = DefaultRefreshBefore
+	}
+	return &Credentials{
+		src:           src,
+		refreshBefore: refreshBefore,
+		insecure:      insecure,
+		clock:         realClock{},
+	}
+}
+
+// GetRequestMetadata returns the authorization header with a valid token.
+func (c *Credentials) GetRequestMetadata(
+	ctx context.Context, _ ...string,
+) (map[string]string, error) {
+	t, err := c.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	typ := t.Type
+	if typ == "" {
+		typ = "Bearer"
+	}
+	return map[string]string{"authorization": typ + " " + t.Value}, nil
+}
+
+// RequireTransportSecurity reports whether the tokens are only sent over
+// secure connections.
+func (c *Credentials) RequireTransportSecurity() bool { return !c.insecure }
+
+// Token returns the current token, obtaining a new one from the source if
+// it must be refreshed. If the refresh fails, the current token is returned
+// while it has not expired, and the source is only called again after
+// refreshRetry. The source is called without holding the lock,
+// and while it is called, the other calls return the current token if it has
+// not expired, or wait for the new one.
+func (c *Credentials) Token(ctx context.Context) (Token, error) {
+	c.mu.Lock()
+	now := c.clock.Now()
+	if c.token.Value != "" && now.Before(c.refreshAt()) {
+		defer c.mu.Unlock()
+		return c.token, nil
+	}
+	refreshing := c.refreshing
+	backoff := !c.failed.IsZero() && now.Before(c.failed.Add(refreshRetry))
+	if (refreshing != nil || backoff) && c.valid(now) {
+		defer c.mu.Unlock()
+		return c.token, nil
+	}
+	if refreshing == nil {
+		done := make(chan struct{})
+		c.refreshing = done
+		c.mu.Unlock()
+		return c.refresh(ctx, now, done)
+	}
+	c.mu.Unlock()
+	select {
+	case <-refreshing:
+		return c.Token(ctx)
+	case <-ctx.Done():
+		return Token{}, fmt.Errorf("get token: %w", ctx.Err())
+	}
+}
+
+// refresh obtains a new token from the source, which was requested at now,
+// and closes done once it is stored.
+func (c *Credentials) refresh(ctx context.Context, now time.Time, done chan struct{}) (Token, error) {
+	t, err := c.src.Token(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshing = nil
+	defer close(done)
+	if err != nil {
+		c.failed = now
+		if c.valid(now) {
+			return c.token, nil
+		}
+		return Token{}, fmt.Errorf("get token: %w", err)
+	}
+	if t.Value == "" {
+		return Token{}, errors.New("get token: empty token")
+	}
+	c.token, c.issued, c.failed = t, now, time.Time{}
+	return t, nil
+}
+
+// valid reports whether the current token has not expired at now.
+func (c *Credentials) valid(now time.Time) bool {
+	return c.token.Value != "" && (c.token.Expiry.IsZero() || now.Before(c.token.Expiry))
+}
+
+// refreshAt returns when the current token must be refreshed. Tokens that
+// live less than twice the refresh time are refreshed halfway through
+// their life, so that they are not refreshed on every call.
+func (c *Credentials) refreshAt() time.Time {
+	if c.token.Expiry.IsZero() {
+		// The zero time is before any other, and so the token is never
+		// refreshed if now is compared with the maximum time instead.
+		return time.Unix(1<<62, 0)
+	}
+	before := c.refreshBefore
+	if half := c.token.Expiry.Sub(c.issued) / 2; half < before {
+		before = half
+	}
+	return c.token.Expiry.Add(-before)
+}
@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCredentials_Refresh(t *testing.T) {
+	start := time.Unix(1000, 0)
+	type step struct {
+		// advance is the time that passes before the call.
+		advance time.Duration
+		// fail makes the source fail.
+		fail     bool
+		expected string
+		isErr    bool
+	}
+	tests := map[string]struct {
+		lifetime time.Duration
+		steps    []step
+	}{
+		"reuse until refresh": {
+			lifetime: 10 * time.Minute,
+			steps: []step{
+				{expected: "token-1"},
+				{advance: 8 * time.Minute, expected: "token-1"},
+				// The token is refreshed a minute before expiring.
+				{advance: time.Minute, expected: "token-2"},
+			},
+		},
+		"short lived": {
+			lifetime: time.Minute,
+			steps: []step{
+				{expected: "token-1"},
+				{advance: 29 * time.Second, expected: "token-1"},
+				// Tokens that live less than two minutes are refreshed
+				// halfway through their life.
+				{advance: time.Second, expected: "token-2"},
+			},
+		},
+		"failed refresh": {
+			lifetime: 10 * time.Minute,
+			steps: []step{
+				{expected: "token-1"},
+				// The current token is used while it has not expired.
+				{advance: 9 * time.Minute, fail: true, expected: "token-1"},
+				{advance: time.Minute, fail: true, isErr: true},
+				{expected: "token-2"},
+			},
+		},
+		"failed refresh backoff": {
+			lifetime: 10 * time.Minute,
+			steps: []step{
+				{expected: "token-1"},
+				{advance: 9 * time.Minute, fail: true, expected: "token-1"},
+				// The source is not called again right after failing.
+				{advance: time.Second, expected: "token-1"},
+				{advance: 4 * time.Second, expected: "token-2"},
+			},
+		},
+		"no expiry": {
+			steps: []step{
+				{expected: "token-1"},
+				{advance: 24 * time.Hour, expected: "token-1"},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			clock := &testClock{now: start}
+			src := &testSource{clock: clock, lifetime: tc.lifetime}
+			creds := NewCredentials(src, 0, false)
+			creds.clock = clock
+			for i, s := range tc.steps {
+				clock.advance(s.advance)
+				src.fail = s.fail
+				md, err := creds.GetRequestMetadata(context.Background())
+				if s.isErr {
+					if err == nil {
+						t.Fatalf("step %d: expected error", i)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("step %d: get metadata: %s", i, err)
+				}
+				expected := map[string]string{"authorization": "Bearer " + s.expected}
+				if diff := cmp.Diff(expected, md); diff != "" {
+					t.Fatalf("step %d: metadata mismatch:\n%s", i, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestCredentials_RefreshConcurrently(t *testing.T) {
+	clock := &testClock{now: time.Unix(1000, 0)}
+	src := &blockingSource{
+		testSource: testSource{clock: clock, lifetime: 10 * time.Minute},
+		entered:    make(chan struct{}),
+		release:    make(chan struct{}),
+	}
+	creds := NewCredentials(src, 0, false)
+	creds.clock = clock
+	ctx := context.Background()
+	if _, err := creds.Token(ctx); err != nil {
+		t.Fatalf("get token: %s", err)
+	}
+
+	// The token must be refreshed but has not expired.
+	clock.advance(9 * time.Minute)
+	src.block = true
+	refreshed := make(chan Token)
+	for i := 0; i < 2; i++ {
+		go func() {
+			tok, err := creds.Token(ctx)
+			if err != nil {
+				t.Errorf("get token: %s", err)
+			}
+			refreshed <- tok
+		}()
+	}
+	<-src.entered
+
+	// The other calls do not wait for the source while the token is valid.
+	current := make(chan Token)
+	go func() {
+		tok, err := creds.Token(ctx)
+		if err != nil {
+			t.Errorf("get token: %s", err)
+		}
+		current <- tok
+	}()
+	select {
+	case tok := <-current:
+		if diff := cmp.Diff("token-1", tok.Value); diff != "" {
+			t.Fatalf("current token mismatch:\n%s", diff)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("token blocked while refreshing")
+	}
+
+	close(src.release)
+	for i := 0; i < 2; i++ {
+		tok := <-refreshed
+		if tok.Value != "token-1" && tok.Value != "token-2" {
+			t.Fatalf("unexpected token %q", tok.Value)
+		}
+	}
+	// The source is only called once to refresh the token.
+	if diff := cmp.Diff(2, src.issued); diff != "" {
+		t.Fatalf("issued tokens mismatch:\n%s", diff)
+	}
+	tok, err := creds.Token(ctx)
+	if err != nil {
+		t.Fatalf("get token: %s", err)
+	}
+	if diff := cmp.Diff("token-2", tok.Value); diff != "" {
+		t.Fatalf("refreshed token mismatch:\n%s", diff)
+	}
+}
+
+// testSource creates numbered tokens that live for lifetime, or that never
+// expire if lifetime is zero.
+type testSource struct {
+	clock    *testClock
+	lifetime time.Duration
+	fail     bool
+	issued   int
+}
+
+func (s *testSource) Token(context.Context) (Token, error) {
+	if s.fail {
+		return Token{}, errors.New("token endpoint unavailable")
+	}
+	s.issued++
+	t := Token{Value: "token-" + strconv.Itoa(s.issued)}
+	if s.lifetime > 0 {
+		t.Expiry = s.clock.Now().Add(s.lifetime)
+	}
+	return t, nil
+}
+
+// blockingSource is a testSource that, once block is set, signals entered
+// and waits for release before creating the tokens.
+type blockingSource struct {
+	testSource
+	block   bool
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSource) Token(ctx context.Context) (Token, error) {
+	if s.block {
+		s.entered <- struct{}{}
+		<-s.release
+	}
+	return s.testSource.Token(ctx)
+}
+
+// testClock only advances when the test advances it.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
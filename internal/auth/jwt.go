@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+// DefaultJWTLifetime is the lifetime of the signed tokens if not specified.
+const DefaultJWTLifetime = time.Hour
+
+// JWTClaims are the registered claims of the signed tokens. The empty
+// claims are omitted.
+type JWTClaims struct {
+	Issuer   string
+	Subject  string
+	Audience string
+}
+
+// JWTSigner creates tokens signed with a private key. RSA keys sign with
+// RS256, ECDSA P-256 keys with ES256 and Ed25519 keys with EdDSA.
+type JWTSigner struct {
+	key      crypto.Signer
+	alg      string
+	keyID    string
+	claims   JWTClaims
+	lifetime time.Duration
+	clock    Clock
+}
+
+type unsupportedKey struct{ key crypto.PublicKey }
+
+func (err *unsupportedKey) Error() string {
+	return fmt.Sprintf("unsupported jwt key type %T", err.key)
+}
+
+// NewJWTSigner creates a signer of tokens that live for lifetime. If
+// lifetime is zero, DefaultJWTLifetime is used. The keyID is sent in the
+// kid header of the tokens, if not empty.
+func NewJWTSigner(
+	key crypto.Signer, keyID string, claims JWTClaims, lifetime time.Duration,
+) (*JWTSigner, error) {
+	var alg string
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		alg = "RS256"
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, &unsupportedKey{key: pub}
+		}
+		alg = "ES256"
+	case ed25519.PublicKey:
+		alg = "EdDSA"
+	default:
+		return nil, &unsupportedKey{key: pub}
+	}
+	if lifetime == 0 {
+		lifetime = DefaultJWTLifetime
+	}
+	s := &JWTSigner{
+		key:      key,
+		alg:      alg,
+		keyID:    keyID,
+		claims:   claims,
+		lifetime: lifetime,
+		clock:    realClock{},
+	}
+	return s, nil
+}
+
+// ReadPrivateKey reads a PEM encoded private key in the PKCS #8, PKCS #1
+// or SEC 1 formats.
+func ReadPrivateKey(file string) (crypto.Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no pem data in %s", file)
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("key in %s cannot sign", file)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown private key format in %s", file)
+}
+
+// Token signs a new token.
+func (s *JWTSigner) Token(context.Context) (Token, error) {
+	now := s.clock.Now()
+	exp := now.Add(s.lifetime)
+	header := struct {
+		Alg string `json:"alg"`
+		Typ string `json:"typ"`
+		Kid string `json:"kid,omitempty"`
+	}{Alg: s.alg, Typ: "JWT", Kid: s.keyID}
+	claims := struct {
+		Iss string `json:"iss,omitempty"`
+		Sub string `json:"sub,omitempty"`
+		Aud string `json:"aud,omitempty"`
+		Iat int64  `json:"iat"`
+		Exp int64  `json:"exp"`
+	}{
+		Iss: s.claims.Issuer,
+		Sub: s.claims.Subject,
+		Aud: s.claims.Audience,
+		Iat: now.Unix(),
+		Exp: exp.Unix(),
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		return Token{}, fmt.Errorf("jwt: %w", err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return Token{}, fmt.Errorf("jwt: %w", err)
+	}
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString(h) + "." + enc.EncodeToString(c)
+	sig, err := s.sign([]byte(signed))
+	if err != nil {
+		return Token{}, fmt.Errorf("jwt: sign: %w", err)
+	}
+	t := Token{
+		Value: signed + "." + enc.EncodeToString(sig),
+		// The expiry is truncated to seconds, as in the exp claim.
+		Expiry: time.Unix(exp.Unix(), 0),
+	}
+	return t, nil
+}
+
+func (s *JWTSigner) sign(data []byte) ([]byte, error) {
+	switch s.alg {
+	case "EdDSA":
+		return s.key.Sign(rand.Reader, data, crypto.Hash(0))
+	case "ES256":
+		digest := sha256.Sum256(data)
+		der, err := s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		return derToES256(der)
+	default:
+		digest := sha256.Sum256(data)
+		return s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+}
+
+// derToES256 converts an ASN.1 ECDSA signature to the fixed size encoding
+// of the signature of a JWT, with 32 bytes for each of r and s.
+func derToES256(der []byte) ([]byte, error) {
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, err
+	}
+	if sig.R.BitLen() > 256 || sig.S.BitLen() > 256 {
+		return nil, errors.New("ecdsa signature too large")
+	}
+	out := make([]byte, 64)
+	sig.R.FillBytes(out[:32])
+	sig.S.FillBytes(out[32:])
+	return out, nil
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJWTSigner_Token(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %s", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ecdsa key: %s", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %s", err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("marshal ecdsa key: %s", err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("marshal ed25519 key: %s", err)
+	}
+	tests := map[string]struct {
+		block *pem.Block
+		alg   string
+	}{
+		"rsa pkcs1": {
+			block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+			alg:   "RS256",
+		},
+		"ecdsa sec1": {
+			block: &pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER},
+			alg:   "ES256",
+		},
+		"ed25519 pkcs8": {
+			block: &pem.Block{Type: "PRIVATE KEY", Bytes: edDER},
+			alg:   "EdDSA",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "key.pem")
+			if err := os.WriteFile(file, pem.EncodeToMemory(tc.block), 0o600); err != nil {
+				t.Fatalf("write key: %s", err)
+			}
+			key, err := ReadPrivateKey(file)
+			if err != nil {
+				t.Fatalf("read key: %s", err)
+			}
+			claims := JWTClaims{Issuer: "maestro", Audience: "pipelines"}
+			signer, err := NewJWTSigner(key, "key-1", claims, 0)
+			if err != nil {
+				t.Fatalf("create signer: %s", err)
+			}
+			now := time.Unix(1000, 0)
+			signer.clock = &testClock{now: now}
+			tok, err := signer.Token(context.Background())
+			if err != nil {
+				t.Fatalf("sign token: %s", err)
+			}
+			if diff := cmp.Diff(now.Add(DefaultJWTLifetime), tok.Expiry); diff != "" {
+				t.Fatalf("expiry mismatch:\n%s", diff)
+			}
+
+			parts := strings.Split(tok.Value, ".")
+			if len(parts) != 3 {
+				t.Fatalf("expected 3 parts, got %d", len(parts))
+			}
+			var header, payload map[string]interface{}
+			decodePart(t, parts[0], &header)
+			decodePart(t, parts[1], &payload)
+			expectedHeader := map[string]interface{}{"alg": tc.alg, "typ": "JWT", "kid": "key-1"}
+			if diff := cmp.Diff(expectedHeader, header); diff != "" {
+				t.Fatalf("header mismatch:\n%s", diff)
+			}
+			expectedPayload := map[string]interface{}{
+				"iss": "maestro",
+				"aud": "pipelines",
+				"iat": float64(1000),
+				"exp": float64(1000 + 3600),
+			}
+			if diff := cmp.Diff(expectedPayload, payload); diff != "" {
+				t.Fatalf("payload mismatch:\n%s", diff)
+			}
+			sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+			if err != nil {
+				t.Fatalf("decode signature: %s", err)
+			}
+			if !verify(key.Public(), []byte(parts[0]+"."+parts[1]), sig) {
+				t.Fatalf("invalid signature")
+			}
+		})
+	}
+}
+
+func TestNewJWTSigner_UnsupportedCurve(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+	if _, err := NewJWTSigner(key, "", JWTClaims{}, 0); err == nil {
+		t.Fatalf("expected error for P-384 key")
+	}
+}
+
+func decodePart(t *testing.T, part string, v interface{}) {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		t.Fatalf("decode part: %s", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("unmarshal part: %s", err)
+	}
+}
+
+func verify(pub crypto.PublicKey, data, sig []byte) bool {
+	digest := sha256.Sum256(data)
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		if len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, digest[:], r, s)
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, data, sig)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ClientCredentials obtains tokens from an OAuth2 token endpoint with the
+// client credentials grant.
+type ClientCredentials struct {
+	// TokenURL is the url of the token endpoint.
+	TokenURL string
+	// ClientID and ClientSecret authenticate the client with the endpoint.
+	ClientID     string
+	ClientSecret string
+	// Scopes are the scopes requested for the tokens, if any.
+	Scopes []string
+	// Audience is the audience requested for the tokens, if not empty.
+	Audience string
+	// Client sends the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	clock Clock
+}
+
+// tokenResponse is the successful response of a token endpoint.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// errorResponse is the error response of a token endpoint.
+type errorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// Token requests a new token from the endpoint.
+func (c *ClientCredentials) Token(ctx context.Context) (Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	if c.Audience != "" {
+		form.Set("audience", c.Audience)
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return Token{}, fmt.Errorf("oauth2: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	clock := c.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	sent := clock.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("oauth2: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Token{}, fmt.Errorf("oauth2: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			if e.Description != "" {
+				return Token{}, fmt.Errorf("oauth2: %s: %s: %s", resp.Status, e.Error, e.Description)
+			}
+			return Token{}, fmt.Errorf("oauth2: %s: %s", resp.Status, e.Error)
+		}
+		return Token{}, fmt.Errorf("oauth2: %s", resp.Status)
+	}
+	var tr tokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return Token{}, fmt.Errorf("oauth2: decode response: %w", err)
+	}
+	if tr.AccessToken == "" {
+		return Token{}, fmt.Errorf("oauth2: response without access_token")
+	}
+	t := Token{Value: tr.AccessToken, Type: tokenType(tr.TokenType)}
+	// The expiry is measured from when the request was sent, so that the
+	// token is refreshed before the endpoint considers it expired.
+	if tr.ExpiresIn > 0 {
+		t.Expiry = sent.Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return t, nil
+}
+
+// tokenType normalizes the case of the bearer type, which endpoints return
+// in lowercase although the servers may expect "Bearer".
+func tokenType(typ string) string {
+	if typ == "" || strings.EqualFold(typ, "bearer") {
+		return "Bearer"
+	}
+	return typ
+}
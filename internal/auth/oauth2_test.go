@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClientCredentials_Token(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		id, secret, _ := r.BasicAuth()
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %s", err)
+		}
+		form := map[string]string{
+			"grant_type": r.PostForm.Get("grant_type"),
+			"scope":      r.PostForm.Get("scope"),
+			"audience":   r.PostForm.Get("audience"),
+		}
+		expectedForm := map[string]string{
+			"grant_type": "client_credentials",
+			"scope":      "read write",
+			"audience":   "pipelines",
+		}
+		if diff := cmp.Diff(expectedForm, form); diff != "" {
+			t.Errorf("form mismatch:\n%s", diff)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if id != "maestro" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"abc","token_type":"bearer","expires_in":300}`))
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1000, 0)
+	src := &ClientCredentials{
+		TokenURL:     srv.URL,
+		ClientID:     "maestro",
+		ClientSecret: "secret",
+		Scopes:       []string{"read", "write"},
+		Audience:     "pipelines",
+		clock:        &testClock{now: now},
+	}
+	tok, err := src.Token(context.Background())
+	if err != nil {
+		t.Fatalf("token: %s", err)
+	}
+	expected := Token{Value: "abc", Type: "Bearer", Expiry: now.Add(5 * time.Minute)}
+	if diff := cmp.Diff(expected, tok); diff != "" {
+		t.Fatalf("token mismatch:\n%s", diff)
+	}
+
+	src.ClientSecret = "wrong"
+	if _, err := src.Token(context.Background()); err == nil {
+		t.Fatalf("expected error with wrong secret")
+	}
+	if diff := cmp.Diff(2, requests); diff != "" {
+		t.Fatalf("requests mismatch:\n%s", diff)
+	}
+}
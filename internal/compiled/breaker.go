@@ -0,0 +1,99 @@
+package compiled
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+)
+
+const (
+	// DefaultBreakerWindow is the number of calls used to compute the error
+	// rate of the circuit breakers that do not specify one.
+	DefaultBreakerWindow = 20
+	// DefaultBreakerOpenTimeout is how long the circuit breakers that do not
+	// specify it stay open.
+	DefaultBreakerOpenTimeout = 30 * time.Second
+	// DefaultBreakerHalfOpenProbes is the number of calls let through by the
+	// half-open circuit breakers that do not specify it.
+	DefaultBreakerHalfOpenProbes = 1
+)
+
+// WhileOpen specifies what happens to the messages of a stage while its
+// circuit breaker is open.
+type WhileOpen string
+
+const (
+	// WhileOpenWait waits for the breaker to be half-open before calling the
+	// method.
+	WhileOpenWait WhileOpen = "wait"
+	// WhileOpenFail fails the calls, which are then handled by the error
+	// policy of the stage.
+	WhileOpenFail WhileOpen = "fail"
+)
+
+// CircuitBreaker stops the calls to a stage method while it keeps failing.
+// All the fields are set, with the defaults for the ones that were not
+// configured. A zero threshold is not used.
+type CircuitBreaker struct {
+	ConsecutiveFailures uint
+	ErrorRate           float64
+	Window              uint
+	OpenTimeout         time.Duration
+	HalfOpenProbes      uint
+	WhileOpen           WhileOpen
+}
+
+func compileCircuitBreaker(cfg *api.CircuitBreaker) (*CircuitBreaker, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if cfg.ConsecutiveFailures == 0 && cfg.ErrorRate == 0 {
+		return nil, &invalidCircuitBreaker{
+			reason: "specify consecutive failures or error rate",
+		}
+	}
+	if cfg.ErrorRate < 0 || cfg.ErrorRate > 1 {
+		return nil, &invalidCircuitBreaker{
+			reason: fmt.Sprintf("error rate %v not between 0 and 1", cfg.ErrorRate),
+		}
+	}
+	if cfg.OpenTimeout < 0 {
+		return nil, &invalidCircuitBreaker{
+			reason: fmt.Sprintf("negative open timeout %s", cfg.OpenTimeout),
+		}
+	}
+	cb := &CircuitBreaker{
+		ConsecutiveFailures: cfg.ConsecutiveFailures,
+		ErrorRate:           cfg.ErrorRate,
+		Window:              cfg.Window,
+		OpenTimeout:         cfg.OpenTimeout,
+		HalfOpenProbes:      cfg.HalfOpenProbes,
+		WhileOpen:           WhileOpen(cfg.WhileOpen),
+	}
+	if cb.Window == 0 {
+		cb.Window = DefaultBreakerWindow
+	}
+	if cb.OpenTimeout == 0 {
+		cb.OpenTimeout = DefaultBreakerOpenTimeout
+	}
+	if cb.HalfOpenProbes == 0 {
+		cb.HalfOpenProbes = DefaultBreakerHalfOpenProbes
+	}
+	switch cb.WhileOpen {
+	case "":
+		cb.WhileOpen = WhileOpenWait
+	case WhileOpenWait, WhileOpenFail:
+	default:
+		return nil, &invalidCircuitBreaker{
+			reason: fmt.Sprintf("unknown while open behaviour '%s'", cb.WhileOpen),
+		}
+	}
+	return cb, nil
+}
+
+type invalidCircuitBreaker struct{ reason string }
+
+func (err *invalidCircuitBreaker) Error() string {
+	return fmt.Sprintf("invalid circuit breaker: %s", err.reason)
+}
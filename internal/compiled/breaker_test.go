@@ -0,0 +1,76 @@
+package compiled
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompileCircuitBreaker(t *testing.T) {
+	tests := map[string]struct {
+		input    *api.CircuitBreaker
+		expected *CircuitBreaker
+		isErr    bool
+	}{
+		"nil": {},
+		"defaults": {
+			input: &api.CircuitBreaker{ConsecutiveFailures: 3},
+			expected: &CircuitBreaker{
+				ConsecutiveFailures: 3,
+				Window:              DefaultBreakerWindow,
+				OpenTimeout:         DefaultBreakerOpenTimeout,
+				HalfOpenProbes:      1,
+				WhileOpen:           WhileOpenWait,
+			},
+		},
+		"all fields": {
+			input: &api.CircuitBreaker{
+				ErrorRate:      0.5,
+				Window:         10,
+				OpenTimeout:    time.Second,
+				HalfOpenProbes: 2,
+				WhileOpen:      "fail",
+			},
+			expected: &CircuitBreaker{
+				ErrorRate:      0.5,
+				Window:         10,
+				OpenTimeout:    time.Second,
+				HalfOpenProbes: 2,
+				WhileOpen:      WhileOpenFail,
+			},
+		},
+		"no threshold": {
+			input: &api.CircuitBreaker{Window: 10},
+			isErr: true,
+		},
+		"error rate above one": {
+			input: &api.CircuitBreaker{ErrorRate: 1.5},
+			isErr: true,
+		},
+		"unknown while open": {
+			input: &api.CircuitBreaker{ConsecutiveFailures: 1, WhileOpen: "retry"},
+			isErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cb, err := compileCircuitBreaker(tc.input)
+			if tc.isErr {
+				var cbErr *invalidCircuitBreaker
+				if !errors.As(err, &cbErr) {
+					t.Fatalf("expected *invalidCircuitBreaker, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compile: %s", err)
+			}
+			if diff := cmp.Diff(tc.expected, cb); diff != "" {
+				t.Fatalf("circuit breaker mismatch:\n%s", diff)
+			}
+		})
+	}
+}
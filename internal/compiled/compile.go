@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/DuarteMRAlves/maestro/internal/api"
 	"github.com/DuarteMRAlves/maestro/internal/message"
@@ -13,11 +15,22 @@ import (
 // Context specifies a compilation context to create the pipeline.
 type Context struct {
 	resolver method.Resolver
+	// ctx bounds the resolution of the stage methods.
+	ctx context.Context
 }
 
 func NewContext(methodLoader method.Resolver) Context {
 	c := Context{}
 	c.resolver = methodLoader
+	c.ctx = context.Background()
+	return c
+}
+
+// WithContext returns a copy of the compilation context where the stage
+// methods are resolved with ctx, for example to set a deadline for the
+// resolution of all the stages.
+func (c Context) WithContext(ctx context.Context) Context {
+	c.ctx = ctx
 	return c
 }
 
@@ -57,43 +70,165 @@ func (err *linksSetSameField) Error() string {
 	return fmt.Sprintf("links '%s' and '%s' set same field '%s'", err.A, err.B, err.field)
 }
 
-type incompatibleMessageDesc struct{ A, B message.Type }
+type incompatibleMessageDesc struct {
+	A, B       message.Type
+	mismatches []message.FieldMismatch
+}
 
 func (err *incompatibleMessageDesc) Error() string {
-	return fmt.Sprintf("incompatible message descriptors: %s, %s", err.A, err.B)
+	msg := fmt.Sprintf("incompatible message descriptors: %s, %s", err.A, err.B)
+	for _, m := range err.mismatches {
+		msg += fmt.Sprintf("\n\tfield %s", m)
+	}
+	return msg
+}
+
+type matchByNameNotSupported struct {
+	link string
+	msg  message.Type
+}
+
+func (err *matchByNameNotSupported) Error() string {
+	return fmt.Sprintf("link '%s' cannot match the fields of %s by name", err.link, err.msg)
+}
+
+type sourceNotEnvelope struct {
+	link string
+	msg  message.Type
+}
+
+func (err *sourceNotEnvelope) Error() string {
+	return fmt.Sprintf("link '%s' declares a source type but %s does not wrap other messages", err.link, err.msg)
+}
+
+type unmatchedFields struct {
+	link           string
+	dropped, unset []message.FieldRef
+}
+
+func (err *unmatchedFields) Error() string {
+	msg := fmt.Sprintf("strict link '%s' has unmatched fields", err.link)
+	for _, f := range err.dropped {
+		msg += fmt.Sprintf("\n\tsource field %s is dropped", f)
+	}
+	for _, f := range err.unset {
+		msg += fmt.Sprintf("\n\ttarget field %s is never set", f)
+	}
+	return msg
+}
+
+// StageError is an error in the specification of a stage.
+type StageError struct {
+	Name string
+	Err  error
+}
+
+func (err *StageError) Error() string {
+	return fmt.Sprintf("stage '%s': %s", err.Name, err.Err)
+}
+
+func (err *StageError) Unwrap() error { return err.Err }
+
+// LinkError is an error in the specification of a link.
+type LinkError struct {
+	Name string
+	Err  error
 }
 
-// New compiles a Pipeline from its specification.
+func (err *LinkError) Error() string {
+	return fmt.Sprintf("link '%s': %s", err.Name, err.Err)
+}
+
+func (err *LinkError) Unwrap() error { return err.Err }
+
+// Errors lists all the errors found while compiling a pipeline.
+type Errors []error
+
+func (errs Errors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors:\n  %s", len(errs), strings.Join(msgs, "\n  "))
+}
+
+// Is reports whether any of the errors matches target.
+func (errs Errors) Is(target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error that matches target.
+func (errs Errors) As(target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// New compiles a Pipeline from its specification. All the stages and links
+// are compiled, and the errors found are returned together as Errors.
 func New(ctx Context, cfg *api.Pipeline) (*Pipeline, error) {
 	name, err := compileName(cfg.Name)
 	if err != nil {
 		return nil, err
 	}
+	propagate, err := compilePropagateMetadata(cfg.PropagateMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("propagate metadata: %w", err)
+	}
+
+	var errs Errors
+	// failed stages are not reported again by the links that use them.
+	failed := make(map[string]bool)
 
 	// condensed graph contains rpc stages with multiple inputs and outputs.
 	condensedGraph := make(stageGraph, len(cfg.Stages))
-	for _, stageCfg := range cfg.Stages {
+	methods := resolveMethods(ctx, cfg.Stages)
+	for i, stageCfg := range cfg.Stages {
 		stageName := stageCfg.Name
-		stage, err := compileStage(ctx, stageCfg)
+		stage, err := compileStage(stageCfg, methods[i])
 		if err != nil {
-			return nil, fmt.Errorf("compile stage '%s': %w", stageName, err)
+			err = fmt.Errorf("compile: %w", err)
+			errs = append(errs, &StageError{Name: stageName, Err: err})
+			failed[stageName] = true
+			continue
 		}
 		err = validateStage(condensedGraph, stage)
 		if err != nil {
-			return nil, fmt.Errorf("validate stage '%s': %w", stageName, err)
+			err = fmt.Errorf("validate: %w", err)
+			errs = append(errs, &StageError{Name: stageName, Err: err})
+			continue
 		}
+		stage.propagate = propagate
 		condensedGraph[stage.name] = stage
 	}
 
 	for _, linkCfg := range cfg.Links {
 		linkName := linkCfg.Name
+		if failed[linkCfg.SourceStage] || failed[linkCfg.TargetStage] {
+			continue
+		}
 		link, err := compileLink(linkCfg)
 		if err != nil {
-			return nil, fmt.Errorf("compile link '%s': %w", linkName, err)
+			err = fmt.Errorf("compile: %w", err)
+			errs = append(errs, &LinkError{Name: linkName, Err: err})
+			continue
 		}
 		err = validateLink(condensedGraph, link)
 		if err != nil {
-			return nil, fmt.Errorf("validate link '%s': %w", linkName, err)
+			err = fmt.Errorf("validate: %w", err)
+			errs = append(errs, &LinkError{Name: linkName, Err: err})
+			continue
 		}
 
 		source := condensedGraph[link.Source().Stage()]
@@ -102,6 +237,9 @@ func New(ctx Context, cfg *api.Pipeline) (*Pipeline, error) {
 		target.inputs = append(target.inputs, link)
 		source.outputs = append(source.outputs, link)
 	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
 
 	augmentedGraph := augmentedGraphFromCondensed(condensedGraph)
 
@@ -123,21 +261,69 @@ func compileName(name string) (PipelineName, error) {
 	return pipelineName, nil
 }
 
-func compileStage(ctx Context, cfg *api.Stage) (*Stage, error) {
+// resolvedMethod is the result of resolving the method of a stage.
+type resolvedMethod struct {
+	desc method.Desc
+	err  error
+}
+
+// resolveMethods resolves the methods of all the stages concurrently, so
+// that the slowest stage bounds the time to resolve the pipeline. Stages
+// with invalid names are not resolved, as they fail to compile.
+func resolveMethods(ctx Context, stages []*api.Stage) []resolvedMethod {
+	methods := make([]resolvedMethod, len(stages))
+	var wg sync.WaitGroup
+	for i, cfg := range stages {
+		if _, err := compileStageName(cfg.Name); err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, cfg *api.Stage) {
+			defer wg.Done()
+			desc, err := ctx.resolver.Resolve(ctx.ctx, StageAddress(cfg))
+			methods[i] = resolvedMethod{desc: desc, err: err}
+		}(i, cfg)
+	}
+	wg.Wait()
+	return methods
+}
+
+func compileStage(cfg *api.Stage, resolved resolvedMethod) (*Stage, error) {
 	name, err := compileStageName(cfg.Name)
 	if err != nil {
 		return nil, err
 	}
-	address := compileStageAddr(cfg.Address, cfg.Service, cfg.Method)
-	method, err := ctx.resolver.Resolve(context.Background(), address)
+	onError, err := compileErrorPolicy(cfg.OnError)
+	if err != nil {
+		return nil, err
+	}
+	breaker, err := compileCircuitBreaker(cfg.CircuitBreaker)
+	if err != nil {
+		return nil, err
+	}
+	retryPolicy, err := RetryPolicy(cfg.Retry)
+	if err != nil {
+		return nil, err
+	}
+	md, err := compileMetadata(cfg.Metadata)
 	if err != nil {
-		return nil, fmt.Errorf("load method %q: %w", cfg.Address, err)
+		return nil, err
+	}
+	if resolved.err != nil {
+		return nil, fmt.Errorf("load method %q: %w", cfg.Address, resolved.err)
 	}
 	stage := &Stage{
 		name:    name,
 		sType:   StageTypeUnary,
-		address: address,
-		desc:    method,
+		address: StageAddress(cfg),
+		timeout: cfg.Timeout,
+		onError: onError,
+		breaker: breaker,
+		retry:   retryPolicy,
+		md:      md,
+		tls:     cfg.TLS,
+		auth:    cfg.Auth,
+		desc:    resolved.desc,
 		inputs:  []*Link{},
 		outputs: []*Link{},
 	}
@@ -155,17 +341,19 @@ func compileStageName(name string) (StageName, error) {
 	return stageName, nil
 }
 
-func compileStageAddr(address, service, method string) string {
-	a := address
+// StageAddress returns the address used to resolve the method of a stage,
+// in the format address/service/method, where unspecified services and
+// methods are replaced by *.
+func StageAddress(cfg *api.Stage) string {
 	s := "*"
 	m := "*"
-	if service != "" {
-		s = service
+	if cfg.Service != "" {
+		s = cfg.Service
 	}
-	if method != "" {
-		m = method
+	if cfg.Method != "" {
+		m = cfg.Method
 	}
-	return fmt.Sprintf("%s/%s/%s", a, s, m)
+	return fmt.Sprintf("%s/%s/%s", cfg.Address, s, m)
 }
 
 func compileLink(cfg *api.Link) (*Link, error) {
@@ -187,11 +375,18 @@ func compileLink(cfg *api.Link) (*Link, error) {
 	if target.Stage().IsEmpty() {
 		return nil, errEmptyTargetName
 	}
-	size := defaultLinkSize
+	size := DefaultLinkSize
 	if cfg.Size > 0 {
 		size = cfg.Size
 	}
+	match, err := compileMatchMode(cfg.Match)
+	if err != nil {
+		return nil, err
+	}
 	l := NewLink(name, source, target, size, cfg.NumEmptyMessages)
+	l.strict = cfg.Strict
+	l.match = match
+	l.sourceType = cfg.SourceType
 	return l, nil
 }
 
@@ -254,18 +449,108 @@ func validateLink(stages stageGraph, link *Link) error {
 
 	targetMsg := target.desc.Input()
 	if !link.Target().Field().IsUnspecified() {
+		// A oneof receives the messages in the member for the source type.
+		selector, ok := targetMsg.(message.OneofSelector)
+		if ok && selector.IsOneof(link.Target().Field()) {
+			member, err := selector.SelectOneof(link.Target().Field(), sourceMsg)
+			if err != nil {
+				return err
+			}
+			link.target.field = member
+		}
 		targetMsg, err = targetMsg.Subfield(link.Target().Field())
 		if err != nil {
 			return err
 		}
 	}
-	if !sourceMsg.Compatible(targetMsg) {
-		return &incompatibleMessageDesc{A: sourceMsg, B: targetMsg}
-	}
 
+	switch {
+	case link.sourceType != "":
+		err = unpackMessages(link, sourceMsg, targetMsg)
+	case isEnvelope(targetMsg) && !isEnvelope(sourceMsg):
+		err = packMessages(link, sourceMsg, targetMsg)
+	default:
+		err = compareMessages(link, sourceMsg, targetMsg)
+	}
+	if err != nil {
+		return err
+	}
 	return compatibleWithPreviousLinks(link, target)
 }
 
+// compareMessages verifies that the messages of the source can be sent to
+// the target, converting them if they are matched by name.
+func compareMessages(link *Link, sourceMsg, targetMsg message.Type) error {
+	var err error
+	// Types that compare their fields also report the unmatched fields,
+	// otherwise only their compatibility is known.
+	var compatible bool
+	if link.Match() == MatchByName {
+		matcher, ok := sourceMsg.(message.NameMatcher)
+		if !ok {
+			return &matchByNameNotSupported{link: link.Name().Unwrap(), msg: sourceMsg}
+		}
+		link.compatibility = matcher.CompareByName(targetMsg)
+		compatible = link.compatibility.Compatible()
+		if compatible {
+			link.convert, err = matcher.ConvertByName(targetMsg)
+			if err != nil {
+				return err
+			}
+		}
+	} else if comparer, ok := sourceMsg.(message.Comparer); ok {
+		link.compatibility = comparer.Compare(targetMsg)
+		compatible = link.compatibility.Compatible()
+	} else {
+		compatible = sourceMsg.Compatible(targetMsg)
+	}
+	if !compatible {
+		return &incompatibleMessageDesc{
+			A:          sourceMsg,
+			B:          targetMsg,
+			mismatches: link.compatibility.Mismatches,
+		}
+	}
+	if link.strict && !link.compatibility.Exact() {
+		return &unmatchedFields{
+			link:    link.Name().Unwrap(),
+			dropped: link.compatibility.Dropped,
+			unset:   link.compatibility.Unset,
+		}
+	}
+	return nil
+}
+
+// packMessages wraps the messages of the source in the envelope messages of
+// the target.
+func packMessages(link *Link, sourceMsg, targetMsg message.Type) error {
+	if link.Match() == MatchByName {
+		return &matchByNameNotSupported{link: link.Name().Unwrap(), msg: targetMsg}
+	}
+	var err error
+	link.convert, err = targetMsg.(message.Envelope).Pack(sourceMsg)
+	return err
+}
+
+// unpackMessages unwraps the messages of the declared source type from the
+// envelope messages of the source.
+func unpackMessages(link *Link, sourceMsg, targetMsg message.Type) error {
+	if !isEnvelope(sourceMsg) {
+		return &sourceNotEnvelope{link: link.Name().Unwrap(), msg: sourceMsg}
+	}
+	if link.Match() == MatchByName {
+		return &matchByNameNotSupported{link: link.Name().Unwrap(), msg: sourceMsg}
+	}
+	var err error
+	link.convert, err = sourceMsg.(message.Envelope).Unpack(link.sourceType, targetMsg)
+	return err
+}
+
+func isEnvelope(t message.Type) bool {
+	e, ok := t.(message.Envelope)
+	return ok && e.IsEnvelope()
+}
+
 func compatibleWithPreviousLinks(link *Link, target *Stage) error {
 	var err error
 	target.RangeInputs(func(prev *Link) bool {
@@ -321,9 +606,9 @@ func compileAuxInputIfNecessary(s *Stage) *Stage {
 		return compileSourceInput(s)
 	case 1:
 		l := s.inputs[0]
-		// We only have one link but we have to set a field and so
-		// we use a single link merge stage.
-		if !l.Target().Field().IsUnspecified() {
+		// We only have one link but we have to set a field or convert
+		// the message and so we use a single link merge stage.
+		if !l.Target().Field().IsUnspecified() || l.Converter() != nil {
 			return compileMergeInput(s)
 		}
 		return nil
@@ -338,7 +623,7 @@ func compileSourceInput(s *Stage) *Stage {
 		LinkName{fmt.Sprintf("%s:aux-source-link", s.name.val)},
 		&LinkEndpoint{stage: name},
 		&LinkEndpoint{stage: s.name},
-		defaultLinkSize,
+		DefaultLinkSize,
 		0,
 	)
 	source := &Stage{
@@ -360,7 +645,7 @@ func compileMergeInput(s *Stage) *Stage {
 		LinkName{fmt.Sprintf("%s:aux-merge-link", s.name.val)},
 		&LinkEndpoint{stage: name},
 		&LinkEndpoint{stage: s.name},
-		defaultLinkSize,
+		DefaultLinkSize,
 		0,
 	)
 	merge := &Stage{
@@ -386,8 +671,10 @@ func compileAuxOutputIfNecessary(s *Stage) *Stage {
 	case 0:
 		return compileSinkOutput(s)
 	case 1:
-		l := s.inputs[0]
-		if !l.Target().Field().IsUnspecified() {
+		// We only have one link but we have to get a field and so we
+		// use a single link split stage.
+		l := s.outputs[0]
+		if !l.Source().Field().IsUnspecified() {
 			return compileSplitOutput(s)
 		}
 		return nil
@@ -402,7 +689,7 @@ func compileSinkOutput(s *Stage) *Stage {
 		LinkName{fmt.Sprintf("%s:aux-sink-link", s.name.val)},
 		&LinkEndpoint{stage: s.name},
 		&LinkEndpoint{stage: name},
-		defaultLinkSize,
+		DefaultLinkSize,
 		0,
 	)
 	sink := &Stage{
@@ -424,7 +711,7 @@ func compileSplitOutput(s *Stage) *Stage {
 		LinkName{fmt.Sprintf("%s:aux-split-link", s.name.val)},
 		&LinkEndpoint{stage: s.name},
 		&LinkEndpoint{stage: name},
-		defaultLinkSize,
+		DefaultLinkSize,
 		0,
 	)
 	split := &Stage{
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/DuarteMRAlves/maestro/internal/api"
 	"github.com/DuarteMRAlves/maestro/internal/message"
@@ -46,7 +48,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "stage-1:aux-source-link"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-1:aux-source"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-1"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 					},
@@ -60,7 +62,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "stage-1:aux-source-link"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-1:aux-source"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-1"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 						outputs: []*Link{
@@ -68,7 +70,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "1-to-2"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-1"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-2"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 					},
@@ -82,7 +84,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "1-to-2"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-1"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-2"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 						outputs: []*Link{
@@ -112,7 +114,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "stage-3:aux-sink-link"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-3"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-3:aux-sink"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 					},
@@ -126,7 +128,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "stage-3:aux-sink-link"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-3"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-3:aux-sink"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 						outputs: []*Link{},
@@ -190,7 +192,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "stage-1:aux-source-link"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-1:aux-source"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-1"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 					},
@@ -204,7 +206,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "stage-1:aux-source-link"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-1:aux-source"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-1"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 						outputs: []*Link{
@@ -212,7 +214,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{"stage-1:aux-split-link"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-1"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-1:aux-split"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 					},
@@ -226,7 +228,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{"stage-1:aux-split-link"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-1"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-1:aux-split"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 						outputs: []*Link{
@@ -234,7 +236,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "1-to-2"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-1:aux-split"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-2"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 							{
 								name:   LinkName{val: "1-to-3"},
@@ -257,7 +259,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "1-to-2"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-1:aux-split"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-2"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 						outputs: []*Link{
@@ -302,7 +304,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "stage-3:aux-merge-link"},
 								source: &LinkEndpoint{stage: StageName{"stage-3:aux-merge"}},
 								target: &LinkEndpoint{stage: StageName{"stage-3"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 					},
@@ -316,7 +318,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "stage-3:aux-merge-link"},
 								source: &LinkEndpoint{stage: StageName{"stage-3:aux-merge"}},
 								target: &LinkEndpoint{stage: StageName{"stage-3"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 						outputs: []*Link{
@@ -324,7 +326,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "stage-3:aux-sink-link"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-3"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-3:aux-sink"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 					},
@@ -338,7 +340,7 @@ func TestNew(t *testing.T) {
 								name:   LinkName{val: "stage-3:aux-sink-link"},
 								source: &LinkEndpoint{stage: StageName{val: "stage-3"}},
 								target: &LinkEndpoint{stage: StageName{val: "stage-3:aux-sink"}},
-								size:   defaultLinkSize,
+								size:   DefaultLinkSize,
 							},
 						},
 						outputs: []*Link{},
@@ -398,8 +400,10 @@ func TestNewIsErr(t *testing.T) {
 				return ""
 			},
 			resolver: func(_ context.Context, address string) (method.Desc, error) {
-				t.Fatalf("No such method: %s", address)
-				return nil, nil
+				// Methods are resolved concurrently, so the test cannot
+				// be stopped here.
+				t.Errorf("No such method: %s", address)
+				return nil, fmt.Errorf("no such method: %s", address)
 			},
 		},
 		"empty stage name": {
@@ -415,8 +419,10 @@ func TestNewIsErr(t *testing.T) {
 				return ""
 			},
 			resolver: func(_ context.Context, address string) (method.Desc, error) {
-				t.Fatalf("No such method: %s", address)
-				return nil, nil
+				// Methods are resolved concurrently, so the test cannot
+				// be stopped here.
+				t.Errorf("No such method: %s", address)
+				return nil, fmt.Errorf("no such method: %s", address)
 			},
 		},
 		"empty link name": {
@@ -814,6 +820,56 @@ func TestNewIsErr(t *testing.T) {
 				return s, nil
 			},
 		},
+		"multiple errors": {
+			input: &api.Pipeline{
+				Name: "Pipeline",
+				Stages: []*api.Stage{
+					{Name: "stage-1", Address: "method-1"},
+					{Name: "stage-2", Address: "unknown"},
+					{Name: "stage-3", Address: "method-2"},
+				},
+				Links: []*api.Link{
+					{Name: "1-to-2", SourceStage: "stage-1", TargetStage: "stage-2"},
+					{Name: "1-to-4", SourceStage: "stage-1", TargetStage: "stage-4"},
+					{Name: "1-to-3", SourceStage: "stage-1", TargetStage: "stage-3"},
+				},
+			},
+			validateErr: func(err error) string {
+				var errs Errors
+				if !errors.As(err, &errs) {
+					format := "Wrong error type: expected Errors, got %s"
+					return fmt.Sprintf(format, reflect.TypeOf(err))
+				}
+				// The link with the stage that failed is not reported.
+				var actual []string
+				for _, e := range errs {
+					var stageErr *StageError
+					var linkErr *LinkError
+					switch {
+					case errors.As(e, &stageErr):
+						actual = append(actual, "stage "+stageErr.Name)
+					case errors.As(e, &linkErr):
+						actual = append(actual, "link "+linkErr.Name)
+					}
+				}
+				expected := []string{"stage stage-2", "link 1-to-4"}
+				if diff := cmp.Diff(expected, actual); diff != "" {
+					return fmt.Sprintf("errors mismatch:\n%s", diff)
+				}
+				return ""
+			},
+			resolver: func(_ context.Context, address string) (method.Desc, error) {
+				mapper := map[string]method.Desc{
+					"method-1/*/*": testLinearStage1Method{},
+					"method-2/*/*": testLinearStage2Method{},
+				}
+				s, ok := mapper[address]
+				if !ok {
+					return nil, fmt.Errorf("no such method: %v", address)
+				}
+				return s, nil
+			},
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -832,6 +888,376 @@ func TestNewIsErr(t *testing.T) {
 	}
 }
 
+func TestNew_ResolvesConcurrently(t *testing.T) {
+	cfg := &api.Pipeline{
+		Name: "pipeline",
+		Stages: []*api.Stage{
+			{Name: "stage-1", Address: "method-1"},
+			{Name: "stage-2", Address: "method-2"},
+			{Name: "stage-3", Address: "method-3"},
+		},
+		Links: []*api.Link{
+			{Name: "1-to-2", SourceStage: "stage-1", TargetStage: "stage-2"},
+			{Name: "2-to-3", SourceStage: "stage-2", TargetStage: "stage-3"},
+		},
+	}
+	// Each resolution only finishes once all of them started, which would
+	// never happen if the stages were resolved sequentially.
+	var started sync.WaitGroup
+	started.Add(len(cfg.Stages))
+	allStarted := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(allStarted)
+	}()
+	resolver := func(ctx context.Context, address string) (method.Desc, error) {
+		started.Done()
+		select {
+		case <-allStarted:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		switch address {
+		case "method-1/*/*":
+			return testLinearStage1Method{}, nil
+		case "method-2/*/*":
+			return testLinearStage2Method{}, nil
+		case "method-3/*/*":
+			return testLinearStage3Method{}, nil
+		default:
+			return nil, fmt.Errorf("no such method: %v", address)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	compilationCtx := NewContext(method.ResolveFunc(resolver)).WithContext(ctx)
+	if _, err := New(compilationCtx, cfg); err != nil {
+		t.Fatalf("new error: %s", err)
+	}
+}
+
+func TestNew_Strict(t *testing.T) {
+	unmatched := message.Compatibility{
+		Dropped: []message.FieldRef{{Path: "inner.extra", Number: 3}},
+		Unset:   []message.FieldRef{{Path: "missing", Number: 4}},
+	}
+	tests := map[string]struct {
+		strict      bool
+		report      message.Compatibility
+		expectedErr error
+	}{
+		"exact": {
+			strict: true,
+			report: message.Compatibility{},
+		},
+		"unmatched fields": {
+			strict: false,
+			report: unmatched,
+		},
+		"strict unmatched fields": {
+			strict: true,
+			report: unmatched,
+			expectedErr: &unmatchedFields{
+				link:    "1-to-2",
+				dropped: unmatched.Dropped,
+				unset:   unmatched.Unset,
+			},
+		},
+		"mismatched fields": {
+			report: message.Compatibility{
+				Mismatches: []message.FieldMismatch{{
+					FieldRef: message.FieldRef{Path: "val", Number: 1},
+					Source:   "string",
+					Target:   "repeated int64",
+				}},
+			},
+			expectedErr: &incompatibleMessageDesc{
+				mismatches: []message.FieldMismatch{{
+					FieldRef: message.FieldRef{Path: "val", Number: 1},
+					Source:   "string",
+					Target:   "repeated int64",
+				}},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := &api.Pipeline{
+				Name: "pipeline",
+				Stages: []*api.Stage{
+					{Name: "stage-1", Address: "method-1"},
+					{Name: "stage-2", Address: "method-2"},
+				},
+				Links: []*api.Link{{
+					Name:        "1-to-2",
+					SourceStage: "stage-1",
+					TargetStage: "stage-2",
+					Strict:      tc.strict,
+				}},
+			}
+			desc := testComparerMethod{typ: testComparerDesc{report: tc.report}}
+			resolver := func(_ context.Context, _ string) (method.Desc, error) {
+				return desc, nil
+			}
+
+			p, err := New(NewContext(method.ResolveFunc(resolver)), cfg)
+			if tc.expectedErr != nil {
+				cmpOpts := cmp.Options{
+					cmp.AllowUnexported(unmatchedFields{}, incompatibleMessageDesc{}),
+					cmp.Comparer(func(_, _ message.Type) bool { return true }),
+				}
+				// The expected error has the same type as the cause of the
+				// link error.
+				actual := reflect.New(reflect.TypeOf(tc.expectedErr))
+				if !errors.As(err, actual.Interface()) {
+					t.Fatalf("expected %T, got %v", tc.expectedErr, err)
+				}
+				if diff := cmp.Diff(tc.expectedErr, actual.Elem().Interface(), cmpOpts); diff != "" {
+					t.Fatalf("error mismatch:\n%s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("new error: %s", err)
+			}
+			var report message.Compatibility
+			_ = p.VisitLinks(func(l *Link) error {
+				if l.Name().Unwrap() == "1-to-2" {
+					report = l.Compatibility()
+				}
+				return nil
+			})
+			if diff := cmp.Diff(tc.report, report); diff != "" {
+				t.Fatalf("compatibility mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNew_Match(t *testing.T) {
+	tests := map[string]struct {
+		match string
+		typ   message.Type
+		// expectedErr is the expected error type, or nil if the pipeline
+		// compiles.
+		expectedErr error
+	}{
+		"by number": {match: "by_number", typ: testComparerDesc{}},
+		"by name":   {match: "by_name", typ: testNameMatcherDesc{}},
+		"by name not supported": {
+			match:       "by_name",
+			typ:         testComparerDesc{},
+			expectedErr: &matchByNameNotSupported{},
+		},
+		"unknown mode": {
+			match:       "by_type",
+			typ:         testNameMatcherDesc{},
+			expectedErr: &unknownMatchMode{},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := &api.Pipeline{
+				Name: "pipeline",
+				Stages: []*api.Stage{
+					{Name: "stage-1", Address: "method-1"},
+					{Name: "stage-2", Address: "method-2"},
+				},
+				Links: []*api.Link{{
+					Name:        "1-to-2",
+					SourceStage: "stage-1",
+					TargetStage: "stage-2",
+					Match:       tc.match,
+				}},
+			}
+			resolver := func(_ context.Context, _ string) (method.Desc, error) {
+				return testComparerMethod{typ: tc.typ}, nil
+			}
+
+			p, err := New(NewContext(method.ResolveFunc(resolver)), cfg)
+			if tc.expectedErr != nil {
+				actual := reflect.New(reflect.TypeOf(tc.expectedErr))
+				if !errors.As(err, actual.Interface()) {
+					t.Fatalf("expected %T, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("new error: %s", err)
+			}
+			// Converted messages are received by a merge stage.
+			_, hasMerge := p.Stage(StageName{val: "stage-2:aux-merge"})
+			if diff := cmp.Diff(tc.match == "by_name", hasMerge); diff != "" {
+				t.Fatalf("merge stage mismatch:\n%s", diff)
+			}
+			var link *Link
+			_ = p.VisitLinks(func(l *Link) error {
+				if l.Name().Unwrap() == "1-to-2" {
+					link = l
+				}
+				return nil
+			})
+			if diff := cmp.Diff(MatchMode(tc.match), link.Match()); diff != "" {
+				t.Fatalf("match mismatch:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.match == "by_name", link.Converter() != nil); diff != "" {
+				t.Fatalf("converter mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestNew_SourceField checks that the field of the single output link of a
+// stage is extracted by a split stage.
+func TestNew_SourceField(t *testing.T) {
+	cfg := &api.Pipeline{
+		Name: "pipeline",
+		Stages: []*api.Stage{
+			{Name: "stage-1", Address: "method-1"},
+			{Name: "stage-3", Address: "method-3"},
+		},
+		Links: []*api.Link{
+			{
+				Name:        "1-to-3",
+				SourceStage: "stage-1",
+				SourceField: "field1",
+				TargetStage: "stage-3",
+				TargetField: "field1",
+			},
+		},
+	}
+	resolver := func(_ context.Context, address string) (method.Desc, error) {
+		mapper := map[string]method.Desc{
+			"method-1/*/*": testLinearStage1Method{},
+			"method-3/*/*": testLinearStage3Method{},
+		}
+		return mapper[address], nil
+	}
+	p, err := New(NewContext(method.ResolveFunc(resolver)), cfg)
+	if err != nil {
+		t.Fatalf("new error: %s", err)
+	}
+	split, ok := p.Stage(StageName{val: "stage-1:aux-split"})
+	if !ok {
+		t.Fatalf("expected split stage for the source field")
+	}
+	if diff := cmp.Diff(StageTypeSplit, split.Type()); diff != "" {
+		t.Fatalf("split stage type mismatch:\n%s", diff)
+	}
+	outputs := split.CopyOutputs()
+	if diff := cmp.Diff(1, len(outputs)); diff != "" {
+		t.Fatalf("split outputs mismatch:\n%s", diff)
+	}
+	if diff := cmp.Diff(message.Field("field1"), outputs[0].Source().Field()); diff != "" {
+		t.Fatalf("split source field mismatch:\n%s", diff)
+	}
+}
+
+func TestNew_Envelope(t *testing.T) {
+	tests := map[string]struct {
+		link   *api.Link
+		output message.Type
+		input  message.Type
+		// expectedErr is the expected error type, or nil if the pipeline
+		// compiles.
+		expectedErr   error
+		expectedField message.Field
+		converted     bool
+		split         bool
+	}{
+		"oneof member": {
+			link:          &api.Link{TargetField: "event"},
+			output:        testComparerDesc{},
+			input:         testOneofDesc{},
+			expectedField: "created",
+		},
+		"pack": {
+			link:          &api.Link{TargetField: "payload"},
+			output:        testComparerDesc{},
+			input:         testOneofDesc{},
+			expectedField: "payload",
+			converted:     true,
+		},
+		"unpack": {
+			link:      &api.Link{SourceType: "events.Created"},
+			output:    testEnvelopeDesc{},
+			input:     testComparerDesc{},
+			converted: true,
+		},
+		"unpack field": {
+			link:      &api.Link{SourceField: "payload", SourceType: "events.Created"},
+			output:    testOneofDesc{},
+			input:     testComparerDesc{},
+			converted: true,
+			split:     true,
+		},
+		"unpack not envelope": {
+			link:        &api.Link{SourceType: "events.Created"},
+			output:      testComparerDesc{},
+			input:       testComparerDesc{},
+			expectedErr: &sourceNotEnvelope{},
+		},
+		"pack by name": {
+			link:        &api.Link{TargetField: "payload", Match: "by_name"},
+			output:      testNameMatcherDesc{},
+			input:       testOneofDesc{},
+			expectedErr: &matchByNameNotSupported{},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			link := *tc.link
+			link.Name = "1-to-2"
+			link.SourceStage = "stage-1"
+			link.TargetStage = "stage-2"
+			cfg := &api.Pipeline{
+				Name: "pipeline",
+				Stages: []*api.Stage{
+					{Name: "stage-1", Address: "method-1"},
+					{Name: "stage-2", Address: "method-2"},
+				},
+				Links: []*api.Link{&link},
+			}
+			resolver := func(_ context.Context, address string) (method.Desc, error) {
+				if address == "method-1/*/*" {
+					return testTypesMethod{input: testComparerDesc{}, output: tc.output}, nil
+				}
+				return testTypesMethod{input: tc.input, output: testComparerDesc{}}, nil
+			}
+
+			p, err := New(NewContext(method.ResolveFunc(resolver)), cfg)
+			if tc.expectedErr != nil {
+				actual := reflect.New(reflect.TypeOf(tc.expectedErr))
+				if !errors.As(err, actual.Interface()) {
+					t.Fatalf("expected %T, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("new error: %s", err)
+			}
+			var compiled *Link
+			_ = p.VisitLinks(func(l *Link) error {
+				if l.Name().Unwrap() == "1-to-2" {
+					compiled = l
+				}
+				return nil
+			})
+			if diff := cmp.Diff(tc.expectedField, compiled.Target().Field()); diff != "" {
+				t.Fatalf("target field mismatch:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.converted, compiled.Converter() != nil); diff != "" {
+				t.Fatalf("converter mismatch:\n%s", diff)
+			}
+			_, hasSplit := p.Stage(StageName{val: "stage-1:aux-split"})
+			if diff := cmp.Diff(tc.split, hasSplit); diff != "" {
+				t.Fatalf("split stage mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
 type testLinearStage1Method struct{}
 
 func (m testLinearStage1Method) Dial() (method.Conn, error) {
@@ -969,3 +1395,85 @@ func (d testInnerValDesc) Build() message.Instance { panic("called build method"
 func (d testInnerValDesc) String() string {
 	return "testInnerValDesc"
 }
+
+type testComparerMethod struct{ typ message.Type }
+
+func (m testComparerMethod) Dial() (method.Conn, error) { return nil, nil }
+
+func (m testComparerMethod) Input() message.Type { return m.typ }
+
+func (m testComparerMethod) Output() message.Type { return m.typ }
+
+// testComparerDesc is a descriptor that reports the given differences when
+// compared with any other descriptor.
+type testComparerDesc struct{ report message.Compatibility }
+
+func (d testComparerDesc) Compatible(other message.Type) bool {
+	return d.report.Compatible()
+}
+
+func (d testComparerDesc) Compare(other message.Type) message.Compatibility {
+	return d.report
+}
+
+func (d testComparerDesc) Subfield(f message.Field) (message.Type, error) {
+	panic("method get field should not be called for testComparerDesc")
+}
+
+func (d testComparerDesc) Build() message.Instance { panic("called build method") }
+
+// testNameMatcherDesc is a descriptor that can also be matched by name.
+type testNameMatcherDesc struct{ testComparerDesc }
+
+func (d testNameMatcherDesc) CompareByName(other message.Type) message.Compatibility {
+	return d.report
+}
+
+func (d testNameMatcherDesc) ConvertByName(other message.Type) (message.Converter, error) {
+	convert := func(msg message.Instance) (message.Instance, error) { return msg, nil }
+	return convert, nil
+}
+
+type testTypesMethod struct{ input, output message.Type }
+
+func (m testTypesMethod) Dial() (method.Conn, error) { return nil, nil }
+
+func (m testTypesMethod) Input() message.Type { return m.input }
+
+func (m testTypesMethod) Output() message.Type { return m.output }
+
+// testEnvelopeDesc is a descriptor of messages that wrap other messages.
+type testEnvelopeDesc struct{ testComparerDesc }
+
+func (d testEnvelopeDesc) IsEnvelope() bool { return true }
+
+func (d testEnvelopeDesc) Pack(t message.Type) (message.Converter, error) {
+	convert := func(msg message.Instance) (message.Instance, error) { return msg, nil }
+	return convert, nil
+}
+
+func (d testEnvelopeDesc) Unpack(name string, t message.Type) (message.Converter, error) {
+	convert := func(msg message.Instance) (message.Instance, error) { return msg, nil }
+	return convert, nil
+}
+
+// testOneofDesc is a descriptor of a message with an event oneof, where the
+// created member receives all messages, and an envelope payload field.
+type testOneofDesc struct{ testComparerDesc }
+
+func (d testOneofDesc) IsOneof(f message.Field) bool { return f == "event" }
+
+func (d testOneofDesc) SelectOneof(oneof message.Field, t message.Type) (message.Field, error) {
+	return "created", nil
+}
+
+func (d testOneofDesc) Subfield(f message.Field) (message.Type, error) {
+	switch f {
+	case "created":
+		return testComparerDesc{}, nil
+	case "payload":
+		return testEnvelopeDesc{}, nil
+	default:
+		panic(fmt.Sprintf("Unknown field for testOneofDesc: %s", string(f)))
+	}
+}
@@ -0,0 +1,143 @@
+package compiled
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Changes lists the differences between two pipelines.
+type Changes struct {
+	AddedStages   []StageName
+	RemovedStages []StageName
+	// ChangedStages are the stages that exist in both pipelines but with
+	// different configurations or links.
+	ChangedStages []StageName
+
+	AddedLinks   []LinkName
+	RemovedLinks []LinkName
+	// ChangedLinks are the links that exist in both pipelines but with
+	// different configurations.
+	ChangedLinks []LinkName
+}
+
+// IsEmpty reports whether the pipelines are equivalent.
+func (c Changes) IsEmpty() bool {
+	return len(c.AddedStages) == 0 &&
+		len(c.RemovedStages) == 0 &&
+		len(c.ChangedStages) == 0 &&
+		len(c.AddedLinks) == 0 &&
+		len(c.RemovedLinks) == 0 &&
+		len(c.ChangedLinks) == 0
+}
+
+// Diff computes the changes from the old to the new pipeline. Stages and
+// links are matched by name. Stages are changed if their type, method,
+// timeout, error policy, circuit breaker, retry policy, metadata, tls,
+// authentication or links are different. Links are changed if their endpoints, size, number of empty
+// messages, match mode or source type are different.
+func Diff(old, new *Pipeline) Changes {
+	var c Changes
+	for name, s := range new.stages {
+		prev, ok := old.stages[name]
+		switch {
+		case !ok:
+			c.AddedStages = append(c.AddedStages, name)
+		case !equalStages(prev, s):
+			c.ChangedStages = append(c.ChangedStages, name)
+		}
+	}
+	for name := range old.stages {
+		if _, ok := new.stages[name]; !ok {
+			c.RemovedStages = append(c.RemovedStages, name)
+		}
+	}
+
+	oldLinks, newLinks := pipelineLinks(old), pipelineLinks(new)
+	for name, l := range newLinks {
+		prev, ok := oldLinks[name]
+		switch {
+		case !ok:
+			c.AddedLinks = append(c.AddedLinks, name)
+		case !equalLinks(prev, l):
+			c.ChangedLinks = append(c.ChangedLinks, name)
+		}
+	}
+	for name := range oldLinks {
+		if _, ok := newLinks[name]; !ok {
+			c.RemovedLinks = append(c.RemovedLinks, name)
+		}
+	}
+
+	sortStageNames(c.AddedStages)
+	sortStageNames(c.RemovedStages)
+	sortStageNames(c.ChangedStages)
+	sortLinkNames(c.AddedLinks)
+	sortLinkNames(c.RemovedLinks)
+	sortLinkNames(c.ChangedLinks)
+	return c
+}
+
+func pipelineLinks(p *Pipeline) map[LinkName]*Link {
+	links := make(map[LinkName]*Link)
+	_ = p.VisitLinks(func(l *Link) error {
+		links[l.name] = l
+		return nil
+	})
+	return links
+}
+
+func equalStages(a, b *Stage) bool {
+	return a.sType == b.sType &&
+		a.address == b.address &&
+		a.Timeout() == b.Timeout() &&
+		a.OnError() == b.OnError() &&
+		equalCircuitBreakers(a.breaker, b.breaker) &&
+		reflect.DeepEqual(a.retry, b.retry) &&
+		reflect.DeepEqual(a.md, b.md) &&
+		reflect.DeepEqual(a.propagate, b.propagate) &&
+		reflect.DeepEqual(a.tls, b.tls) &&
+		reflect.DeepEqual(a.auth, b.auth) &&
+		equalLinkNames(a.inputs, b.inputs) &&
+		equalLinkNames(a.outputs, b.outputs)
+}
+
+func equalCircuitBreakers(a, b *CircuitBreaker) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalLinkNames(a, b []*Link) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].name != b[i].name {
+			return false
+		}
+	}
+	return true
+}
+
+// LinkEndpointsEqual reports whether two links connect the same stages and
+// fields, and so transport the same messages.
+func LinkEndpointsEqual(a, b *Link) bool {
+	return *a.source == *b.source && *a.target == *b.target
+}
+
+func equalLinks(a, b *Link) bool {
+	return LinkEndpointsEqual(a, b) &&
+		a.size == b.size &&
+		a.numEmptyMessages == b.numEmptyMessages &&
+		a.Match() == b.Match() &&
+		a.sourceType == b.sourceType
+}
+
+func sortStageNames(names []StageName) {
+	sort.Slice(names, func(i, j int) bool { return names[i].val < names[j].val })
+}
+
+func sortLinkNames(names []LinkName) {
+	sort.Slice(names, func(i, j int) bool { return names[i].val < names[j].val })
+}
@@ -0,0 +1,140 @@
+package compiled
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiff(t *testing.T) {
+	base := &api.Pipeline{
+		Name: "pipeline",
+		Stages: []*api.Stage{
+			{Name: "stage-1", Address: "method-1"},
+			{Name: "stage-2", Address: "method-2"},
+			{Name: "stage-3", Address: "method-3"},
+		},
+		Links: []*api.Link{
+			{Name: "1-to-2", SourceStage: "stage-1", TargetStage: "stage-2"},
+			{Name: "2-to-3", SourceStage: "stage-2", TargetStage: "stage-3"},
+		},
+	}
+	tests := map[string]struct {
+		update   func(p *api.Pipeline)
+		expected Changes
+	}{
+		"no changes": {
+			update:   func(p *api.Pipeline) {},
+			expected: Changes{},
+		},
+		"stage timeout": {
+			update: func(p *api.Pipeline) { p.Stages[1].Timeout = time.Second },
+			expected: Changes{
+				ChangedStages: []StageName{{val: "stage-2"}},
+			},
+		},
+		"stage tls": {
+			update: func(p *api.Pipeline) {
+				p.Stages[0].TLS = &api.TLS{ServerName: "server-1"}
+			},
+			expected: Changes{
+				ChangedStages: []StageName{{val: "stage-1"}},
+			},
+		},
+		"stage auth": {
+			update: func(p *api.Pipeline) {
+				p.Stages[2].Auth = &api.Auth{JWT: &api.JWT{KeyFile: "key.pem"}}
+			},
+			expected: Changes{
+				ChangedStages: []StageName{{val: "stage-3"}},
+			},
+		},
+		"link size": {
+			update: func(p *api.Pipeline) { p.Links[1].Size = 20 },
+			expected: Changes{
+				ChangedLinks: []LinkName{{val: "2-to-3"}},
+			},
+		},
+		"rename link": {
+			update: func(p *api.Pipeline) { p.Links[0].Name = "link-1" },
+			expected: Changes{
+				ChangedStages: []StageName{{val: "stage-1"}, {val: "stage-2"}},
+				AddedLinks:    []LinkName{{val: "link-1"}},
+				RemovedLinks:  []LinkName{{val: "1-to-2"}},
+			},
+		},
+		"remove stage": {
+			update: func(p *api.Pipeline) {
+				p.Stages = p.Stages[:2]
+				p.Links = p.Links[:1]
+			},
+			expected: Changes{
+				AddedStages: []StageName{{val: "stage-2:aux-sink"}},
+				RemovedStages: []StageName{
+					{val: "stage-3"}, {val: "stage-3:aux-sink"},
+				},
+				ChangedStages: []StageName{{val: "stage-2"}},
+				AddedLinks:    []LinkName{{val: "stage-2:aux-sink-link"}},
+				RemovedLinks: []LinkName{
+					{val: "2-to-3"}, {val: "stage-3:aux-sink-link"},
+				},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := NewContext(testDiffResolver())
+			old, err := New(ctx, copyPipelineCfg(base))
+			if err != nil {
+				t.Fatalf("compile old: %s", err)
+			}
+			cfg := copyPipelineCfg(base)
+			tc.update(cfg)
+			updated, err := New(ctx, cfg)
+			if err != nil {
+				t.Fatalf("compile new: %s", err)
+			}
+			actual := Diff(old, updated)
+			cmpOpts := cmp.AllowUnexported(StageName{}, LinkName{})
+			if diff := cmp.Diff(tc.expected, actual, cmpOpts); diff != "" {
+				t.Fatalf("changes mismatch:\n%s", diff)
+			}
+			if tc.expected.IsEmpty() != actual.IsEmpty() {
+				t.Fatalf("is empty mismatch")
+			}
+		})
+	}
+}
+
+func testDiffResolver() method.ResolveFunc {
+	return func(_ context.Context, address string) (method.Desc, error) {
+		mapper := map[string]method.Desc{
+			"method-1/*/*": testLinearStage1Method{},
+			"method-2/*/*": testLinearStage2Method{},
+			"method-3/*/*": testLinearStage3Method{},
+		}
+		s, ok := mapper[address]
+		if !ok {
+			panic(fmt.Sprintf("No such method: %v", address))
+		}
+		return s, nil
+	}
+}
+
+func copyPipelineCfg(p *api.Pipeline) *api.Pipeline {
+	cp := &api.Pipeline{Name: p.Name}
+	for _, s := range p.Stages {
+		s := *s
+		cp.Stages = append(cp.Stages, &s)
+	}
+	for _, l := range p.Links {
+		l := *l
+		cp.Links = append(cp.Links, &l)
+	}
+	return cp
+}
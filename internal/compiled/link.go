@@ -6,7 +6,8 @@ import (
 	"github.com/DuarteMRAlves/maestro/internal/message"
 )
 
-const defaultLinkSize uint = 10
+// DefaultLinkSize is the size of the links that do not specify one.
+const DefaultLinkSize uint = 10
 
 type Link struct {
 	name             LinkName
@@ -14,6 +15,17 @@ type Link struct {
 	target           *LinkEndpoint
 	numEmptyMessages uint
 	size             uint
+	strict           bool
+	match            MatchMode
+	// sourceType is the declared type of the messages wrapped in the source
+	// messages, which are unwrapped before they are sent.
+	sourceType string
+	// convert transforms the messages of the source into messages of the
+	// target when the fields are matched by name.
+	convert message.Converter
+	// compatibility is the report of the fields transferred from the source
+	// to the target message, computed when the link is validated.
+	compatibility message.Compatibility
 }
 
 func (l *Link) Name() LinkName {
@@ -39,7 +51,7 @@ func (l *Link) Target() *LinkEndpoint {
 
 func (l *Link) Size() uint {
 	if l == nil {
-		return defaultLinkSize
+		return DefaultLinkSize
 	}
 	return l.size
 }
@@ -51,13 +63,57 @@ func (l *Link) NumEmptyMessages() uint {
 	return l.numEmptyMessages
 }
 
+// Strict reports whether the link rejects unmatched fields.
+func (l *Link) Strict() bool {
+	if l == nil {
+		return false
+	}
+	return l.strict
+}
+
+// Compatibility returns the differences between the fields of the source
+// and target messages. It is empty if the messages do not report their
+// fields.
+func (l *Link) Compatibility() message.Compatibility {
+	if l == nil {
+		return message.Compatibility{}
+	}
+	return l.compatibility
+}
+
+// Match returns how the fields of the source and target messages are
+// matched.
+func (l *Link) Match() MatchMode {
+	if l == nil || l.match == "" {
+		return MatchByNumber
+	}
+	return l.match
+}
+
+// SourceType returns the declared type of the messages wrapped in the
+// source messages, or "" if they are not unwrapped.
+func (l *Link) SourceType() string {
+	if l == nil {
+		return ""
+	}
+	return l.sourceType
+}
+
+// Converter returns the function that transforms the messages sent through
+// this link, or nil if they are sent unchanged.
+func (l *Link) Converter() message.Converter {
+	if l == nil {
+		return nil
+	}
+	return l.convert
+}
+
 func NewLink(
 	name LinkName,
 	source, target *LinkEndpoint,
 	size uint,
 	numEmptyMessages uint,
 ) *Link {
-	fmt.Println("Creating link with size", size)
 	return &Link{
 		name:             name,
 		source:           source,
@@ -90,6 +146,35 @@ func (err *invalidLinkName) Error() string {
 	return fmt.Sprintf("invalid link name: '%s'", err.name)
 }
 
+// MatchMode specifies how the fields of the source message of a link are
+// matched with the fields of the target message.
+type MatchMode string
+
+const (
+	// MatchByNumber matches fields with the same number, and the messages
+	// are sent unchanged.
+	MatchByNumber MatchMode = "by_number"
+	// MatchByName matches fields with the same name, and the messages are
+	// converted to the target type.
+	MatchByName MatchMode = "by_name"
+)
+
+func compileMatchMode(mode string) (MatchMode, error) {
+	// The empty mode is kept, as links without a mode match by number.
+	switch MatchMode(mode) {
+	case "", MatchByNumber, MatchByName:
+		return MatchMode(mode), nil
+	default:
+		return "", &unknownMatchMode{mode: mode}
+	}
+}
+
+type unknownMatchMode struct{ mode string }
+
+func (err *unknownMatchMode) Error() string {
+	return fmt.Sprintf("unknown match mode: '%s'", err.mode)
+}
+
 type LinkEndpoint struct {
 	stage StageName
 	field message.Field
@@ -0,0 +1,104 @@
+package compiled
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+)
+
+// compileMetadata reads the values of the headers of a stage, from the
+// configuration, the environment or a file. It returns nil if there are no
+// headers.
+func compileMetadata(headers []*api.Header) (method.Metadata, error) {
+	var md method.Metadata
+	for _, h := range headers {
+		name, err := compileHeaderName(h.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := headerValue(h)
+		if err != nil {
+			return nil, &invalidHeader{name: h.Name, reason: err.Error()}
+		}
+		if md == nil {
+			md = make(method.Metadata, len(headers))
+		}
+		md[name] = append(md[name], value)
+	}
+	return md, nil
+}
+
+func headerValue(h *api.Header) (string, error) {
+	sources := 0
+	for _, s := range []string{h.Value, h.Env, h.File} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return "", fmt.Errorf("expected one of value, env or file, got %d", sources)
+	}
+	switch {
+	case h.Env != "":
+		v, ok := os.LookupEnv(h.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s not set", h.Env)
+		}
+		return v, nil
+	case h.File != "":
+		data, err := os.ReadFile(h.File)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	default:
+		return h.Value, nil
+	}
+}
+
+// compilePropagateMetadata validates the names of the metadata propagated
+// between the stages. It returns nil if there are no names.
+func compilePropagateMetadata(names []string) ([]string, error) {
+	var compiled []string
+	for _, n := range names {
+		name, err := compileHeaderName(n)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, name)
+	}
+	return compiled, nil
+}
+
+// compileHeaderName converts the name of a header to lowercase, as required
+// by grpc, and verifies it is not reserved. Binary headers are rejected, as
+// their values are not text.
+func compileHeaderName(name string) (string, error) {
+	lower := strings.ToLower(name)
+	if lower == "" {
+		return "", &invalidHeader{name: name, reason: "empty name"}
+	}
+	for _, c := range lower {
+		valid := (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.'
+		if !valid {
+			return "", &invalidHeader{name: name, reason: fmt.Sprintf("invalid character %q", c)}
+		}
+	}
+	if strings.HasPrefix(lower, "grpc-") {
+		return "", &invalidHeader{name: name, reason: "reserved name"}
+	}
+	if strings.HasSuffix(lower, "-bin") {
+		return "", &invalidHeader{name: name, reason: "binary headers are not supported"}
+	}
+	return lower, nil
+}
+
+type invalidHeader struct{ name, reason string }
+
+func (err *invalidHeader) Error() string {
+	return fmt.Sprintf("invalid header '%s': %s", err.name, err.reason)
+}
@@ -0,0 +1,92 @@
+package compiled
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompileMetadata(t *testing.T) {
+	t.Setenv("MAESTRO_TEST_API_KEY", "env-key")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("Bearer file-token\n"), 0o600); err != nil {
+		t.Fatalf("write token: %s", err)
+	}
+	tests := map[string]struct {
+		input    []*api.Header
+		expected method.Metadata
+		isErr    bool
+	}{
+		"nil": {},
+		"all sources": {
+			input: []*api.Header{
+				{Name: "X-Tenant-Id", Value: "acme"},
+				{Name: "x-api-key", Env: "MAESTRO_TEST_API_KEY"},
+				{Name: "authorization", File: tokenFile},
+			},
+			expected: method.Metadata{
+				"x-tenant-id":   {"acme"},
+				"x-api-key":     {"env-key"},
+				"authorization": {"Bearer file-token"},
+			},
+		},
+		"repeated name": {
+			input: []*api.Header{
+				{Name: "x-tag", Value: "a"},
+				{Name: "x-tag", Value: "b"},
+			},
+			expected: method.Metadata{"x-tag": {"a", "b"}},
+		},
+		"reserved name": {
+			input: []*api.Header{{Name: "grpc-timeout", Value: "1s"}},
+			isErr: true,
+		},
+		"binary name": {
+			input: []*api.Header{{Name: "x-trace-Bin", Value: "AAEC"}},
+			isErr: true,
+		},
+		"invalid name": {
+			input: []*api.Header{{Name: "x tenant", Value: "acme"}},
+			isErr: true,
+		},
+		"several sources": {
+			input: []*api.Header{{Name: "x-api-key", Value: "key", Env: "MAESTRO_TEST_API_KEY"}},
+			isErr: true,
+		},
+		"no source": {
+			input: []*api.Header{{Name: "x-api-key"}},
+			isErr: true,
+		},
+		"unset env": {
+			input: []*api.Header{{Name: "x-api-key", Env: "MAESTRO_TEST_UNSET"}},
+			isErr: true,
+		},
+		"missing file": {
+			input: []*api.Header{{Name: "authorization", File: tokenFile + ".missing"}},
+			isErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			md, err := compileMetadata(tc.input)
+			if tc.isErr {
+				var headerErr *invalidHeader
+				if !errors.As(err, &headerErr) {
+					t.Fatalf("expected *invalidHeader, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compile: %s", err)
+			}
+			if diff := cmp.Diff(tc.expected, md); diff != "" {
+				t.Fatalf("metadata mismatch:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package compiled
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+)
+
+const (
+	// DefaultRetryAttempts is the maximum number of calls for each message
+	// of the stages with a retry policy that do not specify it.
+	DefaultRetryAttempts = 3
+	// DefaultRetryInitialBackoff is the time before the first retry of the
+	// stages with a retry policy that do not specify it.
+	DefaultRetryInitialBackoff = 100 * time.Millisecond
+	// DefaultRetryMaxBackoff is the maximum time between retries of the
+	// stages with a retry policy that do not specify it.
+	DefaultRetryMaxBackoff = 10 * time.Second
+	// DefaultRetryCode is the name of the grpc status code retried by the
+	// stages with a retry policy that do not specify the codes.
+	DefaultRetryCode = "UNAVAILABLE"
+)
+
+// RetryPolicy compiles the retry configuration of a stage, setting the
+// defaults for the fields that are not specified. It returns nil if cfg is
+// nil.
+func RetryPolicy(cfg *api.Retry) (*retry.Policy, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	initial, max := cfg.InitialBackoff, cfg.MaxBackoff
+	if initial == 0 {
+		initial = DefaultRetryInitialBackoff
+	}
+	if max == 0 {
+		max = DefaultRetryMaxBackoff
+	}
+	if initial < 0 || max < initial {
+		return nil, &invalidRetry{
+			reason: fmt.Sprintf("backoff between %s and %s", initial, max),
+		}
+	}
+	p := &retry.Policy{
+		MaxAttempts: int(cfg.MaxAttempts),
+		Backoff:     retry.NewExponentialBackoff(initial, 2).WithMax(max),
+		Jitter:      retry.Jitter(cfg.Jitter),
+	}
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultRetryAttempts
+	}
+	switch p.Jitter {
+	case "":
+		p.Jitter = retry.JitterFull
+	case retry.JitterNone, retry.JitterFull, retry.JitterDecorrelated:
+	default:
+		return nil, &invalidRetry{reason: fmt.Sprintf("unknown jitter '%s'", p.Jitter)}
+	}
+	names := cfg.Codes
+	if len(names) == 0 {
+		names = []string{DefaultRetryCode}
+	}
+	for _, name := range names {
+		c, err := retry.ParseCode(name)
+		if err != nil {
+			return nil, &invalidRetry{reason: fmt.Sprintf("unknown code '%s'", name)}
+		}
+		p.Codes = append(p.Codes, c)
+	}
+	return p, nil
+}
+
+type invalidRetry struct{ reason string }
+
+func (err *invalidRetry) Error() string {
+	return fmt.Sprintf("invalid retry: %s", err.reason)
+}
@@ -0,0 +1,78 @@
+package compiled
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	tests := map[string]struct {
+		input    *api.Retry
+		expected *retry.Policy
+		isErr    bool
+	}{
+		"nil": {},
+		"defaults": {
+			input: &api.Retry{},
+			expected: &retry.Policy{
+				MaxAttempts: DefaultRetryAttempts,
+				Backoff: retry.NewExponentialBackoff(DefaultRetryInitialBackoff, 2).
+					WithMax(DefaultRetryMaxBackoff),
+				Jitter: retry.JitterFull,
+				Codes:  []codes.Code{codes.Unavailable},
+			},
+		},
+		"all fields": {
+			input: &api.Retry{
+				MaxAttempts:    5,
+				InitialBackoff: time.Second,
+				MaxBackoff:     time.Minute,
+				Jitter:         "decorrelated",
+				Codes:          []string{"UNAVAILABLE", "deadline_exceeded"},
+			},
+			expected: &retry.Policy{
+				MaxAttempts: 5,
+				Backoff:     retry.NewExponentialBackoff(time.Second, 2).WithMax(time.Minute),
+				Jitter:      retry.JitterDecorrelated,
+				Codes:       []codes.Code{codes.Unavailable, codes.DeadlineExceeded},
+			},
+		},
+		"max below initial backoff": {
+			input: &api.Retry{InitialBackoff: time.Minute, MaxBackoff: time.Second},
+			isErr: true,
+		},
+		"unknown jitter": {
+			input: &api.Retry{Jitter: "partial"},
+			isErr: true,
+		},
+		"unknown code": {
+			input: &api.Retry{Codes: []string{"UNKNOWN_CODE"}},
+			isErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := RetryPolicy(tc.input)
+			if tc.isErr {
+				var retryErr *invalidRetry
+				if !errors.As(err, &retryErr) {
+					t.Fatalf("expected *invalidRetry, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compile: %s", err)
+			}
+			cmpOpts := cmp.AllowUnexported(retry.ExponentialBackoff{})
+			if diff := cmp.Diff(tc.expected, p, cmpOpts); diff != "" {
+				t.Fatalf("retry policy mismatch:\n%s", diff)
+			}
+		})
+	}
+}
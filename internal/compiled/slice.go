@@ -0,0 +1,99 @@
+package compiled
+
+import (
+	"fmt"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+)
+
+type stageNotReachable struct{ from, to string }
+
+func (err *stageNotReachable) Error() string {
+	return fmt.Sprintf("stage '%s' not reachable from stage '%s'", err.to, err.from)
+}
+
+// Slice returns a copy of the pipeline configuration with the stages that
+// are on a path from stage from to stage to, and the links between them. If
+// from is empty, the stages that reach to are kept, and if to is empty, the
+// stages reachable from from are kept. If from and to are the same stage,
+// only that stage is kept.
+//
+// When compiled, the stages that lose their inputs are fed by sources and
+// the ones that lose their outputs send their messages to sinks.
+func Slice(cfg *api.Pipeline, from, to string) (*api.Pipeline, error) {
+	stages := make(map[string]*api.Stage, len(cfg.Stages))
+	for _, s := range cfg.Stages {
+		stages[s.Name] = s
+	}
+	for _, name := range []string{from, to} {
+		if _, ok := stages[name]; name != "" && !ok {
+			return nil, &stageNotFound{name: name}
+		}
+	}
+
+	var selected map[string]bool
+	switch {
+	case from != "" && from == to:
+		selected = map[string]bool{from: true}
+	case from != "" && to != "":
+		downstream := reachable(cfg.Links, from, true)
+		if !downstream[to] {
+			return nil, &stageNotReachable{from: from, to: to}
+		}
+		upstream := reachable(cfg.Links, to, false)
+		selected = make(map[string]bool)
+		for name := range downstream {
+			if upstream[name] {
+				selected[name] = true
+			}
+		}
+	case from != "":
+		selected = reachable(cfg.Links, from, true)
+	case to != "":
+		selected = reachable(cfg.Links, to, false)
+	default:
+		selected = make(map[string]bool, len(stages))
+		for name := range stages {
+			selected[name] = true
+		}
+	}
+
+	p := &api.Pipeline{
+		Name:              cfg.Name,
+		DeadLetter:        cfg.DeadLetter,
+		PropagateMetadata: cfg.PropagateMetadata,
+	}
+	for _, s := range cfg.Stages {
+		if selected[s.Name] {
+			p.Stages = append(p.Stages, s)
+		}
+	}
+	for _, l := range cfg.Links {
+		if selected[l.SourceStage] && selected[l.TargetStage] {
+			p.Links = append(p.Links, l)
+		}
+	}
+	return p, nil
+}
+
+// reachable returns the stages reachable from start, including start,
+// following the links forward or backward.
+func reachable(links []*api.Link, start string, forward bool) map[string]bool {
+	visited := map[string]bool{start: true}
+	next := []string{start}
+	for len(next) > 0 {
+		curr := next[0]
+		next = next[1:]
+		for _, l := range links {
+			src, dst := l.SourceStage, l.TargetStage
+			if !forward {
+				src, dst = dst, src
+			}
+			if src == curr && !visited[dst] {
+				visited[dst] = true
+				next = append(next, dst)
+			}
+		}
+	}
+	return visited
+}
@@ -0,0 +1,91 @@
+package compiled
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSlice(t *testing.T) {
+	// stage-1 -> stage-2 -> stage-3 -> stage-5
+	//        \-> stage-4 -/
+	cfg := &api.Pipeline{
+		Name: "pipeline",
+		Stages: []*api.Stage{
+			{Name: "stage-1"},
+			{Name: "stage-2"},
+			{Name: "stage-3"},
+			{Name: "stage-4"},
+			{Name: "stage-5"},
+		},
+		Links: []*api.Link{
+			{Name: "1-to-2", SourceStage: "stage-1", TargetStage: "stage-2"},
+			{Name: "2-to-3", SourceStage: "stage-2", TargetStage: "stage-3", TargetField: "a"},
+			{Name: "1-to-4", SourceStage: "stage-1", TargetStage: "stage-4"},
+			{Name: "4-to-3", SourceStage: "stage-4", TargetStage: "stage-3", TargetField: "b"},
+			{Name: "3-to-5", SourceStage: "stage-3", TargetStage: "stage-5"},
+		},
+	}
+	tests := map[string]struct {
+		from, to       string
+		expectedStages []string
+		expectedLinks  []string
+	}{
+		"from and to": {
+			from:           "stage-2",
+			to:             "stage-5",
+			expectedStages: []string{"stage-2", "stage-3", "stage-5"},
+			expectedLinks:  []string{"2-to-3", "3-to-5"},
+		},
+		"from": {
+			from:           "stage-4",
+			expectedStages: []string{"stage-3", "stage-4", "stage-5"},
+			expectedLinks:  []string{"4-to-3", "3-to-5"},
+		},
+		"to": {
+			to:             "stage-3",
+			expectedStages: []string{"stage-1", "stage-2", "stage-3", "stage-4"},
+			expectedLinks:  []string{"1-to-2", "2-to-3", "1-to-4", "4-to-3"},
+		},
+		"only": {
+			from:           "stage-3",
+			to:             "stage-3",
+			expectedStages: []string{"stage-3"},
+		},
+		"all": {
+			expectedStages: []string{"stage-1", "stage-2", "stage-3", "stage-4", "stage-5"},
+			expectedLinks:  []string{"1-to-2", "2-to-3", "1-to-4", "4-to-3", "3-to-5"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := Slice(cfg, tc.from, tc.to)
+			if err != nil {
+				t.Fatalf("slice: %s", err)
+			}
+			var stages, links []string
+			for _, s := range p.Stages {
+				stages = append(stages, s.Name)
+			}
+			for _, l := range p.Links {
+				links = append(links, l.Name)
+			}
+			if diff := cmp.Diff(tc.expectedStages, stages); diff != "" {
+				t.Fatalf("stages mismatch:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedLinks, links); diff != "" {
+				t.Fatalf("links mismatch:\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := Slice(cfg, "stage-4", "stage-2"); err == nil {
+		t.Fatalf("expected error for unreachable stage")
+	}
+	var notFound *stageNotFound
+	if _, err := Slice(cfg, "unknown", ""); !errors.As(err, &notFound) {
+		t.Fatalf("expected stage not found error, got %v", err)
+	}
+}
@@ -2,11 +2,18 @@ package compiled
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/DuarteMRAlves/maestro/internal/api"
 	"github.com/DuarteMRAlves/maestro/internal/message"
 	"github.com/DuarteMRAlves/maestro/internal/method"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
 )
 
+// DefaultStageTimeout is the timeout for the calls of stages that do not
+// specify one.
+const DefaultStageTimeout = time.Minute
+
 // Stage defines a step of a Pipeline
 type Stage struct {
 	name  StageName
@@ -14,6 +21,17 @@ type Stage struct {
 
 	// static attributes for the method invocation
 	address string
+	timeout time.Duration
+	onError ErrorPolicy
+	breaker *CircuitBreaker
+	retry   *retry.Policy
+	md      method.Metadata
+	// propagate are the names of the reply metadata sent to the next stages.
+	propagate []string
+	// tls and auth are the connection settings of the server, which are
+	// applied when dialing. They are kept to detect changes in updates.
+	tls  *api.TLS
+	auth *api.Auth
 
 	// runtime attributes that can be computed from
 	// the static attributes
@@ -38,6 +56,58 @@ func (s *Stage) Type() StageType {
 	return s.sType
 }
 
+// Timeout returns the maximum duration of each method invocation.
+func (s *Stage) Timeout() time.Duration {
+	if s == nil || s.timeout == 0 {
+		return DefaultStageTimeout
+	}
+	return s.timeout
+}
+
+// OnError returns what happens when the method invocations fail.
+func (s *Stage) OnError() ErrorPolicy {
+	if s == nil || s.onError == "" {
+		return ErrorPolicyFail
+	}
+	return s.onError
+}
+
+// CircuitBreaker returns the circuit breaker for the method invocations, or
+// nil if the method is always called.
+func (s *Stage) CircuitBreaker() *CircuitBreaker {
+	if s == nil {
+		return nil
+	}
+	return s.breaker
+}
+
+// Retry returns the policy to retry the failed method invocations, or nil
+// if they are not retried.
+func (s *Stage) Retry() *retry.Policy {
+	if s == nil {
+		return nil
+	}
+	return s.retry
+}
+
+// Metadata returns the metadata sent with every method invocation, or nil
+// if there is none.
+func (s *Stage) Metadata() method.Metadata {
+	if s == nil {
+		return nil
+	}
+	return s.md
+}
+
+// PropagateMetadata returns the names of the metadata received with the
+// replies that is sent with the invocations of the next stages.
+func (s *Stage) PropagateMetadata() []string {
+	if s == nil {
+		return nil
+	}
+	return s.propagate
+}
+
 func (s *Stage) Dialer() method.Dialer {
 	if s == nil {
 		return nil
@@ -130,6 +200,33 @@ func (err *invalidStageName) Error() string {
 	return fmt.Sprintf("invalid stage name: '%s'", err.name)
 }
 
+// ErrorPolicy specifies what a stage does when its method fails.
+type ErrorPolicy string
+
+const (
+	// ErrorPolicyFail stops the execution of the pipeline.
+	ErrorPolicyFail ErrorPolicy = "fail"
+	// ErrorPolicySkip sends the failed message to the dead letter and
+	// continues with the next message.
+	ErrorPolicySkip ErrorPolicy = "skip"
+)
+
+func compileErrorPolicy(policy string) (ErrorPolicy, error) {
+	// The empty policy is kept, as stages without a policy fail.
+	switch ErrorPolicy(policy) {
+	case "", ErrorPolicyFail, ErrorPolicySkip:
+		return ErrorPolicy(policy), nil
+	default:
+		return "", &unknownErrorPolicy{policy: policy}
+	}
+}
+
+type unknownErrorPolicy struct{ policy string }
+
+func (err *unknownErrorPolicy) Error() string {
+	return fmt.Sprintf("unknown error policy: '%s'", err.policy)
+}
+
 type StageType string
 
 const (
@@ -0,0 +1,154 @@
+// Package dlq stores the messages that the stages of a pipeline failed to
+// process, so that they can be inspected and replayed.
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/message"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+)
+
+// Record is a message that a stage failed to process.
+type Record struct {
+	// Stage is the name of the stage that failed.
+	Stage string `json:"stage"`
+	// Request is the input of the stage, in the protobuf json format.
+	Request json.RawMessage `json:"request"`
+	// Code is the name of the grpc status code of the error, such as
+	// "Unavailable".
+	Code string `json:"code"`
+	// Error is the message of the error.
+	Error string `json:"error"`
+	// Attempts is the number of times the stage method was called.
+	Attempts int `json:"attempts"`
+	// Time is when the message was skipped.
+	Time time.Time `json:"time"`
+}
+
+// NewRecord creates the record of a request that failed with err.
+func NewRecord(stage string, request []byte, err error, attempts int) Record {
+	return Record{
+		Stage:    stage,
+		Request:  request,
+		Code:     retry.Code(err).String(),
+		Error:    err.Error(),
+		Attempts: attempts,
+		Time:     time.Now().UTC(),
+	}
+}
+
+// Sink receives the records of the failed messages.
+type Sink interface {
+	Write(r Record) error
+	Close() error
+}
+
+// FileSink appends the records to a file, one json object per line.
+type FileSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenFile opens the file of a FileSink, creating it if it does not exist.
+func OpenFile(name string) (*FileSink, error) {
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open dead letter: %w", err)
+	}
+	return &FileSink{f: f}, nil
+}
+
+func (s *FileSink) Write(r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("write dead letter: %w", err)
+	}
+	data = append(data, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Write(data); err != nil {
+		return fmt.Errorf("write dead letter: %w", err)
+	}
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+// Unmarshaler decodes a message of type t from the protobuf json format.
+type Unmarshaler func(data []byte, t message.Type) (message.Instance, error)
+
+// MethodSink sends the records to a method. The input of the method is
+// decoded from the json object of the record, and so it must have the
+// fields of the record, where the request is a google.protobuf.Struct and
+// the time is a google.protobuf.Timestamp.
+type MethodSink struct {
+	conn      method.Conn
+	input     message.Type
+	unmarshal Unmarshaler
+	timeout   time.Duration
+}
+
+// DialMethod connects with the method of a MethodSink. Each record is sent
+// within the given timeout.
+func DialMethod(desc method.Desc, unmarshal Unmarshaler, timeout time.Duration) (*MethodSink, error) {
+	conn, err := desc.Dial()
+	if err != nil {
+		return nil, fmt.Errorf("dial dead letter: %w", err)
+	}
+	s := &MethodSink{
+		conn:      conn,
+		input:     desc.Input(),
+		unmarshal: unmarshal,
+		timeout:   timeout,
+	}
+	return s, nil
+}
+
+func (s *MethodSink) Write(r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("write dead letter: %w", err)
+	}
+	msg, err := s.unmarshal(data, s.input)
+	if err != nil {
+		return fmt.Errorf("write dead letter: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if _, err := s.conn.Call(ctx, msg); err != nil {
+		return fmt.Errorf("write dead letter: %w", err)
+	}
+	return nil
+}
+
+func (s *MethodSink) Close() error {
+	return s.conn.Close()
+}
+
+// Read decodes the records written by a FileSink.
+func Read(r io.Reader) ([]Record, error) {
+	var records []Record
+	dec := json.NewDecoder(r)
+	for {
+		var rec Record
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read dead letter %d: %w", len(records)+1, err)
+		}
+		records = append(records, rec)
+	}
+}
@@ -0,0 +1,57 @@
+package dlq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFileSink(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dlq.jsonl")
+	errs := []error{
+		fmt.Errorf("call: %w", status.Error(codes.Unavailable, "server down")),
+		errors.New("no status"),
+	}
+	var expected []Record
+	for i := range errs {
+		// The file is reopened to check the records are appended.
+		sink, err := OpenFile(file)
+		if err != nil {
+			t.Fatalf("open file: %s", err)
+		}
+		request := json.RawMessage(fmt.Sprintf(`{"val":%d}`, i))
+		r := NewRecord("stage", request, errs[i], i+1)
+		if err := sink.Write(r); err != nil {
+			t.Fatalf("write record %d: %s", i, err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("close file: %s", err)
+		}
+		expected = append(expected, r)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("open records: %s", err)
+	}
+	defer f.Close()
+	records, err := Read(f)
+	if err != nil {
+		t.Fatalf("read records: %s", err)
+	}
+	if diff := cmp.Diff(expected, records, cmpopts.EquateApproxTime(0)); diff != "" {
+		t.Fatalf("records mismatch:\n%s", diff)
+	}
+	codes := []string{records[0].Code, records[1].Code}
+	if diff := cmp.Diff([]string{"Unavailable", "Unknown"}, codes); diff != "" {
+		t.Fatalf("codes mismatch:\n%s", diff)
+	}
+}
@@ -0,0 +1,174 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/compiled"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+)
+
+// ErrCircuitOpen is returned by the calls of stages with an open circuit
+// breaker that fail while open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// BreakerState is the state of the circuit breaker of a stage.
+type BreakerState string
+
+const (
+	// BreakerClosed calls the method.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen stops the calls to the method.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen calls the method to probe if it recovered.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// circuitBreaker tracks the results of the calls of a stage. The breaker
+// opens when the consecutive failures or the error rate of the last calls
+// reach their thresholds. After the open timeout, the breaker is half-open
+// and lets calls through, closing once enough of them succeed and opening
+// again if any fails.
+type circuitBreaker struct {
+	name   compiled.StageName
+	cfg    compiled.CircuitBreaker
+	clock  retry.Clock
+	logger Logger
+
+	mu    sync.Mutex
+	state BreakerState
+	// consecutive is the number of calls that failed in a row.
+	consecutive uint
+	// window has the results of the last calls, where true is a failure.
+	window   []bool
+	next     int
+	failures uint
+	openedAt time.Time
+	// probes is the number of successful calls while half-open.
+	probes uint
+}
+
+func newCircuitBreaker(
+	name compiled.StageName, cfg compiled.CircuitBreaker, clock retry.Clock, logger Logger,
+) *circuitBreaker {
+	return &circuitBreaker{
+		name:   name,
+		cfg:    cfg,
+		clock:  clock,
+		logger: logger,
+		state:  BreakerClosed,
+		window: make([]bool, 0, cfg.Window),
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *circuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow waits until the breaker lets a call through. When the breaker is
+// open and configured to fail, it returns ErrCircuitOpen instead.
+func (b *circuitBreaker) allow(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.state == BreakerOpen {
+		remaining := b.cfg.OpenTimeout - b.clock.Now().Sub(b.openedAt)
+		if remaining <= 0 {
+			b.transition(BreakerHalfOpen, "open timeout elapsed")
+			break
+		}
+		if b.cfg.WhileOpen == compiled.WhileOpenFail {
+			return ErrCircuitOpen
+		}
+		b.mu.Unlock()
+		select {
+		case <-b.clock.After(remaining):
+			b.mu.Lock()
+		case <-ctx.Done():
+			b.mu.Lock()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// record updates the breaker with the result of a call.
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			b.open("probe failed")
+			return
+		}
+		b.probes++
+		if b.probes >= b.cfg.HalfOpenProbes {
+			b.reset()
+			b.transition(BreakerClosed, fmt.Sprintf("%d probes succeeded", b.probes))
+		}
+	case BreakerClosed:
+		if failed {
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+		b.push(failed)
+		switch {
+		case b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures:
+			b.open(fmt.Sprintf("%d consecutive failures", b.consecutive))
+		case b.cfg.ErrorRate > 0 && b.errorRate() >= b.cfg.ErrorRate:
+			b.open(fmt.Sprintf("%d of the last %d calls failed", b.failures, len(b.window)))
+		}
+	}
+}
+
+// push adds the result of a call to the window, replacing the oldest one
+// when it is full.
+func (b *circuitBreaker) push(failed bool) {
+	if uint(len(b.window)) < b.cfg.Window {
+		b.window = append(b.window, failed)
+	} else {
+		if b.window[b.next] {
+			b.failures--
+		}
+		b.window[b.next] = failed
+		b.next = (b.next + 1) % len(b.window)
+	}
+	if failed {
+		b.failures++
+	}
+}
+
+// errorRate returns the fraction of failed calls in the window, or 0 if the
+// window is not full.
+func (b *circuitBreaker) errorRate() float64 {
+	if uint(len(b.window)) < b.cfg.Window {
+		return 0
+	}
+	return float64(b.failures) / float64(len(b.window))
+}
+
+func (b *circuitBreaker) open(reason string) {
+	b.openedAt = b.clock.Now()
+	b.probes = 0
+	b.transition(BreakerOpen, reason)
+}
+
+func (b *circuitBreaker) reset() {
+	b.consecutive = 0
+	b.window = b.window[:0]
+	b.next = 0
+	b.failures = 0
+	b.probes = 0
+}
+
+func (b *circuitBreaker) transition(state BreakerState, reason string) {
+	b.logger.Infof("'%s': circuit breaker %s: %s\n", b.name, state, reason)
+	b.state = state
+}
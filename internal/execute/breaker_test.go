@@ -0,0 +1,192 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/compiled"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	// step is either the result of a call, an advance of the clock or a
+	// check of the state and of the calls being allowed.
+	type step struct {
+		fail     *bool
+		advance  time.Duration
+		expected BreakerState
+	}
+	success, failure := false, true
+	tests := map[string]struct {
+		cfg   compiled.CircuitBreaker
+		steps []step
+	}{
+		"consecutive failures": {
+			cfg: compiled.CircuitBreaker{
+				ConsecutiveFailures: 2,
+				Window:              10,
+				OpenTimeout:         time.Second,
+				HalfOpenProbes:      2,
+			},
+			steps: []step{
+				{fail: &failure, expected: BreakerClosed},
+				{fail: &success, expected: BreakerClosed},
+				{fail: &failure, expected: BreakerClosed},
+				{fail: &failure, expected: BreakerOpen},
+				{advance: time.Second, expected: BreakerHalfOpen},
+				{fail: &success, expected: BreakerHalfOpen},
+				{fail: &success, expected: BreakerClosed},
+			},
+		},
+		"error rate": {
+			cfg: compiled.CircuitBreaker{
+				ErrorRate:      0.5,
+				Window:         4,
+				OpenTimeout:    time.Second,
+				HalfOpenProbes: 1,
+			},
+			steps: []step{
+				{fail: &failure, expected: BreakerClosed},
+				{fail: &success, expected: BreakerClosed},
+				{fail: &success, expected: BreakerClosed},
+				{fail: &success, expected: BreakerClosed},
+				// The oldest failure leaves the window.
+				{fail: &failure, expected: BreakerClosed},
+				{fail: &failure, expected: BreakerOpen},
+			},
+		},
+		"failed probe": {
+			cfg: compiled.CircuitBreaker{
+				ConsecutiveFailures: 1,
+				Window:              10,
+				OpenTimeout:         time.Second,
+				HalfOpenProbes:      1,
+			},
+			steps: []step{
+				{fail: &failure, expected: BreakerOpen},
+				{advance: 500 * time.Millisecond, expected: BreakerOpen},
+				{advance: 500 * time.Millisecond, expected: BreakerHalfOpen},
+				{fail: &failure, expected: BreakerOpen},
+				{advance: time.Second, expected: BreakerHalfOpen},
+				{fail: &success, expected: BreakerClosed},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			clock := newTestClock()
+			tc.cfg.WhileOpen = compiled.WhileOpenFail
+			b := newCircuitBreaker(createStageName(t, "stage"), tc.cfg, clock, logger{})
+			for i, s := range tc.steps {
+				if s.fail != nil {
+					b.record(*s.fail)
+				}
+				clock.advance(s.advance)
+				err := b.allow(context.Background())
+				if s.expected == BreakerOpen && !errors.Is(err, ErrCircuitOpen) {
+					t.Fatalf("step %d: expected ErrCircuitOpen, got %v", i, err)
+				}
+				if s.expected != BreakerOpen && err != nil {
+					t.Fatalf("step %d: allow: %s", i, err)
+				}
+				if diff := cmp.Diff(s.expected, b.State()); diff != "" {
+					t.Fatalf("step %d: state mismatch:\n%s", i, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_Wait(t *testing.T) {
+	clock := newTestClock()
+	cfg := compiled.CircuitBreaker{
+		ConsecutiveFailures: 1,
+		Window:              10,
+		OpenTimeout:         time.Second,
+		HalfOpenProbes:      1,
+		WhileOpen:           compiled.WhileOpenWait,
+	}
+	b := newCircuitBreaker(createStageName(t, "stage"), cfg, clock, logger{})
+	b.record(true)
+
+	allowed := make(chan error)
+	go func() { allowed <- b.allow(context.Background()) }()
+	select {
+	case err := <-allowed:
+		t.Fatalf("call allowed while open: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.advance(time.Second)
+	if err := <-allowed; err != nil {
+		t.Fatalf("allow: %s", err)
+	}
+	if diff := cmp.Diff(BreakerHalfOpen, b.State()); diff != "" {
+		t.Fatalf("state mismatch:\n%s", diff)
+	}
+
+	// Waiting calls return when the stage stops.
+	b.record(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { allowed <- b.allow(ctx) }()
+	cancel()
+	if err := <-allowed; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// testClock only moves forward when advanced by the test or, if auto is
+// set, when waited for.
+type testClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	auto    bool
+	waits   []time.Duration
+	waiters []testWaiter
+}
+
+type testWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waits = append(c.waits, d)
+	if c.auto {
+		c.now = c.now.Add(d)
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, testWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = waiting
+}
@@ -6,17 +6,75 @@ import (
 
 	"github.com/DuarteMRAlves/maestro/internal/compiled"
 	"github.com/DuarteMRAlves/maestro/internal/message"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
 )
 
 type Builder func(pipeline *compiled.Pipeline) (Execution, error)
 
-func NewBuilder(logger Logger) Builder {
+// Feed provides the messages sent by the sources of a pipeline, which
+// otherwise send empty messages. It returns io.EOF when there are no more
+// messages, after which the sources stop.
+type Feed func(t message.Type) (message.Instance, error)
+
+// Output receives the messages that reach the sinks of a pipeline, which
+// are otherwise discarded.
+type Output func(msg message.Instance) error
+
+// FailedMessage is a message that a stage failed to process.
+type FailedMessage struct {
+	Stage   compiled.StageName
+	Request message.Instance
+	Err     error
+	// Attempts is the number of times the stage method was called.
+	Attempts int
+}
+
+// DeadLetter receives the messages that the stages with the skip error
+// policy failed to process. If it returns an error, the stage stops.
+type DeadLetter func(msg FailedMessage) error
+
+// BuildOption configures the executions created by a Builder.
+type BuildOption func(*buildConfig)
+
+type buildConfig struct {
+	logger     Logger
+	feed       Feed
+	output     Output
+	deadLetter DeadLetter
+	// ids numbers the messages of the sources of an execution.
+	ids *sourceIDs
+}
+
+// WithFeed makes the sources send the messages of the feed.
+func WithFeed(feed Feed) BuildOption {
+	return func(cfg *buildConfig) { cfg.feed = feed }
+}
+
+// WithOutput makes the sinks send the messages they receive to the output.
+func WithOutput(output Output) BuildOption {
+	return func(cfg *buildConfig) { cfg.output = output }
+}
+
+// WithDeadLetter sends the messages skipped by the stages to the dead
+// letter.
+func WithDeadLetter(dl DeadLetter) BuildOption {
+	return func(cfg *buildConfig) { cfg.deadLetter = dl }
+}
+
+func NewBuilder(logger Logger, opts ...BuildOption) Builder {
+	cfg := buildConfig{logger: logger}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 	return func(pipeline *compiled.Pipeline) (Execution, error) {
-		return buildExecution(pipeline, logger)
+		return buildExecution(pipeline, cfg)
 	}
 }
 
-func buildExecution(pipeline *compiled.Pipeline, logger Logger) (*execution, error) {
+func buildExecution(pipeline *compiled.Pipeline, cfg buildConfig) (*execution, error) {
+	// The ids are shared by the stages built when the execution is updated,
+	// so that restarted sources do not repeat them.
+	cfg.ids = &sourceIDs{}
 	// allChans stores all the channels, including the ones for aux stages.
 	// linkChans stores the channels associates with the pipeline links.
 	var allChans []chan state
@@ -35,7 +93,7 @@ func buildExecution(pipeline *compiled.Pipeline, logger Logger) (*execution, err
 
 	stages := make(map[compiled.StageName]Stage)
 	err = pipeline.VisitStages(func(s *compiled.Stage) error {
-		execStage, err := buildStage(s, chans, logger)
+		execStage, err := buildStage(s, chans, cfg)
 		if err != nil {
 			return fmt.Errorf("build stage: %w", err)
 		}
@@ -46,27 +104,37 @@ func buildExecution(pipeline *compiled.Pipeline, logger Logger) (*execution, err
 		return nil, err
 	}
 
-	initChans(pipeline, chans)
+	var links []*compiled.Link
+	err = pipeline.VisitLinks(func(l *compiled.Link) error {
+		links = append(links, l)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := initLinks(pipeline, links, chans); err != nil {
+		return nil, err
+	}
 
-	return newExecution(stages, logger), nil
+	return newExecution(pipeline, chans, stages, cfg), nil
 }
 
-func buildStage(s *compiled.Stage, chans map[compiled.LinkName]chan state, l Logger) (Stage, error) {
+func buildStage(s *compiled.Stage, chans map[compiled.LinkName]chan state, cfg buildConfig) (Stage, error) {
 	switch s.Type() {
 	case compiled.StageTypeUnary:
-		s, err := buildUnary(s, chans, l)
+		s, err := buildUnary(s, chans, cfg)
 		if err != nil {
 			return nil, fmt.Errorf("build unary: %w", err)
 		}
 		return s, nil
 	case compiled.StageTypeSource:
-		s, err := buildSource(s, chans)
+		s, err := buildSource(s, chans, cfg.feed, cfg.ids)
 		if err != nil {
 			return nil, fmt.Errorf("build source: %w", err)
 		}
 		return s, nil
 	case compiled.StageTypeSink:
-		s, err := buildSink(s, chans)
+		s, err := buildSink(s, chans, cfg.output)
 		if err != nil {
 			return nil, fmt.Errorf("build sink: %w", err)
 		}
@@ -88,7 +156,7 @@ func buildStage(s *compiled.Stage, chans map[compiled.LinkName]chan state, l Log
 	}
 }
 
-func buildUnary(s *compiled.Stage, chans map[compiled.LinkName]chan state, l Logger) (Stage, error) {
+func buildUnary(s *compiled.Stage, chans map[compiled.LinkName]chan state, cfg buildConfig) (Stage, error) {
 	name := s.Name()
 	inputs := s.CopyInputs()
 	outputs := s.CopyOutputs()
@@ -111,10 +179,22 @@ func buildUnary(s *compiled.Stage, chans map[compiled.LinkName]chan state, l Log
 	if dialer == nil {
 		return nil, errors.New("nil dialer")
 	}
-	return newUnary(name, inChan, outChan, dialer, l), nil
+	policy := errorPolicy{
+		skip:       s.OnError() == compiled.ErrorPolicySkip,
+		deadLetter: cfg.deadLetter,
+		retry:      s.Retry(),
+	}
+	var breaker *circuitBreaker
+	if cb := s.CircuitBreaker(); cb != nil {
+		breaker = newCircuitBreaker(name, *cb, retry.RealClock, cfg.logger)
+	}
+	md := callMetadata{static: s.Metadata(), propagate: s.PropagateMetadata()}
+	return newUnary(name, inChan, outChan, dialer, s.Timeout(), policy, breaker, md, cfg.logger), nil
 }
 
-func buildSource(s *compiled.Stage, chans map[compiled.LinkName]chan state) (Stage, error) {
+func buildSource(
+	s *compiled.Stage, chans map[compiled.LinkName]chan state, feed Feed, ids *sourceIDs,
+) (Stage, error) {
 	input := s.InputDesc()
 	if input == nil {
 		return nil, errors.New("nil method input")
@@ -133,10 +213,16 @@ func buildSource(s *compiled.Stage, chans map[compiled.LinkName]chan state) (Sta
 	if !exists {
 		return nil, fmt.Errorf("unknown output link name: %s", outputs[0].Name())
 	}
-	return newSource(message.BuildFunc(input.Build), outChan), nil
+	// The ids are prefixed by the stage that receives the messages, so that
+	// the messages of different sources have different ids.
+	gen := ids.generator(outputs[0].Target().Stage().Unwrap())
+	if feed != nil {
+		return newFeedSource(input, feed, outChan, gen), nil
+	}
+	return newSource(message.BuildFunc(input.Build), outChan, gen), nil
 }
 
-func buildSink(s *compiled.Stage, chans map[compiled.LinkName]chan state) (Stage, error) {
+func buildSink(s *compiled.Stage, chans map[compiled.LinkName]chan state, output Output) (Stage, error) {
 	inputs := s.CopyInputs()
 	outputs := s.CopyOutputs()
 	if len(inputs) != 1 {
@@ -149,16 +235,21 @@ func buildSink(s *compiled.Stage, chans map[compiled.LinkName]chan state) (Stage
 	if !exists {
 		return nil, fmt.Errorf("unknown input link name: %s", inputs[0].Name())
 	}
+	if output != nil {
+		return newOutputSink(inChan, output), nil
+	}
 	return newSink(inChan), nil
 }
 
 func buildMerge(s *compiled.Stage, chans map[compiled.LinkName]chan state) (Stage, error) {
 	inputs := s.CopyInputs()
 	fields := make([]message.Field, 0, len(inputs))
+	converters := make([]message.Converter, 0, len(inputs))
 	// channels where the stage will receive the several inputs.
 	inChans := make([]<-chan state, 0, len(inputs))
 	for _, l := range inputs {
 		fields = append(fields, l.Target().Field())
+		converters = append(converters, l.Converter())
 		inChan, exists := chans[l.Name()]
 		if !exists {
 			return nil, fmt.Errorf("unknown input link name: %s", l.Name())
@@ -179,7 +270,7 @@ func buildMerge(s *compiled.Stage, chans map[compiled.LinkName]chan state) (Stag
 	if input == nil {
 		return nil, errors.New("nil method input")
 	}
-	return newMerge(fields, inChans, outChan, message.BuildFunc(input.Build)), nil
+	return newMerge(fields, converters, inChans, outChan, message.BuildFunc(input.Build)), nil
 }
 
 func buildSplit(s *compiled.Stage, chans map[compiled.LinkName]chan state) (Stage, error) {
@@ -207,12 +298,15 @@ func buildSplit(s *compiled.Stage, chans map[compiled.LinkName]chan state) (Stag
 	return newSplit(fields, inChan, outChans), nil
 }
 
-func initChans(
-	pipeline *compiled.Pipeline, chans map[compiled.LinkName]chan state,
+// initLinks sends the empty messages to the given links of the pipeline.
+func initLinks(
+	pipeline *compiled.Pipeline,
+	links []*compiled.Link,
+	chans map[compiled.LinkName]chan state,
 ) error {
-	return pipeline.VisitLinks(func(l *compiled.Link) error {
+	for _, l := range links {
 		if l.NumEmptyMessages() == 0 {
-			return nil
+			continue
 		}
 		if l.NumEmptyMessages() > l.Size() {
 			return fmt.Errorf(
@@ -241,6 +335,6 @@ func initChans(
 		for i := 0; i < int(l.NumEmptyMessages()); i++ {
 			ch <- newState(msgType.Build())
 		}
-		return nil
-	})
+	}
+	return nil
 }
@@ -2,9 +2,13 @@ package execute
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/DuarteMRAlves/maestro/internal/compiled"
-	"golang.org/x/sync/errgroup"
 )
 
 type Stage interface {
@@ -15,56 +19,478 @@ type Stage interface {
 type Execution interface {
 	Start()
 	Stop() error
+	// Update changes the running pipeline to a new version. Only the stages
+	// and links that changed are restarted, and the messages in the links
+	// that did not change are kept. If the update fails, the execution
+	// continues with the previous pipeline.
+	Update(pipeline *compiled.Pipeline) error
+}
+
+// StatusReporter is implemented by the executions that report the status of
+// their stages.
+type StatusReporter interface {
+	Status() []StageStatus
+}
+
+// StageStatus is the status of a stage of an execution.
+type StageStatus struct {
+	Stage compiled.StageName
+	// Breaker is the state of the circuit breaker of the stage, or empty if
+	// the stage does not have one.
+	Breaker BreakerState
+}
+
+// DefaultDrainTimeout is the maximum time to wait for the restarted stages
+// to process their in-flight messages during an update.
+const DefaultDrainTimeout = 10 * time.Second
+
+type drainKey struct{}
+
+// drainer signals a stage to drain and keeps the messages the stage could
+// not send before draining.
+type drainer struct {
+	signal <-chan struct{}
+	// pending is only written by the stage and read after it returns.
+	pending []pendingMessage
+}
+
+// pendingMessage is a message that a drained stage did not send to a link.
+type pendingMessage struct {
+	link chan<- state
+	st   state
+}
+
+// withDrain returns a context for a stage that should drain when the drain
+// channel is closed. A drained stage finishes processing the messages it
+// received, stops receiving new ones and returns.
+func withDrain(ctx context.Context, d *drainer) context.Context {
+	return context.WithValue(ctx, drainKey{}, d)
+}
+
+// drainSignal returns the channel that is closed when the stage should
+// drain, or nil if the stage is never drained.
+func drainSignal(ctx context.Context) <-chan struct{} {
+	d, _ := ctx.Value(drainKey{}).(*drainer)
+	if d == nil {
+		return nil
+	}
+	return d.signal
+}
+
+// keepPending keeps a message that a draining stage did not send to the
+// link, so that it is sent once the link is updated. The message is
+// discarded if the stage is never drained.
+func keepPending(ctx context.Context, link chan<- state, st state) {
+	if d, _ := ctx.Value(drainKey{}).(*drainer); d != nil {
+		d.pending = append(d.pending, pendingMessage{link: link, st: st})
+	}
+}
+
+func draining(drain <-chan struct{}) bool {
+	select {
+	case <-drain:
+		return true
+	default:
+		return false
+	}
 }
 
 type execution struct {
-	stages map[compiled.StageName]Stage
+	// updateMu serializes the updates, which do not hold mu while waiting
+	// for the stages to drain.
+	updateMu sync.Mutex
+	mu       sync.Mutex
+	stopped  bool
+	pipeline *compiled.Pipeline
+	chans    map[compiled.LinkName]chan state
+	stages   map[compiled.StageName]Stage
+	running  map[compiled.StageName]*runningStage
 
 	runner *runner
 
-	logger Logger
+	drainTimeout time.Duration
+	build        buildConfig
+	logger       Logger
 }
 
-func newExecution(stages map[compiled.StageName]Stage, logger Logger) *execution {
-	return &execution{stages: stages, logger: logger}
+// runningStage controls the goroutine of a single stage.
+type runningStage struct {
+	drain   chan struct{}
+	drainer *drainer
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func newExecution(
+	pipeline *compiled.Pipeline,
+	chans map[compiled.LinkName]chan state,
+	stages map[compiled.StageName]Stage,
+	build buildConfig,
+) *execution {
+	return &execution{
+		pipeline:     pipeline,
+		chans:        chans,
+		stages:       stages,
+		running:      make(map[compiled.StageName]*runningStage),
+		drainTimeout: DefaultDrainTimeout,
+		build:        build,
+		logger:       build.logger,
+	}
 }
 
 func (e *execution) Start() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	e.runner = newRunner()
 
-	for _, s := range e.stages {
-		e.runner.goWithCtx(s.Run)
+	for name, s := range e.stages {
+		e.running[name] = e.runner.goStage(s)
 	}
 
 	e.logger.Debugf("Execution started\n")
 }
 
 func (e *execution) Stop() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stopped = true
 	err := e.runner.cancelAndWait()
 	e.logger.Debugf("Execution stopped\n")
 	return err
 }
 
+// Status returns the status of the stages, sorted by name.
+func (e *execution) Status() []StageStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	status := make([]StageStatus, 0, len(e.stages))
+	for name, s := range e.stages {
+		st := StageStatus{Stage: name}
+		if b, ok := s.(interface{ BreakerState() (BreakerState, bool) }); ok {
+			st.Breaker, _ = b.BreakerState()
+		}
+		status = append(status, st)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Stage.Unwrap() < status[j].Stage.Unwrap()
+	})
+	return status
+}
+
+func (e *execution) Update(pipeline *compiled.Pipeline) error {
+	e.updateMu.Lock()
+	defer e.updateMu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.runner == nil {
+		return errors.New("update: execution not started")
+	}
+	if e.stopped {
+		return errors.New("update: execution stopped")
+	}
+	changes := compiled.Diff(e.pipeline, pipeline)
+	if changes.IsEmpty() {
+		e.logger.Infof("Update: no changes\n")
+		return nil
+	}
+
+	restart := stagesToRestart(e.pipeline, pipeline, changes)
+	replaced := make(map[compiled.LinkName]bool)
+	for _, l := range changes.ChangedLinks {
+		replaced[l] = true
+	}
+	for _, l := range changes.RemovedLinks {
+		replaced[l] = true
+	}
+
+	// Build the new stages before stopping the old ones, so that the
+	// running pipeline is kept if the build fails.
+	oldLinks := pipelineLinks(e.pipeline)
+	chans := make(map[compiled.LinkName]chan state)
+	// moved are the replaced links that transport the same messages, and
+	// so receive the messages buffered in the previous links.
+	moved := make(map[compiled.LinkName]bool)
+	var newLinks []*compiled.Link
+	err := pipeline.VisitLinks(func(l *compiled.Link) error {
+		if ch, ok := e.chans[l.Name()]; ok && !replaced[l.Name()] {
+			chans[l.Name()] = ch
+			return nil
+		}
+		chans[l.Name()] = make(chan state, l.Size())
+		if prev, ok := oldLinks[l.Name()]; ok && compiled.LinkEndpointsEqual(prev, l) {
+			moved[l.Name()] = true
+			return nil
+		}
+		newLinks = append(newLinks, l)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	stages := make(map[compiled.StageName]Stage)
+	for name := range restart {
+		s, ok := pipeline.Stage(name)
+		if !ok {
+			continue
+		}
+		execStage, err := buildStage(s, chans, e.build)
+		if err != nil {
+			return fmt.Errorf("update: build stage %s: %w", name, err)
+		}
+		stages[name] = execStage
+	}
+
+	stopped := make(map[compiled.StageName]*runningStage)
+	for name := range restart {
+		if r, ok := e.running[name]; ok {
+			stopped[name] = r
+			delete(e.running, name)
+		}
+	}
+	// The stages are drained without holding the lock, so that the status
+	// is reported and the execution can be stopped during the update. The
+	// pipeline and links are not changed meanwhile as the updates are
+	// serialized.
+	e.mu.Unlock()
+	pending := e.drainStages(stopped)
+	e.mu.Lock()
+	if e.stopped {
+		return errors.New("update: execution stopped")
+	}
+	e.moveMessages(chans, replaced, moved)
+	resend := e.pendingToResend(chans, replaced, moved, pending)
+	if err := initLinks(pipeline, newLinks, chans); err != nil {
+		// The new stages were not started and the previous ones stopped,
+		// so the update can no longer be reverted.
+		return fmt.Errorf("update: %w", err)
+	}
+
+	for _, name := range changes.RemovedStages {
+		delete(e.stages, name)
+	}
+	for name, s := range stages {
+		e.stages[name] = s
+		if msgs := resend[name]; len(msgs) > 0 {
+			e.running[name] = e.runner.goStage(&resendStage{Stage: s, pending: msgs})
+			continue
+		}
+		e.running[name] = e.runner.goStage(s)
+	}
+	e.chans = chans
+	e.pipeline = pipeline
+	e.logger.Infof(
+		"Update: restarted %d stages, %d links added, %d removed and %d changed\n",
+		len(stages),
+		len(changes.AddedLinks),
+		len(changes.RemovedLinks),
+		len(changes.ChangedLinks),
+	)
+	return nil
+}
+
+// stagesToRestart returns the stages that must be stopped in the old
+// pipeline and started in the new one. These are the changed stages and the
+// stages connected to the changed links.
+func stagesToRestart(
+	old, new *compiled.Pipeline, changes compiled.Changes,
+) map[compiled.StageName]bool {
+	restart := make(map[compiled.StageName]bool)
+	for _, s := range changes.AddedStages {
+		restart[s] = true
+	}
+	for _, s := range changes.RemovedStages {
+		restart[s] = true
+	}
+	for _, s := range changes.ChangedStages {
+		restart[s] = true
+	}
+	addEndpoints := func(p *compiled.Pipeline, name compiled.LinkName) {
+		_ = p.VisitLinks(func(l *compiled.Link) error {
+			if l.Name() == name {
+				restart[l.Source().Stage()] = true
+				restart[l.Target().Stage()] = true
+			}
+			return nil
+		})
+	}
+	for _, l := range changes.ChangedLinks {
+		addEndpoints(old, l)
+		addEndpoints(new, l)
+	}
+	return restart
+}
+
+// drainStages drains the stages concurrently and waits for them to finish.
+// The stages that do not finish before the drain timeout are cancelled. It
+// returns the messages each stage did not send before draining.
+func (e *execution) drainStages(
+	stages map[compiled.StageName]*runningStage,
+) map[compiled.StageName][]pendingMessage {
+	var wg sync.WaitGroup
+	for name, r := range stages {
+		wg.Add(1)
+		go func(name compiled.StageName, r *runningStage) {
+			defer wg.Done()
+			close(r.drain)
+			timer := time.NewTimer(e.drainTimeout)
+			defer timer.Stop()
+			select {
+			case <-r.done:
+			case <-timer.C:
+				e.logger.Infof("'%s': drain timeout, cancelling stage\n", name)
+				r.cancel()
+				<-r.done
+			}
+		}(name, r)
+	}
+	wg.Wait()
+	pending := make(map[compiled.StageName][]pendingMessage)
+	for name, r := range stages {
+		if len(r.drainer.pending) > 0 {
+			pending[name] = r.drainer.pending
+		}
+	}
+	return pending
+}
+
+// moveMessages transfers the messages buffered in the replaced links to the
+// new links that transport the same messages. The messages in the other
+// replaced links, or that do not fit the new links, are discarded.
+func (e *execution) moveMessages(
+	chans map[compiled.LinkName]chan state,
+	replaced, moved map[compiled.LinkName]bool,
+) {
+	for name := range replaced {
+		from := e.chans[name]
+		if !moved[name] {
+			if n := len(from); n > 0 {
+				e.logger.Infof("'%s': discarded %d messages\n", name, n)
+			}
+			continue
+		}
+		to := chans[name]
+		for more := true; more; {
+			select {
+			case st := <-from:
+				select {
+				case to <- st:
+				default:
+					e.logger.Infof("'%s': link full, discarded message\n", name)
+				}
+			default:
+				more = false
+			}
+		}
+	}
+}
+
+// pendingToResend returns the pending messages of the drained stages that
+// the restarted stages send before running, with the links of the updated
+// pipeline. The pending messages of the replaced links that do not transport
+// the same messages are discarded.
+func (e *execution) pendingToResend(
+	chans map[compiled.LinkName]chan state,
+	replaced, moved map[compiled.LinkName]bool,
+	pending map[compiled.StageName][]pendingMessage,
+) map[compiled.StageName][]pendingMessage {
+	links := make(map[chan<- state]compiled.LinkName)
+	for name, ch := range e.chans {
+		links[ch] = name
+	}
+	resend := make(map[compiled.StageName][]pendingMessage)
+	for stage, msgs := range pending {
+		for _, p := range msgs {
+			name := links[p.link]
+			if replaced[name] && !moved[name] {
+				e.logger.Infof("'%s': discarded pending message\n", name)
+				continue
+			}
+			p.link = chans[name]
+			resend[stage] = append(resend[stage], p)
+		}
+	}
+	return resend
+}
+
+// resendStage sends the pending messages of the previous instance of a
+// restarted stage before running it, so that they keep their order.
+type resendStage struct {
+	Stage
+	pending []pendingMessage
+}
+
+func (s *resendStage) Run(ctx context.Context) error {
+	drain := drainSignal(ctx)
+	for i, p := range s.pending {
+		select {
+		case p.link <- p.st:
+		case <-drain:
+			for _, rest := range s.pending[i:] {
+				keepPending(ctx, rest.link, rest.st)
+			}
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return s.Stage.Run(ctx)
+}
+
+func pipelineLinks(p *compiled.Pipeline) map[compiled.LinkName]*compiled.Link {
+	links := make(map[compiled.LinkName]*compiled.Link)
+	_ = p.VisitLinks(func(l *compiled.Link) error {
+		links[l.Name()] = l
+		return nil
+	})
+	return links
+}
+
 type runner struct {
-	wg *errgroup.Group
+	wg sync.WaitGroup
 
 	ctx        context.Context
 	cancelFunc context.CancelFunc
+
+	errOnce sync.Once
+	err     error
 }
 
 func newRunner() *runner {
 	ctx, cancel := context.WithCancel(context.Background())
-	wg, ctx := errgroup.WithContext(ctx)
-	return &runner{wg: wg, cancelFunc: cancel, ctx: ctx}
+	return &runner{cancelFunc: cancel, ctx: ctx}
 }
 
-func (r *runner) goWithCtx(f func(context.Context) error) {
-	r.wg.Go(func() error {
-		return f(r.ctx)
-	})
+// goStage runs a stage in its own goroutine. The first error returned by a
+// stage stops all the stages.
+func (r *runner) goStage(s Stage) *runningStage {
+	ctx, cancel := context.WithCancel(r.ctx)
+	drain := make(chan struct{})
+	rs := &runningStage{
+		drain:   drain,
+		drainer: &drainer{signal: drain},
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	ctx = withDrain(ctx, rs.drainer)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(rs.done)
+		defer cancel()
+		if err := s.Run(ctx); err != nil {
+			r.errOnce.Do(func() {
+				r.err = err
+				r.cancelFunc()
+			})
+		}
+	}()
+	return rs
 }
 
 func (r *runner) cancelAndWait() error {
 	r.cancelFunc()
-	return r.wg.Wait()
+	r.wg.Wait()
+	return r.err
 }
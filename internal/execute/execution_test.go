@@ -50,6 +50,153 @@ func TestExecution_Linear(t *testing.T) {
 	}
 }
 
+func TestExecution_Update(t *testing.T) {
+	max := 1000
+	collect := make([]*testValMsg, 0, max)
+	done := make(chan struct{})
+
+	pipelineCfg, methodLoader := setupLinear(t, max, &collect, done)
+
+	compilationCtx := compiled.NewContext(methodLoader)
+	pipeline, err := compiled.New(compilationCtx, pipelineCfg)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	executionBuilder := NewBuilder(logger{debug: true})
+	e, err := executionBuilder(pipeline)
+	if err != nil {
+		t.Fatalf("build error: %s", err)
+	}
+
+	e.Start()
+
+	// Restart the transform and sink stages while messages are flowing.
+	pipelineCfg.Stages[1].Timeout = time.Second
+	pipelineCfg.Links[1].Size = 20
+	updated, err := compiled.New(compilationCtx, pipelineCfg)
+	if err != nil {
+		t.Fatalf("compile updated error: %s", err)
+	}
+	if err := e.Update(updated); err != nil {
+		t.Fatalf("update error: %s", err)
+	}
+
+	<-done
+	if err := e.Stop(); err != nil {
+		t.Fatalf("stop error: %s", err)
+	}
+	if diff := cmp.Diff(max, len(collect)); diff != "" {
+		t.Fatalf("mismatch on number of collected messages:\n%s", diff)
+	}
+	// No messages are lost or repeated during the update.
+	for i, msg := range collect {
+		if diff := cmp.Diff(int64((i+1)*2), msg.Val); diff != "" {
+			t.Fatalf("mismatch on value %d:\n%s", i, diff)
+		}
+	}
+}
+
+func TestExecution_UpdateWhileDraining(t *testing.T) {
+	max := 100
+	collect := make([]*testValMsg, 0, max)
+	done := make(chan struct{})
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	pipelineCfg, linearLoader := setupLinear(t, max, &collect, done)
+	methodLoader := method.ResolveFunc(func(ctx context.Context, address string) (method.Desc, error) {
+		if address != "transform/*/*" {
+			return linearLoader(ctx, address)
+		}
+		return testMethod{
+			D: method.DialFunc(func() (method.Conn, error) {
+				return &blockingTransformConn{entered: entered, release: release}, nil
+			}),
+			In:  testValDesc{},
+			Out: testValDesc{},
+		}, nil
+	})
+
+	compilationCtx := compiled.NewContext(methodLoader)
+	pipeline, err := compiled.New(compilationCtx, pipelineCfg)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	executionBuilder := NewBuilder(logger{debug: true})
+	e, err := executionBuilder(pipeline)
+	if err != nil {
+		t.Fatalf("build error: %s", err)
+	}
+
+	e.Start()
+	<-entered
+
+	// The transform stage is blocked in a call, so it only drains once the
+	// call is released.
+	pipelineCfg.Stages[1].Timeout = time.Second
+	updated, err := compiled.New(compilationCtx, pipelineCfg)
+	if err != nil {
+		t.Fatalf("compile updated error: %s", err)
+	}
+	updateDone := make(chan error, 1)
+	go func() { updateDone <- e.Update(updated) }()
+
+	statusDone := make(chan struct{})
+	go func() {
+		e.(StatusReporter).Status()
+		close(statusDone)
+	}()
+	select {
+	case <-statusDone:
+	case <-time.After(time.Second):
+		t.Fatalf("status blocked by the update")
+	}
+	select {
+	case err := <-updateDone:
+		t.Fatalf("update finished before the stage drained: %v", err)
+	default:
+	}
+
+	close(release)
+	if err := <-updateDone; err != nil {
+		t.Fatalf("update error: %s", err)
+	}
+	<-done
+	if err := e.Stop(); err != nil {
+		t.Fatalf("stop error: %s", err)
+	}
+	// The reply of the blocked call is sent after the update.
+	for i, msg := range collect {
+		if diff := cmp.Diff(int64((i+1)*2), msg.Val); diff != "" {
+			t.Fatalf("mismatch on value %d:\n%s", i, diff)
+		}
+	}
+}
+
+type blockingTransformConn struct {
+	entered chan<- struct{}
+	release <-chan struct{}
+}
+
+func (c *blockingTransformConn) Call(_ context.Context, req message.Instance) (
+	message.Instance,
+	error,
+) {
+	select {
+	case c.entered <- struct{}{}:
+	default:
+	}
+	<-c.release
+	reqMsg, ok := req.(*testValMsg)
+	if !ok {
+		panic("transform request message is not testValMsg")
+	}
+	return &testValMsg{Val: 2 * reqMsg.Val}, nil
+}
+
+func (c *blockingTransformConn) Close() error { return nil }
+
 func setupLinear(
 	t *testing.T, max int, collect *[]*testValMsg, done chan struct{},
 ) (*api.Pipeline, method.ResolveFunc) {
@@ -233,6 +380,104 @@ func TestExecution_SplitAndMerge(t *testing.T) {
 	}
 }
 
+func TestExecution_UpdateSplitAndMergeWhileBlocked(t *testing.T) {
+	max := 100
+	collect := make([]*testTwoValMsg, 0, max)
+	done := make(chan struct{})
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	pipelineCfg, splitAndMergeLoader := setupSplitAndMerge(t, max, &collect, done)
+	methodLoader := method.ResolveFunc(func(ctx context.Context, address string) (method.Desc, error) {
+		if address != "sink/*/*" {
+			return splitAndMergeLoader(ctx, address)
+		}
+		sink, _ := splitAndMergeLoader(ctx, address)
+		return testMethod{
+			D: method.DialFunc(func() (method.Conn, error) {
+				conn, err := sink.Dial()
+				if err != nil {
+					return nil, err
+				}
+				return &blockingSinkConn{Conn: conn, entered: entered, release: release}, nil
+			}),
+			In:  testTwoValDesc{},
+			Out: testEmptyDesc{},
+		}, nil
+	})
+
+	compilationCtx := compiled.NewContext(methodLoader)
+	pipeline, err := compiled.New(compilationCtx, pipelineCfg)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	executionBuilder := NewBuilder(logger{debug: true})
+	e, err := executionBuilder(pipeline)
+	if err != nil {
+		t.Fatalf("build error: %s", err)
+	}
+
+	e.Start()
+	<-entered
+	// Wait for the messages to fill the links, so that the split and merge
+	// stages are blocked sending to their outputs.
+	time.Sleep(100 * time.Millisecond)
+
+	// The changed links restart the split, transform and merge stages, and
+	// grow so that they keep the buffered messages.
+	pipelineCfg.Links[0].Size = 2 * compiled.DefaultLinkSize
+	pipelineCfg.Links[2].Size = 2 * compiled.DefaultLinkSize
+	updated, err := compiled.New(compilationCtx, pipelineCfg)
+	if err != nil {
+		t.Fatalf("compile updated error: %s", err)
+	}
+	updateDone := make(chan error, 1)
+	go func() { updateDone <- e.Update(updated) }()
+	select {
+	case err := <-updateDone:
+		if err != nil {
+			t.Fatalf("update error: %s", err)
+		}
+	case <-time.After(DefaultDrainTimeout / 2):
+		t.Fatalf("update blocked by the stages with blocked outputs")
+	}
+
+	close(release)
+	<-done
+	if err := e.Stop(); err != nil {
+		t.Fatalf("stop error: %s", err)
+	}
+	// The messages of the blocked stages are sent after the update.
+	for i, msg := range collect {
+		if diff := cmp.Diff(int64((i + 1)), msg.Orig.Val); diff != "" {
+			t.Fatalf("mismatch on orig value %d:\n%s", i, diff)
+		}
+		if diff := cmp.Diff(int64((i+1)*3), msg.Transf.Val); diff != "" {
+			t.Fatalf("mismatch on transf value %d:\n%s", i, diff)
+		}
+	}
+}
+
+// blockingSinkConn signals entered on the first call and blocks the calls
+// until release is closed.
+type blockingSinkConn struct {
+	method.Conn
+	entered chan<- struct{}
+	release <-chan struct{}
+}
+
+func (c *blockingSinkConn) Call(ctx context.Context, req message.Instance) (
+	message.Instance,
+	error,
+) {
+	select {
+	case c.entered <- struct{}{}:
+	default:
+	}
+	<-c.release
+	return c.Conn.Call(ctx, req)
+}
+
 func setupSplitAndMerge(
 	t *testing.T, max int, collect *[]*testTwoValMsg, done chan struct{},
 ) (*api.Pipeline, method.ResolveFunc) {
@@ -4,12 +4,16 @@ import (
 	"context"
 
 	"github.com/DuarteMRAlves/maestro/internal/message"
+	"github.com/DuarteMRAlves/maestro/internal/method"
 )
 
 type merge struct {
 	// fields are the names of the fields of the generated message that should
 	// be filled with the collected messages.
 	fields []message.Field
+	// converters transform the collected messages before they are set. A
+	// nil converter keeps the message unchanged.
+	converters []message.Converter
 	// inputs are the several input channels from which to collect the messages.
 	inputs []<-chan state
 	// output is the channel used to send messages to the downstream stage.
@@ -20,47 +24,86 @@ type merge struct {
 
 func newMerge(
 	fields []message.Field,
+	converters []message.Converter,
 	inputs []<-chan state,
 	output chan<- state,
 	gen message.Builder,
 ) Stage {
 	return &merge{
-		fields:  fields,
-		inputs:  inputs,
-		output:  output,
-		builder: gen,
+		fields:     fields,
+		converters: converters,
+		inputs:     inputs,
+		output:     output,
+		builder:    gen,
 	}
 }
 
 func (s *merge) Run(ctx context.Context) error {
+	drain := drainSignal(ctx)
 	for {
 		var (
 			currState state
 			more      bool
 		)
+		if draining(drain) {
+			return nil
+		}
 		// partial is the current message being constructed.
 		partial := s.builder.Build()
+		// md joins the metadata of all the parts, and the id of the first
+		// part correlates the merged message.
+		var (
+			md method.Metadata
+			id string
+		)
 		for i, input := range s.inputs {
+			// The stage is only drained between messages, so that the
+			// received parts are not discarded.
+			var drainNow <-chan struct{}
+			if i == 0 {
+				drainNow = drain
+			}
 			select {
 			case currState, more = <-input:
+			case <-drainNow:
+				return nil
 			case <-ctx.Done():
-				close(s.output)
 				return nil
 			}
 			if !more {
 				close(s.output)
 				return nil
 			}
-			err := partial.Set(s.fields[i], currState.msg)
+			md = method.Join(md, currState.md)
+			if i == 0 {
+				id = currState.id
+			}
+			msg := currState.msg
+			if convert := s.converters[i]; convert != nil {
+				var err error
+				msg, err = convert(msg)
+				if err != nil {
+					return err
+				}
+			}
+			// A single input without a field sets the entire message.
+			if s.fields[i].IsUnspecified() {
+				partial = msg
+				continue
+			}
+			err := partial.Set(s.fields[i], msg)
 			if err != nil {
 				return err
 			}
 		}
-		sendState := newState(partial)
+		sendState := newState(partial).withID(id).withMetadata(md)
 		select {
 		case s.output <- sendState:
+		case <-drain:
+			// The message is sent once the link is updated.
+			keepPending(ctx, s.output, sendState)
+			return nil
 		case <-ctx.Done():
-			close(s.output)
 			return nil
 		}
 	}
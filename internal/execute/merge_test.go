@@ -24,7 +24,7 @@ func TestMergeStage_Run(t *testing.T) {
 
 	builder := message.BuildFunc(func() message.Instance { return &testMergeOuterMessage{} })
 
-	s := newMerge(fields, inputs, output, builder)
+	s := newMerge(fields, make([]message.Converter, len(fields)), inputs, output, builder)
 
 	inputs1 := []*testMergeInnerMessage{{1}, {4}, {7}, {10}}
 	inputs2 := []*testMergeInnerMessage{{2}, {5}, {8}, {11}}
@@ -84,6 +84,64 @@ func TestMergeStage_Run(t *testing.T) {
 	<-done
 }
 
+func TestMergeStage_RunConvert(t *testing.T) {
+	tests := map[string]struct {
+		fields   []message.Field
+		input    *testMergeInnerMessage
+		expected message.Instance
+	}{
+		"field": {
+			fields:   []message.Field{"inner1"},
+			input:    &testMergeInnerMessage{1},
+			expected: &testMergeOuterMessage{inner1: &testMergeInnerMessage{2}},
+		},
+		"entire message": {
+			fields:   []message.Field{""},
+			input:    &testMergeInnerMessage{1},
+			expected: &testMergeInnerMessage{2},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			input := make(chan state, 1)
+			output := make(chan state)
+			builder := message.BuildFunc(func() message.Instance { return &testMergeOuterMessage{} })
+			double := func(msg message.Instance) (message.Instance, error) {
+				inner := msg.(*testMergeInnerMessage)
+				return &testMergeInnerMessage{2 * inner.val}, nil
+			}
+			s := newMerge(
+				tc.fields,
+				[]message.Converter{double},
+				[]<-chan state{input},
+				output,
+				builder,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan struct{})
+			go func() {
+				if err := s.Run(ctx); err != nil {
+					t.Errorf("run error: %s", err)
+				}
+				close(done)
+			}()
+
+			input <- newState(tc.input)
+			out := <-output
+			cmpOpts := cmp.AllowUnexported(
+				state{}, testMergeInnerMessage{}, testMergeOuterMessage{},
+			)
+			if diff := cmp.Diff(newState(tc.expected), out, cmpOpts); diff != "" {
+				t.Fatalf("output mismatch:\n%s", diff)
+			}
+			cancel()
+			<-done
+		})
+	}
+}
+
 type testMergeInnerMessage struct{ val int32 }
 
 func (m *testMergeInnerMessage) Set(_ message.Field, _ message.Instance) error {
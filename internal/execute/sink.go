@@ -1,6 +1,9 @@
 package execute
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
 
 type sink struct {
 	input <-chan state
@@ -11,9 +14,38 @@ func newSink(input <-chan state) Stage {
 }
 
 func (s *sink) Run(ctx context.Context) error {
+	drain := drainSignal(ctx)
 	for {
 		select {
 		case <-s.input:
+		case <-drain:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// outputSink is a sink that sends the received messages to an output.
+type outputSink struct {
+	input  <-chan state
+	output Output
+}
+
+func newOutputSink(input <-chan state, output Output) Stage {
+	return &outputSink{input: input, output: output}
+}
+
+func (s *outputSink) Run(ctx context.Context) error {
+	drain := drainSignal(ctx)
+	for {
+		select {
+		case st := <-s.input:
+			if err := s.output(st.msg); err != nil {
+				return fmt.Errorf("sink: %w", err)
+			}
+		case <-drain:
+			return nil
 		case <-ctx.Done():
 			return nil
 		}
@@ -2,6 +2,11 @@ package execute
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
 
 	"github.com/DuarteMRAlves/maestro/internal/message"
 )
@@ -11,25 +16,93 @@ import (
 type source struct {
 	builder message.Builder
 	output  chan<- state
+	ids     *idGenerator
 }
 
 func newSource(
-	gen message.Builder, output chan<- state,
+	gen message.Builder, output chan<- state, ids *idGenerator,
 ) Stage {
 	return &source{
 		builder: gen,
 		output:  output,
+		ids:     ids,
 	}
 }
 
 func (s *source) Run(ctx context.Context) error {
+	drain := drainSignal(ctx)
 	for {
-		next := newState(s.builder.Build())
+		next := newState(s.builder.Build()).withID(s.ids.next())
 		select {
 		case s.output <- next:
+		case <-drain:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// feedSource is a source that sends the messages of a feed, and stops when
+// the feed has no more messages.
+type feedSource struct {
+	t      message.Type
+	feed   Feed
+	output chan<- state
+	ids    *idGenerator
+}
+
+func newFeedSource(t message.Type, feed Feed, output chan<- state, ids *idGenerator) Stage {
+	return &feedSource{t: t, feed: feed, output: output, ids: ids}
+}
+
+func (s *feedSource) Run(ctx context.Context) error {
+	drain := drainSignal(ctx)
+	for {
+		msg, err := s.feed(s.t)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("source: %w", err)
+		}
+		select {
+		case s.output <- newState(msg).withID(s.ids.next()):
+		case <-drain:
+			return nil
 		case <-ctx.Done():
-			close(s.output)
 			return nil
 		}
 	}
 }
+
+// sourceIDs counts the messages sent by the sources of an execution. It is
+// safe to use concurrently.
+type sourceIDs struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+// generator returns a generator of the ids with the given prefix, which
+// continues the numbering of the previous generators with the same prefix.
+func (ids *sourceIDs) generator(prefix string) *idGenerator {
+	return &idGenerator{prefix: prefix, ids: ids}
+}
+
+// idGenerator creates the correlation ids of the messages of a source,
+// which are its prefix and the number of the message in the order they are
+// sent.
+type idGenerator struct {
+	prefix string
+	ids    *sourceIDs
+}
+
+func (g *idGenerator) next() string {
+	g.ids.mu.Lock()
+	defer g.ids.mu.Unlock()
+	if g.ids.counts == nil {
+		g.ids.counts = make(map[string]uint64)
+	}
+	g.ids.counts[g.prefix]++
+	return g.prefix + "/" + strconv.FormatUint(g.ids.counts[g.prefix], 10)
+}
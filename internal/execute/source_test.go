@@ -0,0 +1,22 @@
+package execute
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSourceIDs(t *testing.T) {
+	var ids sourceIDs
+	first := ids.generator("stage-1")
+	second := ids.generator("stage-2")
+	actual := []string{first.next(), second.next(), first.next()}
+	// A restarted source continues the numbering of the previous one.
+	restarted := ids.generator("stage-1")
+	actual = append(actual, restarted.next())
+
+	expected := []string{"stage-1/1", "stage-2/1", "stage-1/2", "stage-1/3"}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("ids mismatch:\n%s", diff)
+	}
+}
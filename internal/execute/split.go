@@ -30,20 +30,23 @@ func newSplit(
 }
 
 func (s *split) Run(ctx context.Context) error {
+	drain := drainSignal(ctx)
 	for {
 		var currState state
+		if draining(drain) {
+			return nil
+		}
 		select {
 		case currState = <-s.input:
+		case <-drain:
+			return nil
 		case <-ctx.Done():
-			for _, c := range s.outputs {
-				close(c)
-			}
 			return nil
 		}
 		msg := currState.msg
-		for i, out := range s.outputs {
+		sendStates := make([]state, 0, len(s.outputs))
+		for _, field := range s.fields {
 			send := msg
-			field := s.fields[i]
 			if !field.IsUnspecified() {
 				fieldMsg, err := msg.Get(field)
 				if err != nil {
@@ -51,14 +54,19 @@ func (s *split) Run(ctx context.Context) error {
 				}
 				send = fieldMsg
 			}
-			sendState := newState(send)
+			sendStates = append(sendStates, newState(send).withID(currState.id).withMetadata(currState.md))
+		}
+		for i, out := range s.outputs {
 			select {
-			case out <- sendState:
-			case <-ctx.Done():
-				for _, c := range s.outputs {
-					close(c)
+			case out <- sendStates[i]:
+			case <-drain:
+				// The messages are sent once the links are updated.
+				for j := i; j < len(s.outputs); j++ {
+					keepPending(ctx, s.outputs[j], sendStates[j])
 				}
 				return nil
+			case <-ctx.Done():
+				return nil
 			}
 		}
 	}
@@ -91,6 +91,42 @@ func TestSplitStage_Run(t *testing.T) {
 	<-done
 }
 
+func TestSplitStage_RunDrain(t *testing.T) {
+	fields := []message.Field{"inner1", "inner2"}
+	input := make(chan state, 1)
+	// The second output is not read, so its message is pending when the
+	// stage drains.
+	output1 := make(chan state, 1)
+	output2 := make(chan state)
+	s := newSplit(fields, input, []chan<- state{output1, output2})
+
+	drain := make(chan struct{})
+	d := &drainer{signal: drain}
+	ctx := withDrain(context.Background(), d)
+
+	msg := &testSplitOuterMessage{&testSplitInnerMessage{1}, &testSplitInnerMessage{2}, nil}
+	input <- newState(msg).withID("1")
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	<-output1
+	close(drain)
+	if err := <-done; err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+
+	if diff := cmp.Diff(1, len(d.pending)); diff != "" {
+		t.Fatalf("mismatch on number of pending messages:\n%s", diff)
+	}
+	if d.pending[0].link != output2 {
+		t.Fatalf("pending message not kept for the second output")
+	}
+	exp := newState(msg.inner2).withID("1")
+	cmpOpts := cmp.AllowUnexported(state{}, testSplitInnerMessage{})
+	if diff := cmp.Diff(exp, d.pending[0].st, cmpOpts); diff != "" {
+		t.Fatalf("mismatch on pending message:\n%s", diff)
+	}
+}
+
 type testSplitInnerMessage struct{ val int32 }
 
 func (m *testSplitInnerMessage) Set(_ message.Field, _ message.Instance) error {
@@ -4,17 +4,38 @@ import (
 	"fmt"
 
 	"github.com/DuarteMRAlves/maestro/internal/message"
+	"github.com/DuarteMRAlves/maestro/internal/method"
 )
 
 // state defines a structure to store the state of an pipeline.
 type state struct {
+	// id correlates the messages of all the stages that derive from the
+	// same source message.
+	id  string
 	msg message.Instance
+	// md is the metadata propagated from the previous stage, if any.
+	md method.Metadata
 }
 
 func newState(msg message.Instance) state {
 	return state{msg: msg}
 }
 
+// withMetadata returns a copy of the state with the metadata md.
+func (s state) withMetadata(md method.Metadata) state {
+	s.md = md
+	return s
+}
+
+// withID returns a copy of the state with the correlation id.
+func (s state) withID(id string) state {
+	s.id = id
+	return s
+}
+
 func (s state) String() string {
-	return fmt.Sprintf("state{msg:%v}", s.msg)
+	if s.md != nil {
+		return fmt.Sprintf("state{id:%s, msg:%v, md:%v}", s.id, s.msg, s.md)
+	}
+	return fmt.Sprintf("state{id:%s, msg:%v}", s.id, s.msg)
 }
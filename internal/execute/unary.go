@@ -2,11 +2,22 @@ package execute
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/DuarteMRAlves/maestro/internal/compiled"
 	"github.com/DuarteMRAlves/maestro/internal/message"
 	"github.com/DuarteMRAlves/maestro/internal/method"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+)
+
+const (
+	// unavailableBackoff is the initial time between the calls to a server
+	// that is unavailable while its connection is ready.
+	unavailableBackoff = 100 * time.Millisecond
+	// maxUnavailableBackoff is the maximum time between those calls.
+	maxUnavailableBackoff = 5 * time.Second
 )
 
 type unary struct {
@@ -15,43 +26,105 @@ type unary struct {
 	input  <-chan state
 	output chan<- state
 
-	dialer method.Dialer
+	dialer  method.Dialer
+	timeout time.Duration
+	policy  errorPolicy
+	// breaker is nil if the method is always called.
+	breaker *circuitBreaker
+	md      callMetadata
+	// clock measures the time between retries.
+	clock retry.Clock
 
 	logger Logger
 }
 
+// errorPolicy specifies what a stage does with the messages that fail.
+type errorPolicy struct {
+	// skip continues with the next message instead of stopping the stage.
+	skip bool
+	// deadLetter receives the skipped messages, if not nil.
+	deadLetter DeadLetter
+	// retry retries the failed calls before the message fails, if not nil.
+	retry *retry.Policy
+}
+
+// callMetadata specifies the metadata of the calls of a stage.
+type callMetadata struct {
+	// static is sent with every call.
+	static method.Metadata
+	// propagate are the names of the reply metadata sent to the next stage.
+	propagate []string
+}
+
 func newUnary(
 	name compiled.StageName,
 	input <-chan state,
 	output chan<- state,
 	dialer method.Dialer,
+	timeout time.Duration,
+	policy errorPolicy,
+	breaker *circuitBreaker,
+	md callMetadata,
 	logger Logger,
 ) Stage {
 	return &unary{
-		name:   name,
-		input:  input,
-		output: output,
-		dialer: dialer,
-		logger: logger,
+		name:    name,
+		input:   input,
+		output:  output,
+		dialer:  dialer,
+		timeout: timeout,
+		policy:  policy,
+		breaker: breaker,
+		md:      md,
+		clock:   retry.RealClock,
+		logger:  logger,
 	}
 }
 
 func (s *unary) Run(ctx context.Context) error {
 	var (
-		in, out state
-		more    bool
+		in   state
+		more bool
 	)
 	conn, err := s.dialer.Dial()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
+	drain := drainSignal(ctx)
+	healthCtx, cancelHealth := context.WithCancel(ctx)
+	defer cancelHealth()
+	health := s.watchHealth(healthCtx, conn)
 	s.logger.Infof("'%s': started\n", s.name)
 	for {
+		if draining(drain) {
+			s.logger.Infof("'%s': drained\n", s.name)
+			return nil
+		}
+		// Messages are not consumed while the server is unhealthy, so that
+		// they are kept in the input link until the server recovers.
+		if health.curr == method.Unhealthy {
+			select {
+			case h, ok := <-health.updates:
+				health.update(h, ok)
+			case <-drain:
+				s.logger.Infof("'%s': drained\n", s.name)
+				return nil
+			case <-ctx.Done():
+				s.logger.Infof("'%s': finished\n", s.name)
+				return nil
+			}
+			continue
+		}
 		select {
 		case in, more = <-s.input:
+		case h, ok := <-health.updates:
+			health.update(h, ok)
+			continue
+		case <-drain:
+			s.logger.Infof("'%s': drained\n", s.name)
+			return nil
 		case <-ctx.Done():
-			close(s.output)
 			s.logger.Infof("'%s': finished\n", s.name)
 			return nil
 		}
@@ -62,28 +135,193 @@ func (s *unary) Run(ctx context.Context) error {
 			return nil
 		}
 		s.logger.Debugf("'%s': recv msg: %v\n", s.name, in.msg)
-		req := in.msg
-		rep, err := s.call(ctx, conn, req)
+		out, attempts, err := s.callWhenHealthy(ctx, conn, in, health)
 		if err != nil {
-			return err
+			if ctx.Err() != nil {
+				s.logger.Infof("'%s': finished, discarded in-flight message\n", s.name)
+				return nil
+			}
+			if !s.policy.skip {
+				return err
+			}
+			if err := s.skip(in.msg, attempts, err); err != nil {
+				return err
+			}
+			continue
 		}
 
-		out = newState(rep)
 		s.logger.Debugf("'%s': send msg: %v\n", s.name, out.msg)
 		select {
 		case s.output <- out:
+		case <-drain:
+			// The message is sent once the link is updated.
+			keepPending(ctx, s.output, out)
+			s.logger.Infof("'%s': drained\n", s.name)
+			return nil
 		case <-ctx.Done():
-			close(s.output)
-			s.logger.Infof("'%s': finished\n", s.name)
+			s.logger.Infof("'%s': finished, discarded in-flight message\n", s.name)
 			return nil
 		}
 	}
 }
 
-func (s *unary) call(
-	ctx context.Context, conn method.Conn, req message.Instance,
-) (message.Instance, error) {
-	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+// skip sends the failed message to the dead letter, if any.
+func (s *unary) skip(req message.Instance, attempts int, err error) error {
+	s.logger.Infof("'%s': skipped failed message: %s\n", s.name, err)
+	if s.policy.deadLetter == nil {
+		return nil
+	}
+	failed := FailedMessage{Stage: s.name, Request: req, Err: err, Attempts: attempts}
+	if err := s.policy.deadLetter(failed); err != nil {
+		return fmt.Errorf("dead letter: %w", err)
+	}
+	return nil
+}
+
+// callWhenHealthy calls the method and, if the server is unavailable and its
+// health is monitored, retries the call after a backoff, or once the server
+// recovers if it is reported unhealthy.
+// Other failed calls are retried according to the retry policy, if any. It
+// returns the number of times the method was called.
+func (s *unary) callWhenHealthy(
+	ctx context.Context, conn method.Conn, in state, health *stageHealth,
+) (state, int, error) {
+	var (
+		retrier *retry.Retrier
+		// backoff is the time between the calls while the server is
+		// unavailable but not reported unhealthy.
+		backoff *retry.ExponentialBackoff
+	)
+	if s.policy.retry != nil {
+		retrier = s.policy.retry.NewRetrier(s.clock)
+	}
+	for attempts := 1; ; attempts++ {
+		out, err := s.call(ctx, conn, in)
+		if err == nil {
+			return out, attempts, nil
+		}
+		if !errors.Is(err, method.ErrUnavailable) || health.updates == nil {
+			if retrier == nil || !retrier.Wait(ctx, attempts, err) {
+				return state{}, attempts, err
+			}
+			s.logger.Debugf("'%s': retry failed call %d: %s\n", s.name, attempts, err)
+			continue
+		}
+		// The server may be unavailable while the connection is ready, and
+		// then the health does not change. The call is retried after a
+		// backoff, unless the server is reported unhealthy before.
+		if health.curr != method.Unhealthy {
+			if backoff == nil {
+				b := retry.NewExponentialBackoff(unavailableBackoff, 2).WithMax(maxUnavailableBackoff)
+				backoff = &b
+			}
+			s.logger.Debugf("'%s': retry unavailable call %d: %s\n", s.name, attempts, err)
+			select {
+			case h, ok := <-health.updates:
+				health.update(h, ok)
+			case <-s.clock.After(backoff.Next()):
+			case <-ctx.Done():
+				return state{}, attempts, ctx.Err()
+			}
+			if health.updates == nil {
+				return state{}, attempts, err
+			}
+		}
+		for health.curr == method.Unhealthy {
+			select {
+			case h, ok := <-health.updates:
+				health.update(h, ok)
+			case <-ctx.Done():
+				return state{}, attempts, ctx.Err()
+			}
+			if health.updates == nil {
+				return state{}, attempts, err
+			}
+		}
+	}
+}
+
+// call calls the method through the circuit breaker, if any. The breaker
+// may wait to let the call through, which is not part of the call timeout.
+// The static metadata of the stage is sent with the metadata propagated from
+// the previous stage, and takes precedence over it. The reply keeps the
+// correlation id of the received message.
+func (s *unary) call(ctx context.Context, conn method.Conn, in state) (state, error) {
+	if s.breaker != nil {
+		if err := s.breaker.allow(ctx); err != nil {
+			return state{}, err
+		}
+	}
+	callCtx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
-	return conn.Call(ctx, req)
+	if in.id != "" {
+		callCtx = method.WithCorrelationID(callCtx, in.id)
+	}
+	var (
+		rep   message.Instance
+		repMD method.Metadata
+		err   error
+	)
+	if caller, ok := conn.(method.MetadataCaller); ok {
+		md := method.Join(s.md.static, in.md)
+		rep, repMD, err = caller.CallWithMetadata(callCtx, in.msg, md)
+	} else {
+		rep, err = conn.Call(callCtx, in.msg)
+	}
+	// Calls canceled because the stage stopped say nothing about the method.
+	if s.breaker != nil && ctx.Err() == nil {
+		s.breaker.record(err != nil)
+	}
+	if err != nil {
+		return state{}, err
+	}
+	return newState(rep).withID(in.id).withMetadata(repMD.Select(s.md.propagate)), nil
+}
+
+// BreakerState returns the state of the circuit breaker of the stage, or
+// false if the stage does not have one.
+func (s *unary) BreakerState() (BreakerState, bool) {
+	if s.breaker == nil {
+		return "", false
+	}
+	return s.breaker.State(), true
+}
+
+// stageHealth tracks the health of the server of a stage.
+type stageHealth struct {
+	name compiled.StageName
+	// updates is nil if the health is not monitored.
+	updates <-chan method.Health
+	curr    method.Health
+	logger  Logger
+}
+
+// watchHealth starts monitoring the health of the server if the connection
+// supports it.
+func (s *unary) watchHealth(ctx context.Context, conn method.Conn) *stageHealth {
+	h := &stageHealth{name: s.name, curr: method.HealthUnknown, logger: s.logger}
+	if w, ok := conn.(method.HealthWatcher); ok {
+		h.updates = w.WatchHealth(ctx)
+	}
+	return h
+}
+
+func (h *stageHealth) update(health method.Health, ok bool) {
+	if !ok {
+		// The health is no longer monitored.
+		h.updates = nil
+		h.curr = method.HealthUnknown
+		return
+	}
+	switch {
+	case health == h.curr:
+		return
+	case health == method.Unhealthy:
+		h.logger.Infof("'%s': server unhealthy, pausing\n", h.name)
+	case health == method.Healthy && h.curr == method.Unhealthy:
+		h.logger.Infof("'%s': server healthy, resuming\n", h.name)
+	default:
+		h.logger.Infof("'%s': server %s\n", h.name, health)
+	}
+	h.curr = health
 }
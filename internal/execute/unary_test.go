@@ -2,13 +2,21 @@ package execute
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/DuarteMRAlves/maestro/internal/compiled"
 	"github.com/DuarteMRAlves/maestro/internal/message"
 	"github.com/DuarteMRAlves/maestro/internal/method"
+	"github.com/DuarteMRAlves/maestro/internal/record"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestUnaryStage_Run(t *testing.T) {
@@ -29,7 +37,7 @@ func TestUnaryStage_Run(t *testing.T) {
 
 	name := createStageName(t, "test-stage")
 	dialer := testDialer{}
-	stage := newUnary(name, input, output, dialer, logger{debug: true})
+	stage := newUnary(name, input, output, dialer, time.Minute, errorPolicy{}, nil, callMetadata{}, logger{debug: true})
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -74,6 +82,55 @@ func TestUnaryStage_Run(t *testing.T) {
 	}
 }
 
+func TestUnaryStage_RunDrain(t *testing.T) {
+	input := make(chan state, 1)
+	// The output is not read, so the reply is pending when the stage drains.
+	output := make(chan state)
+	called := make(chan struct{})
+
+	name := createStageName(t, "test-stage")
+	dialer := testDesc{conn: &testSignalConn{called: called}}
+	stage := newUnary(name, input, output, dialer, time.Minute, errorPolicy{}, nil, callMetadata{}, logger{debug: true})
+
+	drain := make(chan struct{})
+	d := &drainer{signal: drain}
+	ctx := withDrain(context.Background(), d)
+
+	input <- newState(testUnaryMessage{"val1"}).withID("1")
+	stageDone := make(chan error)
+	go func() { stageDone <- stage.Run(ctx) }()
+	<-called
+	close(drain)
+	if err := <-stageDone; err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+
+	if diff := cmp.Diff(1, len(d.pending)); diff != "" {
+		t.Fatalf("mismatch on number of pending messages:\n%s", diff)
+	}
+	if d.pending[0].link != output {
+		t.Fatalf("pending message not kept for the output link")
+	}
+	exp := newState(testUnaryMessage{"val1val1"}).withID("1")
+	cmpOpts := cmp.AllowUnexported(state{}, testUnaryMessage{})
+	if diff := cmp.Diff(exp, d.pending[0].st, cmpOpts); diff != "" {
+		t.Fatalf("mismatch on pending message:\n%s", diff)
+	}
+}
+
+type testSignalConn struct {
+	testUnaryConn
+	called chan struct{}
+}
+
+func (c *testSignalConn) Call(ctx context.Context, req message.Instance) (
+	message.Instance,
+	error,
+) {
+	defer close(c.called)
+	return c.testUnaryConn.Call(ctx, req)
+}
+
 func createStageName(t *testing.T, name string) compiled.StageName {
 	stageName, err := compiled.NewStageName(name)
 	if err != nil {
@@ -111,3 +168,380 @@ func (c testUnaryConn) Call(_ context.Context, req message.Instance) (
 }
 
 func (c testUnaryConn) Close() error { return nil }
+
+func TestUnaryStage_RunHealth(t *testing.T) {
+	input := make(chan state, 1)
+	output := make(chan state, 1)
+
+	conn := &testHealthConn{
+		health:      make(chan method.Health),
+		unavailable: 1,
+	}
+	dialer := method.DialFunc(func() (method.Conn, error) { return conn, nil })
+	name := createStageName(t, "test-stage")
+	stage := newUnary(name, input, output, dialer, time.Minute, errorPolicy{}, nil, callMetadata{}, logger{debug: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stageDone := make(chan struct{})
+	go func() {
+		if err := stage.Run(ctx); err != nil {
+			t.Errorf("run error: %s", err)
+		}
+		close(stageDone)
+	}()
+
+	cmpOpts := cmp.AllowUnexported(state{}, testUnaryMessage{})
+	conn.health <- method.Healthy
+
+	// The first call fails as the server is unavailable while the
+	// connection is healthy, and is retried after a backoff.
+	input <- newState(testUnaryMessage{"val1"})
+	expected := newState(testUnaryMessage{"val1val1"})
+	if diff := cmp.Diff(expected, <-output, cmpOpts); diff != "" {
+		t.Fatalf("mismatch on message 1:\n%s", diff)
+	}
+
+	// Messages are not consumed while the server is unhealthy.
+	conn.health <- method.Unhealthy
+	input <- newState(testUnaryMessage{"val2"})
+	time.Sleep(50 * time.Millisecond)
+	if diff := cmp.Diff(1, len(input)); diff != "" {
+		t.Fatalf("message consumed while unhealthy:\n%s", diff)
+	}
+	conn.health <- method.Healthy
+	expected = newState(testUnaryMessage{"val2val2"})
+	if diff := cmp.Diff(expected, <-output, cmpOpts); diff != "" {
+		t.Fatalf("mismatch on message 2:\n%s", diff)
+	}
+
+	cancel()
+	<-stageDone
+}
+
+func TestUnaryStage_RunUnavailableUntilHealthy(t *testing.T) {
+	input := make(chan state, 1)
+	output := make(chan state, 1)
+
+	conn := &testHealthConn{
+		health:      make(chan method.Health),
+		unavailable: 1,
+	}
+	dialer := method.DialFunc(func() (method.Conn, error) { return conn, nil })
+	name := createStageName(t, "test-stage")
+	stage := newUnary(name, input, output, dialer, time.Minute, errorPolicy{}, nil, callMetadata{}, logger{debug: true})
+	// The backoff never ends, so that the call is only retried once the
+	// server is healthy.
+	stage.(*unary).clock = newTestClock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stageDone := make(chan struct{})
+	go func() {
+		if err := stage.Run(ctx); err != nil {
+			t.Errorf("run error: %s", err)
+		}
+		close(stageDone)
+	}()
+
+	conn.health <- method.Healthy
+	input <- newState(testUnaryMessage{"val1"})
+	conn.health <- method.Unhealthy
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case out := <-output:
+		t.Fatalf("message sent while unhealthy: %v", out)
+	default:
+	}
+	conn.health <- method.Healthy
+	cmpOpts := cmp.AllowUnexported(state{}, testUnaryMessage{})
+	expected := newState(testUnaryMessage{"val1val1"})
+	if diff := cmp.Diff(expected, <-output, cmpOpts); diff != "" {
+		t.Fatalf("mismatch on message:\n%s", diff)
+	}
+
+	cancel()
+	<-stageDone
+}
+
+// testHealthConn fails the first calls with method.ErrUnavailable and
+// reports the health sent by the test.
+type testHealthConn struct {
+	testUnaryConn
+	health      chan method.Health
+	unavailable int
+}
+
+func (c *testHealthConn) Call(ctx context.Context, req message.Instance) (
+	message.Instance,
+	error,
+) {
+	if c.unavailable > 0 {
+		c.unavailable--
+		return nil, fmt.Errorf("call: %w", method.ErrUnavailable)
+	}
+	return c.testUnaryConn.Call(ctx, req)
+}
+
+func (c *testHealthConn) WatchHealth(context.Context) <-chan method.Health {
+	return c.health
+}
+
+func TestUnaryStage_RunSkip(t *testing.T) {
+	input := make(chan state, 2)
+	output := make(chan state, 2)
+
+	callErr := errors.New("call failed")
+	dialer := method.DialFunc(func() (method.Conn, error) {
+		return testFailConn{fail: "bad", err: callErr}, nil
+	})
+	var failed []FailedMessage
+	policy := errorPolicy{
+		skip: true,
+		deadLetter: func(msg FailedMessage) error {
+			failed = append(failed, msg)
+			return nil
+		},
+	}
+	name := createStageName(t, "test-stage")
+	stage := newUnary(name, input, output, dialer, time.Minute, policy, nil, callMetadata{}, logger{debug: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stageDone := make(chan struct{})
+	go func() {
+		if err := stage.Run(ctx); err != nil {
+			t.Errorf("run error: %s", err)
+		}
+		close(stageDone)
+	}()
+
+	// The failed message is skipped and the next one is processed.
+	input <- newState(testUnaryMessage{"bad"})
+	input <- newState(testUnaryMessage{"val"})
+	cmpOpts := cmp.AllowUnexported(state{}, testUnaryMessage{})
+	expected := newState(testUnaryMessage{"valval"})
+	if diff := cmp.Diff(expected, <-output, cmpOpts); diff != "" {
+		t.Fatalf("mismatch on message:\n%s", diff)
+	}
+	cancel()
+	<-stageDone
+
+	expectedFailed := []FailedMessage{{
+		Stage:    name,
+		Request:  testUnaryMessage{"bad"},
+		Err:      callErr,
+		Attempts: 1,
+	}}
+	cmpOpts = cmp.Options{
+		cmp.AllowUnexported(compiled.StageName{}, testUnaryMessage{}),
+		cmpopts.EquateErrors(),
+	}
+	if diff := cmp.Diff(expectedFailed, failed, cmpOpts); diff != "" {
+		t.Fatalf("mismatch on failed messages:\n%s", diff)
+	}
+}
+
+// testFailConn fails the calls with the given request value.
+type testFailConn struct {
+	testUnaryConn
+	fail string
+	err  error
+}
+
+func (c testFailConn) Call(ctx context.Context, req message.Instance) (
+	message.Instance,
+	error,
+) {
+	if req.(testUnaryMessage).val == c.fail {
+		return nil, c.err
+	}
+	return c.testUnaryConn.Call(ctx, req)
+}
+
+func TestUnaryStage_RunRetry(t *testing.T) {
+	input := make(chan state, 1)
+	output := make(chan state, 1)
+
+	unavailable := status.Error(codes.Unavailable, "server down")
+	conn := &testRetryConn{errs: []error{unavailable, unavailable}}
+	dialer := method.DialFunc(func() (method.Conn, error) { return conn, nil })
+	policy := errorPolicy{
+		retry: &retry.Policy{
+			MaxAttempts: 3,
+			Backoff:     *retry.NewExponentialBackoff(100*time.Millisecond, 2),
+			Codes:       []codes.Code{codes.Unavailable},
+		},
+	}
+	name := createStageName(t, "test-stage")
+	stage := newUnary(name, input, output, dialer, time.Minute, policy, nil, callMetadata{}, logger{debug: true})
+	clock := &testClock{auto: true}
+	stage.(*unary).clock = clock
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stageDone := make(chan struct{})
+	go func() {
+		if err := stage.Run(ctx); err != nil {
+			t.Errorf("run error: %s", err)
+		}
+		close(stageDone)
+	}()
+
+	input <- newState(testUnaryMessage{"val"})
+	cmpOpts := cmp.AllowUnexported(state{}, testUnaryMessage{})
+	expected := newState(testUnaryMessage{"valval"})
+	if diff := cmp.Diff(expected, <-output, cmpOpts); diff != "" {
+		t.Fatalf("mismatch on message:\n%s", diff)
+	}
+	cancel()
+	<-stageDone
+
+	expectedWaits := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}
+	if diff := cmp.Diff(expectedWaits, clock.waits); diff != "" {
+		t.Fatalf("mismatch on waits:\n%s", diff)
+	}
+}
+
+// testRetryConn fails the first calls with the given errors.
+type testRetryConn struct {
+	testUnaryConn
+	errs []error
+}
+
+func (c *testRetryConn) Call(ctx context.Context, req message.Instance) (
+	message.Instance,
+	error,
+) {
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return nil, err
+	}
+	return c.testUnaryConn.Call(ctx, req)
+}
+
+func TestUnaryStage_RunMetadata(t *testing.T) {
+	tests := map[string]func(t *testing.T, conn method.Conn) method.Dialer{
+		"direct": func(_ *testing.T, conn method.Conn) method.Dialer {
+			return method.DialFunc(func() (method.Conn, error) { return conn, nil })
+		},
+		// Recorded connections must send and receive the same metadata.
+		"recorded": func(t *testing.T, conn method.Conn) method.Dialer {
+			resolver := method.ResolveFunc(func(context.Context, string) (method.Desc, error) {
+				return testDesc{conn: conn}, nil
+			})
+			rec, err := record.NewRecorder(t.TempDir(), testCodec{}, resolver, logger{})
+			if err != nil {
+				t.Fatalf("create recorder: %s", err)
+			}
+			t.Cleanup(func() { _ = rec.Close() })
+			desc, err := rec.Resolve(context.Background(), "test")
+			if err != nil {
+				t.Fatalf("resolve: %s", err)
+			}
+			return desc
+		},
+	}
+	for name, dialer := range tests {
+		t.Run(name, func(t *testing.T) {
+			testRunMetadata(t, dialer)
+		})
+	}
+}
+
+func testRunMetadata(t *testing.T, newDialer func(*testing.T, method.Conn) method.Dialer) {
+	input := make(chan state, 1)
+	output := make(chan state, 1)
+
+	conn := &testMetadataConn{}
+	dialer := newDialer(t, conn)
+	name := createStageName(t, "test-stage")
+	md := callMetadata{
+		static:    method.Metadata{"x-api-key": {"key"}, "x-tenant": {"static"}},
+		propagate: []string{"x-request-id"},
+	}
+	stage := newUnary(name, input, output, dialer, time.Minute, errorPolicy{}, nil, md, logger{debug: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stageDone := make(chan struct{})
+	go func() {
+		if err := stage.Run(ctx); err != nil {
+			t.Errorf("run error: %s", err)
+		}
+		close(stageDone)
+	}()
+
+	// The static metadata takes precedence over the propagated one, and only
+	// the selected reply metadata is propagated.
+	propagated := method.Metadata{"x-tenant": {"propagated"}, "x-request-id": {"1"}}
+	input <- newState(testUnaryMessage{"val"}).withID("7").withMetadata(propagated)
+	out := <-output
+	cancel()
+	<-stageDone
+
+	expectedSent := method.Metadata{
+		"x-api-key":    {"key"},
+		"x-tenant":     {"static"},
+		"x-request-id": {"1"},
+	}
+	if diff := cmp.Diff(expectedSent, conn.sent); diff != "" {
+		t.Fatalf("mismatch on sent metadata:\n%s", diff)
+	}
+	// The correlation id is sent with the call and kept in the reply.
+	if diff := cmp.Diff("7", conn.correlation); diff != "" {
+		t.Fatalf("mismatch on correlation id:\n%s", diff)
+	}
+	expected := newState(testUnaryMessage{"valval"}).withID("7").
+		withMetadata(method.Metadata{"x-request-id": {"1"}})
+	cmpOpts := cmp.AllowUnexported(state{}, testUnaryMessage{})
+	if diff := cmp.Diff(expected, out, cmpOpts); diff != "" {
+		t.Fatalf("mismatch on message:\n%s", diff)
+	}
+}
+
+// testDesc is the description of a method that dials conn.
+type testDesc struct{ conn method.Conn }
+
+func (d testDesc) Dial() (method.Conn, error) { return d.conn, nil }
+
+func (d testDesc) Input() message.Type { return nil }
+
+func (d testDesc) Output() message.Type { return nil }
+
+// testCodec encodes the test messages as json strings.
+type testCodec struct{}
+
+func (c testCodec) MarshalMessage(m message.Instance) ([]byte, error) {
+	return json.Marshal(m.(testUnaryMessage).val)
+}
+
+func (c testCodec) UnmarshalMessage(data []byte, _ message.Type) (message.Instance, error) {
+	var m testUnaryMessage
+	return m, json.Unmarshal(data, &m.val)
+}
+
+func (c testCodec) MarshalMethod(method.Desc) ([]byte, error) { return []byte("{}"), nil }
+
+func (c testCodec) UnmarshalMethod([]byte) (method.Desc, error) { return testDesc{}, nil }
+
+// testMetadataConn records the metadata sent with the calls and replies
+// with the same metadata plus a trailer.
+type testMetadataConn struct {
+	testUnaryConn
+	sent        method.Metadata
+	correlation string
+}
+
+func (c *testMetadataConn) CallWithMetadata(
+	ctx context.Context, req message.Instance, md method.Metadata,
+) (message.Instance, method.Metadata, error) {
+	c.sent = md
+	c.correlation = method.CorrelationID(ctx)
+	rep, err := c.testUnaryConn.Call(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rep, method.Join(md, method.Metadata{"x-trailer": {"t"}}), nil
+}
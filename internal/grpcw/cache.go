@@ -0,0 +1,127 @@
+package grpcw
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// CachePolicy specifies how the resolver uses the descriptor cache.
+type CachePolicy int
+
+const (
+	// CachePrefer uses the cached descriptors when they exist, and only
+	// uses reflection for the services that are not cached.
+	CachePrefer CachePolicy = iota
+	// CacheFallback uses reflection and only uses the cached descriptors
+	// when the server is unreachable.
+	CacheFallback
+	// CacheRefresh always uses reflection and updates the cache.
+	CacheRefresh
+)
+
+// ErrNotCached is returned when the descriptors of a service are not cached.
+var ErrNotCached = errors.New("descriptors not cached")
+
+// CacheEntry stores the file descriptors of a service, as returned by the
+// reflection service.
+type CacheEntry struct {
+	Address Address `json:"address"`
+	// Service is the requested service, which may be unspecified.
+	Service Service `json:"service"`
+	// Resolved is the full name of the service the descriptors describe.
+	Resolved Service `json:"resolved"`
+	// Hash is the sha256 of the files and changes only if the descriptors
+	// change.
+	Hash string `json:"hash"`
+	// Files are the serialized file descriptors, with their dependencies.
+	Files [][]byte `json:"files"`
+}
+
+// DescriptorCache stores the descriptors of the services in a directory,
+// with one file for each address and service.
+type DescriptorCache struct {
+	dir string
+}
+
+func NewDescriptorCache(dir string) *DescriptorCache {
+	return &DescriptorCache{dir: dir}
+}
+
+// Get returns the cached descriptors of the service at address. It returns
+// ErrNotCached if the descriptors are not in the cache.
+func (c *DescriptorCache) Get(address Address, service Service) (*CacheEntry, error) {
+	data, err := os.ReadFile(c.path(address, service))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotCached
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read cache: %w", err)
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("read cache: %w", err)
+	}
+	if hash := filesHash(entry.Files); hash != entry.Hash {
+		return nil, &corruptedCacheEntry{expected: entry.Hash, actual: hash}
+	}
+	return &entry, nil
+}
+
+// Put stores the descriptors in the cache, setting their hash. It reports
+// whether the cache changed, which does not happen if the same descriptors
+// were already cached.
+func (c *DescriptorCache) Put(entry *CacheEntry) (bool, error) {
+	entry.Hash = filesHash(entry.Files)
+	prev, err := c.Get(entry.Address, entry.Service)
+	if err == nil && prev.Hash == entry.Hash && prev.Resolved == entry.Resolved {
+		return false, nil
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return false, fmt.Errorf("write cache: %w", err)
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return false, fmt.Errorf("write cache: %w", err)
+	}
+	if err := os.WriteFile(c.path(entry.Address, entry.Service), data, 0644); err != nil {
+		return false, fmt.Errorf("write cache: %w", err)
+	}
+	return true, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// path returns the file of the cache entry. The name is readable, and ends
+// with a hash of the key so that different keys never share a file.
+func (c *DescriptorCache) path(address Address, service Service) string {
+	key := fmt.Sprintf("%s/%s", address, service)
+	sum := sha256.Sum256([]byte(key))
+	name := unsafeFileChars.ReplaceAllString(key, "_")
+	return filepath.Join(c.dir, fmt.Sprintf("%s-%s.json", name, hex.EncodeToString(sum[:4])))
+}
+
+func filesHash(files [][]byte) string {
+	h := sha256.New()
+	for _, f := range files {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(f)))
+		h.Write(size[:])
+		h.Write(f)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+type corruptedCacheEntry struct {
+	expected, actual string
+}
+
+func (err *corruptedCacheEntry) Error() string {
+	return fmt.Sprintf("corrupted cache entry: expected hash %s but found %s", err.expected, err.actual)
+}
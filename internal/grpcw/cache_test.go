@@ -0,0 +1,137 @@
+package grpcw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/logs"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+func TestDescriptorCache(t *testing.T) {
+	cache := NewDescriptorCache(t.TempDir())
+
+	if _, err := cache.Get("localhost:8080", "Service"); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("expected not cached error, got %v", err)
+	}
+
+	entry := &CacheEntry{
+		Address:  "localhost:8080",
+		Service:  "*",
+		Resolved: "pkg.Service",
+		Files:    [][]byte{[]byte("file-1"), []byte("file-2")},
+	}
+	changed, err := cache.Put(entry)
+	if err != nil {
+		t.Fatalf("put error: %s", err)
+	}
+	if !changed {
+		t.Fatalf("expected changed cache on first put")
+	}
+	actual, err := cache.Get("localhost:8080", "*")
+	if err != nil {
+		t.Fatalf("get error: %s", err)
+	}
+	if diff := cmp.Diff(entry, actual); diff != "" {
+		t.Fatalf("entry mismatch:\n%s", diff)
+	}
+
+	same := &CacheEntry{
+		Address:  "localhost:8080",
+		Service:  "*",
+		Resolved: "pkg.Service",
+		Files:    [][]byte{[]byte("file-1"), []byte("file-2")},
+	}
+	changed, err = cache.Put(same)
+	if err != nil {
+		t.Fatalf("put error: %s", err)
+	}
+	if changed {
+		t.Fatalf("expected unchanged cache for the same descriptors")
+	}
+
+	// Entries for other services are stored separately.
+	if _, err := cache.Get("localhost:8080", "pkg.Service"); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("expected not cached error, got %v", err)
+	}
+}
+
+func TestDescriptorCache_Corrupted(t *testing.T) {
+	cache := NewDescriptorCache(t.TempDir())
+	entry := &CacheEntry{Address: "localhost:8080", Service: "*", Files: [][]byte{[]byte("file")}}
+	if _, err := cache.Put(entry); err != nil {
+		t.Fatalf("put error: %s", err)
+	}
+	// Change the files without updating the hash.
+	entry.Files = [][]byte{[]byte("changed")}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("marshal: %s", err)
+	}
+	if err := os.WriteFile(cache.path("localhost:8080", "*"), data, 0644); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	var corrupted *corruptedCacheEntry
+	if _, err := cache.Get("localhost:8080", "*"); !errors.As(err, &corrupted) {
+		t.Fatalf("expected corrupted entry error, got %v", err)
+	}
+}
+
+func TestReflectionResolver_Cache(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	s := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	reflection.Register(s)
+	go func() { _ = s.Serve(lis) }()
+
+	address := lis.Addr().String() + "/grpc.health.v1.Health/Check"
+	cache := NewDescriptorCache(t.TempDir())
+	newResolver := func(policy CachePolicy) *ReflectionResolver {
+		r, err := NewReflectionResolver(time.Second, retry.ExponentialBackoff{}, logs.New(false))
+		if err != nil {
+			t.Fatalf("create resolver: %s", err)
+		}
+		r.UseCache(cache, policy)
+		return r
+	}
+
+	ctx := context.Background()
+	entry, changed, err := newResolver(CacheRefresh).Pull(ctx, address)
+	if err != nil {
+		t.Fatalf("pull error: %s", err)
+	}
+	if !changed {
+		t.Fatalf("expected changed cache on first pull")
+	}
+	if diff := cmp.Diff(Service("grpc.health.v1.Health"), entry.Resolved); diff != "" {
+		t.Fatalf("resolved service mismatch:\n%s", diff)
+	}
+	if _, changed, err = newResolver(CacheRefresh).Pull(ctx, address); err != nil || changed {
+		t.Fatalf("expected unchanged cache on second pull, got changed %t, err %v", changed, err)
+	}
+
+	// The server is stopped, so methods can only be resolved from the
+	// cache.
+	s.Stop()
+	for _, policy := range []CachePolicy{CachePrefer, CacheFallback} {
+		if _, err := newResolver(policy).Resolve(ctx, address); err != nil {
+			t.Fatalf("policy %d: resolve error: %s", policy, err)
+		}
+	}
+	if _, err := newResolver(CacheRefresh).Resolve(ctx, address); err == nil {
+		t.Fatalf("expected error when refreshing with the server stopped")
+	}
+}
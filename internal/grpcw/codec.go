@@ -0,0 +1,128 @@
+package grpcw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/DuarteMRAlves/maestro/internal/message"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var (
+	errNotGrpcType        = errors.New("type is not grpc")
+	errNotGrpcMethod      = errors.New("method is not grpc")
+	errNoMethodDescriptor = errors.New("method has no descriptor")
+)
+
+// Codec serializes grpc messages and methods so that they can be stored and
+// later restored without contacting the servers that define them.
+type Codec struct{}
+
+// MarshalMessage encodes a message in the protobuf json format.
+func (c Codec) MarshalMessage(msg message.Instance) ([]byte, error) {
+	inst, ok := msg.(messageInstance)
+	if !ok {
+		return nil, errNotGrpcMessage
+	}
+	return protojson.Marshal(inst.m.Interface())
+}
+
+// UnmarshalMessage decodes a message of type t in the protobuf json format.
+func (c Codec) UnmarshalMessage(data []byte, t message.Type) (message.Instance, error) {
+	typ, ok := t.(messageType)
+	if !ok {
+		return nil, errNotGrpcType
+	}
+	m := typ.t.New()
+	if err := protojson.Unmarshal(data, m.Interface()); err != nil {
+		return nil, err
+	}
+	return messageInstance{m: m}, nil
+}
+
+type methodData struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	// Files is a serialized descriptorpb.FileDescriptorSet with the file
+	// defining the method and all its dependencies.
+	Files []byte `json:"files"`
+}
+
+// MarshalMethod encodes a method, including the descriptors of all the
+// files required to define it.
+func (c Codec) MarshalMethod(desc method.Desc) ([]byte, error) {
+	m, ok := desc.(unaryMethod)
+	if !ok {
+		return nil, errNotGrpcMethod
+	}
+	if m.desc == nil {
+		return nil, errNoMethodDescriptor
+	}
+	set := fileDescriptorSet(m.desc.ParentFile())
+	files, err := proto.Marshal(set)
+	if err != nil {
+		return nil, fmt.Errorf("marshal method %s: %w", m.desc.FullName(), err)
+	}
+	data := methodData{
+		Name:    string(m.desc.FullName()),
+		Address: m.address,
+		Files:   files,
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalMethod decodes a method encoded with MarshalMethod.
+func (c Codec) UnmarshalMethod(data []byte) (method.Desc, error) {
+	var (
+		md  methodData
+		set descriptorpb.FileDescriptorSet
+	)
+	if err := json.Unmarshal(data, &md); err != nil {
+		return nil, fmt.Errorf("unmarshal method: %w", err)
+	}
+	if err := proto.Unmarshal(md.Files, &set); err != nil {
+		return nil, fmt.Errorf("unmarshal method %s: %w", md.Name, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal method %s: %w", md.Name, err)
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(md.Name))
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal method %s: %w", md.Name, err)
+	}
+	desc, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("unmarshal method %s: not a method", md.Name)
+	}
+	return newUnaryMethodFromDescriptor(desc, md.Address), nil
+}
+
+// fileDescriptorSet creates a set with the given file and all its transitive
+// dependencies, ordered so that each file appears after its dependencies.
+func fileDescriptorSet(f protoreflect.FileDescriptor) *descriptorpb.FileDescriptorSet {
+	var (
+		set   descriptorpb.FileDescriptorSet
+		visit func(f protoreflect.FileDescriptor)
+	)
+	seen := make(map[string]bool)
+	visit = func(f protoreflect.FileDescriptor) {
+		if seen[f.Path()] {
+			return
+		}
+		seen[f.Path()] = true
+		imports := f.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			visit(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(f))
+	}
+	visit(f)
+	return &set
+}
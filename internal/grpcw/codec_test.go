@@ -0,0 +1,67 @@
+package grpcw
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCodec_Message(t *testing.T) {
+	var codec Codec
+	desc := grpc_health_v1.File_grpc_health_v1_health_proto.Services().Get(0).Methods().ByName("Check")
+	m := newUnaryMethodFromDescriptor(desc, "localhost:50051")
+
+	req := &grpc_health_v1.HealthCheckRequest{Service: "service"}
+	data, err := codec.MarshalMessage(messageInstance{m: req.ProtoReflect()})
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+	inst, err := codec.UnmarshalMessage(data, m.Input())
+	if err != nil {
+		t.Fatalf("unmarshal error: %s", err)
+	}
+	actual := &grpc_health_v1.HealthCheckRequest{}
+	b, err := proto.Marshal(inst.(messageInstance).m.Interface())
+	if err != nil {
+		t.Fatalf("proto marshal error: %s", err)
+	}
+	if err := proto.Unmarshal(b, actual); err != nil {
+		t.Fatalf("proto unmarshal error: %s", err)
+	}
+	if !proto.Equal(req, actual) {
+		t.Fatalf("message mismatch: expected %v, got %v", req, actual)
+	}
+}
+
+func TestCodec_Method(t *testing.T) {
+	var codec Codec
+	desc := grpc_health_v1.File_grpc_health_v1_health_proto.Services().Get(0).Methods().ByName("Check")
+	m := newUnaryMethodFromDescriptor(desc, "localhost:50051")
+
+	data, err := codec.MarshalMethod(m)
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+	d, err := codec.UnmarshalMethod(data)
+	if err != nil {
+		t.Fatalf("unmarshal error: %s", err)
+	}
+	restored, ok := d.(unaryMethod)
+	if !ok {
+		t.Fatalf("method type mismatch: expected unaryMethod, got %T", d)
+	}
+	if diff := cmp.Diff(m.address, restored.address); diff != "" {
+		t.Fatalf("address mismatch:\n%s", diff)
+	}
+	if diff := cmp.Diff(desc.FullName(), restored.desc.FullName()); diff != "" {
+		t.Fatalf("method name mismatch:\n%s", diff)
+	}
+	if !restored.Input().Compatible(m.Input()) {
+		t.Fatalf("input types not compatible")
+	}
+	if !restored.Output().Compatible(m.Output()) {
+		t.Fatalf("output types not compatible")
+	}
+}
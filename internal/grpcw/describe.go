@@ -0,0 +1,267 @@
+package grpcw
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Schema describes methods and the messages and enums they use.
+type Schema struct {
+	Services []ServiceSchema `json:"services"`
+	Messages []MessageSchema `json:"messages"`
+	Enums    []EnumSchema    `json:"enums,omitempty"`
+}
+
+type ServiceSchema struct {
+	Name    string         `json:"name"`
+	Methods []MethodSchema `json:"methods"`
+}
+
+type MethodSchema struct {
+	Name            string `json:"name"`
+	Input           string `json:"input"`
+	Output          string `json:"output"`
+	ClientStreaming bool   `json:"clientStreaming,omitempty"`
+	ServerStreaming bool   `json:"serverStreaming,omitempty"`
+}
+
+type MessageSchema struct {
+	Name   string        `json:"name"`
+	Fields []FieldSchema `json:"fields"`
+	// Nested are the names of the messages and enums declared in the
+	// message.
+	Nested []string `json:"nested,omitempty"`
+}
+
+type FieldSchema struct {
+	Name   string `json:"name"`
+	Number int32  `json:"number"`
+	// Kind is the protobuf type of the field, such as int32, string, message
+	// or enum.
+	Kind string `json:"kind"`
+	// Type is the full name of the message or enum of the field.
+	Type     string `json:"type,omitempty"`
+	Repeated bool   `json:"repeated,omitempty"`
+	// Key and Value are the kinds, or types, of the keys and values of a map
+	// field.
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+	Oneof string `json:"oneof,omitempty"`
+}
+
+type EnumSchema struct {
+	Name   string            `json:"name"`
+	Values []EnumValueSchema `json:"values"`
+}
+
+type EnumValueSchema struct {
+	Name   string `json:"name"`
+	Number int32  `json:"number"`
+}
+
+// NewSchema describes the methods, and all the messages and enums that are
+// used by them or declared in their messages, sorted by name.
+func NewSchema(methods []protoreflect.MethodDescriptor) *Schema {
+	s := &Schema{}
+	services := make(map[protoreflect.FullName]int)
+	messages := make(map[protoreflect.FullName]protoreflect.MessageDescriptor)
+	enums := make(map[protoreflect.FullName]protoreflect.EnumDescriptor)
+
+	var addMessage func(protoreflect.MessageDescriptor)
+	addEnum := func(e protoreflect.EnumDescriptor) { enums[e.FullName()] = e }
+	addMessage = func(m protoreflect.MessageDescriptor) {
+		if _, ok := messages[m.FullName()]; ok {
+			return
+		}
+		messages[m.FullName()] = m
+		fields := m.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			f := fields.Get(i)
+			if f.IsMap() {
+				f = f.MapValue()
+			}
+			if f.Message() != nil {
+				addMessage(f.Message())
+			}
+			if f.Enum() != nil {
+				addEnum(f.Enum())
+			}
+		}
+		nested := m.Messages()
+		for i := 0; i < nested.Len(); i++ {
+			addMessage(nested.Get(i))
+		}
+		nestedEnums := m.Enums()
+		for i := 0; i < nestedEnums.Len(); i++ {
+			addEnum(nestedEnums.Get(i))
+		}
+	}
+
+	for _, m := range methods {
+		srv := m.Parent().(protoreflect.ServiceDescriptor)
+		i, ok := services[srv.FullName()]
+		if !ok {
+			i = len(s.Services)
+			services[srv.FullName()] = i
+			s.Services = append(s.Services, ServiceSchema{Name: string(srv.FullName())})
+		}
+		s.Services[i].Methods = append(s.Services[i].Methods, MethodSchema{
+			Name:            string(m.Name()),
+			Input:           string(m.Input().FullName()),
+			Output:          string(m.Output().FullName()),
+			ClientStreaming: m.IsStreamingClient(),
+			ServerStreaming: m.IsStreamingServer(),
+		})
+		addMessage(m.Input())
+		addMessage(m.Output())
+	}
+	sort.Slice(s.Services, func(i, j int) bool { return s.Services[i].Name < s.Services[j].Name })
+
+	for _, m := range messages {
+		if m.IsMapEntry() {
+			continue
+		}
+		s.Messages = append(s.Messages, messageSchema(m))
+	}
+	sort.Slice(s.Messages, func(i, j int) bool { return s.Messages[i].Name < s.Messages[j].Name })
+
+	for _, e := range enums {
+		s.Enums = append(s.Enums, enumSchema(e))
+	}
+	sort.Slice(s.Enums, func(i, j int) bool { return s.Enums[i].Name < s.Enums[j].Name })
+	return s
+}
+
+func messageSchema(m protoreflect.MessageDescriptor) MessageSchema {
+	schema := MessageSchema{Name: string(m.FullName()), Fields: []FieldSchema{}}
+	fields := m.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		schema.Fields = append(schema.Fields, fieldSchema(fields.Get(i)))
+	}
+	nested := m.Messages()
+	for i := 0; i < nested.Len(); i++ {
+		if !nested.Get(i).IsMapEntry() {
+			schema.Nested = append(schema.Nested, string(nested.Get(i).FullName()))
+		}
+	}
+	nestedEnums := m.Enums()
+	for i := 0; i < nestedEnums.Len(); i++ {
+		schema.Nested = append(schema.Nested, string(nestedEnums.Get(i).FullName()))
+	}
+	return schema
+}
+
+func fieldSchema(f protoreflect.FieldDescriptor) FieldSchema {
+	schema := FieldSchema{
+		Name:   string(f.Name()),
+		Number: int32(f.Number()),
+	}
+	if oneof := f.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+		schema.Oneof = string(oneof.Name())
+	}
+	switch {
+	case f.IsMap():
+		schema.Kind = "map"
+		schema.Key = typeName(f.MapKey())
+		schema.Value = typeName(f.MapValue())
+	default:
+		schema.Kind = f.Kind().String()
+		schema.Repeated = f.IsList()
+		if f.Message() != nil {
+			schema.Type = string(f.Message().FullName())
+		}
+		if f.Enum() != nil {
+			schema.Type = string(f.Enum().FullName())
+		}
+	}
+	return schema
+}
+
+// typeName returns the full name of the message or enum of the field, or its
+// kind for scalar fields.
+func typeName(f protoreflect.FieldDescriptor) string {
+	switch {
+	case f.Message() != nil:
+		return string(f.Message().FullName())
+	case f.Enum() != nil:
+		return string(f.Enum().FullName())
+	default:
+		return f.Kind().String()
+	}
+}
+
+func enumSchema(e protoreflect.EnumDescriptor) EnumSchema {
+	schema := EnumSchema{Name: string(e.FullName())}
+	values := e.Values()
+	for i := 0; i < values.Len(); i++ {
+		v := values.Get(i)
+		schema.Values = append(schema.Values, EnumValueSchema{
+			Name:   string(v.Name()),
+			Number: int32(v.Number()),
+		})
+	}
+	return schema
+}
+
+// WriteText writes the schema in a syntax similar to the protobuf language,
+// with the full names of all messages and enums.
+func (s *Schema) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, srv := range s.Services {
+		fmt.Fprintf(&b, "service %s {\n", srv.Name)
+		for _, m := range srv.Methods {
+			fmt.Fprintf(
+				&b,
+				"  rpc %s(%s%s) returns (%s%s);\n",
+				m.Name, stream(m.ClientStreaming), m.Input, stream(m.ServerStreaming), m.Output,
+			)
+		}
+		b.WriteString("}\n\n")
+	}
+	for _, m := range s.Messages {
+		fmt.Fprintf(&b, "message %s {\n", m.Name)
+		for _, f := range m.Fields {
+			b.WriteString("  ")
+			switch {
+			case f.Kind == "map":
+				fmt.Fprintf(&b, "map<%s, %s>", f.Key, f.Value)
+			case f.Type != "":
+				if f.Repeated {
+					b.WriteString("repeated ")
+				}
+				b.WriteString(f.Type)
+			default:
+				if f.Repeated {
+					b.WriteString("repeated ")
+				}
+				b.WriteString(f.Kind)
+			}
+			fmt.Fprintf(&b, " %s = %d;", f.Name, f.Number)
+			if f.Oneof != "" {
+				fmt.Fprintf(&b, " // oneof %s", f.Oneof)
+			}
+			b.WriteRune('\n')
+		}
+		b.WriteString("}\n\n")
+	}
+	for _, e := range s.Enums {
+		fmt.Fprintf(&b, "enum %s {\n", e.Name)
+		for _, v := range e.Values {
+			fmt.Fprintf(&b, "  %s = %d;\n", v.Name, v.Number)
+		}
+		b.WriteString("}\n\n")
+	}
+	_, err := io.WriteString(w, strings.TrimSuffix(b.String(), "\n"))
+	return err
+}
+
+func stream(streaming bool) string {
+	if streaming {
+		return "stream "
+	}
+	return ""
+}
@@ -0,0 +1,262 @@
+package grpcw
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/logs"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestNewSchema(t *testing.T) {
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	fdProto := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("describe.proto"),
+		Package:    proto.String("describe"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Request"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("ids"),
+						Number:   proto.Int32(1),
+						Label:    repeated,
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(),
+						JsonName: proto.String("ids"),
+					},
+					{
+						Name:     proto.String("labels"),
+						Number:   proto.Int32(2),
+						Label:    repeated,
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+						TypeName: proto.String(".describe.Request.LabelsEntry"),
+						JsonName: proto.String("labels"),
+					},
+					{
+						Name:       proto.String("name"),
+						Number:     proto.Int32(3),
+						Label:      optional,
+						Type:       descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+						OneofIndex: proto.Int32(0),
+						JsonName:   proto.String("name"),
+					},
+					{
+						Name:       proto.String("inner"),
+						Number:     proto.Int32(4),
+						Label:      optional,
+						Type:       descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+						TypeName:   proto.String(".describe.Request.Inner"),
+						OneofIndex: proto.Int32(0),
+						JsonName:   proto.String("inner"),
+					},
+				},
+				NestedType: []*descriptorpb.DescriptorProto{
+					{
+						Name: proto.String("LabelsEntry"),
+						Field: []*descriptorpb.FieldDescriptorProto{
+							{
+								Name:     proto.String("key"),
+								Number:   proto.Int32(1),
+								Label:    optional,
+								Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+								JsonName: proto.String("key"),
+							},
+							{
+								Name:     proto.String("value"),
+								Number:   proto.Int32(2),
+								Label:    optional,
+								Type:     descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum(),
+								TypeName: proto.String(".describe.Level"),
+								JsonName: proto.String("value"),
+							},
+						},
+						Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+					},
+					{
+						Name: proto.String("Inner"),
+						Field: []*descriptorpb.FieldDescriptorProto{{
+							Name:     proto.String("time"),
+							Number:   proto.Int32(1),
+							Label:    optional,
+							Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+							TypeName: proto.String(".google.protobuf.Timestamp"),
+							JsonName: proto.String("time"),
+						}},
+					},
+				},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("target")}},
+			},
+			{Name: proto.String("Reply")},
+		},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Level"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("LOW"), Number: proto.Int32(0)},
+				{Name: proto.String("HIGH"), Number: proto.Int32(1)},
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Service"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:            proto.String("Method"),
+				InputType:       proto.String(".describe.Request"),
+				OutputType:      proto.String(".describe.Reply"),
+				ServerStreaming: proto.Bool(true),
+			}},
+		}},
+	}
+	var registry ProtoRegistry
+	registry = registry.RegisterFile(timestamppb.File_google_protobuf_timestamp_proto)
+	fd, err := protodesc.NewFile(fdProto, registry)
+	if err != nil {
+		t.Fatalf("create file: %s", err)
+	}
+	methods := []protoreflect.MethodDescriptor{fd.Services().Get(0).Methods().Get(0)}
+
+	expected := &Schema{
+		Services: []ServiceSchema{{
+			Name: "describe.Service",
+			Methods: []MethodSchema{{
+				Name:            "Method",
+				Input:           "describe.Request",
+				Output:          "describe.Reply",
+				ServerStreaming: true,
+			}},
+		}},
+		Messages: []MessageSchema{
+			{Name: "describe.Reply", Fields: []FieldSchema{}},
+			{
+				Name: "describe.Request",
+				Fields: []FieldSchema{
+					{Name: "ids", Number: 1, Kind: "int64", Repeated: true},
+					{Name: "labels", Number: 2, Kind: "map", Key: "string", Value: "describe.Level"},
+					{Name: "name", Number: 3, Kind: "string", Oneof: "target"},
+					{Name: "inner", Number: 4, Kind: "message", Type: "describe.Request.Inner", Oneof: "target"},
+				},
+				Nested: []string{"describe.Request.Inner"},
+			},
+			{
+				Name: "describe.Request.Inner",
+				Fields: []FieldSchema{
+					{Name: "time", Number: 1, Kind: "message", Type: "google.protobuf.Timestamp"},
+				},
+			},
+			{
+				Name: "google.protobuf.Timestamp",
+				Fields: []FieldSchema{
+					{Name: "seconds", Number: 1, Kind: "int64"},
+					{Name: "nanos", Number: 2, Kind: "int32"},
+				},
+			},
+		},
+		Enums: []EnumSchema{{
+			Name:   "describe.Level",
+			Values: []EnumValueSchema{{Name: "LOW", Number: 0}, {Name: "HIGH", Number: 1}},
+		}},
+	}
+	schema := NewSchema(methods)
+	if diff := cmp.Diff(expected, schema); diff != "" {
+		t.Fatalf("schema mismatch:\n%s", diff)
+	}
+
+	var b strings.Builder
+	if err := schema.WriteText(&b); err != nil {
+		t.Fatalf("write text: %s", err)
+	}
+	expectedText := `service describe.Service {
+  rpc Method(describe.Request) returns (stream describe.Reply);
+}
+
+message describe.Reply {
+}
+
+message describe.Request {
+  repeated int64 ids = 1;
+  map<string, describe.Level> labels = 2;
+  string name = 3; // oneof target
+  describe.Request.Inner inner = 4; // oneof target
+}
+
+message describe.Request.Inner {
+  google.protobuf.Timestamp time = 1;
+}
+
+message google.protobuf.Timestamp {
+  int64 seconds = 1;
+  int32 nanos = 2;
+}
+
+enum describe.Level {
+  LOW = 0;
+  HIGH = 1;
+}
+`
+	if diff := cmp.Diff(expectedText, b.String()); diff != "" {
+		t.Fatalf("text mismatch:\n%s", diff)
+	}
+}
+
+func TestReflectionResolver_Describe(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	s := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	reflection.Register(s)
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	r, err := NewReflectionResolver(time.Second, retry.ExponentialBackoff{}, logs.New(false))
+	if err != nil {
+		t.Fatalf("create resolver: %s", err)
+	}
+
+	tests := map[string]struct {
+		address  string
+		expected []string
+	}{
+		"server":  {address: "", expected: []string{"Check", "Watch"}},
+		"service": {address: "/grpc.health.v1.Health", expected: []string{"Check", "Watch"}},
+		"method":  {address: "/grpc.health.v1.Health/Watch", expected: []string{"Watch"}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			schema, err := r.Describe(context.Background(), lis.Addr().String()+tc.address)
+			if err != nil {
+				t.Fatalf("describe: %s", err)
+			}
+			if diff := cmp.Diff(1, len(schema.Services)); diff != "" {
+				t.Fatalf("number of services mismatch:\n%s", diff)
+			}
+			var methods []string
+			for _, m := range schema.Services[0].Methods {
+				methods = append(methods, m.Name)
+			}
+			if diff := cmp.Diff(tc.expected, methods); diff != "" {
+				t.Fatalf("methods mismatch:\n%s", diff)
+			}
+		})
+	}
+
+	address := lis.Addr().String() + "/grpc.health.v1.Health/Unknown"
+	if _, err := r.Describe(context.Background(), address); err == nil {
+		t.Fatalf("expected error for unknown method")
+	}
+}
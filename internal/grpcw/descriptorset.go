@@ -0,0 +1,59 @@
+package grpcw
+
+import (
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// LoadDescriptorSet registers the descriptors of a file with a serialized
+// FileDescriptorSet, such as the ones written by protoc with the
+// --descriptor_set_out and --include_imports options. The services defined
+// in the set are then resolved from these descriptors, without contacting
+// the servers. The servers are only contacted when the methods are dialed.
+func (m *ReflectionResolver) LoadDescriptorSet(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("load descriptor set: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("load descriptor set %s: %w", file, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.registerFileProtos(set.GetFile()); err != nil {
+		return fmt.Errorf("load descriptor set %s: %w", file, err)
+	}
+	for _, fd := range set.GetFile() {
+		for _, s := range fd.GetService() {
+			name := s.GetName()
+			if pkg := fd.GetPackage(); pkg != "" {
+				name = pkg + "." + name
+			}
+			m.setServices = append(m.setServices, Service(name))
+		}
+	}
+	return nil
+}
+
+// setServiceDescriptor returns the descriptor of the service at addr if it
+// is defined in the loaded descriptor sets. An unspecified service is only
+// found if the sets define a single service.
+func (m *ReflectionResolver) setServiceDescriptor(addr addr) (protoreflect.ServiceDescriptor, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	service, err := findService(m.setServices, addr.Service())
+	if err != nil {
+		return nil, false
+	}
+	d, err := m.registry.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, false
+	}
+	desc, ok := d.(protoreflect.ServiceDescriptor)
+	return desc, ok
+}
@@ -0,0 +1,63 @@
+package grpcw
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/logs"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestReflectionResolver_LoadDescriptorSet(t *testing.T) {
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(grpc_health_v1.File_grpc_health_v1_health_proto),
+		},
+	}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatalf("marshal set: %s", err)
+	}
+	file := filepath.Join(t.TempDir(), "health.pb")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatalf("write set: %s", err)
+	}
+
+	r, err := NewReflectionResolver(time.Second, retry.ExponentialBackoff{}, logs.New(false))
+	if err != nil {
+		t.Fatalf("create resolver: %s", err)
+	}
+	if err := r.LoadDescriptorSet(file); err != nil {
+		t.Fatalf("load descriptor set: %s", err)
+	}
+
+	// No server listens at the address, so the methods can only be
+	// resolved from the descriptor set.
+	for _, address := range []string{
+		"localhost:1/grpc.health.v1.Health/Check",
+		"localhost:1//Check",
+	} {
+		desc, err := r.Resolve(context.Background(), address)
+		if err != nil {
+			t.Fatalf("%s: resolve error: %s", address, err)
+		}
+		expected := "GrpcMessageType(grpc.health.v1.HealthCheckRequest)"
+		if diff := cmp.Diff(expected, fmt.Sprint(desc.Input())); diff != "" {
+			t.Fatalf("%s: input mismatch:\n%s", address, diff)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := r.Resolve(ctx, "localhost:1/pkg.Unknown/Method"); err == nil {
+		t.Fatalf("expected error for a service not in the set")
+	}
+}
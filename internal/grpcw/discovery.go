@@ -0,0 +1,227 @@
+package grpcw
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
+)
+
+// The addresses of the stages can use the following schemes to discover the
+// servers dynamically:
+//
+//   - dns:///host:port resolves all the addresses of host with the grpc dns
+//     resolver.
+//   - srv:///_service._proto.name resolves the targets of the DNS SRV record.
+//   - file:///path/to/endpoints reads the endpoints from a file, with one
+//     host:port per line. The file is read again when it changes.
+//
+// The calls are balanced between all the resolved servers with the
+// round_robin policy.
+const (
+	srvScheme  = "srv"
+	fileScheme = "file"
+)
+
+const (
+	// srvRefreshInterval is the interval between the lookups of SRV records.
+	srvRefreshInterval = 30 * time.Second
+	// fileRefreshInterval is the interval between the reads of endpoint
+	// files.
+	fileRefreshInterval = time.Second
+)
+
+var errNoEndpoints = errors.New("no endpoints found")
+
+// withDiscovery returns the dial option that registers the resolvers for the
+// discovery schemes. Addresses without a scheme are dialed directly.
+func withDiscovery() grpc.DialOption {
+	return grpc.WithResolvers(
+		&srvBuilder{lookup: net.DefaultResolver.LookupSRV, interval: srvRefreshInterval},
+		&fileBuilder{interval: fileRefreshInterval},
+	)
+}
+
+// hasScheme reports whether the address is a target with a scheme, such as
+// dns:///host:port.
+func hasScheme(address string) bool {
+	return strings.Contains(address, "://")
+}
+
+type lookupSRVFunc func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+// srvBuilder creates resolvers that lookup the servers in DNS SRV records.
+type srvBuilder struct {
+	lookup   lookupSRVFunc
+	interval time.Duration
+}
+
+func (b *srvBuilder) Scheme() string { return srvScheme }
+
+func (b *srvBuilder) Build(
+	target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions,
+) (resolver.Resolver, error) {
+	name := target.Endpoint
+	if name == "" {
+		return nil, &invalidTarget{target: target.URL.String(), msg: "empty record name"}
+	}
+	resolve := func(ctx context.Context) ([]resolver.Address, error) {
+		_, records, err := b.lookup(ctx, "", "", name)
+		if err != nil {
+			return nil, fmt.Errorf("lookup srv %s: %w", name, err)
+		}
+		addrs := make([]resolver.Address, 0, len(records))
+		for _, r := range records {
+			host := strings.TrimSuffix(r.Target, ".")
+			port := strconv.Itoa(int(r.Port))
+			addrs = append(addrs, resolver.Address{Addr: net.JoinHostPort(host, port)})
+		}
+		return addrs, nil
+	}
+	return newPollingResolver(cc, resolve, b.interval), nil
+}
+
+// fileBuilder creates resolvers that read the servers from a file with one
+// endpoint per line. Empty lines and lines starting with # are ignored.
+type fileBuilder struct {
+	interval time.Duration
+}
+
+func (b *fileBuilder) Scheme() string { return fileScheme }
+
+func (b *fileBuilder) Build(
+	target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions,
+) (resolver.Resolver, error) {
+	file := target.URL.Path
+	if file == "" {
+		file = target.URL.Opaque
+	}
+	if file == "" {
+		return nil, &invalidTarget{target: target.URL.String(), msg: "empty file"}
+	}
+	resolve := func(context.Context) ([]resolver.Address, error) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read endpoints: %w", err)
+		}
+		return parseEndpoints(data), nil
+	}
+	return newPollingResolver(cc, resolve, b.interval), nil
+}
+
+func parseEndpoints(data []byte) []resolver.Address {
+	var addrs []resolver.Address
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		addrs = append(addrs, resolver.Address{Addr: l})
+	}
+	return addrs
+}
+
+// pollingResolver resolves the servers periodically and when requested by
+// grpc, and updates the connection when the servers change.
+type pollingResolver struct {
+	cc       resolver.ClientConn
+	resolve  func(context.Context) ([]resolver.Address, error)
+	interval time.Duration
+
+	now    chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newPollingResolver(
+	cc resolver.ClientConn,
+	resolve func(context.Context) ([]resolver.Address, error),
+	interval time.Duration,
+) *pollingResolver {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &pollingResolver{
+		cc:       cc,
+		resolve:  resolve,
+		interval: interval,
+		now:      make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	r.wg.Add(1)
+	go r.watch()
+	return r
+}
+
+func (r *pollingResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.now <- struct{}{}:
+	default:
+	}
+}
+
+func (r *pollingResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *pollingResolver) watch() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	var last []resolver.Address
+	for {
+		addrs, err := r.resolve(r.ctx)
+		switch {
+		case r.ctx.Err() != nil:
+			return
+		case err != nil:
+			r.cc.ReportError(err)
+		case len(addrs) == 0:
+			r.cc.ReportError(errNoEndpoints)
+		case !equalAddresses(addrs, last):
+			if err := r.cc.UpdateState(resolver.State{Addresses: addrs}); err == nil {
+				last = addrs
+			}
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.now:
+		}
+	}
+}
+
+func equalAddresses(a, b []resolver.Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Addr != b[i].Addr {
+			return false
+		}
+	}
+	return true
+}
+
+type invalidTarget struct {
+	target string
+	msg    string
+}
+
+func (err *invalidTarget) Error() string {
+	return fmt.Sprintf("invalid target %q: %s", err.target, err.msg)
+}
@@ -0,0 +1,223 @@
+package grpcw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/logs"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := map[string]struct {
+		address  string
+		expected addr
+	}{
+		"host and port": {
+			address:  "localhost:8080/Service/Method",
+			expected: NewAddress("localhost:8080", "Service", "Method"),
+		},
+		"only host": {
+			address:  "localhost:8080",
+			expected: NewAddress("localhost:8080", "", ""),
+		},
+		"dns": {
+			address:  "dns:///service.local:8080/Service/*",
+			expected: NewAddress("dns:///service.local:8080", "Service", "*"),
+		},
+		"dns with authority": {
+			address:  "dns://8.8.8.8/service.local:8080/*/*",
+			expected: NewAddress("dns://8.8.8.8/service.local:8080", "*", "*"),
+		},
+		"file": {
+			address:  "file:///etc/maestro/endpoints/Service/Method",
+			expected: NewAddress("file:///etc/maestro/endpoints", "Service", "Method"),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := parseAddress(tc.address)
+			if err != nil {
+				t.Fatalf("parse error: %s", err)
+			}
+			if diff := cmp.Diff(tc.expected, actual, cmp.AllowUnexported(addr{})); diff != "" {
+				t.Fatalf("address mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseAddress_Err(t *testing.T) {
+	for _, address := range []string{"a/b/c/d", "dns:///host:8080", "dns:///host:8080/Service"} {
+		if _, err := parseAddress(address); !errors.Is(err, errMalFormedAddress) {
+			t.Fatalf("%q: expected malformed address, got %v", address, err)
+		}
+	}
+}
+
+func TestSRVResolver(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		records = []*net.SRV{
+			{Target: "host-1.local.", Port: 8080},
+			{Target: "host-2.local.", Port: 8081},
+		}
+	)
+	lookup := func(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		if name != "_grpc._tcp.service.local" {
+			return "", nil, fmt.Errorf("unexpected name %q", name)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return "", records, nil
+	}
+	b := &srvBuilder{lookup: lookup, interval: time.Hour}
+	cc := newTestClientConn()
+	r, err := b.Build(newTarget(t, "srv:///_grpc._tcp.service.local"), cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatalf("build error: %s", err)
+	}
+	defer r.Close()
+
+	expected := []string{"host-1.local:8080", "host-2.local:8081"}
+	if diff := cmp.Diff(expected, cc.nextAddrs(t)); diff != "" {
+		t.Fatalf("addresses mismatch:\n%s", diff)
+	}
+
+	mu.Lock()
+	records = []*net.SRV{{Target: "host-3.local.", Port: 8082}}
+	mu.Unlock()
+	r.ResolveNow(resolver.ResolveNowOptions{})
+
+	expected = []string{"host-3.local:8082"}
+	if diff := cmp.Diff(expected, cc.nextAddrs(t)); diff != "" {
+		t.Fatalf("addresses mismatch after update:\n%s", diff)
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "endpoints")
+	writeEndpoints(t, file, "# servers\nhost-1:8080\n\n  host-2:8081  \n")
+
+	b := &fileBuilder{interval: 10 * time.Millisecond}
+	cc := newTestClientConn()
+	r, err := b.Build(newTarget(t, "file://"+file), cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatalf("build error: %s", err)
+	}
+	defer r.Close()
+
+	expected := []string{"host-1:8080", "host-2:8081"}
+	if diff := cmp.Diff(expected, cc.nextAddrs(t)); diff != "" {
+		t.Fatalf("addresses mismatch:\n%s", diff)
+	}
+
+	writeEndpoints(t, file, "host-3:8082\n")
+	expected = []string{"host-3:8082"}
+	if diff := cmp.Diff(expected, cc.nextAddrs(t)); diff != "" {
+		t.Fatalf("addresses mismatch after update:\n%s", diff)
+	}
+}
+
+func TestReflectionResolver_FileDiscovery(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	s := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	reflection.Register(s)
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	file := filepath.Join(t.TempDir(), "endpoints")
+	writeEndpoints(t, file, lis.Addr().String()+"\n")
+
+	r, err := NewReflectionResolver(time.Second, retry.ExponentialBackoff{}, logs.New(false))
+	if err != nil {
+		t.Fatalf("create resolver: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	desc, err := r.Resolve(ctx, "file://"+file+"/grpc.health.v1.Health/Check")
+	if err != nil {
+		t.Fatalf("resolve error: %s", err)
+	}
+	conn, err := desc.Dial()
+	if err != nil {
+		t.Fatalf("dial error: %s", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Call(ctx, desc.Input().Build()); err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+}
+
+func writeEndpoints(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("write endpoints: %s", err)
+	}
+}
+
+func newTarget(t *testing.T, target string) resolver.Target {
+	t.Helper()
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("parse target: %s", err)
+	}
+	return resolver.Target{
+		Scheme:    u.Scheme,
+		Authority: u.Host,
+		Endpoint:  strings.TrimPrefix(u.Path, "/"),
+		URL:       *u,
+	}
+}
+
+// testClientConn records the addresses updated by a resolver.
+type testClientConn struct {
+	resolver.ClientConn
+	updates chan []string
+}
+
+func newTestClientConn() *testClientConn {
+	return &testClientConn{updates: make(chan []string, 10)}
+}
+
+func (cc *testClientConn) UpdateState(s resolver.State) error {
+	addrs := make([]string, 0, len(s.Addresses))
+	for _, a := range s.Addresses {
+		addrs = append(addrs, a.Addr)
+	}
+	cc.updates <- addrs
+	return nil
+}
+
+func (cc *testClientConn) ReportError(error) {}
+
+func (cc *testClientConn) nextAddrs(t *testing.T) []string {
+	t.Helper()
+	select {
+	case addrs := <-cc.updates:
+		return addrs
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for addresses")
+		return nil
+	}
+}
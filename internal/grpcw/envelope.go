@@ -0,0 +1,208 @@
+package grpcw
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DuarteMRAlves/maestro/internal/message"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	anyFullName protoreflect.FullName = "google.protobuf.Any"
+	// anyTypeURLPrefix is the prefix of the type urls of the packed messages,
+	// followed by the full name of their type.
+	anyTypeURLPrefix = "type.googleapis.com/"
+)
+
+// IsEnvelope reports whether the type is google.protobuf.Any.
+func (t messageType) IsEnvelope() bool {
+	return t.t.Descriptor().FullName() == anyFullName
+}
+
+// Pack returns a converter that serializes messages of the given type into
+// google.protobuf.Any messages, with the type url of the given type.
+func (t messageType) Pack(o message.Type) (message.Converter, error) {
+	if !t.IsEnvelope() {
+		return nil, &notAnyType{Type: t}
+	}
+	other, ok := o.(messageType)
+	if !ok {
+		return nil, fmt.Errorf("type not messageType: %v", o)
+	}
+	typeURL := anyTypeURLPrefix + string(other.t.Descriptor().FullName())
+	fields := t.t.Descriptor().Fields()
+	typeURLField, valueField := fields.ByName("type_url"), fields.ByName("value")
+	pack := func(msg message.Instance) (message.Instance, error) {
+		src, ok := msg.(messageInstance)
+		if !ok {
+			return nil, fmt.Errorf("value not of type messageInstance: %v", msg)
+		}
+		data, err := proto.Marshal(src.m.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("pack %s: %w", typeURL, err)
+		}
+		dst := t.t.New()
+		dst.Set(typeURLField, protoreflect.ValueOfString(typeURL))
+		dst.Set(valueField, protoreflect.ValueOfBytes(data))
+		return messageInstance{m: dst}, nil
+	}
+	return pack, nil
+}
+
+// Unpack returns a converter that deserializes google.protobuf.Any messages
+// holding messages of the type with the given name into messages of the
+// given type. The named type is searched in the files of the given type and
+// their imports, and must be compatible with it. Messages with other type
+// urls are rejected.
+func (t messageType) Unpack(name string, o message.Type) (message.Converter, error) {
+	if !t.IsEnvelope() {
+		return nil, &notAnyType{Type: t}
+	}
+	other, ok := o.(messageType)
+	if !ok {
+		return nil, fmt.Errorf("type not messageType: %v", o)
+	}
+	target := other.t.Descriptor()
+	packed := findMessage(target.ParentFile(), protoreflect.FullName(name), map[string]bool{})
+	if packed == nil {
+		return nil, &unknownPackedType{Name: name, Type: other}
+	}
+	packedType := messageType{dynamicpb.NewMessageType(packed)}
+	if !packedType.Compatible(other) {
+		return nil, fmt.Errorf("incompatible packed type: %s, %s", packedType, other)
+	}
+	fields := t.t.Descriptor().Fields()
+	typeURLField, valueField := fields.ByName("type_url"), fields.ByName("value")
+	unpack := func(msg message.Instance) (message.Instance, error) {
+		src, ok := msg.(messageInstance)
+		if !ok {
+			return nil, fmt.Errorf("value not of type messageInstance: %v", msg)
+		}
+		typeURL := src.m.Get(typeURLField).String()
+		if typeURL[strings.LastIndex(typeURL, "/")+1:] != name {
+			return nil, &unexpectedPackedType{Expected: name, TypeURL: typeURL}
+		}
+		dst := other.t.New()
+		if err := proto.Unmarshal(src.m.Get(valueField).Bytes(), dst.Interface()); err != nil {
+			return nil, fmt.Errorf("unpack %s: %w", typeURL, err)
+		}
+		return messageInstance{m: dst}, nil
+	}
+	return unpack, nil
+}
+
+// findMessage searches the message with the given name in the file and its
+// imports.
+func findMessage(
+	fd protoreflect.FileDescriptor,
+	name protoreflect.FullName,
+	visited map[string]bool,
+) protoreflect.MessageDescriptor {
+	if visited[fd.Path()] {
+		return nil
+	}
+	visited[fd.Path()] = true
+	if msg := findNestedMessage(fd.Messages(), name); msg != nil {
+		return msg
+	}
+	imports := fd.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		if msg := findMessage(imports.Get(i).FileDescriptor, name, visited); msg != nil {
+			return msg
+		}
+	}
+	return nil
+}
+
+func findNestedMessage(
+	msgs protoreflect.MessageDescriptors,
+	name protoreflect.FullName,
+) protoreflect.MessageDescriptor {
+	for i := 0; i < msgs.Len(); i++ {
+		msg := msgs.Get(i)
+		if msg.FullName() == name {
+			return msg
+		}
+		if nested := findNestedMessage(msg.Messages(), name); nested != nil {
+			return nested
+		}
+	}
+	return nil
+}
+
+// IsOneof reports whether the field is a oneof of the type. The oneofs
+// generated for proto3 optional fields are not considered.
+func (t messageType) IsOneof(field message.Field) bool {
+	oneof := t.t.Descriptor().Oneofs().ByName(protoreflect.Name(field))
+	return oneof != nil && !oneof.IsSynthetic()
+}
+
+// SelectOneof returns the member of the oneof with the given type. If no
+// member has the type, the single google.protobuf.Any member is selected,
+// so that the messages are packed.
+func (t messageType) SelectOneof(field message.Field, o message.Type) (message.Field, error) {
+	other, ok := o.(messageType)
+	if !ok {
+		return "", fmt.Errorf("type not messageType: %v", o)
+	}
+	oneof := t.t.Descriptor().Oneofs().ByName(protoreflect.Name(field))
+	if oneof == nil || oneof.IsSynthetic() {
+		return "", &errUnknownField{Field: field}
+	}
+	var anyMembers []message.Field
+	members := oneof.Fields()
+	for i := 0; i < members.Len(); i++ {
+		member := members.Get(i)
+		if member.Message() == nil {
+			continue
+		}
+		switch member.Message().FullName() {
+		case other.t.Descriptor().FullName():
+			return message.Field(member.Name()), nil
+		case anyFullName:
+			anyMembers = append(anyMembers, message.Field(member.Name()))
+		}
+	}
+	if len(anyMembers) == 1 {
+		return anyMembers[0], nil
+	}
+	return "", &noOneofMember{Oneof: field, Type: other}
+}
+
+type notAnyType struct {
+	Type messageType
+}
+
+func (err *notAnyType) Error() string {
+	return fmt.Sprintf("type is not %s: %s", anyFullName, err.Type)
+}
+
+type unknownPackedType struct {
+	Name string
+	Type messageType
+}
+
+func (err *unknownPackedType) Error() string {
+	return fmt.Sprintf("packed type %q not found in the files of %s", err.Name, err.Type)
+}
+
+type unexpectedPackedType struct {
+	Expected string
+	TypeURL  string
+}
+
+func (err *unexpectedPackedType) Error() string {
+	return fmt.Sprintf("packed type mismatch: expected %q, got type url %q", err.Expected, err.TypeURL)
+}
+
+type noOneofMember struct {
+	Oneof message.Field
+	Type  messageType
+}
+
+func (err *noOneofMember) Error() string {
+	return fmt.Sprintf("no member of oneof %q for %s", err.Oneof, err.Type)
+}
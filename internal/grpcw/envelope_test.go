@@ -0,0 +1,199 @@
+package grpcw
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DuarteMRAlves/maestro/internal/message"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// envelopeTypes creates the types of a file with an event envelope that
+// holds created and deleted events in a oneof.
+func envelopeTypes(t *testing.T) func(name string) messageType {
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	stringType := descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	messageKind := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+	fdProto := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("events.proto"),
+		Package:    proto.String("events"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/any.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Created"),
+				Field: []*descriptorpb.FieldDescriptorProto{{
+					Name:     proto.String("id"),
+					Number:   proto.Int32(1),
+					Label:    optional,
+					Type:     stringType,
+					JsonName: proto.String("id"),
+				}},
+			},
+			{
+				Name: proto.String("Deleted"),
+				Field: []*descriptorpb.FieldDescriptorProto{{
+					Name:     proto.String("id"),
+					Number:   proto.Int32(1),
+					Label:    optional,
+					Type:     stringType,
+					JsonName: proto.String("id"),
+				}},
+			},
+			{
+				Name: proto.String("Envelope"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:       proto.String("created"),
+						Number:     proto.Int32(1),
+						Label:      optional,
+						Type:       messageKind,
+						TypeName:   proto.String(".events.Created"),
+						OneofIndex: proto.Int32(0),
+						JsonName:   proto.String("created"),
+					},
+					{
+						Name:       proto.String("other"),
+						Number:     proto.Int32(2),
+						Label:      optional,
+						Type:       messageKind,
+						TypeName:   proto.String(".google.protobuf.Any"),
+						OneofIndex: proto.Int32(0),
+						JsonName:   proto.String("other"),
+					},
+					{
+						Name:     proto.String("payload"),
+						Number:   proto.Int32(3),
+						Label:    optional,
+						Type:     messageKind,
+						TypeName: proto.String(".google.protobuf.Any"),
+						JsonName: proto.String("payload"),
+					},
+				},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("event")}},
+			},
+		},
+	}
+	var registry ProtoRegistry
+	registry = registry.RegisterFile(anypb.File_google_protobuf_any_proto)
+	fd, err := protodesc.NewFile(fdProto, registry)
+	if err != nil {
+		t.Fatalf("create file: %s", err)
+	}
+	return func(name string) messageType {
+		if name == string(anyFullName) {
+			return messageType{dynamicpb.NewMessageType(fd.Imports().Get(0).Messages().ByName("Any"))}
+		}
+		return messageType{dynamicpb.NewMessageType(fd.Messages().ByName(protoreflect.Name(name)))}
+	}
+}
+
+func TestType_PackUnpack(t *testing.T) {
+	typeOf := envelopeTypes(t)
+	anyType, created, deleted := typeOf(string(anyFullName)), typeOf("Created"), typeOf("Deleted")
+
+	if diff := cmp.Diff(true, anyType.IsEnvelope()); diff != "" {
+		t.Fatalf("any is envelope mismatch:\n%s", diff)
+	}
+	if diff := cmp.Diff(false, created.IsEnvelope()); diff != "" {
+		t.Fatalf("created is envelope mismatch:\n%s", diff)
+	}
+
+	pack, err := anyType.Pack(created)
+	if err != nil {
+		t.Fatalf("pack: %s", err)
+	}
+	msg := created.t.New()
+	msg.Set(msg.Descriptor().Fields().ByName("id"), protoreflect.ValueOfString("id-1"))
+	packed, err := pack(messageInstance{m: msg})
+	if err != nil {
+		t.Fatalf("pack message: %s", err)
+	}
+	anyFields := anyType.t.Descriptor().Fields()
+	typeURL := packed.(messageInstance).m.Get(anyFields.ByName("type_url")).String()
+	if diff := cmp.Diff("type.googleapis.com/events.Created", typeURL); diff != "" {
+		t.Fatalf("type url mismatch:\n%s", diff)
+	}
+
+	unpack, err := anyType.Unpack("events.Created", created)
+	if err != nil {
+		t.Fatalf("unpack: %s", err)
+	}
+	unpacked, err := unpack(packed)
+	if err != nil {
+		t.Fatalf("unpack message: %s", err)
+	}
+	if !proto.Equal(msg.Interface(), unpacked.(messageInstance).m.Interface()) {
+		t.Fatalf("unpacked message mismatch: expected %v, got %v", msg, unpacked)
+	}
+
+	unpackDeleted, err := anyType.Unpack("events.Deleted", deleted)
+	if err != nil {
+		t.Fatalf("unpack deleted: %s", err)
+	}
+	var typeErr *unexpectedPackedType
+	if _, err := unpackDeleted(packed); !errors.As(err, &typeErr) {
+		t.Fatalf("expected *unexpectedPackedType, got %v", err)
+	}
+
+	var unknownErr *unknownPackedType
+	if _, err := anyType.Unpack("events.Unknown", created); !errors.As(err, &unknownErr) {
+		t.Fatalf("expected *unknownPackedType, got %v", err)
+	}
+	var notAnyErr *notAnyType
+	if _, err := created.Pack(deleted); !errors.As(err, &notAnyErr) {
+		t.Fatalf("expected *notAnyType, got %v", err)
+	}
+}
+
+func TestType_SelectOneof(t *testing.T) {
+	typeOf := envelopeTypes(t)
+	envelope := typeOf("Envelope")
+
+	tests := map[string]struct {
+		field    message.Field
+		typ      messageType
+		isOneof  bool
+		expected message.Field
+	}{
+		"member type": {
+			field:    "event",
+			typ:      typeOf("Created"),
+			isOneof:  true,
+			expected: "created",
+		},
+		"any member": {
+			field:    "event",
+			typ:      typeOf("Deleted"),
+			isOneof:  true,
+			expected: "other",
+		},
+		"not oneof": {
+			field:   "payload",
+			isOneof: false,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.isOneof, envelope.IsOneof(tc.field)); diff != "" {
+				t.Fatalf("is oneof mismatch:\n%s", diff)
+			}
+			if !tc.isOneof {
+				return
+			}
+			member, err := envelope.SelectOneof(tc.field, tc.typ)
+			if err != nil {
+				t.Fatalf("select oneof: %s", err)
+			}
+			if diff := cmp.Diff(tc.expected, member); diff != "" {
+				t.Fatalf("member mismatch:\n%s", diff)
+			}
+		})
+	}
+}
@@ -77,43 +77,186 @@ func (t messageType) Subfield(field message.Field) (message.Type, error) {
 }
 
 func (t messageType) Compatible(o message.Type) bool {
+	return t.Compare(o).Compatible()
+}
+
+// Compare matches the fields of both types by number. Fields with the same
+// number must have the same kind and cardinality, and fields of message kind
+// are compared recursively.
+func (t messageType) Compare(o message.Type) message.Compatibility {
+	return t.compare(o, false)
+}
+
+// CompareByName is like Compare but matches the fields by name. Fields of
+// message kind are also matched by name, and map fields only match other
+// map fields.
+func (t messageType) CompareByName(o message.Type) message.Compatibility {
+	return t.compare(o, true)
+}
+
+func (t messageType) compare(o message.Type, byName bool) message.Compatibility {
 	other, ok := o.(messageType)
 	if !ok {
-		return false
+		return message.Compatibility{
+			Mismatches: []message.FieldMismatch{{Source: t.String(), Target: fmt.Sprint(o)}},
+		}
+	}
+	c := messageComparison{
+		byName:    byName,
+		comparing: make(map[[2]protoreflect.FullName]bool),
 	}
-	return compatibleMessageDescriptors(t.t.Descriptor(), other.t.Descriptor())
+	c.compare(t.t.Descriptor(), other.t.Descriptor(), "", "")
+	return c.report
 }
 
-func compatibleMessageDescriptors(d1, d2 protoreflect.MessageDescriptor) bool {
-	fields1 := d1.Fields()
-	fields2 := d2.Fields()
-	for i1 := 0; i1 < fields1.Len(); i1++ {
-		f1 := fields1.Get(i1)
-		f2 := fields2.ByNumber(f1.Number())
+// ConvertByName returns a converter that copies the fields of messages of
+// this type to new messages of the other type, matching the fields by name.
+// The types must be compatible by name, which is not verified again for
+// each message.
+func (t messageType) ConvertByName(o message.Type) (message.Converter, error) {
+	other, ok := o.(messageType)
+	if !ok {
+		return nil, fmt.Errorf("type not messageType: %v", o)
+	}
+	if report := t.CompareByName(o); !report.Compatible() {
+		return nil, fmt.Errorf("incompatible types by name: %s, %s", t, other)
+	}
+	convert := func(msg message.Instance) (message.Instance, error) {
+		src, ok := msg.(messageInstance)
+		if !ok {
+			return nil, fmt.Errorf("value not of type messageInstance: %v", msg)
+		}
+		dst := other.t.New()
+		copyByName(src.m, dst)
+		return messageInstance{m: dst}, nil
+	}
+	return convert, nil
+}
 
-		// Ignore unmatched fields
+// copyByName sets the fields of dst with the populated fields of src with
+// the same name.
+func copyByName(src, dst protoreflect.Message) {
+	dstFields := dst.Descriptor().Fields()
+	src.Range(func(f1 protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		f2 := dstFields.ByName(f1.Name())
 		if f2 == nil {
-			continue
+			return true
 		}
-
-		// Both fields must have the same cardinality
-		if f1.Cardinality() != f2.Cardinality() {
-			return false
+		switch {
+		case f1.IsMap():
+			m := dst.Mutable(f2).Map()
+			v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				m.Set(k, convertValue(f1.MapValue(), mv, m.NewValue))
+				return true
+			})
+		case f1.IsList():
+			l := dst.Mutable(f2).List()
+			for i := 0; i < v.List().Len(); i++ {
+				l.Append(convertValue(f1, v.List().Get(i), l.NewElement))
+			}
+		default:
+			dst.Set(f2, convertValue(f1, v, func() protoreflect.Value { return dst.NewField(f2) }))
 		}
+		return true
+	})
+}
 
-		// Fields with the same number must have the same kind
-		if f1.Kind() != f2.Kind() {
-			return false
-		}
+// convertValue converts a single value of the field fd. Scalar values are
+// kept and messages are copied by name into the value returned by newValue.
+func convertValue(
+	fd protoreflect.FieldDescriptor,
+	v protoreflect.Value,
+	newValue func() protoreflect.Value,
+) protoreflect.Value {
+	if fd.Message() == nil {
+		return v
+	}
+	converted := newValue()
+	copyByName(v.Message(), converted.Message())
+	return converted
+}
+
+type messageComparison struct {
+	report message.Compatibility
+	// byName specifies that the fields are matched by name instead of by
+	// number.
+	byName bool
+	// comparing stores the pairs of messages being compared in the current
+	// path, so that recursive messages are not compared again inside
+	// themselves. Pairs under other paths are compared again, so that their
+	// fields are reported for each path.
+	comparing map[[2]protoreflect.FullName]bool
+}
 
+// compare compares the fields of the source and target descriptors. The
+// fields are reported with the given prefixes, as the names of the fields
+// may differ in both messages.
+func (c *messageComparison) compare(src, tgt protoreflect.MessageDescriptor, srcPrefix, tgtPrefix string) {
+	key := [2]protoreflect.FullName{src.FullName(), tgt.FullName()}
+	if c.comparing[key] {
+		return
+	}
+	c.comparing[key] = true
+	defer delete(c.comparing, key)
+
+	srcFields, tgtFields := src.Fields(), tgt.Fields()
+	for i := 0; i < srcFields.Len(); i++ {
+		f1 := srcFields.Get(i)
+		ref := message.FieldRef{Path: srcPrefix + string(f1.Name()), Number: int(f1.Number())}
+		f2 := c.match(tgtFields, f1)
+		if f2 == nil {
+			c.report.Dropped = append(c.report.Dropped, ref)
+			continue
+		}
+		// Fields with the same number must have the same kind and cardinality
+		// and, when copied by name, maps are only copied to maps.
+		if f1.Cardinality() != f2.Cardinality() ||
+			f1.Kind() != f2.Kind() ||
+			(c.byName && f1.IsMap() != f2.IsMap()) {
+			c.report.Mismatches = append(c.report.Mismatches, message.FieldMismatch{
+				FieldRef: ref,
+				Source:   describeField(f1),
+				Target:   describeField(f2),
+			})
+			continue
+		}
 		// If the fields are messages, they must also be compatible
 		if f1.Kind() == protoreflect.MessageKind {
-			if !compatibleMessageDescriptors(f1.Message(), f2.Message()) {
-				return false
-			}
+			c.compare(f1.Message(), f2.Message(), ref.Path+".", tgtPrefix+string(f2.Name())+".")
 		}
 	}
-	return true
+	for i := 0; i < tgtFields.Len(); i++ {
+		f2 := tgtFields.Get(i)
+		if c.match(srcFields, f2) == nil {
+			ref := message.FieldRef{Path: tgtPrefix + string(f2.Name()), Number: int(f2.Number())}
+			c.report.Unset = append(c.report.Unset, ref)
+		}
+	}
+}
+
+// match returns the field of fields that matches fd, or nil if none does.
+func (c *messageComparison) match(
+	fields protoreflect.FieldDescriptors,
+	fd protoreflect.FieldDescriptor,
+) protoreflect.FieldDescriptor {
+	if c.byName {
+		return fields.ByName(fd.Name())
+	}
+	return fields.ByNumber(fd.Number())
+}
+
+func describeField(fd protoreflect.FieldDescriptor) string {
+	if fd.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", fd.MapKey().Kind(), fd.MapValue().Kind())
+	}
+	switch fd.Cardinality() {
+	case protoreflect.Repeated:
+		return "repeated " + fd.Kind().String()
+	case protoreflect.Required:
+		return "required " + fd.Kind().String()
+	default:
+		return fd.Kind().String()
+	}
 }
 
 func (t messageType) searchFieldDescriptor(field message.Field) protoreflect.FieldDescriptor {
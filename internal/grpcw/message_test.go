@@ -7,8 +7,12 @@ import (
 	"github.com/DuarteMRAlves/maestro/internal/message"
 	"github.com/DuarteMRAlves/maestro/test/protobuf/unit"
 	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 func TestInstanceSet(t *testing.T) {
@@ -149,3 +153,277 @@ func TestTypeCompatible(t *testing.T) {
 		)
 	}
 }
+
+func TestTypeCompare(t *testing.T) {
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	field := func(name string, number int32, label *descriptorpb.FieldDescriptorProto_Label, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  label,
+			Type:   typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	int64Type := descriptorpb.FieldDescriptorProto_TYPE_INT64
+	int32Type := descriptorpb.FieldDescriptorProto_TYPE_INT32
+	stringType := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	messageKind := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	fdProto := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("compare.proto"),
+		Package: proto.String("compare"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Source"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, optional, int64Type, ""),
+					field("inner", 2, optional, messageKind, ".compare.SourceInner"),
+					field("extra", 3, optional, stringType, ""),
+					field("tags", 5, repeated, stringType, ""),
+				},
+			},
+			{
+				Name: proto.String("SourceInner"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("value", 1, optional, stringType, ""),
+					field("note", 2, optional, stringType, ""),
+				},
+			},
+			{
+				Name: proto.String("Target"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, optional, int32Type, ""),
+					field("nested", 2, optional, messageKind, ".compare.TargetInner"),
+					field("count", 4, optional, int32Type, ""),
+					field("tags", 5, optional, stringType, ""),
+				},
+			},
+			{
+				Name: proto.String("TargetInner"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("value", 1, optional, stringType, ""),
+					field("size", 3, optional, int64Type, ""),
+				},
+			},
+			{
+				Name: proto.String("SourcePair"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("first", 1, optional, messageKind, ".compare.SourceInner"),
+					field("second", 2, optional, messageKind, ".compare.SourceInner"),
+				},
+			},
+			{
+				Name: proto.String("TargetPair"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("first", 1, optional, messageKind, ".compare.TargetInner"),
+					field("second", 2, optional, messageKind, ".compare.TargetInner"),
+				},
+			},
+			{
+				Name: proto.String("Node"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("child", 1, optional, messageKind, ".compare.Node"),
+				},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(fdProto, nil)
+	if err != nil {
+		t.Fatalf("create file: %s", err)
+	}
+	typeOf := func(name string) messageType {
+		return messageType{dynamicpb.NewMessageType(fd.Messages().ByName(protoreflect.Name(name)))}
+	}
+
+	tests := map[string]struct {
+		source, target messageType
+		expected       message.Compatibility
+	}{
+		"fields": {
+			source: typeOf("Source"),
+			target: typeOf("Target"),
+			expected: message.Compatibility{
+				Mismatches: []message.FieldMismatch{
+					{FieldRef: message.FieldRef{Path: "id", Number: 1}, Source: "int64", Target: "int32"},
+					{FieldRef: message.FieldRef{Path: "tags", Number: 5}, Source: "repeated string", Target: "string"},
+				},
+				Dropped: []message.FieldRef{{Path: "inner.note", Number: 2}, {Path: "extra", Number: 3}},
+				Unset:   []message.FieldRef{{Path: "nested.size", Number: 3}, {Path: "count", Number: 4}},
+			},
+		},
+		"repeated types": {
+			source: typeOf("SourcePair"),
+			target: typeOf("TargetPair"),
+			expected: message.Compatibility{
+				Dropped: []message.FieldRef{{Path: "first.note", Number: 2}, {Path: "second.note", Number: 2}},
+				Unset:   []message.FieldRef{{Path: "first.size", Number: 3}, {Path: "second.size", Number: 3}},
+			},
+		},
+		"recursive": {
+			source:   typeOf("Node"),
+			target:   typeOf("Node"),
+			expected: message.Compatibility{},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			report := tc.source.Compare(tc.target)
+			if diff := cmp.Diff(tc.expected, report); diff != "" {
+				t.Fatalf("compatibility mismatch:\n%s", diff)
+			}
+			if diff := cmp.Diff(len(tc.expected.Mismatches) == 0, tc.source.Compatible(tc.target)); diff != "" {
+				t.Fatalf("compatible mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTypeConvertByName(t *testing.T) {
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	stringType := descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	int64Type := descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()
+	messageKind := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+	field := func(
+		name string,
+		number int32,
+		label *descriptorpb.FieldDescriptorProto_Label,
+		typ *descriptorpb.FieldDescriptorProto_Type,
+		typeName string,
+	) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    label,
+			Type:     typ,
+			JsonName: proto.String(name),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	labelsEntry := func(valueType string) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{
+			Name: proto.String("LabelsEntry"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("key", 1, optional, stringType, ""),
+				field("value", 2, optional, messageKind, valueType),
+			},
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		}
+	}
+	fdProto := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("byname.proto"),
+		Package: proto.String("byname"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Source"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, optional, stringType, ""),
+					field("id", 2, optional, int64Type, ""),
+					field("inner", 3, optional, messageKind, ".byname.SourceInner"),
+					field("tags", 4, repeated, messageKind, ".byname.SourceInner"),
+					field("labels", 5, repeated, messageKind, ".byname.Source.LabelsEntry"),
+					field("dropped", 6, optional, stringType, ""),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{labelsEntry(".byname.SourceInner")},
+			},
+			{
+				Name:  proto.String("SourceInner"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("value", 1, optional, stringType, "")},
+			},
+			{
+				Name: proto.String("Target"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, optional, int64Type, ""),
+					field("name", 2, optional, stringType, ""),
+					field("labels", 3, repeated, messageKind, ".byname.Target.LabelsEntry"),
+					field("tags", 4, repeated, messageKind, ".byname.TargetInner"),
+					field("inner", 5, optional, messageKind, ".byname.TargetInner"),
+					field("unset", 6, optional, stringType, ""),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{labelsEntry(".byname.TargetInner")},
+			},
+			{
+				Name:  proto.String("TargetInner"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("value", 2, optional, stringType, "")},
+			},
+			{
+				Name: proto.String("Mismatch"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, repeated, stringType, ""),
+					field("id", 2, optional, stringType, ""),
+				},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(fdProto, nil)
+	if err != nil {
+		t.Fatalf("create file: %s", err)
+	}
+	typeOf := func(name string) messageType {
+		return messageType{dynamicpb.NewMessageType(fd.Messages().ByName(protoreflect.Name(name)))}
+	}
+	source, target := typeOf("Source"), typeOf("Target")
+
+	expectedReport := message.Compatibility{
+		Dropped: []message.FieldRef{{Path: "dropped", Number: 6}},
+		Unset:   []message.FieldRef{{Path: "unset", Number: 6}},
+	}
+	if diff := cmp.Diff(expectedReport, source.CompareByName(target)); diff != "" {
+		t.Fatalf("compatibility mismatch:\n%s", diff)
+	}
+	expectedMismatches := []message.FieldMismatch{
+		{FieldRef: message.FieldRef{Path: "name", Number: 1}, Source: "string", Target: "repeated string"},
+		{FieldRef: message.FieldRef{Path: "id", Number: 2}, Source: "int64", Target: "string"},
+	}
+	report := source.CompareByName(typeOf("Mismatch"))
+	if diff := cmp.Diff(expectedMismatches, report.Mismatches); diff != "" {
+		t.Fatalf("mismatches mismatch:\n%s", diff)
+	}
+	if _, err := source.ConvertByName(typeOf("Mismatch")); err == nil {
+		t.Fatalf("expected error converting incompatible types")
+	}
+
+	convert, err := source.ConvertByName(target)
+	if err != nil {
+		t.Fatalf("converter: %s", err)
+	}
+	parse := func(typ messageType, data string) protoreflect.Message {
+		msg := typ.t.New()
+		if err := protojson.Unmarshal([]byte(data), msg.Interface()); err != nil {
+			t.Fatalf("unmarshal %s: %s", data, err)
+		}
+		return msg
+	}
+	src := parse(source, `{
+		"name": "a",
+		"id": "2",
+		"inner": {"value": "b"},
+		"tags": [{"value": "c"}, {"value": "d"}],
+		"labels": {"e": {"value": "f"}},
+		"dropped": "g"
+	}`)
+	expected := parse(target, `{
+		"id": "2",
+		"name": "a",
+		"labels": {"e": {"value": "f"}},
+		"tags": [{"value": "c"}, {"value": "d"}],
+		"inner": {"value": "b"}
+	}`)
+	converted, err := convert(messageInstance{m: src})
+	if err != nil {
+		t.Fatalf("convert: %s", err)
+	}
+	actual := converted.(messageInstance).m
+	if !proto.Equal(expected.Interface(), actual.Interface()) {
+		t.Fatalf("converted message mismatch: expected %v, got %v", expected, actual)
+	}
+}
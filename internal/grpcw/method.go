@@ -8,6 +8,9 @@ import (
 	"github.com/DuarteMRAlves/maestro/internal/message"
 	"github.com/DuarteMRAlves/maestro/internal/method"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/dynamicpb"
@@ -18,9 +21,13 @@ var (
 )
 
 type unaryMethod struct {
-	dialer method.DialFunc
-	input  messageType
-	output messageType
+	address string
+	dialer  method.DialFunc
+	input   messageType
+	output  messageType
+	// desc is the protobuf descriptor for the method. It may be nil if the
+	// method was not created from a descriptor.
+	desc protoreflect.MethodDescriptor
 }
 
 func (d unaryMethod) Dial() (method.Conn, error) {
@@ -39,29 +46,41 @@ func newUnaryMethod(
 	address string,
 	invokePath string,
 	inDesc, outDesc messageType,
+	opts ...grpc.DialOption,
 ) unaryMethod {
 	return unaryMethod{
-		input:  inDesc,
-		output: outDesc,
-		dialer: newDialFunc(address, invokePath, outDesc.Build),
+		address: address,
+		input:   inDesc,
+		output:  outDesc,
+		dialer:  newDialFunc(address, invokePath, outDesc.Build, opts...),
 	}
 }
 
-func newUnaryMethodFromDescriptor(desc protoreflect.MethodDescriptor, address string) unaryMethod {
+func newUnaryMethodFromDescriptor(
+	desc protoreflect.MethodDescriptor, address string, opts ...grpc.DialOption,
+) unaryMethod {
 	invokePath := methodInvokePath(desc)
 	input := messageType{t: dynamicpb.NewMessageType(desc.Input())}
 	output := messageType{t: dynamicpb.NewMessageType(desc.Output())}
 
-	return newUnaryMethod(address, invokePath, input, output)
+	m := newUnaryMethod(address, invokePath, input, output, opts...)
+	m.desc = desc
+	return m
 }
 
+// newDialFunc creates a function to connect with the method. If no options
+// are specified, the connection is insecure.
 func newDialFunc(
 	address string,
 	invokePath string,
 	emptyGen message.BuildFunc,
+	opts ...grpc.DialOption,
 ) method.DialFunc {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithInsecure()}
+	}
 	return func() (method.Conn, error) {
-		conn, err := grpc.Dial(string(address), grpc.WithInsecure())
+		conn, err := grpc.Dial(string(address), opts...)
 		if err != nil {
 			return nil, err
 		}
@@ -91,25 +110,99 @@ func (c unaryClient) Call(
 	ctx context.Context,
 	req message.Instance,
 ) (message.Instance, error) {
+	rep, _, err := c.CallWithMetadata(ctx, req, nil)
+	return rep, err
+}
+
+// CallWithMetadata calls the method with md as the outgoing metadata. The
+// returned metadata joins the headers and trailers of the reply.
+func (c unaryClient) CallWithMetadata(
+	ctx context.Context,
+	req message.Instance,
+	md method.Metadata,
+) (message.Instance, method.Metadata, error) {
 	rep := c.buildFunc()
 
 	reqInst, ok := req.(messageInstance)
 	if !ok {
-		return nil, errNotGrpcMessage
+		return nil, nil, errNotGrpcMessage
 	}
 	repInst, ok := rep.(messageInstance)
 	if !ok {
-		return nil, errNotGrpcMessage
+		return nil, nil, errNotGrpcMessage
 	}
 
-	err := c.conn.Invoke(ctx, c.invokePath, reqInst.m.Interface(), repInst.m.Interface())
+	if len(md) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.MD(md))
+	}
+	var header, trailer metadata.MD
+	err := c.conn.Invoke(
+		ctx,
+		c.invokePath,
+		reqInst.m.Interface(),
+		repInst.m.Interface(),
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
 	if err != nil {
 		st, _ := status.FromError(err)
-		return nil, fmt.Errorf("invoke %s: %w", c.invokePath, st.Err())
+		if st.Code() == codes.Unavailable {
+			return nil, nil, fmt.Errorf("invoke %s: %w", c.invokePath, &unavailable{err: st.Err()})
+		}
+		return nil, nil, fmt.Errorf("invoke %s: %w", c.invokePath, st.Err())
 	}
-	return repInst, nil
+	return repInst, method.Metadata(metadata.Join(header, trailer)), nil
+}
+
+// WatchHealth reports the health of the server from the connectivity state
+// of the connection. As the connection checks the grpc.health.v1 service of
+// the servers, the connection is only ready if a server is serving.
+func (c unaryClient) WatchHealth(ctx context.Context) <-chan method.Health {
+	healthCh := make(chan method.Health)
+	go func() {
+		defer close(healthCh)
+		last := method.HealthUnknown
+		for {
+			state := c.conn.GetState()
+			health := last
+			switch state {
+			case connectivity.Idle:
+				// Idle connections only reconnect when a call is made, so
+				// the stage would never know when the server recovers.
+				c.conn.Connect()
+			case connectivity.Ready:
+				health = method.Healthy
+			case connectivity.TransientFailure, connectivity.Shutdown:
+				health = method.Unhealthy
+			}
+			if health != last {
+				select {
+				case healthCh <- health:
+				case <-ctx.Done():
+					return
+				}
+				last = health
+			}
+			if !c.conn.WaitForStateChange(ctx, state) {
+				return
+			}
+		}
+	}()
+	return healthCh
 }
 
 func (c unaryClient) Close() error {
 	return c.conn.Close()
 }
+
+// unavailable is the error returned when a call fails because no server is
+// available. It matches method.ErrUnavailable and keeps the grpc status.
+type unavailable struct {
+	err error
+}
+
+func (err *unavailable) Error() string { return err.err.Error() }
+
+func (err *unavailable) Unwrap() error { return err.err }
+
+func (err *unavailable) Is(target error) bool { return target == method.ErrUnavailable }
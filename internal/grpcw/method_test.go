@@ -4,14 +4,21 @@ import (
 	"context"
 	"errors"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/DuarteMRAlves/maestro/internal/logs"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
 	"github.com/DuarteMRAlves/maestro/test/protobuf/unit"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 )
@@ -259,3 +266,214 @@ func testMethodStartServer(t *testing.T, lis net.Listener) *grpc.Server {
 	}()
 	return testServer
 }
+
+func TestUnaryClient_WatchHealth(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	s := grpc.NewServer()
+	healthServer := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(s, healthServer)
+	reflection.Register(s)
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	r, err := NewReflectionResolver(time.Second, retry.ExponentialBackoff{}, logs.New(false))
+	if err != nil {
+		t.Fatalf("create resolver: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	desc, err := r.Resolve(ctx, lis.Addr().String()+"/grpc.health.v1.Health/Check")
+	if err != nil {
+		t.Fatalf("resolve error: %s", err)
+	}
+	conn, err := desc.Dial()
+	if err != nil {
+		t.Fatalf("dial error: %s", err)
+	}
+	defer conn.Close()
+
+	watcher, ok := conn.(method.HealthWatcher)
+	if !ok {
+		t.Fatalf("connection does not watch health")
+	}
+	healthCh := watcher.WatchHealth(ctx)
+	expectHealth := func(expected method.Health) {
+		t.Helper()
+		select {
+		case h := <-healthCh:
+			if diff := cmp.Diff(expected, h); diff != "" {
+				t.Fatalf("health mismatch:\n%s", diff)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for health %s", expected)
+		}
+	}
+
+	expectHealth(method.Healthy)
+	healthServer.SetServingStatus("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	expectHealth(method.Unhealthy)
+	_, err = conn.Call(ctx, desc.Input().Build())
+	if !errors.Is(err, method.ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+	healthServer.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+	expectHealth(method.Healthy)
+}
+
+func TestUnaryClient_CallWithMetadata(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	// echo returns the received tenant in the header and the received key
+	// in the trailer.
+	echo := func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if err := grpc.SetHeader(ctx, metadata.MD{"x-tenant": md["x-tenant"]}); err != nil {
+			return nil, err
+		}
+		if err := grpc.SetTrailer(ctx, metadata.MD{"x-key": md["x-key"]}); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(echo))
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	reflection.Register(s)
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	r, err := NewReflectionResolver(time.Second, retry.ExponentialBackoff{}, logs.New(false))
+	if err != nil {
+		t.Fatalf("create resolver: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	desc, err := r.Resolve(ctx, lis.Addr().String()+"/grpc.health.v1.Health/Check")
+	if err != nil {
+		t.Fatalf("resolve error: %s", err)
+	}
+	conn, err := desc.Dial()
+	if err != nil {
+		t.Fatalf("dial error: %s", err)
+	}
+	defer conn.Close()
+
+	caller, ok := conn.(method.MetadataCaller)
+	if !ok {
+		t.Fatalf("connection does not send metadata")
+	}
+	md := method.Metadata{"x-tenant": {"acme"}, "x-key": {"secret"}}
+	_, rep, err := caller.CallWithMetadata(ctx, desc.Input().Build(), md)
+	if err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+	selected := rep.Select([]string{"x-tenant", "x-key"})
+	if diff := cmp.Diff(md, selected); diff != "" {
+		t.Fatalf("metadata mismatch:\n%s", diff)
+	}
+}
+
+func TestReflectionResolver_Credentials(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	// The server rejects the reflection requests and the calls without the
+	// token.
+	authorized := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if diff := cmp.Diff([]string{"Bearer token"}, md["authorization"]); diff != "" {
+			return status.Error(codes.Unauthenticated, diff)
+		}
+		return nil
+	}
+	unaryAuth := func(
+		ctx context.Context,
+		req interface{},
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if err := authorized(ctx); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	streamAuth := func(
+		srv interface{},
+		ss grpc.ServerStream,
+		_ *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := authorized(ss.Context()); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(unaryAuth), grpc.StreamInterceptor(streamAuth))
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	reflection.Register(s)
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	r, err := NewReflectionResolver(time.Second, retry.ExponentialBackoff{}, logs.New(false))
+	if err != nil {
+		t.Fatalf("create resolver: %s", err)
+	}
+	creds := &testCredentials{token: "token"}
+	r.ConfigureServer(lis.Addr().String(), ServerConfig{Credentials: creds})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	desc, err := r.Resolve(ctx, lis.Addr().String()+"/grpc.health.v1.Health/Check")
+	if err != nil {
+		t.Fatalf("resolve error: %s", err)
+	}
+	resolveCalls := creds.count()
+	if resolveCalls == 0 {
+		t.Fatalf("reflection requests without credentials")
+	}
+	conn, err := desc.Dial()
+	if err != nil {
+		t.Fatalf("dial error: %s", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Call(ctx, desc.Input().Build()); err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+	if creds.count() == resolveCalls {
+		t.Fatalf("call without credentials")
+	}
+}
+
+// testCredentials sends a fixed token over insecure connections and counts
+// the requests.
+type testCredentials struct {
+	token string
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *testCredentials) GetRequestMetadata(
+	context.Context, ...string,
+) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+func (c *testCredentials) RequireTransportSecurity() bool { return false }
+
+func (c *testCredentials) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
@@ -0,0 +1,130 @@
+package grpcw
+
+import (
+	"math/rand"
+
+	"github.com/DuarteMRAlves/maestro/internal/message"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// maxRandomDepth limits the nesting of generated messages, as message
+	// definitions may be recursive.
+	maxRandomDepth = 3
+	// maxRandomLen is the maximum number of elements of generated repeated
+	// fields, maps, strings and bytes.
+	maxRandomLen = 4
+)
+
+const randomLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// BuildRandom creates a message of this type with randomly populated fields.
+func (t messageType) BuildRandom(r *rand.Rand) message.Instance {
+	m := t.t.New()
+	populateRandom(m, r, maxRandomDepth)
+	return messageInstance{m: m}
+}
+
+func populateRandom(m protoreflect.Message, r *rand.Rand, depth int) {
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		// Oneof members are populated below so that only one is set.
+		if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() {
+			continue
+		}
+		populateRandomField(m, fd, r, depth)
+	}
+	oneofs := m.Descriptor().Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		od := oneofs.Get(i)
+		if od.IsSynthetic() {
+			continue
+		}
+		members := od.Fields()
+		populateRandomField(m, members.Get(r.Intn(members.Len())), r, depth)
+	}
+}
+
+func populateRandomField(
+	m protoreflect.Message, fd protoreflect.FieldDescriptor, r *rand.Rand, depth int,
+) {
+	switch {
+	case fd.IsMap():
+		if isMessageKind(fd.MapValue()) && depth <= 1 {
+			return
+		}
+		mp := m.Mutable(fd).Map()
+		for n := r.Intn(maxRandomLen + 1); n > 0; n-- {
+			key := randomScalar(fd.MapKey(), r).MapKey()
+			if isMessageKind(fd.MapValue()) {
+				v := mp.NewValue()
+				populateRandom(v.Message(), r, depth-1)
+				mp.Set(key, v)
+			} else {
+				mp.Set(key, randomScalar(fd.MapValue(), r))
+			}
+		}
+	case fd.IsList():
+		if isMessageKind(fd) && depth <= 1 {
+			return
+		}
+		l := m.Mutable(fd).List()
+		for n := r.Intn(maxRandomLen + 1); n > 0; n-- {
+			if isMessageKind(fd) {
+				v := l.NewElement()
+				populateRandom(v.Message(), r, depth-1)
+				l.Append(v)
+			} else {
+				l.Append(randomScalar(fd, r))
+			}
+		}
+	case isMessageKind(fd):
+		if depth <= 1 {
+			return
+		}
+		v := m.NewField(fd)
+		populateRandom(v.Message(), r, depth-1)
+		m.Set(fd, v)
+	default:
+		m.Set(fd, randomScalar(fd, r))
+	}
+}
+
+func isMessageKind(fd protoreflect.FieldDescriptor) bool {
+	return fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind
+}
+
+func randomScalar(fd protoreflect.FieldDescriptor, r *rand.Rand) protoreflect.Value {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(r.Intn(2) == 1)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		return protoreflect.ValueOfEnum(values.Get(r.Intn(values.Len())).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(int32(r.Uint32()))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(int64(r.Uint64()))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(r.Uint32())
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(r.Uint64())
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(r.Float32())
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(r.Float64())
+	case protoreflect.StringKind:
+		b := make([]byte, r.Intn(maxRandomLen+1))
+		for i := range b {
+			b[i] = randomLetters[r.Intn(len(randomLetters))]
+		}
+		return protoreflect.ValueOfString(string(b))
+	case protoreflect.BytesKind:
+		b := make([]byte, r.Intn(maxRandomLen+1))
+		r.Read(b)
+		return protoreflect.ValueOfBytes(b)
+	default:
+		return fd.Default()
+	}
+}
@@ -0,0 +1,37 @@
+package grpcw
+
+import (
+	"math/rand"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestTypeBuildRandom(t *testing.T) {
+	desc := (&descriptorpb.FileDescriptorProto{}).ProtoReflect().Descriptor()
+	typ := messageType{t: dynamicpb.NewMessageType(desc)}
+
+	first := typ.BuildRandom(rand.New(rand.NewSource(42)))
+	second := typ.BuildRandom(rand.New(rand.NewSource(42)))
+
+	firstInst, ok := first.(messageInstance)
+	if !ok {
+		t.Fatalf("instance type mismatch: expected messageInstance, got %T", first)
+	}
+	secondInst, ok := second.(messageInstance)
+	if !ok {
+		t.Fatalf("instance type mismatch: expected messageInstance, got %T", second)
+	}
+	if !proto.Equal(firstInst.m.Interface(), secondInst.m.Interface()) {
+		t.Fatalf("messages with same seed differ: %v, %v", firstInst, secondInst)
+	}
+	if proto.Equal(firstInst.m.Interface(), typ.Build().(messageInstance).m.Interface()) {
+		t.Fatalf("random message equals empty message")
+	}
+	// Verify the generated message can be serialized.
+	if _, err := proto.Marshal(firstInst.m.Interface()); err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+}
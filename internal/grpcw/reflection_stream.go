@@ -9,44 +9,116 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
+// reflectionVersion is a version of the grpc reflection protocol. The v1 and
+// v1alpha versions have the same messages, and only differ in the name of
+// the service, so the v1alpha messages are used for both.
+type reflectionVersion string
+
+const (
+	reflectionV1      reflectionVersion = "grpc.reflection.v1.ServerReflection"
+	reflectionV1Alpha reflectionVersion = "grpc.reflection.v1alpha.ServerReflection"
+)
+
+func (v reflectionVersion) method() string {
+	return fmt.Sprintf("/%s/ServerReflectionInfo", v)
+}
+
+var reflectionStreamDesc = grpc.StreamDesc{
+	StreamName:    "ServerReflectionInfo",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+// blockingReflectionStream sends reflection requests and waits for their
+// responses. The protocol version is negotiated with the first request,
+// trying v1 first and falling back to v1alpha if the server does not
+// implement v1.
 type blockingReflectionStream struct {
-	stream grpc_reflection_v1alpha.ServerReflection_ServerReflectionInfoClient
-	mu     sync.Mutex
+	ctx  context.Context
+	conn grpc.ClientConnInterface
+
+	mu         sync.Mutex
+	stream     grpc.ClientStream
+	version    reflectionVersion
+	negotiated bool
 }
 
 func newBlockingReflectionStream(
 	ctx context.Context, conn grpc.ClientConnInterface,
 ) (*blockingReflectionStream, error) {
-	var s blockingReflectionStream
-	stub := grpc_reflection_v1alpha.NewServerReflectionClient(conn)
-	stream, err := stub.ServerReflectionInfo(ctx)
-	if err != nil {
+	s := &blockingReflectionStream{ctx: ctx, conn: conn}
+	if err := s.open(reflectionV1); err != nil {
 		return nil, err
 	}
+	return s, nil
+}
+
+func (s *blockingReflectionStream) open(version reflectionVersion) error {
+	stream, err := s.conn.NewStream(s.ctx, &reflectionStreamDesc, version.method())
+	if err != nil {
+		return err
+	}
 	s.stream = stream
-	s.mu = sync.Mutex{}
-	return &s, nil
+	s.version = version
+	return nil
 }
 
-func (s *blockingReflectionStream) listServiceNames() ([]string, error) {
+// roundTrip sends a request and receives its response. If the server does
+// not implement the version of the stream, and the version was not
+// negotiated yet, the request is sent again with v1alpha.
+func (s *blockingReflectionStream) roundTrip(
+	req *grpc_reflection_v1alpha.ServerReflectionRequest,
+) (*grpc_reflection_v1alpha.ServerReflectionResponse, error) {
 	if s == nil || s.stream == nil {
 		return nil, fmt.Errorf("not connected")
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	rep, err := s.sendAndRecv(req)
+	if status.Code(err) == codes.Unimplemented && !s.negotiated && s.version == reflectionV1 {
+		if err := s.open(reflectionV1Alpha); err != nil {
+			return nil, err
+		}
+		rep, err = s.sendAndRecv(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.negotiated = true
+	return rep, nil
+}
+
+func (s *blockingReflectionStream) sendAndRecv(
+	req *grpc_reflection_v1alpha.ServerReflectionRequest,
+) (*grpc_reflection_v1alpha.ServerReflectionResponse, error) {
+	if err := s.stream.SendMsg(req); err != nil {
+		// The status of the stream is returned by RecvMsg.
+		rep := new(grpc_reflection_v1alpha.ServerReflectionResponse)
+		if recvErr := s.stream.RecvMsg(rep); recvErr != nil {
+			return nil, recvErr
+		}
+		return nil, err
+	}
+	rep := new(grpc_reflection_v1alpha.ServerReflectionResponse)
+	if err := s.stream.RecvMsg(rep); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+func (s *blockingReflectionStream) listServiceNames() ([]string, error) {
 	req := &grpc_reflection_v1alpha.ServerReflectionRequest{
 		MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_ListServices{
 			// this field value is ignored by grpc
 			ListServices: "*",
 		},
 	}
-	if err := s.stream.Send(req); err != nil {
-		return nil, err
-	}
-	rep, err := s.stream.Recv()
+	rep, err := s.roundTrip(req)
 	if err != nil {
 		return nil, err
 	}
@@ -66,22 +138,27 @@ func (s *blockingReflectionStream) listServiceNames() ([]string, error) {
 }
 
 func (s *blockingReflectionStream) filesForSymbol(symb string) ([][]byte, error) {
-	if s == nil || s.stream == nil {
-		return nil, fmt.Errorf("not connected")
-	}
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	req := &grpc_reflection_v1alpha.ServerReflectionRequest{
 		MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_FileContainingSymbol{
 			FileContainingSymbol: symb,
 		},
 	}
+	return s.files(req, "find file containing symbol")
+}
 
-	if err := s.stream.Send(req); err != nil {
-		return nil, err
+func (s *blockingReflectionStream) fileByFilename(name string) ([][]byte, error) {
+	req := &grpc_reflection_v1alpha.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_FileByFilename{
+			FileByFilename: name,
+		},
 	}
-	rep, err := s.stream.Recv()
+	return s.files(req, "find file by filename")
+}
+
+func (s *blockingReflectionStream) files(
+	req *grpc_reflection_v1alpha.ServerReflectionRequest, desc string,
+) ([][]byte, error) {
+	rep, err := s.roundTrip(req)
 	if err != nil {
 		return nil, err
 	}
@@ -93,6 +170,62 @@ func (s *blockingReflectionStream) filesForSymbol(symb string) ([][]byte, error)
 	case *grpc_reflection_v1alpha.ServerReflectionResponse_ErrorResponse:
 		return nil, status.Error(codes.Code(r.ErrorResponse.ErrorCode), r.ErrorResponse.ErrorMessage)
 	default:
-		return nil, fmt.Errorf("invalid find file containing symbol response type: %q", r)
+		return nil, fmt.Errorf("invalid %s response type: %q", desc, r)
+	}
+}
+
+// filesWithDependencies returns the files that define the symbol and all
+// their transitive dependencies, ordered so that each file comes after its
+// dependencies. Servers may omit dependencies from the response, or send
+// them only once per stream, so the missing ones are fetched by name.
+func (s *blockingReflectionStream) filesWithDependencies(symb string) ([][]byte, error) {
+	data, err := s.filesForSymbol(symb)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		fds  []*descriptorpb.FileDescriptorProto
+		raw  [][]byte
+		seen = make(map[string]bool)
+	)
+	add := func(data [][]byte) error {
+		for _, buf := range data {
+			var fd descriptorpb.FileDescriptorProto
+			if err := proto.Unmarshal(buf, &fd); err != nil {
+				return err
+			}
+			if seen[fd.GetName()] {
+				continue
+			}
+			seen[fd.GetName()] = true
+			fds = append(fds, &fd)
+			raw = append(raw, buf)
+		}
+		return nil
+	}
+	if err := add(data); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(fds); i++ {
+		for _, dep := range fds[i].GetDependency() {
+			if seen[dep] {
+				continue
+			}
+			data, err := s.fileByFilename(dep)
+			if err != nil {
+				return nil, fmt.Errorf("dependency %s: %w", dep, err)
+			}
+			if err := add(data); err != nil {
+				return nil, err
+			}
+			if !seen[dep] {
+				return nil, &missingDependency{file: fds[i].GetName(), dep: dep}
+			}
+		}
+	}
+	sorted := make([][]byte, 0, len(raw))
+	for _, i := range sortByDependencies(fds) {
+		sorted = append(sorted, raw[i])
 	}
+	return sorted, nil
 }
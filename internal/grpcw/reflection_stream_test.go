@@ -3,6 +3,7 @@ package grpcw
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"testing"
 
@@ -11,9 +12,11 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 func TestListServiceNames(t *testing.T) {
@@ -118,6 +121,216 @@ func TestNoReflection(t *testing.T) {
 	}
 }
 
+func TestBlockingReflectionStream_Version(t *testing.T) {
+	tests := map[string]struct {
+		versions []reflectionVersion
+		expected reflectionVersion
+	}{
+		"v1 only": {
+			versions: []reflectionVersion{reflectionV1},
+			expected: reflectionV1,
+		},
+		"v1alpha only": {
+			versions: []reflectionVersion{reflectionV1Alpha},
+			expected: reflectionV1Alpha,
+		},
+		"both": {
+			versions: []reflectionVersion{reflectionV1, reflectionV1Alpha},
+			expected: reflectionV1,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := grpc.NewServer()
+			srv := reflection.NewServer(reflection.ServerOptions{Services: s})
+			for _, v := range tc.versions {
+				registerReflection(s, v, srv)
+			}
+			addr, stop := serve(t, s)
+			defer stop()
+
+			conn, close := dialServer(addr)
+			defer close()
+
+			stream, err := newBlockingReflectionStream(context.Background(), conn)
+			if err != nil {
+				t.Fatalf("create reflection client: %s", err)
+			}
+			services, err := stream.listServiceNames()
+			if err != nil {
+				t.Fatalf("list services: %s", err)
+			}
+			if diff := cmp.Diff(tc.expected, stream.version); diff != "" {
+				t.Fatalf("version mismatch:\n%s", diff)
+			}
+			if diff := cmp.Diff(len(tc.versions), len(services)); diff != "" {
+				t.Fatalf("mismatch on number of services:\n%s", diff)
+			}
+			// The version is kept for the following requests.
+			if _, err := stream.listServiceNames(); err != nil {
+				t.Fatalf("list services again: %s", err)
+			}
+			if diff := cmp.Diff(tc.expected, stream.version); diff != "" {
+				t.Fatalf("version mismatch on second request:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFilesWithDependencies(t *testing.T) {
+	files := map[string]*descriptorpb.FileDescriptorProto{
+		"base.proto": {
+			Name:        proto.String("base.proto"),
+			Package:     proto.String("deps"),
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Base")}},
+		},
+		"message.proto": {
+			Name:       proto.String("message.proto"),
+			Package:    proto.String("deps"),
+			Dependency: []string{"base.proto"},
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Message"),
+				Field: []*descriptorpb.FieldDescriptorProto{{
+					Name:     proto.String("base"),
+					Number:   proto.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+					TypeName: proto.String(".deps.Base"),
+				}},
+			}},
+		},
+		"service.proto": {
+			Name:       proto.String("service.proto"),
+			Package:    proto.String("deps"),
+			Dependency: []string{"message.proto", "base.proto"},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("Service"),
+				Method: []*descriptorpb.MethodDescriptorProto{{
+					Name:       proto.String("Method"),
+					InputType:  proto.String(".deps.Message"),
+					OutputType: proto.String(".deps.Base"),
+				}},
+			}},
+		},
+	}
+	s := grpc.NewServer()
+	registerReflection(s, reflectionV1, &dependenciesReflection{files: files})
+	addr, stop := serve(t, s)
+	defer stop()
+
+	conn, close := dialServer(addr)
+	defer close()
+
+	stream, err := newBlockingReflectionStream(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("create reflection client: %s", err)
+	}
+	data, err := stream.filesWithDependencies("deps.Service")
+	if err != nil {
+		t.Fatalf("files with dependencies: %s", err)
+	}
+	var names []string
+	for _, buf := range data {
+		var fd descriptorpb.FileDescriptorProto
+		if err := proto.Unmarshal(buf, &fd); err != nil {
+			t.Fatalf("unmarshal: %s", err)
+		}
+		names = append(names, fd.GetName())
+	}
+	expected := []string{"base.proto", "message.proto", "service.proto"}
+	if diff := cmp.Diff(expected, names); diff != "" {
+		t.Fatalf("files mismatch:\n%s", diff)
+	}
+
+	var registry ProtoRegistry
+	m := &ReflectionResolver{registry: registry}
+	if _, err := m.registerService("deps.Service", data); err != nil {
+		t.Fatalf("register service: %s", err)
+	}
+
+	_, err = stream.filesWithDependencies("deps.Unknown")
+	if diff := cmp.Diff(codes.NotFound, status.Code(err)); diff != "" {
+		t.Fatalf("code mismatch:\n%s", diff)
+	}
+}
+
+// dependenciesReflection is a reflection server that only returns the file
+// that defines a symbol, without its dependencies.
+type dependenciesReflection struct {
+	grpc_reflection_v1alpha.UnimplementedServerReflectionServer
+	files map[string]*descriptorpb.FileDescriptorProto
+}
+
+func (s *dependenciesReflection) ServerReflectionInfo(
+	stream grpc_reflection_v1alpha.ServerReflection_ServerReflectionInfoServer,
+) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var fd *descriptorpb.FileDescriptorProto
+		switch r := req.MessageRequest.(type) {
+		case *grpc_reflection_v1alpha.ServerReflectionRequest_FileContainingSymbol:
+			for _, f := range s.files {
+				for _, srv := range f.Service {
+					if f.GetPackage()+"."+srv.GetName() == r.FileContainingSymbol {
+						fd = f
+					}
+				}
+			}
+		case *grpc_reflection_v1alpha.ServerReflectionRequest_FileByFilename:
+			fd = s.files[r.FileByFilename]
+		}
+		rep := &grpc_reflection_v1alpha.ServerReflectionResponse{OriginalRequest: req}
+		if fd == nil {
+			rep.MessageResponse = &grpc_reflection_v1alpha.ServerReflectionResponse_ErrorResponse{
+				ErrorResponse: &grpc_reflection_v1alpha.ErrorResponse{
+					ErrorCode:    int32(codes.NotFound),
+					ErrorMessage: "not found",
+				},
+			}
+		} else {
+			buf, err := proto.Marshal(fd)
+			if err != nil {
+				return err
+			}
+			rep.MessageResponse = &grpc_reflection_v1alpha.ServerReflectionResponse_FileDescriptorResponse{
+				FileDescriptorResponse: &grpc_reflection_v1alpha.FileDescriptorResponse{
+					FileDescriptorProto: [][]byte{buf},
+				},
+			}
+		}
+		if err := stream.Send(rep); err != nil {
+			return err
+		}
+	}
+}
+
+// registerReflection registers the reflection server with the service name of
+// the given version.
+func registerReflection(
+	s *grpc.Server,
+	v reflectionVersion,
+	srv grpc_reflection_v1alpha.ServerReflectionServer,
+) {
+	desc := grpc_reflection_v1alpha.ServerReflection_ServiceDesc
+	desc.ServiceName = string(v)
+	s.RegisterService(&desc, srv)
+}
+
+func serve(t *testing.T, s *grpc.Server) (string, func()) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	go func() { _ = s.Serve(lis) }()
+	return lis.Addr().String(), s.Stop
+}
+
 type testService struct {
 	unit.UnimplementedMethodLoaderTestServiceServer
 }
@@ -5,43 +5,66 @@ import (
 	"strings"
 
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/apipb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/sourcecontextpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
+// wellKnownFiles are the files of the well-known types, which are used when
+// a server does not send them as dependencies.
+var wellKnownFiles = map[string]protoreflect.FileDescriptor{}
+
+func init() {
+	for _, f := range []protoreflect.FileDescriptor{
+		anypb.File_google_protobuf_any_proto,
+		apipb.File_google_protobuf_api_proto,
+		descriptorpb.File_google_protobuf_descriptor_proto,
+		durationpb.File_google_protobuf_duration_proto,
+		emptypb.File_google_protobuf_empty_proto,
+		fieldmaskpb.File_google_protobuf_field_mask_proto,
+		sourcecontextpb.File_google_protobuf_source_context_proto,
+		structpb.File_google_protobuf_struct_proto,
+		timestamppb.File_google_protobuf_timestamp_proto,
+		typepb.File_google_protobuf_type_proto,
+		wrapperspb.File_google_protobuf_wrappers_proto,
+	} {
+		wellKnownFiles[f.Path()] = f
+	}
+}
+
 type ProtoRegistry struct {
 	descs map[protoreflect.FullName]protoreflect.Descriptor
 	files map[string]protoreflect.FileDescriptor
 }
 
-// Register file registers the top level definitions of a file. The behaviour
-// for duplicate descriptors is to replace with the new descriptors.
+// Register file registers the definitions of a file, including the nested
+// messages, enums and extensions and the methods of the services. The
+// behaviour for duplicate descriptors is to replace with the new descriptors.
 // The function also associates the file with its path. If multiple files have
 // the same path, the last one is also kept.
 func (r ProtoRegistry) RegisterFile(f protoreflect.FileDescriptor) ProtoRegistry {
 	var toAdd []protoreflect.Descriptor
 
-	enums := f.Enums()
-	for i := 0; i < enums.Len(); i++ {
-		enum := enums.Get(i)
-		toAdd = append(toAdd, enum)
-		values := enum.Values()
-		for j := 0; j < values.Len(); j++ {
-			toAdd = append(toAdd, values.Get(i))
-		}
-	}
-
-	msgs := f.Messages()
-	for i := 0; i < msgs.Len(); i++ {
-		toAdd = append(toAdd, msgs.Get(i))
-	}
-
-	exts := f.Extensions()
-	for i := 0; i < exts.Len(); i++ {
-		toAdd = append(toAdd, exts.Get(i))
-	}
+	toAdd = appendEnums(toAdd, f.Enums())
+	toAdd = appendMessages(toAdd, f.Messages())
+	toAdd = appendExtensions(toAdd, f.Extensions())
 
 	srvs := f.Services()
 	for i := 0; i < srvs.Len(); i++ {
-		toAdd = append(toAdd, srvs.Get(i))
+		srv := srvs.Get(i)
+		toAdd = append(toAdd, srv)
+		methods := srv.Methods()
+		for j := 0; j < methods.Len(); j++ {
+			toAdd = append(toAdd, methods.Get(j))
+		}
 	}
 
 	newDescs := make(map[protoreflect.FullName]protoreflect.Descriptor, len(r.descs)+len(toAdd))
@@ -60,6 +83,36 @@ func (r ProtoRegistry) RegisterFile(f protoreflect.FileDescriptor) ProtoRegistry
 	return ProtoRegistry{descs: newDescs, files: newFiles}
 }
 
+func appendEnums(descs []protoreflect.Descriptor, enums protoreflect.EnumDescriptors) []protoreflect.Descriptor {
+	for i := 0; i < enums.Len(); i++ {
+		enum := enums.Get(i)
+		descs = append(descs, enum)
+		values := enum.Values()
+		for j := 0; j < values.Len(); j++ {
+			descs = append(descs, values.Get(j))
+		}
+	}
+	return descs
+}
+
+func appendMessages(descs []protoreflect.Descriptor, msgs protoreflect.MessageDescriptors) []protoreflect.Descriptor {
+	for i := 0; i < msgs.Len(); i++ {
+		msg := msgs.Get(i)
+		descs = append(descs, msg)
+		descs = appendEnums(descs, msg.Enums())
+		descs = appendMessages(descs, msg.Messages())
+		descs = appendExtensions(descs, msg.Extensions())
+	}
+	return descs
+}
+
+func appendExtensions(descs []protoreflect.Descriptor, exts protoreflect.ExtensionDescriptors) []protoreflect.Descriptor {
+	for i := 0; i < exts.Len(); i++ {
+		descs = append(descs, exts.Get(i))
+	}
+	return descs
+}
+
 func (r ProtoRegistry) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
 	var (
 		desc        protoreflect.Descriptor
@@ -67,7 +120,12 @@ func (r ProtoRegistry) FindDescriptorByName(name protoreflect.FullName) (protore
 		suffixParts []protoreflect.Name
 	)
 
-	// Start by full name and incrementally search for a smaller prefix
+	if desc, ok := r.descs[name]; ok {
+		return desc, nil
+	}
+
+	// Search for fields and oneofs, which are not registered, starting by
+	// the full name and incrementally searching for a smaller prefix
 	for prefix = name; prefix != ""; prefix = prefix.Parent() {
 		var ok bool
 		if desc, ok = r.descs[prefix]; ok {
@@ -165,6 +223,24 @@ func (r ProtoRegistry) FindFileByPath(p string) (protoreflect.FileDescriptor, er
 	return f, nil
 }
 
+// registerWellKnown registers the file of well-known types at path p, and
+// its dependencies, if they are not registered yet. It reports whether the
+// path is of a well-known file.
+func (r ProtoRegistry) registerWellKnown(p string) (ProtoRegistry, bool) {
+	f, ok := wellKnownFiles[p]
+	if !ok {
+		return r, false
+	}
+	if _, registered := r.files[p]; registered {
+		return r, true
+	}
+	imports := f.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		r, _ = r.registerWellKnown(imports.Get(i).Path())
+	}
+	return r.RegisterFile(f), true
+}
+
 func (r ProtoRegistry) String() string {
 	return fmt.Sprintf("ProtoRegistry{\n\tdescriptors: %s,\n\tfiles: %s\n}", r.descs, r.files)
 }
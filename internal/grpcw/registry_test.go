@@ -6,6 +6,7 @@ import (
 	"github.com/DuarteMRAlves/maestro/test/protobuf/unit"
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
@@ -275,3 +276,32 @@ func TestRegisterAndFindFile(t *testing.T) {
 		t.Fatalf("custom file descriptor not the same struct")
 	}
 }
+
+func TestRegisterFile_Nested(t *testing.T) {
+	var registry ProtoRegistry
+	registry = registry.RegisterFile(descriptorpb.File_google_protobuf_descriptor_proto)
+
+	names := []protoreflect.FullName{
+		"google.protobuf.FieldDescriptorProto",
+		"google.protobuf.FieldDescriptorProto.Type",
+		"google.protobuf.FieldDescriptorProto.TYPE_STRING",
+		"google.protobuf.DescriptorProto.ExtensionRange",
+		"google.protobuf.SourceCodeInfo.Location",
+	}
+	for _, name := range names {
+		desc, ok := registry.descs[name]
+		if !ok {
+			t.Fatalf("descriptor %s missing", name)
+		}
+		if diff := cmp.Diff(name, desc.FullName()); diff != "" {
+			t.Fatalf("name mismatch:\n%s", diff)
+		}
+		found, err := registry.FindDescriptorByName(name)
+		if err != nil {
+			t.Fatalf("find %s: %s", name, err)
+		}
+		if found != desc {
+			t.Fatalf("found descriptor for %s not the same struct", name)
+		}
+	}
+}
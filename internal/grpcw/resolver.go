@@ -2,15 +2,21 @@ package grpcw
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/DuarteMRAlves/maestro/internal/method"
 	"github.com/DuarteMRAlves/maestro/internal/retry"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	// Registers the client side health checking.
+	_ "google.golang.org/grpc/health"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
@@ -19,7 +25,9 @@ import (
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
-const reflectionServiceName = "grpc.reflection.v1alpha.ServerReflection"
+// minConnectTimeout is the minimum time to wait for a connection to be
+// established before retrying.
+const minConnectTimeout = 5 * time.Second
 
 var (
 	errMalFormedAddress = errors.New("malformed address")
@@ -32,12 +40,30 @@ type Logger interface {
 	Infof(format string, args ...any)
 }
 
+// ReflectionResolver resolves methods with the grpc reflection service. It
+// is safe to resolve multiple methods concurrently.
 type ReflectionResolver struct {
 	timeout    time.Duration
 	expBackoff retry.ExponentialBackoff
+	// policy retries the reflection requests of the servers without their
+	// own retry policy.
+	policy retry.Policy
 
+	// mu protects the registry and the servers.
+	mu       sync.Mutex
 	registry ProtoRegistry
 
+	// servers stores the connection settings for each server address.
+	servers map[Address]ServerConfig
+
+	// cache stores the descriptors of the services, if not nil.
+	cache       *DescriptorCache
+	cachePolicy CachePolicy
+
+	// setServices are the services defined in the loaded descriptor sets,
+	// which are resolved without reflection.
+	setServices []Service
+
 	logger Logger
 }
 
@@ -49,21 +75,248 @@ func NewReflectionResolver(
 	r := &ReflectionResolver{
 		timeout:    timeout,
 		expBackoff: backoff,
-		registry:   registry,
-		logger:     logger,
+		policy: retry.Policy{
+			Backoff: backoff,
+			Codes:   []codes.Code{codes.Unavailable},
+		},
+		registry: registry,
+		servers:  make(map[Address]ServerConfig),
+		logger:   logger,
 	}
 	return r, nil
 }
 
+// ServerConfig specifies the settings to connect with a server.
+type ServerConfig struct {
+	// TLS configures a secure connection. If nil, the connection is insecure.
+	TLS *tls.Config
+	// Retry specifies the backoffs between the reflection requests, which
+	// are retried while the server is unavailable. Its attempts and codes
+	// are ignored. If nil, the backoff of the resolver is used.
+	Retry *retry.Policy
+	// Credentials authenticate the reflection requests and the calls to the
+	// resolved methods. If nil, the calls are not authenticated.
+	Credentials credentials.PerRPCCredentials
+}
+
+// defaultServiceConfig balances the calls between all the servers of an
+// address and checks their health with the grpc.health.v1 service. Servers
+// that do not implement the health service are considered healthy.
+const defaultServiceConfig = `{
+	"loadBalancingConfig": [{"round_robin": {}}],
+	"healthCheckConfig": {"serviceName": ""}
+}`
+
+func (c ServerConfig) dialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{
+		withDiscovery(),
+		grpc.WithDefaultServiceConfig(defaultServiceConfig),
+	}
+	if c.Credentials != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(c.Credentials))
+	}
+	if c.TLS == nil {
+		return append(opts, grpc.WithInsecure())
+	}
+	return append(opts, grpc.WithTransportCredentials(credentials.NewTLS(c.TLS)))
+}
+
+// ConfigureServer sets the connection settings for the server at address.
+// These settings are used to resolve the methods of the server and by the
+// resolved methods to connect to the server.
+func (m *ReflectionResolver) ConfigureServer(address string, cfg ServerConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.servers == nil {
+		m.servers = make(map[Address]ServerConfig)
+	}
+	m.servers[Address(address)] = cfg
+}
+
+// UseCache makes the resolver store the descriptors of the services in the
+// cache, and use them according to the policy.
+func (m *ReflectionResolver) UseCache(cache *DescriptorCache, policy CachePolicy) {
+	m.cache = cache
+	m.cachePolicy = policy
+}
+
 func (m *ReflectionResolver) Resolve(ctx context.Context, address string) (method.Desc, error) {
 	m.logger.Infof("Load method with reflection: %q\n", address)
 
-	addr, err := m.parseAddress(address)
+	addr, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	dialOpts := m.dialOptions(addr)
+	serviceDesc, err := m.serviceDescriptor(ctx, addr, dialOpts)
+	if err != nil {
+		return nil, err
+	}
+	method, err := findMethod(serviceDesc.Methods(), addr.Method())
+	if err != nil {
+		return nil, err
+	}
+	return newUnaryMethodFromDescriptor(method, addr.Address().String(), dialOpts...), nil
+}
+
+// Describe returns the schema of the methods at address, which may omit the
+// method and the service. If the service is not specified, the methods of
+// all the services of the server are described.
+func (m *ReflectionResolver) Describe(ctx context.Context, address string) (*Schema, error) {
+	methods, err := m.describeMethods(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewSchema(methods), nil
+}
+
+func (m *ReflectionResolver) describeMethods(
+	ctx context.Context, address string,
+) ([]protoreflect.MethodDescriptor, error) {
+	addr, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	dialOpts := m.dialOptions(addr)
+	services := []Service{addr.Service()}
+	if addr.Service().IsUnspecified() {
+		services, err = m.services(ctx, addr, dialOpts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var methods []protoreflect.MethodDescriptor
+	for _, s := range services {
+		serviceAddr := NewAddress(addr.Address(), s, addr.Method())
+		desc, err := m.serviceDescriptor(ctx, serviceAddr, dialOpts)
+		if err != nil {
+			return nil, err
+		}
+		available := desc.Methods()
+		for i := 0; i < available.Len(); i++ {
+			method := available.Get(i)
+			if addr.Method().IsUnspecified() || method.Name() == protoreflect.Name(addr.Method()) {
+				methods = append(methods, method)
+			}
+		}
+	}
+	if len(methods) == 0 && !addr.Method().IsUnspecified() {
+		return nil, &methodNotFound{meth: string(addr.Method())}
+	}
+	return methods, nil
+}
+
+// services lists the services of the server at addr with reflection.
+func (m *ReflectionResolver) services(
+	ctx context.Context, addr addr, dialOpts []grpc.DialOption,
+) ([]Service, error) {
+	conn, err := grpc.Dial(string(addr.Address()), dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	return m.listServices(ctx, conn, m.retryPolicy(addr))
+}
+
+// Pull fetches the descriptors of the service at address with reflection
+// and stores them in the cache. It reports whether the cache changed.
+func (m *ReflectionResolver) Pull(ctx context.Context, address string) (*CacheEntry, bool, error) {
+	if m.cache == nil {
+		return nil, false, errors.New("pull: no descriptor cache")
+	}
+	addr, err := parseAddress(address)
+	if err != nil {
+		return nil, false, err
+	}
+	entry, err := m.reflect(ctx, addr, m.dialOptions(addr))
+	if err != nil {
+		return nil, false, err
+	}
+	// Validate the descriptors before caching them.
+	if _, err := m.registerService(entry.Resolved, entry.Files); err != nil {
+		return nil, false, err
+	}
+	changed, err := m.cache.Put(entry)
+	if err != nil {
+		return nil, false, err
+	}
+	return entry, changed, nil
+}
+
+// retryPolicy returns the policy to retry the reflection requests of the
+// server at addr. Only the backoffs of the server policy are used, so that
+// the requests are retried while the server is unavailable until the
+// timeout of the resolver, as servers may still be starting.
+func (m *ReflectionResolver) retryPolicy(addr addr) retry.Policy {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	policy := m.policy
+	if p := m.servers[addr.Address()].Retry; p != nil {
+		policy.Backoff = p.Backoff
+		policy.Jitter = p.Jitter
+	}
+	return policy
+}
+
+func (m *ReflectionResolver) dialOptions(addr addr) []grpc.DialOption {
+	m.mu.Lock()
+	server := m.servers[addr.Address()]
+	m.mu.Unlock()
+	return append(server.dialOptions(), m.connectParams())
+}
+
+// serviceDescriptor returns the descriptor of the service at addr, from the
+// loaded descriptor sets, the descriptor cache or the reflection service of
+// the server, according to the cache policy.
+func (m *ReflectionResolver) serviceDescriptor(
+	ctx context.Context, addr addr, dialOpts []grpc.DialOption,
+) (protoreflect.ServiceDescriptor, error) {
+	if desc, ok := m.setServiceDescriptor(addr); ok {
+		m.logger.Debugf("Use descriptor set for %s/%s\n", addr.Address(), addr.Service())
+		return desc, nil
+	}
+	if m.cache != nil && m.cachePolicy == CachePrefer {
+		entry, err := m.cache.Get(addr.Address(), addr.Service())
+		switch {
+		case err == nil:
+			m.logger.Debugf("Use cached descriptors for %s/%s\n", addr.Address(), addr.Service())
+			return m.registerService(entry.Resolved, entry.Files)
+		case !errors.Is(err, ErrNotCached):
+			m.logger.Infof("Ignore cached descriptors for %s/%s: %s\n", addr.Address(), addr.Service(), err)
+		}
+	}
+	entry, err := m.reflect(ctx, addr, dialOpts)
+	if err != nil {
+		if m.cache == nil || m.cachePolicy != CacheFallback || !unreachable(err) {
+			return nil, err
+		}
+		cached, cacheErr := m.cache.Get(addr.Address(), addr.Service())
+		if cacheErr != nil {
+			return nil, err
+		}
+		m.logger.Infof("Server %s unreachable, using cached descriptors: %s\n", addr.Address(), err)
+		return m.registerService(cached.Resolved, cached.Files)
+	}
+	desc, err := m.registerService(entry.Resolved, entry.Files)
 	if err != nil {
 		return nil, err
 	}
+	if m.cache != nil {
+		if _, err := m.cache.Put(entry); err != nil {
+			m.logger.Infof("Update descriptor cache: %s\n", err)
+		}
+	}
+	return desc, nil
+}
 
-	conn, err := grpc.Dial(string(addr.Address()), grpc.WithInsecure())
+// reflect fetches the descriptors of the service at addr with the
+// reflection service of the server.
+func (m *ReflectionResolver) reflect(
+	ctx context.Context, addr addr, dialOpts []grpc.DialOption,
+) (*CacheEntry, error) {
+	conn, err := grpc.Dial(string(addr.Address()), dialOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +324,8 @@ func (m *ReflectionResolver) Resolve(ctx context.Context, address string) (metho
 	ctx, cancel := context.WithTimeout(ctx, m.timeout)
 	defer cancel()
 
-	services, err := m.listServices(ctx, conn)
+	policy := m.retryPolicy(addr)
+	services, err := m.listServices(ctx, conn, policy)
 	if err != nil {
 		return nil, err
 	}
@@ -79,19 +333,65 @@ func (m *ReflectionResolver) Resolve(ctx context.Context, address string) (metho
 	if err != nil {
 		return nil, err
 	}
-	serviceDesc, err := m.resolveService(ctx, conn, service)
+	files, err := m.fetchFiles(ctx, conn, service, policy)
 	if err != nil {
 		return nil, err
 	}
-	method, err := findMethod(serviceDesc.Methods(), addr.Method())
+	entry := &CacheEntry{
+		Address:  addr.Address(),
+		Service:  Service(addr.Service().String()),
+		Resolved: service,
+		Files:    files,
+	}
+	return entry, nil
+}
+
+// unreachable reports whether err was caused by a server that could not be
+// reached.
+func unreachable(err error) bool {
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		code := grpcErr.GRPCStatus().Code()
+		return code == codes.Unavailable || code == codes.DeadlineExceeded
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// connectParams configures the reconnections with the servers to use the
+// backoff of the resolver, so that servers that are starting are connected
+// as soon as they are ready.
+func (m *ReflectionResolver) connectParams() grpc.DialOption {
+	cfg := backoff.Config{
+		BaseDelay:  m.expBackoff.Initial(),
+		Multiplier: float64(m.expBackoff.Factor()),
+		Jitter:     m.expBackoff.Jitter(),
+		MaxDelay:   m.expBackoff.Max(),
+	}
+	if cfg.MaxDelay == 0 {
+		cfg.MaxDelay = backoff.DefaultConfig.MaxDelay
+	}
+	return grpc.WithConnectParams(grpc.ConnectParams{
+		Backoff:           cfg,
+		MinConnectTimeout: minConnectTimeout,
+	})
+}
+
+// ServerAddress returns the address of the server in a method address, which
+// can be used to configure the server.
+func ServerAddress(address string) (string, error) {
+	addr, err := parseAddress(address)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return newUnaryMethodFromDescriptor(method, addr.Address().String()), nil
+	return string(addr.Address()), nil
 }
 
-func (r *ReflectionResolver) parseAddress(address string) (addr, error) {
+// parseAddress splits a method address into the server, service and method.
+func parseAddress(address string) (addr, error) {
 	var addr addr
+	if hasScheme(address) {
+		return parseSchemeAddress(address)
+	}
 	splits := strings.Split(address, "/")
 	switch n := len(splits); n {
 	// No backslash, only address was specified.
@@ -112,31 +412,46 @@ func (r *ReflectionResolver) parseAddress(address string) (addr, error) {
 	return addr, nil
 }
 
+// parseSchemeAddress parses an address where the server is a target with a
+// scheme, such as dns:///host:port/service/method. As the target may have
+// slashes, the service and method must always be specified, even if with *.
+func parseSchemeAddress(address string) (addr, error) {
+	var addr addr
+	i := strings.Index(address, "://")
+	splits := strings.Split(address[i+len("://"):], "/")
+	// The target has at least the authority, which may be empty, and the
+	// endpoint.
+	n := len(splits)
+	if n < 4 {
+		return addr, errMalFormedAddress
+	}
+	target := address[:i+len("://")] + strings.Join(splits[:n-2], "/")
+	addr.server = Address(target)
+	addr.service = Service(splits[n-2])
+	addr.method = Method(splits[n-1])
+	return addr, nil
+}
+
 func (m *ReflectionResolver) listServices(
-	ctx context.Context, conn grpc.ClientConnInterface,
+	ctx context.Context, conn grpc.ClientConnInterface, policy retry.Policy,
 ) ([]Service, error) {
-	var (
-		all []string
-		st  *status.Status
-	)
-
-	retry.WhileTrue(func() bool {
+	var all []string
+	_, err := policy.Do(ctx, retry.RealClock, func() error {
 		stream, err := newBlockingReflectionStream(ctx, conn)
 		if err != nil {
-			st, _ = status.FromError(err)
-			return st.Code() == codes.Unavailable
+			return err
 		}
 		all, err = stream.listServiceNames()
-		st, _ = status.FromError(err)
-		return st.Code() == codes.Unavailable
-	}, &m.expBackoff)
-	if st.Err() != nil {
+		return err
+	})
+	if err != nil {
+		st, _ := status.FromError(err)
 		return nil, fmt.Errorf("list services: %w", st.Err())
 	}
-	// Filter the reflection service
-	services := make([]Service, 0, len(all)-1)
+	// Filter the reflection services
+	services := make([]Service, 0, len(all))
 	for _, s := range all {
-		if s != reflectionServiceName {
+		if v := reflectionVersion(s); v != reflectionV1 && v != reflectionV1Alpha {
 			services = append(services, Service(s))
 		}
 	}
@@ -159,24 +474,21 @@ func findService(available []Service, search Service) (Service, error) {
 	}
 }
 
-func (m *ReflectionResolver) resolveService(
-	ctx context.Context, conn grpc.ClientConnInterface, service Service,
-) (protoreflect.ServiceDescriptor, error) {
-	var (
-		data [][]byte
-		st   *status.Status
-	)
-
-	retry.WhileTrue(func() bool {
+// fetchFiles fetches the file descriptors that define the service, and their
+// dependencies, ordered so that each file comes after its dependencies.
+func (m *ReflectionResolver) fetchFiles(
+	ctx context.Context, conn grpc.ClientConnInterface, service Service, policy retry.Policy,
+) ([][]byte, error) {
+	var data [][]byte
+	_, err := policy.Do(ctx, retry.RealClock, func() error {
 		stream, err := newBlockingReflectionStream(ctx, conn)
 		if err != nil {
-			st, _ = status.FromError(err)
-			return st.Code() == codes.Unavailable
+			return err
 		}
-		data, err = stream.filesForSymbol(string(service))
-		st, _ = status.FromError(err)
-		return st.Code() == codes.Unavailable
-	}, &m.expBackoff)
+		data, err = stream.filesWithDependencies(string(service))
+		return err
+	})
+	st, _ := status.FromError(err)
 	if st.Err() != nil {
 		switch st.Code() {
 		case codes.NotFound:
@@ -185,6 +497,16 @@ func (m *ReflectionResolver) resolveService(
 			return nil, fmt.Errorf("resolve service %s: %w", service, st.Err())
 		}
 	}
+	return data, nil
+}
+
+// registerService registers the file descriptors and returns the
+// descriptor of the service.
+func (m *ReflectionResolver) registerService(
+	service Service, data [][]byte,
+) (protoreflect.ServiceDescriptor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if err := m.registerFiles(data); err != nil {
 		return nil, fmt.Errorf("resolve service %s: %w", service, err)
 	}
@@ -199,13 +521,43 @@ func (m *ReflectionResolver) resolveService(
 	return desc, nil
 }
 
+// registerFiles registers the file descriptors after their dependencies.
+// Dependencies that are neither in data nor registered must be well-known
+// types.
 func (m *ReflectionResolver) registerFiles(data [][]byte) error {
+	fds := make([]*descriptorpb.FileDescriptorProto, 0, len(data))
 	for _, buf := range data {
 		var descPb descriptorpb.FileDescriptorProto
 		if err := proto.Unmarshal(buf, &descPb); err != nil {
 			return err
 		}
-		desc, err := protodesc.NewFile(&descPb, m.registry)
+		fds = append(fds, &descPb)
+	}
+	return m.registerFileProtos(fds)
+}
+
+// registerFileProtos registers the file descriptors after their
+// dependencies, as registerFiles.
+func (m *ReflectionResolver) registerFileProtos(fds []*descriptorpb.FileDescriptorProto) error {
+	received := make(map[string]bool, len(fds))
+	for _, fd := range fds {
+		received[fd.GetName()] = true
+	}
+	for _, i := range sortByDependencies(fds) {
+		descPb := fds[i]
+		for _, dep := range descPb.GetDependency() {
+			if received[dep] {
+				continue
+			}
+			if _, err := m.registry.FindFileByPath(dep); err == nil {
+				continue
+			}
+			var ok bool
+			if m.registry, ok = m.registry.registerWellKnown(dep); !ok {
+				return &missingDependency{file: descPb.GetName(), dep: dep}
+			}
+		}
+		desc, err := protodesc.NewFile(descPb, m.registry)
 		if err != nil {
 			return err
 		}
@@ -214,6 +566,36 @@ func (m *ReflectionResolver) registerFiles(data [][]byte) error {
 	return nil
 }
 
+// sortByDependencies returns the indexes of the files ordered so that each
+// file comes after its dependencies, keeping the received order otherwise.
+func sortByDependencies(fds []*descriptorpb.FileDescriptorProto) []int {
+	index := make(map[string]int, len(fds))
+	for i, fd := range fds {
+		if _, ok := index[fd.GetName()]; !ok {
+			index[fd.GetName()] = i
+		}
+	}
+	sorted := make([]int, 0, len(fds))
+	visited := make(map[int]bool, len(fds))
+	var visit func(i int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		for _, dep := range fds[i].GetDependency() {
+			if j, ok := index[dep]; ok {
+				visit(j)
+			}
+		}
+		sorted = append(sorted, i)
+	}
+	for i := range fds {
+		visit(i)
+	}
+	return sorted
+}
+
 func findMethod(
 	available protoreflect.MethodDescriptors, search Method,
 ) (protoreflect.MethodDescriptor, error) {
@@ -316,6 +698,14 @@ func (err *notService) Error() string {
 	return fmt.Sprintf("symbol not a service: %q", err.symb)
 }
 
+type missingDependency struct {
+	file, dep string
+}
+
+func (err *missingDependency) Error() string {
+	return fmt.Sprintf("file %s: dependency not found: %s", err.file, err.dep)
+}
+
 type methodNotFound struct {
 	meth string
 }
@@ -17,7 +17,9 @@ import (
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 func TestReflectionClient_SlowServerStartup(t *testing.T) {
@@ -72,7 +74,7 @@ func TestReflectionClient_ListServices(t *testing.T) {
 	}(conn)
 
 	m := ReflectionResolver{timeout: 5 * time.Second}
-	services, err := m.listServices(ctx, conn)
+	services, err := m.listServices(ctx, conn, m.policy)
 	if err != nil {
 		t.Fatalf("list services: %s", err)
 	}
@@ -118,7 +120,7 @@ func TestReflectionClient_ListServicesNoReflection(t *testing.T) {
 	}(conn)
 
 	m := ReflectionResolver{timeout: 5 * time.Second}
-	services, err := m.listServices(ctx, conn)
+	services, err := m.listServices(ctx, conn, m.policy)
 	if err == nil {
 		t.Fatalf("expected non nil error at listServices")
 	}
@@ -150,29 +152,28 @@ func TestReflectionClient_ResolveService_TestService(t *testing.T) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	conn, err := grpc.Dial(addr, grpc.WithInsecure())
-	if err != nil {
-		t.Fatalf("dial error: %s", err)
-	}
-	defer func(conn *grpc.ClientConn) {
-		if err := conn.Close(); err != nil {
-			t.Errorf("close connection: %s", err)
-		}
-	}(conn)
-
 	serviceName := Service("unit.MethodLoaderTestService")
 	var backoff retry.ExponentialBackoff
-	m, err := NewReflectionResolver(5*time.Second, backoff, nil)
+	m, err := NewReflectionResolver(5*time.Second, backoff, testLogger{})
 	if err != nil {
 		t.Fatalf("create resolver: %v", err)
 	}
-	serv, err := m.resolveService(ctx, conn, serviceName)
+	serv, err := resolveTestService(ctx, m, addr, serviceName)
 	if err != nil {
 		t.Fatalf("resolve service: %s", err)
 	}
 	assertTestService(t, serv)
 }
 
+// resolveTestService resolves the service at address with the same path as
+// the resolution of the methods.
+func resolveTestService(
+	ctx context.Context, m *ReflectionResolver, address string, service Service,
+) (protoreflect.ServiceDescriptor, error) {
+	a := NewAddress(Address(address), service, "")
+	return m.serviceDescriptor(ctx, a, m.dialOptions(a))
+}
+
 func assertTestService(t *testing.T, descriptor protoreflect.ServiceDescriptor) {
 	methods := descriptor.Methods()
 	if diff := cmp.Diff(4, methods.Len()); diff != "" {
@@ -290,21 +291,11 @@ func TestReflectionClient_ResolveServiceNoReflection(t *testing.T) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	conn, err := grpc.Dial(addr, grpc.WithInsecure())
-	if err != nil {
-		t.Fatalf("dial: %s", err)
-	}
-	defer func(conn *grpc.ClientConn) {
-		if err := conn.Close(); err != nil {
-			t.Errorf("close connection: %s", err)
-		}
-	}(conn)
-
 	serviceName := Service("pb.TestService")
 	m := ReflectionResolver{timeout: 5 * time.Second}
-	serv, err := m.resolveService(ctx, conn, serviceName)
+	serv, err := resolveTestService(ctx, &m, addr, serviceName)
 	if err == nil {
-		t.Fatalf("expected non nil error at resolveService")
+		t.Fatalf("expected non nil error at serviceDescriptor")
 	}
 	cause, ok := errors.Unwrap(err).(interface {
 		GRPCStatus() *status.Status
@@ -333,21 +324,11 @@ func TestReflectionClient_ResolveServiceUnknownService(t *testing.T) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	conn, err := grpc.Dial(addr, grpc.WithInsecure())
-	if err != nil {
-		t.Fatalf("dial: %s", err)
-	}
-	defer func(conn *grpc.ClientConn) {
-		if err := conn.Close(); err != nil {
-			t.Errorf("close connection: %s", err)
-		}
-	}(conn)
-
 	serviceName := Service("pb.UnknownService")
 	m := ReflectionResolver{timeout: 5 * time.Second}
-	serv, err := m.resolveService(ctx, conn, serviceName)
+	serv, err := resolveTestService(ctx, &m, addr, serviceName)
 	if err == nil {
-		t.Fatalf("expected non nil error at listServices")
+		t.Fatalf("expected non nil error at serviceDescriptor")
 	}
 
 	var notFoundErr interface{ NotFound() }
@@ -410,3 +391,105 @@ func (t testLogger) Debugf(format string, args ...any) {
 func (t testLogger) Infof(format string, args ...any) {
 	fmt.Printf(format, args...)
 }
+
+func TestReflectionResolver_RegisterFiles(t *testing.T) {
+	message := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("message.proto"),
+		Package:    proto.String("deps"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Message"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("time"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				TypeName: proto.String(".google.protobuf.Timestamp"),
+			}},
+			NestedType: []*descriptorpb.DescriptorProto{{Name: proto.String("Nested")}},
+		}},
+	}
+	service := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("service.proto"),
+		Package:    proto.String("deps"),
+		Dependency: []string{"message.proto", "google/protobuf/struct.proto"},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Service"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Method"),
+				InputType:  proto.String(".deps.Message.Nested"),
+				OutputType: proto.String(".google.protobuf.Struct"),
+			}},
+		}},
+	}
+	marshal := func(fds ...*descriptorpb.FileDescriptorProto) [][]byte {
+		var data [][]byte
+		for _, fd := range fds {
+			buf, err := proto.Marshal(fd)
+			if err != nil {
+				t.Fatalf("marshal: %s", err)
+			}
+			data = append(data, buf)
+		}
+		return data
+	}
+
+	// The service is received before its dependency and the well-known
+	// types are not received.
+	var m ReflectionResolver
+	desc, err := m.registerService("deps.Service", marshal(service, message))
+	if err != nil {
+		t.Fatalf("register service: %s", err)
+	}
+	method := desc.Methods().ByName("Method")
+	if diff := cmp.Diff(protoreflect.FullName("deps.Message.Nested"), method.Input().FullName()); diff != "" {
+		t.Fatalf("input mismatch:\n%s", diff)
+	}
+	if diff := cmp.Diff(protoreflect.FullName("google.protobuf.Struct"), method.Output().FullName()); diff != "" {
+		t.Fatalf("output mismatch:\n%s", diff)
+	}
+
+	missing := proto.Clone(service).(*descriptorpb.FileDescriptorProto)
+	missing.Dependency = append(missing.Dependency, "other.proto")
+	var missingErr *missingDependency
+	err = (&ReflectionResolver{}).registerFiles(marshal(message, missing))
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("expected missing dependency error, got %v", err)
+	}
+	if diff := cmp.Diff("other.proto", missingErr.dep); diff != "" {
+		t.Fatalf("dependency mismatch:\n%s", diff)
+	}
+}
+
+func TestReflectionResolver_RetryPolicy(t *testing.T) {
+	r, err := NewReflectionResolver(time.Second, retry.ExponentialBackoff{}, testLogger{})
+	if err != nil {
+		t.Fatalf("create resolver error: %s", err)
+	}
+	backoff := retry.NewExponentialBackoff(time.Second, 3).WithMax(time.Minute)
+	r.ConfigureServer("localhost:8080", ServerConfig{
+		Retry: &retry.Policy{
+			MaxAttempts: 2,
+			Backoff:     backoff,
+			Jitter:      retry.JitterFull,
+			Codes:       []codes.Code{codes.Internal},
+		},
+	})
+	a, err := parseAddress("localhost:8080/Service/Method")
+	if err != nil {
+		t.Fatalf("parse address error: %s", err)
+	}
+
+	// The attempts and codes of the server policy are ignored, so that the
+	// reflection requests are retried until the timeout.
+	expected := retry.Policy{
+		Backoff: backoff,
+		Jitter:  retry.JitterFull,
+		Codes:   []codes.Code{codes.Unavailable},
+	}
+	actual := r.retryPolicy(a)
+	opts := cmp.AllowUnexported(retry.ExponentialBackoff{})
+	if diff := cmp.Diff(expected, actual, opts); diff != "" {
+		t.Fatalf("policy mismatch:\n%s", diff)
+	}
+}
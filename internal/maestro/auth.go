@@ -0,0 +1,93 @@
+package maestro
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/auth"
+)
+
+// authCredentials creates the credentials that authenticate the calls to a
+// server from their specification.
+func authCredentials(spec *api.Auth) (*auth.Credentials, error) {
+	var (
+		src auth.TokenSource
+		err error
+	)
+	switch {
+	case spec.OAuth2 != nil && spec.JWT != nil:
+		return nil, errors.New("oauth2 and jwt must not be specified together")
+	case spec.OAuth2 != nil:
+		src, err = clientCredentials(spec.OAuth2)
+	case spec.JWT != nil:
+		src, err = jwtSigner(spec.JWT)
+	default:
+		return nil, errors.New("one of oauth2 or jwt must be specified")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewCredentials(src, spec.RefreshBefore, spec.Insecure), nil
+}
+
+func clientCredentials(spec *api.OAuth2) (*auth.ClientCredentials, error) {
+	if spec.TokenURL == "" || spec.ClientID == "" {
+		return nil, errors.New("oauth2: token url and client id are required")
+	}
+	secret, err := clientSecret(spec)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: client secret: %w", err)
+	}
+	src := &auth.ClientCredentials{
+		TokenURL:     spec.TokenURL,
+		ClientID:     spec.ClientID,
+		ClientSecret: secret,
+		Scopes:       spec.Scopes,
+		Audience:     spec.Audience,
+	}
+	return src, nil
+}
+
+// clientSecret reads the secret of the client from the configuration, the
+// environment or a file.
+func clientSecret(spec *api.OAuth2) (string, error) {
+	switch {
+	case spec.ClientSecretEnv != "":
+		v, ok := os.LookupEnv(spec.ClientSecretEnv)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s not set", spec.ClientSecretEnv)
+		}
+		return v, nil
+	case spec.ClientSecretFile != "":
+		data, err := os.ReadFile(spec.ClientSecretFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	default:
+		return spec.ClientSecret, nil
+	}
+}
+
+func jwtSigner(spec *api.JWT) (*auth.JWTSigner, error) {
+	if spec.KeyFile == "" {
+		return nil, errors.New("jwt: key file is required")
+	}
+	key, err := auth.ReadPrivateKey(spec.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: %w", err)
+	}
+	claims := auth.JWTClaims{
+		Issuer:   spec.Issuer,
+		Subject:  spec.Subject,
+		Audience: spec.Audience,
+	}
+	signer, err := auth.NewJWTSigner(key, spec.KeyID, claims, spec.Lifetime)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: %w", err)
+	}
+	return signer, nil
+}
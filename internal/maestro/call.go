@@ -0,0 +1,154 @@
+package maestro
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/grpcw"
+	"github.com/DuarteMRAlves/maestro/internal/logs"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+	"github.com/spf13/cobra"
+)
+
+// defaultCallTimeout is the default time to resolve and to call the method.
+const defaultCallTimeout = 10 * time.Second
+
+type CallOpts struct {
+	address string
+	data    string
+	timeout time.Duration
+	verbose bool
+
+	tls tlsOpts
+
+	inR    io.Reader
+	outW   io.Writer
+	logger logs.Logger
+}
+
+func NewCallCmd() *cobra.Command {
+	var opts CallOpts
+
+	cmd := cobra.Command{
+		Use:                   "call [OPTIONS] ADDRESS/SERVICE/METHOD",
+		DisableFlagsInUseLine: true,
+		Short:                 "Call the method of a stage",
+		Long: `Call the method of a stage with a request in the protobuf json format
+and print the response.
+
+The address has the same format as the address of a stage, and the method
+is resolved and called in the same way as when the pipeline is executed.
+The request is given with --data, where @FILE reads it from a file and @-
+from the standard input.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := opts.complete(cmd, args); err != nil {
+				opts.logger.Infof("fatal: %s\n", err)
+				os.Exit(1)
+			}
+			if err := opts.run(); err != nil {
+				opts.logger.Infof("fatal: %s\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.data, "data", "d", "{}", "request in the protobuf json format")
+	cmd.Flags().DurationVar(
+		&opts.timeout, "timeout", defaultCallTimeout, "maximum time to resolve and to call the method",
+	)
+	cmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "increase verbosity")
+	opts.tls.addFlags(&cmd)
+
+	return &cmd
+}
+
+func (opts *CallOpts) complete(cmd *cobra.Command, args []string) error {
+	opts.inR = cmd.InOrStdin()
+	opts.outW = cmd.OutOrStdout()
+	opts.logger = logs.NewWithOutput(cmd.ErrOrStderr(), opts.verbose)
+	if len(args) != 1 {
+		return errors.New("expected exactly one address")
+	}
+	opts.address = args[0]
+	return opts.tls.validate()
+}
+
+func (opts *CallOpts) run() error {
+	data, err := opts.request()
+	if err != nil {
+		return err
+	}
+
+	backoff := retry.ExponentialBackoff{}.WithMax(defaultMaxBackoff).WithJitter(defaultBackoffJitter)
+	r, err := grpcw.NewReflectionResolver(opts.timeout, backoff, opts.logger)
+	if err != nil {
+		return err
+	}
+	if err := opts.tls.configure(r, opts.address); err != nil {
+		return err
+	}
+	desc, err := r.Resolve(context.Background(), opts.address)
+	if err != nil {
+		return err
+	}
+
+	var codec grpcw.Codec
+	req, err := codec.UnmarshalMessage(data, desc.Input())
+	if err != nil {
+		return fmt.Errorf("parse request: %w", err)
+	}
+	conn, err := desc.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	rep, err := conn.Call(ctx, req)
+	if err != nil {
+		return err
+	}
+	repData, err := codec.MarshalMessage(rep)
+	if err != nil {
+		return fmt.Errorf("write response: %w", err)
+	}
+	// The protobuf json format does not have a stable layout, so it is
+	// indented again.
+	var out bytes.Buffer
+	if err := json.Indent(&out, repData, "", "  "); err != nil {
+		return fmt.Errorf("write response: %w", err)
+	}
+	out.WriteRune('\n')
+	_, err = out.WriteTo(opts.outW)
+	return err
+}
+
+// request returns the request data, reading it from a file or the standard
+// input if it starts with @.
+func (opts *CallOpts) request() ([]byte, error) {
+	if !strings.HasPrefix(opts.data, "@") {
+		return []byte(opts.data), nil
+	}
+	name := strings.TrimPrefix(opts.data, "@")
+	var (
+		data []byte
+		err  error
+	)
+	if name == "-" {
+		data, err = io.ReadAll(opts.inR)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read request: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,94 @@
+package maestro
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCallCmd(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	s := newTestServer()
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	requestFile := filepath.Join(t.TempDir(), "request.json")
+	if err := os.WriteFile(requestFile, []byte(`{"service": ""}`), 0644); err != nil {
+		t.Fatalf("write request: %s", err)
+	}
+	address := lis.Addr().String() + "/grpc.health.v1.Health/Check"
+	expected := "{\n  \"status\": \"SERVING\"\n}\n"
+
+	tests := map[string]struct {
+		args  []string
+		stdin string
+	}{
+		"default request": {
+			args: []string{address},
+		},
+		"data": {
+			args: []string{address, "--data", `{"service": ""}`},
+		},
+		"data file": {
+			args: []string{address, "--data", "@" + requestFile},
+		},
+		"data stdin": {
+			args:  []string{address, "--data", "@-"},
+			stdin: `{"service": ""}`,
+		},
+		"unspecified service": {
+			args: []string{lis.Addr().String() + "//Check"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			cmd := NewCallCmd()
+			cmd.SetArgs(tc.args)
+			cmd.SetIn(strings.NewReader(tc.stdin))
+			cmd.SetOut(&stdout)
+			cmd.SetErr(&stderr)
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("execute: %s", err)
+			}
+			if diff := cmp.Diff(expected, stdout.String()); diff != "" {
+				t.Fatalf("response mismatch:\n%s\nlogs:\n%s", diff, stderr.String())
+			}
+		})
+	}
+
+	errTests := map[string]struct {
+		address string
+		data    string
+	}{
+		"unknown method":  {address: lis.Addr().String() + "/grpc.health.v1.Health/Unknown", data: "{}"},
+		"invalid request": {address: address, data: `{"unknown": 1}`},
+		"missing file":    {address: address, data: "@" + filepath.Join(t.TempDir(), "missing.json")},
+	}
+	for name, tc := range errTests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			cmd := NewCallCmd()
+			cmd.SetOut(&stdout)
+			cmd.SetErr(&stderr)
+			opts := CallOpts{data: tc.data, timeout: defaultCallTimeout}
+			if err := opts.complete(cmd, []string{tc.address}); err != nil {
+				t.Fatalf("complete: %s", err)
+			}
+			if err := opts.run(); err == nil {
+				t.Fatalf("expected error")
+			}
+			if stdout.Len() != 0 {
+				t.Fatalf("unexpected response: %s", stdout.String())
+			}
+		})
+	}
+}
@@ -3,16 +3,37 @@ package maestro
 import (
 	"errors"
 	"fmt"
-	"github.com/DuarteMRAlves/maestro/internal/yaml"
-	"github.com/spf13/cobra"
 	"io"
 	"log"
+	"os"
 	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/auth"
+	"github.com/DuarteMRAlves/maestro/internal/compiled"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+	"github.com/DuarteMRAlves/maestro/internal/yaml"
+	"github.com/spf13/cobra"
+)
+
+const (
+	formatV0   = "v0"
+	formatV1   = "v1"
+	formatJSON = "json"
+	// formatCanonical is the v1 format with the pipelines, stages and links
+	// sorted by name and the default values filled.
+	formatCanonical = "canonical"
 )
 
 type ConvertOpts struct {
-	inFile  string
+	inFiles []string
 	outFile string
+	from    string
+	to      string
+	split   bool
 
 	outW io.Writer
 }
@@ -21,16 +42,28 @@ func NewConvertCmd() *cobra.Command {
 	var opts ConvertOpts
 
 	cmd := cobra.Command{
-		Use:                   "convert [OPTIONS] v0-file",
+		Use:                   "convert [OPTIONS] file...",
 		DisableFlagsInUseLine: true,
-		Short:                 "Convert configs from version 0 to version 1",
-		Long:                  "Convert a configuration file from version 0 to version 1.",
+		Short:                 "Convert configs between formats",
+		Long: `Convert configuration files between formats.
+
+The supported source formats are v0 and v1, where v1 files with the .json
+extension are read in the json format. The supported target formats are
+v0, v1, json and canonical, which is the v1 format with the pipelines,
+stages and links sorted by name and the default values filled. The
+service and method of the stages, and the sections that are not specified,
+such as retry or circuit_breaker, are left unset.
+
+Multiple v1 files can be converted together. By default all the pipelines
+are written to a single file. With --split, each pipeline is written to
+its own file, named after the pipeline, in the output directory.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			var err error
 			if err = opts.complete(cmd, args); err != nil {
 				if _, writeErr := fmt.Fprintln(opts.outW, err); writeErr != nil {
 					log.Fatalf("write error at convert command: %s\n", writeErr)
 				}
+				return
 			}
 			if err = opts.run(); err != nil {
 				if _, writeErr := fmt.Fprintln(opts.outW, err); writeErr != nil {
@@ -41,31 +74,218 @@ func NewConvertCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(
-		&opts.outFile, "output", "o", "", "name for the output file (defaults to conv-<in-file>",
+		&opts.outFile,
+		"output",
+		"o",
+		"",
+		"name for the output file (defaults to conv-<in-file>), or directory with --split",
 	)
+	cmd.Flags().StringVar(&opts.from, "from", formatV0, "format of the input files (v0, v1, json)")
+	cmd.Flags().StringVar(
+		&opts.to,
+		"to",
+		formatV1,
+		"format of the output files (v0, v1, json, canonical). Defaults to json for .json output files",
+	)
+	cmd.Flags().BoolVar(&opts.split, "split", false, "write each pipeline to its own file")
 
 	return &cmd
 }
 
 func (o *ConvertOpts) complete(cmd *cobra.Command, args []string) error {
 	o.outW = cmd.OutOrStdout()
-	if len(args) != 1 {
-		return errors.New("invalid number of arguments: expected one with source file")
+	if len(args) == 0 {
+		return errors.New("invalid number of arguments: expected at least one source file")
 	}
-	o.inFile = args[0]
+	o.inFiles = args
 
-	if o.outFile == "" {
-		dir, f := path.Split(o.inFile)
-		conv := fmt.Sprintf("conv-%s", f)
+	switch o.from {
+	case formatV0:
+		if len(o.inFiles) > 1 {
+			return errors.New("only one source file allowed for v0 format")
+		}
+	case formatV1, formatJSON:
+	default:
+		return fmt.Errorf("unknown source format %q: expected v0, v1 or json", o.from)
+	}
+	if !cmd.Flags().Changed("to") && !o.split && yaml.IsJSONFile(o.outFile) {
+		o.to = formatJSON
+	}
+	switch o.to {
+	case formatV0, formatV1, formatJSON, formatCanonical:
+	default:
+		return fmt.Errorf("unknown target format %q: expected v0, v1, json or canonical", o.to)
+	}
+
+	if o.outFile == "" && !o.split {
+		dir, f := path.Split(o.inFiles[0])
+		base := strings.TrimSuffix(f, filepath.Ext(f))
+		conv := fmt.Sprintf("conv-%s%s", base, o.outExt(f))
 		o.outFile = path.Join(dir, conv)
 	}
+	if o.outFile == "" && o.split {
+		o.outFile = path.Dir(o.inFiles[0])
+	}
 	return nil
 }
 
+// outExt returns the extension for the output files. The extension of the
+// input file is kept if it is in the same format.
+func (o *ConvertOpts) outExt(inFile string) string {
+	if o.to == formatJSON {
+		return ".json"
+	}
+	ext := filepath.Ext(inFile)
+	if ext == ".yml" || ext == ".yaml" {
+		return ext
+	}
+	return ".yml"
+}
+
 func (o *ConvertOpts) run() error {
-	resources, err := yaml.ReadV0(o.inFile)
-	if err != nil {
+	var pipelines []*api.Pipeline
+	switch o.from {
+	case formatV0:
+		p, err := yaml.ReadV0(o.inFiles[0])
+		if err != nil {
+			return err
+		}
+		pipelines = []*api.Pipeline{p}
+	default:
+		var err error
+		pipelines, err = yaml.ReadV1(o.inFiles...)
+		if err != nil {
+			return err
+		}
+	}
+	if o.to == formatCanonical {
+		pipelines = canonicalPipelines(pipelines)
+	}
+
+	if !o.split {
+		return o.write(o.outFile, pipelines)
+	}
+	if err := os.MkdirAll(o.outFile, 0755); err != nil {
 		return err
 	}
-	return yaml.WriteV1(resources, o.outFile, 0644)
+	for _, p := range pipelines {
+		file := path.Join(o.outFile, p.Name+o.outExt(o.inFiles[0]))
+		if err := o.write(file, []*api.Pipeline{p}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *ConvertOpts) write(file string, pipelines []*api.Pipeline) error {
+	switch o.to {
+	case formatV0:
+		if len(pipelines) != 1 {
+			return errors.New("v0 format supports a single pipeline per file: use --split")
+		}
+		return yaml.WriteV0(pipelines[0], file, 0644)
+	case formatJSON:
+		return yaml.WriteV1JSON(pipelines, file, 0644)
+	default:
+		return yaml.WriteV1(pipelines, file, 0644)
+	}
+}
+
+// canonicalPipelines returns copies of the pipelines where the pipelines,
+// stages and links are sorted by name, and the fields that are not set are
+// filled with the values used by default when executing the pipelines. The
+// service and method of the stages are left unset as they are only known
+// once the servers are contacted, and so are the optional sections, such as
+// the retry policy or the circuit breaker, that are not specified.
+func canonicalPipelines(pipelines []*api.Pipeline) []*api.Pipeline {
+	canonical := make([]*api.Pipeline, 0, len(pipelines))
+	for _, p := range pipelines {
+		c := *p
+		c.Stages = make([]*api.Stage, 0, len(p.Stages))
+		for _, s := range p.Stages {
+			c.Stages = append(c.Stages, canonicalStage(s))
+		}
+		c.Links = make([]*api.Link, 0, len(p.Links))
+		for _, l := range p.Links {
+			cl := *l
+			if cl.Size == 0 {
+				cl.Size = compiled.DefaultLinkSize
+			}
+			if cl.Match == "" {
+				cl.Match = string(compiled.MatchByNumber)
+			}
+			c.Links = append(c.Links, &cl)
+		}
+		sort.SliceStable(c.Stages, func(i, j int) bool {
+			return c.Stages[i].Name < c.Stages[j].Name
+		})
+		sort.SliceStable(c.Links, func(i, j int) bool {
+			return c.Links[i].Name < c.Links[j].Name
+		})
+		canonical = append(canonical, &c)
+	}
+	sort.SliceStable(canonical, func(i, j int) bool {
+		return canonical[i].Name < canonical[j].Name
+	})
+	return canonical
+}
+
+func canonicalStage(s *api.Stage) *api.Stage {
+	cs := *s
+	if cs.Timeout == 0 {
+		cs.Timeout = compiled.DefaultStageTimeout
+	}
+	if cs.OnError == "" {
+		cs.OnError = string(compiled.ErrorPolicyFail)
+	}
+	if s.Retry != nil {
+		r := *s.Retry
+		if r.MaxAttempts == 0 {
+			r.MaxAttempts = compiled.DefaultRetryAttempts
+		}
+		if r.InitialBackoff == 0 {
+			r.InitialBackoff = compiled.DefaultRetryInitialBackoff
+		}
+		if r.MaxBackoff == 0 {
+			r.MaxBackoff = compiled.DefaultRetryMaxBackoff
+		}
+		if r.Jitter == "" {
+			r.Jitter = string(retry.JitterFull)
+		}
+		if len(r.Codes) == 0 {
+			r.Codes = []string{compiled.DefaultRetryCode}
+		}
+		cs.Retry = &r
+	}
+	if s.CircuitBreaker != nil {
+		cb := *s.CircuitBreaker
+		if cb.Window == 0 {
+			cb.Window = compiled.DefaultBreakerWindow
+		}
+		if cb.OpenTimeout == 0 {
+			cb.OpenTimeout = compiled.DefaultBreakerOpenTimeout
+		}
+		if cb.HalfOpenProbes == 0 {
+			cb.HalfOpenProbes = compiled.DefaultBreakerHalfOpenProbes
+		}
+		if cb.WhileOpen == "" {
+			cb.WhileOpen = string(compiled.WhileOpenWait)
+		}
+		cs.CircuitBreaker = &cb
+	}
+	if s.Auth != nil {
+		a := *s.Auth
+		if a.RefreshBefore == 0 {
+			a.RefreshBefore = auth.DefaultRefreshBefore
+		}
+		if s.Auth.JWT != nil {
+			jwt := *s.Auth.JWT
+			if jwt.Lifetime == 0 {
+				jwt.Lifetime = auth.DefaultJWTLifetime
+			}
+			a.JWT = &jwt
+		}
+		cs.Auth = &a
+	}
+	return &cs
 }
@@ -0,0 +1,207 @@
+package maestro
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/yaml"
+	"github.com/google/go-cmp/cmp"
+)
+
+const convertPipelines = `kind: pipeline
+spec:
+  name: pipeline-2
+  dead_letter:
+    file: dlq.jsonl
+---
+kind: stage
+spec:
+  name: stage-2
+  address: address-2:2
+  pipeline: pipeline-2
+  retry:
+    max_attempts: 5
+---
+kind: stage
+spec:
+  name: stage-1
+  address: address-1:1
+  pipeline: pipeline-2
+  circuit_breaker:
+    consecutive_failures: 3
+---
+kind: link
+spec:
+  name: link-1
+  source_stage: stage-1
+  target_stage: stage-2
+  pipeline: pipeline-2
+---
+kind: pipeline
+spec:
+  name: pipeline-1
+---
+kind: stage
+spec:
+  name: stage-3
+  address: address-3:3
+  pipeline: pipeline-1
+`
+
+func TestConvertCmd(t *testing.T) {
+	tests := map[string]struct {
+		args []string
+		// files are the names of the output files relative to the temporary
+		// directory, in the order of the pipelines they contain.
+		files []string
+	}{
+		"single file": {
+			args:  []string{"--from", "v1", "-o", "out.yml"},
+			files: []string{"out.yml"},
+		},
+		"json from extension": {
+			args:  []string{"--from", "v1", "-o", "out.json"},
+			files: []string{"out.json"},
+		},
+		"from json": {
+			args:  []string{"--from", "json", "-o", "out.yml"},
+			files: []string{"out.yml"},
+		},
+		"split": {
+			args:  []string{"--from", "v1", "--split", "-o", "out"},
+			files: []string{"out/pipeline-2.yml", "out/pipeline-1.yml"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			in := filepath.Join(dir, "in.yml")
+			if err := os.WriteFile(in, []byte(convertPipelines), 0644); err != nil {
+				t.Fatalf("write input: %s", err)
+			}
+			expected, err := yaml.ReadV1(in)
+			if err != nil {
+				t.Fatalf("read input: %s", err)
+			}
+			args := append([]string{}, tc.args...)
+			for i, a := range args {
+				if strings.HasPrefix(a, "out") {
+					args[i] = filepath.Join(dir, a)
+				}
+			}
+			runConvertCmd(t, append(args, in)...)
+
+			var actual []*api.Pipeline
+			for _, f := range tc.files {
+				data, err := os.ReadFile(filepath.Join(dir, f))
+				if err != nil {
+					t.Fatalf("read output: %s", err)
+				}
+				isJSON := strings.HasPrefix(strings.TrimSpace(string(data)), "[") ||
+					strings.HasPrefix(strings.TrimSpace(string(data)), "{")
+				if diff := cmp.Diff(yaml.IsJSONFile(f), isJSON); diff != "" {
+					t.Fatalf("%s: json format mismatch:\n%s", f, diff)
+				}
+				pipelines, err := yaml.ReadV1(filepath.Join(dir, f))
+				if err != nil {
+					t.Fatalf("read output: %s", err)
+				}
+				actual = append(actual, pipelines...)
+			}
+			if diff := cmp.Diff(expected, actual); diff != "" {
+				t.Fatalf("pipelines mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConvertCmd_Canonical(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.yml")
+	if err := os.WriteFile(in, []byte(convertPipelines), 0644); err != nil {
+		t.Fatalf("write input: %s", err)
+	}
+	out := filepath.Join(dir, "out.yml")
+	runConvertCmd(t, "--from", "v1", "--to", "canonical", "-o", out, in)
+
+	actual, err := yaml.ReadV1(out)
+	if err != nil {
+		t.Fatalf("read output: %s", err)
+	}
+	expected := []*api.Pipeline{
+		{
+			Name: "pipeline-1",
+			Stages: []*api.Stage{
+				{
+					Name:    "stage-3",
+					Address: "address-3:3",
+					Timeout: time.Minute,
+					OnError: "fail",
+				},
+			},
+		},
+		{
+			Name: "pipeline-2",
+			Stages: []*api.Stage{
+				{
+					Name:    "stage-1",
+					Address: "address-1:1",
+					Timeout: time.Minute,
+					OnError: "fail",
+					CircuitBreaker: &api.CircuitBreaker{
+						ConsecutiveFailures: 3,
+						Window:              20,
+						OpenTimeout:         30 * time.Second,
+						HalfOpenProbes:      1,
+						WhileOpen:           "wait",
+					},
+				},
+				{
+					Name:    "stage-2",
+					Address: "address-2:2",
+					Timeout: time.Minute,
+					OnError: "fail",
+					Retry: &api.Retry{
+						MaxAttempts:    5,
+						InitialBackoff: 100 * time.Millisecond,
+						MaxBackoff:     10 * time.Second,
+						Jitter:         "full",
+						Codes:          []string{"UNAVAILABLE"},
+					},
+				},
+			},
+			Links: []*api.Link{
+				{
+					Name:        "link-1",
+					SourceStage: "stage-1",
+					TargetStage: "stage-2",
+					Size:        10,
+					Match:       "by_number",
+				},
+			},
+			DeadLetter: &api.DeadLetter{File: "dlq.jsonl"},
+		},
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("pipelines mismatch:\n%s", diff)
+	}
+}
+
+func runConvertCmd(t *testing.T, args ...string) {
+	t.Helper()
+	var output bytes.Buffer
+	cmd := NewConvertCmd()
+	cmd.SetOut(&output)
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %s", err)
+	}
+	if output.Len() != 0 {
+		t.Fatalf("convert error: %s", output.String())
+	}
+}
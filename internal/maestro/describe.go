@@ -0,0 +1,108 @@
+package maestro
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/grpcw"
+	"github.com/DuarteMRAlves/maestro/internal/logs"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+type DescribeOpts struct {
+	address string
+	output  string
+	timeout time.Duration
+	verbose bool
+
+	tls tlsOpts
+
+	outW   io.Writer
+	logger logs.Logger
+}
+
+func NewDescribeCmd() *cobra.Command {
+	var opts DescribeOpts
+
+	cmd := cobra.Command{
+		Use:                   "describe [OPTIONS] ADDRESS[/SERVICE[/METHOD]]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Describe the services of a server",
+		Long: `Describe the services of a server with reflection.
+
+The address has the same format as the address of a stage. If the service
+is omitted, all the services of the server are described. If the method is
+omitted, all the methods of the service are described.
+
+The input and output messages of the methods are printed with their
+fields, numbers and kinds, along with all the nested messages and enums,
+so that the field names can be used in the links of a pipeline.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := opts.complete(cmd, args); err != nil {
+				opts.logger.Infof("fatal: %s\n", err)
+				os.Exit(1)
+			}
+			if err := opts.run(); err != nil {
+				opts.logger.Infof("fatal: %s\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.output, "output", "o", outputText, "output format (text, json)")
+	cmd.Flags().DurationVar(
+		&opts.timeout, "timeout", 10*time.Second, "maximum time to fetch the descriptors",
+	)
+	cmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "increase verbosity")
+	opts.tls.addFlags(&cmd)
+
+	return &cmd
+}
+
+func (opts *DescribeOpts) complete(cmd *cobra.Command, args []string) error {
+	opts.outW = cmd.OutOrStdout()
+	opts.logger = logs.NewWithOutput(cmd.ErrOrStderr(), opts.verbose)
+	if len(args) != 1 {
+		return errors.New("expected exactly one address")
+	}
+	opts.address = args[0]
+	if opts.output != outputText && opts.output != outputJSON {
+		return fmt.Errorf("unknown output format %q: expected text or json", opts.output)
+	}
+	return opts.tls.validate()
+}
+
+func (opts *DescribeOpts) run() error {
+	backoff := retry.ExponentialBackoff{}.WithMax(defaultMaxBackoff).WithJitter(defaultBackoffJitter)
+	r, err := grpcw.NewReflectionResolver(opts.timeout, backoff, opts.logger)
+	if err != nil {
+		return err
+	}
+	if err := opts.tls.configure(r, opts.address); err != nil {
+		return err
+	}
+
+	schema, err := r.Describe(context.Background(), opts.address)
+	if err != nil {
+		return err
+	}
+	switch opts.output {
+	case outputJSON:
+		enc := json.NewEncoder(opts.outW)
+		enc.SetIndent("", "  ")
+		return enc.Encode(schema)
+	default:
+		return schema.WriteText(opts.outW)
+	}
+}
@@ -0,0 +1,224 @@
+package maestro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/compiled"
+	"github.com/DuarteMRAlves/maestro/internal/grpcw"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+	"github.com/DuarteMRAlves/maestro/internal/yaml"
+	"github.com/spf13/cobra"
+)
+
+// defaultDescriptorCache is the default directory of the descriptor cache
+// for the descriptors pull command.
+const defaultDescriptorCache = ".maestro/descriptors"
+
+var cachePolicies = map[string]grpcw.CachePolicy{
+	"prefer":   grpcw.CachePrefer,
+	"fallback": grpcw.CacheFallback,
+	"refresh":  grpcw.CacheRefresh,
+}
+
+// addCacheFlags adds the flags to configure the descriptor cache and the
+// descriptor sets.
+func (opts *RunOpts) addCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(
+		&opts.descriptorSets,
+		"descriptor-set",
+		nil,
+		"file with a FileDescriptorSet of the stage methods, used instead of reflection",
+	)
+	cmd.Flags().StringVar(
+		&opts.descriptorCache,
+		"descriptor-cache",
+		"",
+		"directory where to cache the descriptors of the stage methods",
+	)
+	cmd.Flags().StringVar(
+		&opts.cachePolicy,
+		"descriptor-cache-policy",
+		"prefer",
+		"use cached descriptors before reflection (prefer), only when a server is unreachable (fallback) or never (refresh)",
+	)
+}
+
+// useDescriptorCache configures the resolver to use the descriptor cache, if
+// one was specified.
+func (opts *RunOpts) useDescriptorCache(r *grpcw.ReflectionResolver) error {
+	if opts.descriptorCache == "" {
+		return nil
+	}
+	policy, ok := cachePolicies[opts.cachePolicy]
+	if !ok {
+		return fmt.Errorf(
+			"unknown descriptor cache policy %q: expected prefer, fallback or refresh",
+			opts.cachePolicy,
+		)
+	}
+	r.UseCache(grpcw.NewDescriptorCache(opts.descriptorCache), policy)
+	return nil
+}
+
+// loadDescriptorSets registers the descriptor sets in the resolver, so that
+// the services they define are resolved without contacting the servers.
+func (opts *RunOpts) loadDescriptorSets(r *grpcw.ReflectionResolver) error {
+	for _, file := range opts.descriptorSets {
+		if err := r.LoadDescriptorSet(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewDescriptorsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "descriptors COMMAND [OPTIONS]",
+		Short: "Manage the descriptors of the stage methods",
+	}
+	cmd.AddCommand(newDescriptorsPullCmd())
+	return cmd
+}
+
+func newDescriptorsPullCmd() *cobra.Command {
+	var opts RunOpts
+
+	cmd := cobra.Command{
+		Use:                   "pull [OPTIONS] [PIPELINE]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Fetch the descriptors of the stage methods into the cache",
+		Long: `Fetch the descriptors of the methods of all the stages with reflection
+and store them in the descriptor cache.
+
+If no pipeline is specified, the stages of all the pipelines in the
+configuration files are fetched. The cache can be committed with the
+configuration files, and used with 'run --descriptor-cache', so that the
+servers do not need to be contacted to compile the pipelines.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := opts.complete(cmd, args); err != nil {
+				opts.logger.Infof("fatal: %s\n", err)
+				os.Exit(1)
+			}
+			if err := opts.pull(); err != nil {
+				opts.logger.Infof("fatal: %s\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	opts.addConfigFlags(&cmd)
+	cmd.Flags().StringVar(
+		&opts.descriptorCache,
+		"descriptor-cache",
+		defaultDescriptorCache,
+		"directory where to store the descriptors",
+	)
+	cmd.Flags().DurationVar(
+		&opts.startupTimeout,
+		"timeout",
+		defaultStartupTimeout,
+		"maximum time to fetch the descriptors of each stage",
+	)
+
+	return &cmd
+}
+
+// pull fetches the descriptors of all the stages into the cache.
+func (opts *RunOpts) pull() error {
+	if len(opts.files) == 0 {
+		return errors.New("specify at least one configuration file")
+	}
+	pipelines, err := opts.readPipelines()
+	if err != nil {
+		return err
+	}
+
+	backoff := retry.ExponentialBackoff{}.WithMax(defaultMaxBackoff).WithJitter(defaultBackoffJitter)
+	r, err := grpcw.NewReflectionResolver(opts.startupTimeout, backoff, opts.logger)
+	if err != nil {
+		return err
+	}
+	r.UseCache(grpcw.NewDescriptorCache(opts.descriptorCache), grpcw.CacheRefresh)
+
+	addresses := make(map[string]bool)
+	for _, p := range pipelines {
+		if err := configureServers(r, p); err != nil {
+			return err
+		}
+		for _, s := range p.Stages {
+			addresses[compiled.StageAddress(s)] = true
+		}
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		msgs []string
+		errs []string
+	)
+	for address := range addresses {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			entry, changed, err := r.Pull(context.Background(), address)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", address, err))
+				return
+			}
+			state := "unchanged"
+			if changed {
+				state = "updated"
+			}
+			msgs = append(msgs, fmt.Sprintf("%s: %s %s (%s)", address, state, entry.Resolved, entry.Hash))
+		}(address)
+	}
+	wg.Wait()
+
+	sort.Strings(msgs)
+	sort.Strings(errs)
+	for _, m := range msgs {
+		opts.logger.Infof("%s\n", m)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("pull %d descriptors failed:\n  %s", len(errs), strings.Join(errs, "\n  "))
+	}
+	opts.logger.Infof("Pulled %d descriptors to %s\n", len(msgs), opts.descriptorCache)
+	return nil
+}
+
+// readPipelines reads the pipelines in the configuration files. If a
+// pipeline name was specified, only that pipeline is returned.
+func (opts *RunOpts) readPipelines() ([]*api.Pipeline, error) {
+	if opts.version == v0 {
+		p, err := yaml.ReadV0(opts.files[0])
+		if err != nil {
+			return nil, err
+		}
+		return []*api.Pipeline{p}, nil
+	}
+	values, err := opts.templateValues()
+	if err != nil {
+		return nil, err
+	}
+	pipelines, err := yaml.ReadV1WithValues(values, opts.files...)
+	if err != nil {
+		return nil, err
+	}
+	if opts.pipelineName == "" {
+		return pipelines, nil
+	}
+	p, err := opts.pipelineToRun(pipelines...)
+	if err != nil {
+		return nil, err
+	}
+	return []*api.Pipeline{p}, nil
+}
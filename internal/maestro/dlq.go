@@ -0,0 +1,136 @@
+package maestro
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/dlq"
+	"github.com/DuarteMRAlves/maestro/internal/execute"
+	"github.com/DuarteMRAlves/maestro/internal/grpcw"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+	"github.com/spf13/cobra"
+)
+
+func NewDLQCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dlq COMMAND [OPTIONS]",
+		Short: "Manage the messages of the dead letter of a pipeline",
+	}
+	cmd.AddCommand(newDLQReplayCmd())
+	return cmd
+}
+
+func newDLQReplayCmd() *cobra.Command {
+	var opts RunOpts
+
+	cmd := cobra.Command{
+		Use:                   "replay [OPTIONS] [PIPELINE]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Send the messages of a dead letter file to their stage",
+		Long: `Send the messages of a dead letter file to the stage that failed to
+process them, and execute the pipeline from that stage until all of them
+are processed.
+
+If no stage is specified, all the messages of the file should be from a
+single stage. The messages of the last stages are written to the standard
+output, one per line.`,
+		Run: opts.runCmd,
+	}
+
+	opts.addConfigFlags(&cmd)
+	cmd.Flags().StringVar(
+		&opts.deadLetters, "letters", "", "dead letter file with the messages to send (required)",
+	)
+	cmd.Flags().StringVar(
+		&opts.deadLetterStage, "stage", "", "send only the messages of this stage",
+	)
+	_ = cmd.MarkFlagRequired("letters")
+
+	return &cmd
+}
+
+// readDeadLetters reads the messages of the dead letter file and feeds them
+// to their stage.
+func (opts *RunOpts) readDeadLetters() error {
+	f, err := os.Open(opts.deadLetters)
+	if err != nil {
+		return fmt.Errorf("read dead letters: %w", err)
+	}
+	defer f.Close()
+	records, err := dlq.Read(f)
+	if err != nil {
+		return err
+	}
+
+	stages := make(map[string]bool)
+	var input bytes.Buffer
+	for _, r := range records {
+		if opts.deadLetterStage != "" && r.Stage != opts.deadLetterStage {
+			continue
+		}
+		stages[r.Stage] = true
+		input.Write(r.Request)
+		input.WriteByte('\n')
+	}
+	switch len(stages) {
+	case 0:
+		return errors.New("no dead letters to replay")
+	case 1:
+	default:
+		names := make([]string, 0, len(stages))
+		for name := range stages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf(
+			"dead letters of stages %s: select one with --stage", strings.Join(names, ", "),
+		)
+	}
+	for name := range stages {
+		opts.from = name
+	}
+	opts.input = "-"
+	opts.inReader = &input
+	return nil
+}
+
+// openDeadLetter opens the dead letter of the pipeline, if any. Dead letter
+// addresses are resolved with the resolver of the stages.
+func openDeadLetter(
+	cfg *api.Pipeline, r method.Resolver, timeout time.Duration,
+) (dlq.Sink, error) {
+	switch {
+	case cfg.DeadLetter == nil:
+		return nil, nil
+	case cfg.DeadLetter.File != "":
+		return dlq.OpenFile(cfg.DeadLetter.File)
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		desc, err := r.Resolve(ctx, cfg.DeadLetter.Address)
+		if err != nil {
+			return nil, fmt.Errorf("resolve dead letter: %w", err)
+		}
+		return dlq.DialMethod(desc, grpcw.Codec{}.UnmarshalMessage, timeout)
+	}
+}
+
+// deadLetterWriter converts the failed messages of the execution into dead
+// letter records.
+func deadLetterWriter(sink dlq.Sink) execute.DeadLetter {
+	var codec grpcw.Codec
+	return func(msg execute.FailedMessage) error {
+		data, err := codec.MarshalMessage(msg.Request)
+		if err != nil {
+			return err
+		}
+		return sink.Write(dlq.NewRecord(msg.Stage.Unwrap(), data, msg.Err, msg.Attempts))
+	}
+}
@@ -8,6 +8,14 @@ func RootCmd() *cobra.Command {
 		Short: "maestro is a tool to execute grpc pipelines",
 	}
 
-	cmd.AddCommand(NewRunCmd(), NewConvertCmd())
+	cmd.AddCommand(
+		NewRunCmd(),
+		NewReplayCmd(),
+		NewConvertCmd(),
+		NewDescriptorsCmd(),
+		NewDescribeCmd(),
+		NewCallCmd(),
+		NewDLQCmd(),
+	)
 	return cmd
 }
@@ -0,0 +1,31 @@
+package maestro
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func NewReplayCmd() *cobra.Command {
+	var opts RunOpts
+
+	cmd := cobra.Command{
+		Use:                   "replay [OPTIONS] [PIPELINE]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Execute a single pipeline with recorded traffic",
+		Long: `Execute a single pipeline from configuration files, replacing the
+stage methods with the responses recorded by 'run --record'.
+
+The stage methods are not contacted, and so the servers do not need
+to be running. Each message of the pipeline has a correlation id, and
+each stage replies to it with the response recorded for the same id,
+or fails with the recorded error and its grpc status code.`,
+		Run: opts.runCmd,
+	}
+
+	opts.addConfigFlags(&cmd)
+	cmd.Flags().StringVar(
+		&opts.replayDir, "from", "", "directory with the recorded traffic (required)",
+	)
+	_ = cmd.MarkFlagRequired("from")
+
+	return &cmd
+}
@@ -1,11 +1,14 @@
 package maestro
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,6 +18,9 @@ import (
 	"github.com/DuarteMRAlves/maestro/internal/execute"
 	"github.com/DuarteMRAlves/maestro/internal/grpcw"
 	"github.com/DuarteMRAlves/maestro/internal/logs"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+	"github.com/DuarteMRAlves/maestro/internal/mock"
+	"github.com/DuarteMRAlves/maestro/internal/record"
 	"github.com/DuarteMRAlves/maestro/internal/repr"
 	"github.com/DuarteMRAlves/maestro/internal/retry"
 	"github.com/DuarteMRAlves/maestro/internal/yaml"
@@ -30,11 +36,37 @@ const (
 
 type RunOpts struct {
 	files        []string
+	template     bool
+	setValues    []string
+	valuesFiles  []string
 	pipelineName string
 	v0           bool
 	v1           bool
 	verbose      bool
+	dryRun       bool
+	dryRunRandom bool
+	recordDir    string
+	replayDir    string
+	watch        bool
 
+	startupTimeout time.Duration
+	maxBackoff     time.Duration
+	backoffJitter  float64
+	startWhenReady []string
+
+	descriptorCache string
+	cachePolicy     string
+	descriptorSets  []string
+
+	from  string
+	to    string
+	only  string
+	input string
+
+	deadLetters     string
+	deadLetterStage string
+
+	inReader  io.Reader
 	outWriter io.Writer
 	version   configVersion
 	logger    logs.Logger
@@ -50,35 +82,125 @@ func NewRunCmd() *cobra.Command {
 		Long: `Execute a single pipeline from configuration files.
 
 If no pipeline is specified, the configuration files should only contain
-a single pipeline, that will be executed.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var err error
-			if err = opts.complete(cmd, args); err != nil {
-				opts.logger.Infof("fatal: %s\n", err)
-				os.Exit(1)
-			}
-			if err = opts.validate(); err != nil {
-				opts.logger.Infof("fatal: %s\n", err)
-				os.Exit(1)
-			}
-			if err = opts.run(); err != nil {
-				opts.logger.Infof("fatal: %s\n", err)
-				os.Exit(1)
-			}
-		},
+a single pipeline, that will be executed.
+
+Version 1 configuration files with the .json extension are read in the
+json format. All other files are read in the yaml format.
+
+The stages are connected concurrently when the pipeline starts, retrying
+while their servers are unavailable, and the readiness of each stage is
+reported. The pipeline fails to start if the stages are not ready within
+the startup timeout. With --start-when-ready, the pipeline starts once the
+listed stages are ready, and the other stages are added as they become
+ready.
+
+With --dry-run, the stage methods are replaced by in-process mocks. The
+servers are then only contacted to fetch the descriptors of the methods,
+which can instead be read from --descriptor-set files or from the
+--descriptor-cache, so that no server needs to be running.
+
+With --from, --to or --only, only part of the pipeline is executed. The
+first stages are fed with the json messages of --input, random messages
+with --dry-run-random, or empty messages, and the messages of the last
+stages are written to the standard output, one per line. The logs are then
+written to the standard error.`,
+		Run: opts.runCmd,
 	}
 
+	opts.addConfigFlags(&cmd)
+	cmd.Flags().BoolVar(
+		&opts.dryRun, "dry-run", false, "replace stage methods with in-process mocks",
+	)
+	cmd.Flags().BoolVar(
+		&opts.dryRunRandom, "dry-run-random", false, "populate dry run replies with random values",
+	)
+	cmd.Flags().StringVar(
+		&opts.recordDir, "record", "", "directory where to record the traffic of all stages",
+	)
+	cmd.Flags().BoolVar(
+		&opts.watch, "watch", false, "reload the pipeline when the config files change",
+	)
+	cmd.Flags().DurationVar(
+		&opts.startupTimeout,
+		"startup-timeout",
+		defaultStartupTimeout,
+		"maximum time for the stages to be ready",
+	)
+	cmd.Flags().DurationVar(
+		&opts.maxBackoff,
+		"max-backoff",
+		defaultMaxBackoff,
+		"maximum time between attempts to connect with a stage",
+	)
+	cmd.Flags().Float64Var(
+		&opts.backoffJitter,
+		"backoff-jitter",
+		defaultBackoffJitter,
+		"fraction by which the time between attempts is randomly changed",
+	)
+	cmd.Flags().StringSliceVar(
+		&opts.startWhenReady,
+		"start-when-ready",
+		nil,
+		"start once these stages are ready, adding the others when they are ready",
+	)
+	opts.addCacheFlags(&cmd)
+	opts.addSubPipelineFlags(&cmd)
+
+	return &cmd
+}
+
+// addConfigFlags adds the flags to read the pipeline configuration.
+func (opts *RunOpts) addConfigFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolVar(&opts.v0, "v0", false, "use version 0 for config yaml format")
 	cmd.Flags().BoolVar(&opts.v1, "v1", false, "use version 1 for config yaml format")
 	cmd.Flags().StringArrayVarP(&opts.files, "file", "f", nil, "config files")
+	cmd.Flags().BoolVar(
+		&opts.template,
+		"template",
+		false,
+		"expand v1 config files as templates (implied by --set and --values)",
+	)
+	cmd.Flags().StringArrayVar(
+		&opts.setValues, "set", nil, "set template values for v1 config files (key=value)",
+	)
+	cmd.Flags().StringArrayVar(
+		&opts.valuesFiles, "values", nil, "yaml files with template values for v1 config files",
+	)
 	cmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "increase verbosity")
+}
 
-	return &cmd
+func (opts *RunOpts) runCmd(cmd *cobra.Command, args []string) {
+	var err error
+	if err = opts.complete(cmd, args); err != nil {
+		opts.logger.Infof("fatal: %s\n", err)
+		os.Exit(1)
+	}
+	if err = opts.validate(); err != nil {
+		opts.logger.Infof("fatal: %s\n", err)
+		os.Exit(1)
+	}
+	if err = opts.run(); err != nil {
+		opts.logger.Infof("fatal: %s\n", err)
+		os.Exit(1)
+	}
 }
 
 func (opts *RunOpts) complete(cmd *cobra.Command, args []string) error {
+	opts.inReader = cmd.InOrStdin()
 	opts.outWriter = cmd.OutOrStdout()
-	opts.logger = logs.NewWithOutput(opts.outWriter, opts.verbose)
+	if opts.deadLetters != "" {
+		// The dead letters are fed to their stage as a sub-pipeline.
+		if err := opts.readDeadLetters(); err != nil {
+			return err
+		}
+	}
+	logW := opts.outWriter
+	if opts.isSubPipeline() {
+		// The standard output has the messages of the last stages.
+		logW = cmd.ErrOrStderr()
+	}
+	opts.logger = logs.NewWithOutput(logW, opts.verbose)
 	if len(args) > 1 {
 		return errors.New("too many arguments: expected at most one positional argument")
 	}
@@ -93,6 +215,10 @@ func (opts *RunOpts) complete(cmd *cobra.Command, args []string) error {
 	if opts.v0 {
 		opts.version = v0
 	}
+	// The replay command does not have the startup flags.
+	if opts.startupTimeout == 0 {
+		opts.startupTimeout = defaultStartupTimeout
+	}
 	return nil
 }
 
@@ -103,72 +229,410 @@ func (opts *RunOpts) validate() error {
 	if opts.version == v0 && len(opts.files) > 1 {
 		return errors.New("only one configuration file allowed for v0 file specification")
 	}
-	return nil
+	if opts.version == v0 && (opts.template || len(opts.setValues) > 0 || len(opts.valuesFiles) > 0) {
+		return errors.New("template values are not supported for v0 file specification")
+	}
+	if opts.dryRunRandom && !opts.dryRun && !opts.isSubPipeline() {
+		return errors.New("dry-run-random option requires dry-run, from, to or only")
+	}
+	if opts.replayDir != "" && opts.dryRun {
+		return errors.New("replay and dry-run options are incompatible")
+	}
+	if opts.replayDir != "" && opts.recordDir != "" {
+		return errors.New("replay and record options are incompatible")
+	}
+	if opts.replayDir != "" && opts.watch {
+		return errors.New("replay and watch options are incompatible")
+	}
+	if opts.startupTimeout < 0 || opts.maxBackoff < 0 {
+		return errors.New("startup-timeout and max-backoff must not be negative")
+	}
+	if opts.backoffJitter < 0 || opts.backoffJitter > 1 {
+		return errors.New("backoff-jitter must be between 0 and 1")
+	}
+	return opts.validateSubPipeline()
 }
 
 func (opts *RunOpts) run() error {
-	var (
-		pipelineCfg *api.Pipeline
-		err         error
-		backoff     retry.ExponentialBackoff
-	)
-	switch opts.version {
-	case v0:
-		opts.logger.Debugf("read v0 from file %s", opts.files[0])
-		pipelineCfg, err = yaml.ReadV0(opts.files[0])
+	backoff := retry.ExponentialBackoff{}.WithMax(opts.maxBackoff).WithJitter(opts.backoffJitter)
+	pipelineCfg, positions, err := opts.readPipeline()
+	if err != nil {
+		return err
+	}
+	if opts.isSubPipeline() {
+		pipelineCfg, err = opts.slice(pipelineCfg)
 		if err != nil {
 			return err
 		}
-	case v1:
-		var pipelines []*api.Pipeline
-		opts.logger.Debugf("read v1 from files %s", opts.files)
-		pipelines, err = yaml.ReadV1(opts.files...)
-		if err != nil {
-			return err
+	}
+	opts.logger.Infof("Pipeline Config:\n%s", repr.Pipeline(pipelineCfg))
+	for _, name := range opts.startWhenReady {
+		if findStage(pipelineCfg, name) == nil {
+			return fmt.Errorf("start-when-ready: stage %s not found", name)
+		}
+	}
+
+	var (
+		r          method.Resolver
+		reflection *grpcw.ReflectionResolver
+	)
+	if opts.replayDir != "" {
+		opts.logger.Infof("Replay from %s: stage methods will not be called\n", opts.replayDir)
+		r, err = record.NewReplayer(opts.replayDir, grpcw.Codec{})
+	} else {
+		reflection, err = grpcw.NewReflectionResolver(opts.startupTimeout, backoff, opts.logger)
+		if err == nil {
+			err = configureServers(reflection, pipelineCfg)
+		}
+		if err == nil {
+			err = opts.useDescriptorCache(reflection)
+		}
+		if err == nil {
+			err = opts.loadDescriptorSets(reflection)
+		}
+		r = reflection
+	}
+	if err != nil {
+		return err
+	}
+	if opts.dryRun {
+		opts.logger.Infof("Dry run: stage methods will not be called\n")
+		gen := mock.EmptyGenerator()
+		if opts.dryRunRandom {
+			gen = mock.RandomGenerator(time.Now().UnixNano())
 		}
-		pipelineCfg, err = opts.pipelineToRun(pipelines...)
+		r = mock.NewResolver(r, gen)
+	}
+	// The dead letter method is not recorded as it is not a stage.
+	deadLetter, err := openDeadLetter(pipelineCfg, r, opts.startupTimeout)
+	if err != nil {
+		return err
+	}
+	if deadLetter != nil {
+		defer func() {
+			if err := deadLetter.Close(); err != nil {
+				opts.logger.Infof("close dead letter: %s\n", err)
+			}
+		}()
+	}
+	if opts.recordDir != "" {
+		opts.logger.Infof("Record to %s\n", opts.recordDir)
+		rec, err := record.NewRecorder(opts.recordDir, grpcw.Codec{}, r, opts.logger)
 		if err != nil {
 			return err
 		}
-	default:
-		// Should never happen if command was completed and validated.
-		return fmt.Errorf(
-			"unknown config version: expected %s or %s but found %s", v0, v1, opts.version,
-		)
+		defer func() {
+			if err := rec.Close(); err != nil {
+				opts.logger.Infof("close recording: %s\n", err)
+			}
+		}()
+		r = rec
 	}
-	opts.logger.Infof("Pipeline Config:\n%s", repr.Pipeline(pipelineCfg))
 
-	r, err := grpcw.NewReflectionResolver(time.Minute, backoff, opts.logger)
-	if err != nil {
-		return err
+	// All the stages are resolved concurrently. The pipeline starts when all
+	// of them are ready, or only the required ones with start-when-ready.
+	startupCtx, cancelStartup := context.WithTimeout(context.Background(), opts.startupTimeout)
+	defer cancelStartup()
+	ready := newReadiness(r, pipelineCfg, opts.logger)
+	ready.resolveAll(startupCtx)
+	startCfg := pipelineCfg
+	if len(opts.startWhenReady) > 0 {
+		if err := ready.waitFor(startupCtx, opts.startWhenReady); err != nil {
+			opts.logger.Infof("%s", ready.report())
+			return err
+		}
+		startCfg = ready.readyPipeline()
 	}
-	compilationCtx := compiled.NewContext(r)
-	compiledPipeline, err := compiled.New(compilationCtx, pipelineCfg)
+	compiledPipeline, err := compiled.New(
+		compiled.NewContext(ready).WithContext(startupCtx), startCfg,
+	)
+	opts.logger.Infof("%s", ready.report())
 	if err != nil {
+		err = compileDiagnostics(err, pipelineCfg.Name, positions)
 		return fmt.Errorf("compile %s: %w", pipelineCfg.Name, err)
 	}
-	b := execute.NewBuilder(opts.logger)
+	opts.warnUnmatchedFields(compiledPipeline)
+	var (
+		buildOpts []execute.BuildOption
+		sio       *subPipelineIO
+	)
+	if opts.isSubPipeline() {
+		sio, err = opts.newSubPipelineIO(pipelineCfg)
+		if err != nil {
+			return err
+		}
+		defer sio.Close()
+		buildOpts = sio.buildOptions()
+	}
+	var dl execute.DeadLetter
+	if deadLetter != nil {
+		dl = deadLetterWriter(deadLetter)
+	}
+	if sio != nil {
+		dl = sio.deadLetter(dl)
+	}
+	if dl != nil {
+		buildOpts = append(buildOpts, execute.WithDeadLetter(dl))
+	}
+	b := execute.NewBuilder(opts.logger, buildOpts...)
 	execution, err := b(compiledPipeline)
 	if err != nil {
 		return fmt.Errorf("build execution %s: %w", pipelineCfg.Name, err)
 	}
 
 	errs := make(chan error, 1)
-	sigs := make(chan os.Signal)
+	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		sig := <-sigs
 		opts.logger.Infof("Received signal: %v", sig)
 		errs <- execution.Stop()
 	}()
+	if sio != nil {
+		go func() {
+			<-sio.done
+			if err := sio.Err(); err != nil {
+				_ = execution.Stop()
+				errs <- err
+				return
+			}
+			opts.logger.Infof("All input messages processed\n")
+			errs <- execution.Stop()
+		}()
+	}
 
 	execution.Start()
 
+	if len(startCfg.Stages) < len(pipelineCfg.Stages) {
+		go opts.startRemaining(startupCtx, ready, len(startCfg.Stages), execution)
+	}
+
+	compilationCtx := compiled.NewContext(r)
+	if opts.watch {
+		stopWatch := make(chan struct{})
+		defer close(stopWatch)
+		reload := func() {
+			err := opts.reload(compilationCtx, reflection, execution)
+			if err != nil {
+				opts.logger.Infof("Reload failed, keeping the running pipeline: %s\n", err)
+				return
+			}
+			opts.logger.Infof("Reload finished\n")
+		}
+		files := append(append([]string{}, opts.files...), opts.valuesFiles...)
+		go watchFiles(files, watchInterval, stopWatch, reload, opts.logger)
+		opts.logger.Infof("Watching %s for changes\n", files)
+	}
+
 	err = <-errs
+	opts.logStatus(execution)
 	opts.logger.Debugf("Execution terminated with error: %s", err)
 	return err
 }
 
+// logStatus logs the state of the circuit breakers of the stages, if any.
+func (opts *RunOpts) logStatus(execution execute.Execution) {
+	reporter, ok := execution.(execute.StatusReporter)
+	if !ok {
+		return
+	}
+	var report strings.Builder
+	for _, s := range reporter.Status() {
+		if s.Breaker != "" {
+			fmt.Fprintf(&report, "  %s: circuit breaker %s\n", s.Stage, s.Breaker)
+		}
+	}
+	if report.Len() > 0 {
+		opts.logger.Infof("Stage status:\n%s", report.String())
+	}
+}
+
+// startRemaining adds the stages that were not ready when the pipeline
+// started, once the resolution of all the stages finishes. The stages that
+// are not ready by then are not executed.
+func (opts *RunOpts) startRemaining(
+	ctx context.Context, ready *readiness, started int, execution execute.Execution,
+) {
+	ready.wait(ctx)
+	opts.logger.Infof("%s", ready.report())
+	cfg := ready.readyPipeline()
+	if len(cfg.Stages) == started {
+		opts.logger.Infof("No more stages ready, running with %d stages\n", started)
+		return
+	}
+	compiledPipeline, err := compiled.New(compiled.NewContext(ready).WithContext(ctx), cfg)
+	if err == nil {
+		err = execution.Update(compiledPipeline)
+	}
+	if err != nil {
+		opts.logger.Infof("Add remaining stages failed, keeping the running pipeline: %s\n", err)
+		return
+	}
+	opts.logger.Infof("Added %d stages that became ready\n", len(cfg.Stages)-started)
+}
+
+// compileDiagnostics sets the positions in the configuration files of the
+// stages and links with compilation errors.
+func compileDiagnostics(err error, pipeline string, positions yaml.Positions) error {
+	var errs compiled.Errors
+	if positions == nil || !errors.As(err, &errs) {
+		return err
+	}
+	diags := make(yaml.Diagnostics, 0, len(errs))
+	for _, e := range errs {
+		var (
+			pos      yaml.Position
+			found    bool
+			stageErr *compiled.StageError
+			linkErr  *compiled.LinkError
+		)
+		switch {
+		case errors.As(e, &stageErr):
+			pos, found = positions.Stage(pipeline, stageErr.Name)
+		case errors.As(e, &linkErr):
+			pos, found = positions.Link(pipeline, linkErr.Name)
+		}
+		if !found {
+			pos, _ = positions.Pipeline(pipeline)
+		}
+		diags = append(diags, &yaml.Diagnostic{Pos: pos, Err: e})
+	}
+	return diags
+}
+
+// readPipeline reads the pipeline to execute from the configuration files.
+// The positions are only returned for v1 files.
+func (opts *RunOpts) readPipeline() (*api.Pipeline, yaml.Positions, error) {
+	switch opts.version {
+	case v0:
+		opts.logger.Debugf("read v0 from file %s", opts.files[0])
+		pipelineCfg, err := yaml.ReadV0(opts.files[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		return pipelineCfg, nil, nil
+	case v1:
+		values, err := opts.templateValues()
+		if err != nil {
+			return nil, nil, err
+		}
+		opts.logger.Debugf("read v1 from files %s", opts.files)
+		pipelines, positions, err := yaml.ReadV1WithPositions(values, opts.files...)
+		if err != nil {
+			return nil, nil, err
+		}
+		pipelineCfg, err := opts.pipelineToRun(pipelines...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pipelineCfg, positions, nil
+	default:
+		// Should never happen if command was completed and validated.
+		return nil, nil, fmt.Errorf(
+			"unknown config version: expected %s or %s but found %s", v0, v1, opts.version,
+		)
+	}
+}
+
+// reload reads the configuration files and updates the execution with the
+// new pipeline. The execution is not changed if the pipeline has errors.
+func (opts *RunOpts) reload(
+	ctx compiled.Context,
+	reflection *grpcw.ReflectionResolver,
+	execution execute.Execution,
+) error {
+	pipelineCfg, positions, err := opts.readPipeline()
+	if err != nil {
+		return err
+	}
+	if reflection != nil {
+		if err := configureServers(reflection, pipelineCfg); err != nil {
+			return err
+		}
+	}
+	compiledPipeline, err := compiled.New(ctx, pipelineCfg)
+	if err != nil {
+		err = compileDiagnostics(err, pipelineCfg.Name, positions)
+		return fmt.Errorf("compile %s: %w", pipelineCfg.Name, err)
+	}
+	opts.warnUnmatchedFields(compiledPipeline)
+	return execution.Update(compiledPipeline)
+}
+
+// warnUnmatchedFields logs the fields that are not transferred by the links
+// of the pipeline. Strict links with unmatched fields fail to compile.
+func (opts *RunOpts) warnUnmatchedFields(p *compiled.Pipeline) {
+	var links []*compiled.Link
+	_ = p.VisitLinks(func(l *compiled.Link) error {
+		links = append(links, l)
+		return nil
+	})
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Name().Unwrap() < links[j].Name().Unwrap()
+	})
+	for _, l := range links {
+		c := l.Compatibility()
+		for _, f := range c.Dropped {
+			opts.logger.Infof("Warning: link %s drops source field %s\n", l.Name(), f)
+		}
+		for _, f := range c.Unset {
+			opts.logger.Infof("Warning: link %s never sets target field %s\n", l.Name(), f)
+		}
+	}
+}
+
+// configureServers sets the connection settings of the stages of the
+// pipeline in the resolver.
+func configureServers(r *grpcw.ReflectionResolver, pipelineCfg *api.Pipeline) error {
+	for _, s := range pipelineCfg.Stages {
+		if s.TLS == nil && s.Retry == nil && s.Auth == nil {
+			continue
+		}
+		var (
+			cfg grpcw.ServerConfig
+			err error
+		)
+		if s.TLS != nil {
+			cfg.TLS, err = tlsConfig(s.TLS)
+			if err != nil {
+				return fmt.Errorf("stage %s: tls: %w", s.Name, err)
+			}
+		}
+		cfg.Retry, err = compiled.RetryPolicy(s.Retry)
+		if err != nil {
+			return fmt.Errorf("stage %s: %w", s.Name, err)
+		}
+		if s.Auth != nil {
+			// The credentials are shared by the reflection requests and the
+			// calls to the methods, so that both reuse the same tokens.
+			cfg.Credentials, err = authCredentials(s.Auth)
+			if err != nil {
+				return fmt.Errorf("stage %s: auth: %w", s.Name, err)
+			}
+		}
+		r.ConfigureServer(s.Address, cfg)
+	}
+	return nil
+}
+
+// templateValues collects the values for the config templates. Values set
+// in the command line take precedence over the ones in values files. It
+// returns nil values if the files are not templates.
+func (opts *RunOpts) templateValues() (yaml.Values, error) {
+	if !opts.template && len(opts.valuesFiles) == 0 && len(opts.setValues) == 0 {
+		return nil, nil
+	}
+	values, err := yaml.ReadValues(opts.valuesFiles...)
+	if err != nil {
+		return nil, err
+	}
+	set, err := yaml.ParseSetValues(opts.setValues...)
+	if err != nil {
+		return nil, err
+	}
+	return values.Merge(set), nil
+}
+
 func (opts *RunOpts) pipelineToRun(available ...*api.Pipeline) (*api.Pipeline, error) {
 	if opts.pipelineName != "" {
 		pred := func(v *api.Pipeline) bool {
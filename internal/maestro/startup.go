@@ -0,0 +1,195 @@
+package maestro
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/compiled"
+	"github.com/DuarteMRAlves/maestro/internal/logs"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+)
+
+const (
+	// defaultStartupTimeout is the default time for all the stages to be
+	// ready.
+	defaultStartupTimeout = time.Minute
+	// defaultMaxBackoff is the default maximum time between attempts to
+	// connect with a stage.
+	defaultMaxBackoff = 5 * time.Second
+	// defaultBackoffJitter is the default fraction by which the time between
+	// attempts is randomly changed.
+	defaultBackoffJitter = 0.2
+)
+
+// readiness resolves the methods of the stages of a pipeline concurrently
+// and reports when each stage is ready. The results are kept, so that the
+// pipeline can be compiled with the stages that are ready without resolving
+// them again.
+type readiness struct {
+	resolver method.Resolver
+	pipeline *api.Pipeline
+	start    time.Time
+	logger   logs.Logger
+
+	mu          sync.Mutex
+	resolutions map[string]*resolution
+}
+
+// resolution is the result of resolving a stage address.
+type resolution struct {
+	done    chan struct{}
+	desc    method.Desc
+	err     error
+	elapsed time.Duration
+}
+
+func newReadiness(r method.Resolver, pipeline *api.Pipeline, logger logs.Logger) *readiness {
+	return &readiness{
+		resolver:    r,
+		pipeline:    pipeline,
+		start:       time.Now(),
+		logger:      logger,
+		resolutions: make(map[string]*resolution),
+	}
+}
+
+// resolveAll starts resolving the methods of all the stages.
+func (r *readiness) resolveAll(ctx context.Context) {
+	for _, s := range r.pipeline.Stages {
+		go func(address string) { _, _ = r.Resolve(ctx, address) }(compiled.StageAddress(s))
+	}
+}
+
+// Resolve resolves the method at address. Concurrent calls for the same
+// address wait for the first one to finish, which is bounded by the context
+// of the first call.
+func (r *readiness) Resolve(ctx context.Context, address string) (method.Desc, error) {
+	r.mu.Lock()
+	res, ok := r.resolutions[address]
+	if !ok {
+		res = &resolution{done: make(chan struct{})}
+		r.resolutions[address] = res
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		res.desc, res.err = r.resolver.Resolve(ctx, address)
+		res.elapsed = time.Since(r.start)
+		close(res.done)
+		r.logResolution(address, res)
+	}
+	<-res.done
+	return res.desc, res.err
+}
+
+func (r *readiness) logResolution(address string, res *resolution) {
+	for _, s := range r.pipeline.Stages {
+		if compiled.StageAddress(s) != address {
+			continue
+		}
+		if res.err != nil {
+			r.logger.Infof("Stage '%s' not ready after %s: %s\n", s.Name, round(res.elapsed), res.err)
+		} else {
+			r.logger.Infof("Stage '%s' ready after %s\n", s.Name, round(res.elapsed))
+		}
+	}
+}
+
+// resolution returns the resolution of a stage, or nil if it was not
+// started.
+func (r *readiness) resolution(s *api.Stage) *resolution {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.resolutions[compiled.StageAddress(s)]
+}
+
+// waitFor waits for the given stages to be ready. It fails if one of the
+// stages cannot be resolved.
+func (r *readiness) waitFor(ctx context.Context, stages []string) error {
+	for _, name := range stages {
+		s := findStage(r.pipeline, name)
+		if s == nil {
+			return fmt.Errorf("stage %s not found", name)
+		}
+		if _, err := r.Resolve(ctx, compiled.StageAddress(s)); err != nil {
+			return fmt.Errorf("stage %s not ready: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// wait waits for the resolution of all the stages to finish.
+func (r *readiness) wait(ctx context.Context) {
+	for _, s := range r.pipeline.Stages {
+		_, _ = r.Resolve(ctx, compiled.StageAddress(s))
+	}
+}
+
+// readyPipeline returns a copy of the pipeline with only the stages that are
+// ready and the links between them, and the same pipeline settings.
+func (r *readiness) readyPipeline() *api.Pipeline {
+	ready := make(map[string]bool)
+	p := &api.Pipeline{
+		Name:              r.pipeline.Name,
+		DeadLetter:        r.pipeline.DeadLetter,
+		PropagateMetadata: r.pipeline.PropagateMetadata,
+	}
+	for _, s := range r.pipeline.Stages {
+		res := r.resolution(s)
+		if res == nil || !isDone(res) || res.err != nil {
+			continue
+		}
+		ready[s.Name] = true
+		p.Stages = append(p.Stages, s)
+	}
+	for _, l := range r.pipeline.Links {
+		if ready[l.SourceStage] && ready[l.TargetStage] {
+			p.Links = append(p.Links, l)
+		}
+	}
+	return p
+}
+
+// report writes the readiness of all the stages.
+func (r *readiness) report() string {
+	var b strings.Builder
+	b.WriteString("Stage readiness:\n")
+	for _, s := range r.pipeline.Stages {
+		res := r.resolution(s)
+		switch {
+		case res == nil || !isDone(res):
+			fmt.Fprintf(&b, "  %s: pending\n", s.Name)
+		case res.err != nil:
+			fmt.Fprintf(&b, "  %s: not ready after %s: %s\n", s.Name, round(res.elapsed), res.err)
+		default:
+			fmt.Fprintf(&b, "  %s: ready after %s\n", s.Name, round(res.elapsed))
+		}
+	}
+	return b.String()
+}
+
+func isDone(res *resolution) bool {
+	select {
+	case <-res.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func findStage(p *api.Pipeline, name string) *api.Stage {
+	for _, s := range p.Stages {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
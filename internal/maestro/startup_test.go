@@ -0,0 +1,107 @@
+package maestro
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/grpcw"
+	"github.com/DuarteMRAlves/maestro/internal/logs"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+func TestReadiness(t *testing.T) {
+	// The server only starts serving after the resolution starts, so the
+	// stage becomes ready during the startup.
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	s := newTestServer()
+	defer s.Stop()
+	time.AfterFunc(100*time.Millisecond, func() { _ = s.Serve(lis) })
+
+	pipeline := &api.Pipeline{
+		Name: "pipeline",
+		Stages: []*api.Stage{
+			{Name: "ready", Address: lis.Addr().String(), Service: "grpc.health.v1.Health", Method: "Check"},
+			{Name: "late", Address: unusedAddress(t), Service: "grpc.health.v1.Health", Method: "Check"},
+		},
+		Links:             []*api.Link{{Name: "link", SourceStage: "ready", TargetStage: "late"}},
+		DeadLetter:        &api.DeadLetter{File: "dead.jsonl"},
+		PropagateMetadata: []string{"x-request-id"},
+	}
+	timeout := time.Second
+	backoff := retry.NewExponentialBackoff(10*time.Millisecond, 2).WithMax(50 * time.Millisecond)
+	resolver, err := grpcw.NewReflectionResolver(timeout, backoff, logs.New(false))
+	if err != nil {
+		t.Fatalf("create resolver: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ready := newReadiness(resolver, pipeline, logs.New(false))
+	ready.resolveAll(ctx)
+
+	if err := ready.waitFor(ctx, []string{"ready"}); err != nil {
+		t.Fatalf("wait for ready stage: %s", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("ready stage only ready after the deadline")
+	}
+	expected := &api.Pipeline{
+		Name:              "pipeline",
+		Stages:            pipeline.Stages[:1],
+		DeadLetter:        pipeline.DeadLetter,
+		PropagateMetadata: pipeline.PropagateMetadata,
+	}
+	if diff := cmp.Diff(expected, ready.readyPipeline()); diff != "" {
+		t.Fatalf("ready pipeline before the deadline mismatch:\n%s", diff)
+	}
+	if !strings.Contains(ready.report(), "late: pending") {
+		t.Fatalf("late stage not pending in report:\n%s", ready.report())
+	}
+
+	if err := ready.waitFor(ctx, []string{"late"}); err == nil {
+		t.Fatalf("expected late stage to miss the deadline")
+	}
+	ready.wait(ctx)
+	if diff := cmp.Diff(expected, ready.readyPipeline()); diff != "" {
+		t.Fatalf("ready pipeline after the deadline mismatch:\n%s", diff)
+	}
+	report := ready.report()
+	for _, line := range []string{"  ready: ready after", "  late: not ready after"} {
+		if !strings.Contains(report, line) {
+			t.Fatalf("report does not contain %q:\n%s", line, report)
+		}
+	}
+}
+
+// newTestServer returns a server with the health service and reflection.
+func newTestServer() *grpc.Server {
+	s := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	reflection.Register(s)
+	return s
+}
+
+// unusedAddress returns a local address where no server listens.
+func unusedAddress(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	address := lis.Addr().String()
+	if err := lis.Close(); err != nil {
+		t.Fatalf("close listener: %s", err)
+	}
+	return address
+}
@@ -0,0 +1,281 @@
+package maestro
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/compiled"
+	"github.com/DuarteMRAlves/maestro/internal/execute"
+	"github.com/DuarteMRAlves/maestro/internal/grpcw"
+	"github.com/DuarteMRAlves/maestro/internal/message"
+	"github.com/DuarteMRAlves/maestro/internal/mock"
+	"github.com/spf13/cobra"
+)
+
+// addSubPipelineFlags adds the flags to run only part of the pipeline.
+func (opts *RunOpts) addSubPipelineFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(
+		&opts.from, "from", "", "run only the stages after this stage, including it",
+	)
+	cmd.Flags().StringVar(
+		&opts.to, "to", "", "run only the stages before this stage, including it",
+	)
+	cmd.Flags().StringVar(&opts.only, "only", "", "run only this stage")
+	cmd.Flags().StringVar(
+		&opts.input,
+		"input",
+		"",
+		"file with the json messages for the first stage of a sub-pipeline (- for stdin)",
+	)
+}
+
+// isSubPipeline reports whether only part of the pipeline is executed.
+func (opts *RunOpts) isSubPipeline() bool {
+	return opts.from != "" || opts.to != "" || opts.only != ""
+}
+
+func (opts *RunOpts) validateSubPipeline() error {
+	if opts.only != "" && (opts.from != "" || opts.to != "") {
+		return errors.New("only option is incompatible with from and to")
+	}
+	if opts.input != "" && !opts.isSubPipeline() {
+		return errors.New("input option requires from, to or only")
+	}
+	if opts.isSubPipeline() && opts.watch {
+		return errors.New("watch option is incompatible with from, to and only")
+	}
+	return nil
+}
+
+// slice returns the part of the pipeline to execute.
+func (opts *RunOpts) slice(cfg *api.Pipeline) (*api.Pipeline, error) {
+	from, to := opts.from, opts.to
+	if opts.only != "" {
+		from, to = opts.only, opts.only
+	}
+	return compiled.Slice(cfg, from, to)
+}
+
+// subPipelineIO feeds the first stages of a sub-pipeline and writes the
+// messages of the last stages. When the messages are read from a file, the
+// done channel is closed once all of them reach the last stages, or when
+// the messages cannot be read or written.
+type subPipelineIO struct {
+	input *json.Decoder
+	gen   mock.Generator
+	codec grpcw.Codec
+	out   io.Writer
+	sinks int
+	// sinksAfter is the number of last stages that receive the messages of
+	// each stage.
+	sinksAfter map[string]int
+	closer     io.Closer
+
+	mu      sync.Mutex
+	fed     int
+	eof     bool
+	written int
+	// skipped is the number of messages that the last stages never receive
+	// because they were skipped by a previous stage.
+	skipped int
+	err     error
+	done    chan struct{}
+}
+
+func (opts *RunOpts) newSubPipelineIO(cfg *api.Pipeline) (*subPipelineIO, error) {
+	sio := &subPipelineIO{out: opts.outWriter, done: make(chan struct{})}
+	sources, sinks := endStages(cfg)
+	sio.sinks = sinks
+	sio.sinksAfter = sinksAfter(cfg)
+	switch {
+	case opts.input != "":
+		if sources != 1 {
+			return nil, fmt.Errorf("input option requires a single first stage, found %d", sources)
+		}
+		r := opts.inReader
+		if opts.input != "-" {
+			f, err := os.Open(opts.input)
+			if err != nil {
+				return nil, fmt.Errorf("open input: %w", err)
+			}
+			sio.closer = f
+			r = f
+		}
+		sio.input = json.NewDecoder(r)
+	case opts.dryRunRandom:
+		sio.gen = mock.RandomGenerator(time.Now().UnixNano())
+	}
+	return sio, nil
+}
+
+// buildOptions returns the options for the execution to use the sub-pipeline
+// messages.
+func (sio *subPipelineIO) buildOptions() []execute.BuildOption {
+	opts := []execute.BuildOption{execute.WithOutput(sio.write)}
+	if sio.input != nil || sio.gen != nil {
+		opts = append(opts, execute.WithFeed(sio.read))
+	}
+	return opts
+}
+
+func (sio *subPipelineIO) read(t message.Type) (message.Instance, error) {
+	if sio.gen != nil {
+		return sio.gen.Generate(t), nil
+	}
+	// The input is only read by a single source, so the lock is not held
+	// while waiting for the messages.
+	var data json.RawMessage
+	err := sio.input.Decode(&data)
+	sio.mu.Lock()
+	defer sio.mu.Unlock()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			sio.eof = true
+			sio.checkDone()
+			return nil, err
+		}
+		return nil, sio.fail(fmt.Errorf("read input: %w", err))
+	}
+	msg, err := sio.codec.UnmarshalMessage(data, t)
+	if err != nil {
+		return nil, sio.fail(fmt.Errorf("read input message %d: %w", sio.fed+1, err))
+	}
+	sio.fed++
+	return msg, nil
+}
+
+func (sio *subPipelineIO) write(msg message.Instance) error {
+	sio.mu.Lock()
+	defer sio.mu.Unlock()
+	data, err := sio.codec.MarshalMessage(msg)
+	if err != nil {
+		return sio.fail(fmt.Errorf("write output: %w", err))
+	}
+	// The protobuf json format may have spaces between the fields, so the
+	// messages are compacted to write one per line.
+	var line bytes.Buffer
+	if err := json.Compact(&line, data); err != nil {
+		return sio.fail(fmt.Errorf("write output: %w", err))
+	}
+	line.WriteRune('\n')
+	if _, err := line.WriteTo(sio.out); err != nil {
+		return sio.fail(fmt.Errorf("write output: %w", err))
+	}
+	sio.written++
+	sio.checkDone()
+	return nil
+}
+
+// deadLetter counts the messages skipped by the stages, which never reach
+// the last stages after the stage, and sends them to the next dead letter,
+// if any.
+func (sio *subPipelineIO) deadLetter(next execute.DeadLetter) execute.DeadLetter {
+	return func(msg execute.FailedMessage) error {
+		if next != nil {
+			if err := next(msg); err != nil {
+				return err
+			}
+		}
+		sio.mu.Lock()
+		defer sio.mu.Unlock()
+		sio.skipped += sio.sinksAfter[msg.Stage.Unwrap()]
+		sio.checkDone()
+		return nil
+	}
+}
+
+// checkDone closes the done channel once all the input messages were
+// written by all the last stages, or skipped. It must be called with the
+// lock held.
+func (sio *subPipelineIO) checkDone() {
+	if sio.input == nil || !sio.eof || sio.written+sio.skipped < sio.fed*sio.sinks {
+		return
+	}
+	sio.closeDone()
+}
+
+// fail stops the sub-pipeline with the error. It must be called with the
+// lock held.
+func (sio *subPipelineIO) fail(err error) error {
+	if sio.err == nil {
+		sio.err = err
+		sio.closeDone()
+	}
+	return err
+}
+
+// Err returns the error that stopped the sub-pipeline, if any.
+func (sio *subPipelineIO) Err() error {
+	sio.mu.Lock()
+	defer sio.mu.Unlock()
+	return sio.err
+}
+
+func (sio *subPipelineIO) closeDone() {
+	select {
+	case <-sio.done:
+	default:
+		close(sio.done)
+	}
+}
+
+func (sio *subPipelineIO) Close() error {
+	if sio.closer == nil {
+		return nil
+	}
+	return sio.closer.Close()
+}
+
+// endStages counts the stages of the pipeline without inputs and without
+// outputs.
+func endStages(cfg *api.Pipeline) (sources, sinks int) {
+	hasInput := make(map[string]bool)
+	hasOutput := make(map[string]bool)
+	for _, l := range cfg.Links {
+		hasOutput[l.SourceStage] = true
+		hasInput[l.TargetStage] = true
+	}
+	for _, s := range cfg.Stages {
+		if !hasInput[s.Name] {
+			sources++
+		}
+		if !hasOutput[s.Name] {
+			sinks++
+		}
+	}
+	return sources, sinks
+}
+
+// sinksAfter counts, for each stage, the stages without outputs that are
+// reached from the stage, including itself.
+func sinksAfter(cfg *api.Pipeline) map[string]int {
+	next := make(map[string][]string)
+	for _, l := range cfg.Links {
+		next[l.SourceStage] = append(next[l.SourceStage], l.TargetStage)
+	}
+	counts := make(map[string]int, len(cfg.Stages))
+	for _, s := range cfg.Stages {
+		visited := make(map[string]bool)
+		queue := []string{s.Name}
+		for len(queue) > 0 {
+			curr := queue[0]
+			queue = queue[1:]
+			if visited[curr] {
+				continue
+			}
+			visited[curr] = true
+			if len(next[curr]) == 0 {
+				counts[s.Name]++
+			}
+			queue = append(queue, next[curr]...)
+		}
+	}
+	return counts
+}
@@ -0,0 +1,183 @@
+package maestro
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRunCmd_SubPipelineWithSplit(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	s := grpc.NewServer()
+	s.RegisterService(&echoServiceDesc, struct{}{})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	// The messages of split are sent to both check and echo, and check
+	// skips the bad messages, which only reach echo.
+	dir := t.TempDir()
+	config := fmt.Sprintf(`kind: pipeline
+spec:
+  name: pipeline
+---
+kind: stage
+spec:
+  name: source
+  address: %[1]s
+  service: maestro.test.Echo
+  method: Echo
+---
+kind: stage
+spec:
+  name: split
+  address: %[1]s
+  service: maestro.test.Echo
+  method: Echo
+---
+kind: stage
+spec:
+  name: check
+  address: %[1]s
+  service: maestro.test.Echo
+  method: Check
+  on_error: skip
+---
+kind: stage
+spec:
+  name: echo
+  address: %[1]s
+  service: maestro.test.Echo
+  method: Echo
+---
+kind: link
+spec:
+  name: source-split
+  source_stage: source
+  target_stage: split
+---
+kind: link
+spec:
+  name: split-check
+  source_stage: split
+  target_stage: check
+---
+kind: link
+spec:
+  name: split-echo
+  source_stage: split
+  target_stage: echo
+`, lis.Addr().String())
+	configFile := filepath.Join(dir, "pipeline.yml")
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatalf("write config: %s", err)
+	}
+	inputFile := filepath.Join(dir, "input.json")
+	if err := os.WriteFile(inputFile, []byte("\"good\"\n\"bad\"\n\"ok\"\n"), 0644); err != nil {
+		t.Fatalf("write input: %s", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := NewRunCmd()
+	cmd.SetArgs([]string{
+		"-f", configFile,
+		"--from", "split",
+		"--input", inputFile,
+		"--descriptor-set", writeEchoDescriptorSet(t, dir),
+	})
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	sort.Strings(lines)
+	expected := []string{`"bad"`, `"good"`, `"good"`, `"ok"`, `"ok"`}
+	if diff := cmp.Diff(expected, lines); diff != "" {
+		t.Fatalf("output mismatch:\n%s\nlogs:\n%s", diff, stderr.String())
+	}
+}
+
+// echoServiceDesc is a service where Echo returns the request and Check
+// returns the request or fails if it is "bad".
+var echoServiceDesc = grpc.ServiceDesc{
+	ServiceName: "maestro.test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Echo", Handler: echoHandler(false)},
+		{MethodName: "Check", Handler: echoHandler(true)},
+	},
+}
+
+func echoHandler(check bool) func(
+	interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	return func(
+		_ interface{}, _ context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor,
+	) (interface{}, error) {
+		req := &wrapperspb.StringValue{}
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if check && req.Value == "bad" {
+			return nil, status.Error(codes.InvalidArgument, "bad request")
+		}
+		return req, nil
+	}
+}
+
+// writeEchoDescriptorSet writes the descriptors of the echo service to dir,
+// and returns the file.
+func writeEchoDescriptorSet(t *testing.T, dir string) string {
+	t.Helper()
+	method := func(name string) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:       proto.String(name),
+			InputType:  proto.String(".google.protobuf.StringValue"),
+			OutputType: proto.String(".google.protobuf.StringValue"),
+		}
+	}
+	echo := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("maestro/test/echo.proto"),
+		Package:    proto.String("maestro.test"),
+		Dependency: []string{"google/protobuf/wrappers.proto"},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name:   proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{method("Echo"), method("Check")},
+		}},
+		Syntax: proto.String("proto3"),
+	}
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(wrapperspb.File_google_protobuf_wrappers_proto),
+			echo,
+		},
+	}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatalf("marshal descriptor set: %s", err)
+	}
+	file := filepath.Join(dir, "echo.pb")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatalf("write descriptor set: %s", err)
+	}
+	return file
+}
@@ -0,0 +1,104 @@
+package maestro
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/DuarteMRAlves/maestro/internal/grpcw"
+	"github.com/spf13/cobra"
+)
+
+// tlsConfig creates the configuration for a secure connection from its
+// specification.
+func tlsConfig(spec *api.TLS) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         spec.ServerName,
+		InsecureSkipVerify: spec.InsecureSkipVerify,
+	}
+	if spec.CAFile != "" {
+		data, err := ioutil.ReadFile(spec.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates in ca file %s", spec.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if (spec.CertFile == "") != (spec.KeyFile == "") {
+		return nil, errors.New("cert file and key file must be specified together")
+	}
+	if spec.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(spec.CertFile, spec.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// tlsOpts are the options to connect with a server specified in the command
+// line, which is not configured in a pipeline.
+type tlsOpts struct {
+	enabled            bool
+	caFile             string
+	certFile           string
+	keyFile            string
+	serverName         string
+	insecureSkipVerify bool
+}
+
+func (opts *tlsOpts) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&opts.enabled, "tls", false, "connect to the server with tls")
+	cmd.Flags().StringVar(&opts.caFile, "ca-file", "", "certificate authority to verify the server")
+	cmd.Flags().StringVar(&opts.certFile, "cert-file", "", "client certificate for mutual tls")
+	cmd.Flags().StringVar(&opts.keyFile, "key-file", "", "client key for mutual tls")
+	cmd.Flags().StringVar(
+		&opts.serverName, "server-name", "", "name used to verify the server certificate",
+	)
+	cmd.Flags().BoolVar(
+		&opts.insecureSkipVerify,
+		"insecure-skip-verify",
+		false,
+		"do not verify the server certificate",
+	)
+}
+
+func (opts *tlsOpts) validate() error {
+	if !opts.enabled && (opts.caFile != "" || opts.certFile != "" || opts.keyFile != "" ||
+		opts.serverName != "" || opts.insecureSkipVerify) {
+		return errors.New("tls options require tls")
+	}
+	return nil
+}
+
+// configure sets the tls configuration of the server of the method address,
+// if tls is enabled.
+func (opts *tlsOpts) configure(r *grpcw.ReflectionResolver, address string) error {
+	if !opts.enabled {
+		return nil
+	}
+	spec := &api.TLS{
+		CAFile:             opts.caFile,
+		CertFile:           opts.certFile,
+		KeyFile:            opts.keyFile,
+		ServerName:         opts.serverName,
+		InsecureSkipVerify: opts.insecureSkipVerify,
+	}
+	cfg, err := tlsConfig(spec)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	server, err := grpcw.ServerAddress(address)
+	if err != nil {
+		return err
+	}
+	r.ConfigureServer(server, grpcw.ServerConfig{TLS: cfg})
+	return nil
+}
@@ -0,0 +1,101 @@
+package maestro
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir)
+	emptyFile := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(emptyFile, nil, 0o600); err != nil {
+		t.Fatalf("write empty file: %s", err)
+	}
+
+	spec := &api.TLS{
+		CAFile:     certFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "maestro.test",
+	}
+	cfg, err := tlsConfig(spec)
+	if err != nil {
+		t.Fatalf("tls config: %s", err)
+	}
+	if diff := cmp.Diff("maestro.test", cfg.ServerName); diff != "" {
+		t.Fatalf("server name mismatch:\n%s", diff)
+	}
+	if cfg.RootCAs == nil {
+		t.Fatalf("expected root certificate authorities")
+	}
+	if diff := cmp.Diff(1, len(cfg.Certificates)); diff != "" {
+		t.Fatalf("certificates mismatch:\n%s", diff)
+	}
+
+	errTests := map[string]*api.TLS{
+		"missing ca file":   {CAFile: filepath.Join(dir, "missing.pem")},
+		"empty ca file":     {CAFile: emptyFile},
+		"cert without key":  {CertFile: certFile},
+		"key is not a cert": {CertFile: keyFile, KeyFile: keyFile},
+	}
+	for name, spec := range errTests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tlsConfig(spec); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+// writeCertificate writes a self-signed certificate for localhost and its
+// key to dir, and returns the files.
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost", "maestro.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %s", err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("write certificate: %s", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatalf("write key: %s", err)
+	}
+	return certFile, keyFile
+}
@@ -0,0 +1,64 @@
+package maestro
+
+import (
+	"os"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/logs"
+)
+
+// watchInterval is the time between checks for changes in watched files.
+const watchInterval = time.Second
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchFiles calls onChange every time one of the files is modified, until
+// stop is closed. Files are polled at the given interval and changes to
+// multiple files in the same interval trigger a single call.
+func watchFiles(
+	files []string,
+	interval time.Duration,
+	stop <-chan struct{},
+	onChange func(),
+	logger logs.Logger,
+) {
+	versions := fileVersions(files, logger)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		next := fileVersions(files, logger)
+		changed := false
+		for f, v := range next {
+			if versions[f] != v {
+				logger.Infof("File %s changed\n", f)
+				changed = true
+			}
+		}
+		versions = next
+		if changed {
+			onChange()
+		}
+	}
+}
+
+func fileVersions(files []string, logger logs.Logger) map[string]fileVersion {
+	versions := make(map[string]fileVersion, len(files))
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			// Files may be temporarily missing while editors save them.
+			logger.Debugf("watch %s: %s\n", f, err)
+			continue
+		}
+		versions[f] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+	}
+	return versions
+}
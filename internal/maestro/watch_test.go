@@ -0,0 +1,53 @@
+package maestro
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/logs"
+)
+
+func TestWatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "pipeline.yml")
+	if err := os.WriteFile(file, []byte("kind: pipeline\n"), 0644); err != nil {
+		t.Fatalf("write file: %s", err)
+	}
+	missing := filepath.Join(dir, "missing.yml")
+
+	changes := make(chan struct{}, 10)
+	stop := make(chan struct{})
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		onChange := func() { changes <- struct{}{} }
+		watchFiles([]string{file, missing}, 10*time.Millisecond, stop, onChange, logs.New(false))
+	}()
+
+	select {
+	case <-changes:
+		t.Fatalf("reload without changes")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The size changes, so the change is detected even if the modification
+	// time has a coarse resolution.
+	if err := os.WriteFile(file, []byte("kind: pipeline\nspec: {}\n"), 0644); err != nil {
+		t.Fatalf("update file: %s", err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatalf("no reload after the file changed")
+	}
+
+	close(stop)
+	<-watchDone
+	select {
+	case <-changes:
+		t.Fatalf("reload for a single change")
+	default:
+	}
+}
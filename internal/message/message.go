@@ -1,5 +1,10 @@
 package message
 
+import (
+	"fmt"
+	"math/rand"
+)
+
 // Instance specifies an interface for concrete messages. These messages
 // can be sent and received in stages.
 // An instance can have subfields, that can be updated.
@@ -34,3 +39,100 @@ type Builder interface {
 type BuildFunc func() Instance
 
 func (fn BuildFunc) Build() Instance { return fn() }
+
+// RandomBuilder creates instances with randomly populated fields. Types
+// may optionally implement this interface to support generating test data.
+type RandomBuilder interface {
+	BuildRandom(r *rand.Rand) Instance
+}
+
+// Comparer describes the differences between the fields of two types.
+// Types may optionally implement this interface to report why they are not
+// compatible and which fields are not transferred.
+type Comparer interface {
+	// Compare reports the differences when messages of this type are sent
+	// to the given type.
+	Compare(Type) Compatibility
+}
+
+// Compatibility is a field level report of the differences between a
+// source and a target type. Fields are identified by their path from the
+// root message, such as inner.value, and by their number.
+type Compatibility struct {
+	// Mismatches are the fields with the same number in both types but with
+	// a different kind or cardinality.
+	Mismatches []FieldMismatch
+	// Dropped are the source fields without a target field, whose values
+	// are discarded.
+	Dropped []FieldRef
+	// Unset are the target fields without a source field, that are never
+	// populated.
+	Unset []FieldRef
+}
+
+// Compatible reports whether the messages can be sent from the source to
+// the target type.
+func (c Compatibility) Compatible() bool { return len(c.Mismatches) == 0 }
+
+// Exact reports whether the types are compatible and all fields are
+// transferred.
+func (c Compatibility) Exact() bool {
+	return c.Compatible() && len(c.Dropped) == 0 && len(c.Unset) == 0
+}
+
+// FieldRef identifies a field by its path and number.
+type FieldRef struct {
+	Path   string
+	Number int
+}
+
+func (f FieldRef) String() string { return fmt.Sprintf("%s (%d)", f.Path, f.Number) }
+
+// FieldMismatch describes a field with different definitions in the source
+// and target types.
+type FieldMismatch struct {
+	FieldRef
+	// Source and Target describe the field in each type, such as
+	// "repeated int64".
+	Source, Target string
+}
+
+func (f FieldMismatch) String() string {
+	return fmt.Sprintf("%s: %s != %s", f.FieldRef, f.Source, f.Target)
+}
+
+// NameMatcher is implemented by types whose fields can be matched by name
+// instead of by number.
+type NameMatcher interface {
+	// CompareByName is like Compare but matches the fields by name.
+	CompareByName(Type) Compatibility
+	// ConvertByName returns a function that converts messages of this type
+	// to the given type, copying the fields with the same name.
+	ConvertByName(Type) (Converter, error)
+}
+
+// Converter transforms a message into a message of another type.
+type Converter func(Instance) (Instance, error)
+
+// Envelope is implemented by types whose messages may wrap messages of other
+// types, such as the protobuf Any type.
+type Envelope interface {
+	// IsEnvelope reports whether messages of this type wrap other messages.
+	IsEnvelope() bool
+	// Pack returns a converter that wraps messages of the given type in
+	// messages of this type.
+	Pack(Type) (Converter, error)
+	// Unpack returns a converter that unwraps the messages of the type with
+	// the given name into messages of the given type.
+	Unpack(name string, t Type) (Converter, error)
+}
+
+// OneofSelector is implemented by types with fields that hold one of several
+// alternatives, such as protobuf oneofs.
+type OneofSelector interface {
+	// IsOneof reports whether the field is a oneof.
+	IsOneof(Field) bool
+	// SelectOneof returns the member of the oneof that receives messages of
+	// the given type.
+	SelectOneof(oneof Field, t Type) (Field, error)
+}
@@ -2,6 +2,7 @@ package method
 
 import (
 	"context"
+	"errors"
 
 	"github.com/DuarteMRAlves/maestro/internal/message"
 )
@@ -38,3 +39,99 @@ type ResolveFunc func(ctx context.Context, address string) (Desc, error)
 func (fn ResolveFunc) Resolve(ctx context.Context, address string) (Desc, error) {
 	return fn(ctx, address)
 }
+
+// ErrUnavailable is returned by Conn.Call when the server is unavailable.
+// The call can be retried once the server is healthy.
+var ErrUnavailable = errors.New("server unavailable")
+
+// Health is the health of the server that executes a method.
+type Health int
+
+const (
+	HealthUnknown Health = iota
+	Healthy
+	Unhealthy
+)
+
+func (h Health) String() string {
+	switch h {
+	case Healthy:
+		return "healthy"
+	case Unhealthy:
+		return "unhealthy"
+	default:
+		return "unknown"
+	}
+}
+
+// HealthWatcher is implemented by the connections that monitor the health
+// of the server.
+type HealthWatcher interface {
+	// WatchHealth sends the health of the server every time it changes,
+	// until the context is cancelled, at which point the channel is closed.
+	WatchHealth(ctx context.Context) <-chan Health
+}
+
+// Metadata are the headers sent and received with the calls of a method,
+// such as the grpc metadata. The keys are lowercase.
+type Metadata map[string][]string
+
+// Select returns the entries of md with the given keys, or nil if there are
+// none.
+func (md Metadata) Select(keys []string) Metadata {
+	var sel Metadata
+	for _, k := range keys {
+		if v, ok := md[k]; ok {
+			if sel == nil {
+				sel = make(Metadata, len(keys))
+			}
+			sel[k] = v
+		}
+	}
+	return sel
+}
+
+// Join returns the entries of all the given metadata, or nil if there are
+// none. A key in several metadata keeps the values of the first one.
+func Join(mds ...Metadata) Metadata {
+	var joined Metadata
+	for _, md := range mds {
+		for k, v := range md {
+			if _, ok := joined[k]; ok {
+				continue
+			}
+			if joined == nil {
+				joined = make(Metadata, len(md))
+			}
+			joined[k] = v
+		}
+	}
+	return joined
+}
+
+// MetadataCaller is implemented by the connections that send and receive
+// metadata with the calls.
+type MetadataCaller interface {
+	// CallWithMetadata calls the method with the metadata md. It returns the
+	// reply and the metadata received with it, such as the grpc headers and
+	// trailers.
+	CallWithMetadata(
+		ctx context.Context, req message.Instance, md Metadata,
+	) (message.Instance, Metadata, error)
+}
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a copy of ctx with the correlation id of the
+// message being processed, which is shared by the calls of all the stages
+// for the messages that derive from the same source message.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation id of the message being processed,
+// or an empty string if ctx does not have one.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
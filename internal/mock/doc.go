@@ -0,0 +1,3 @@
+// Package mock provides in-process replacements for remote methods, so that
+// pipelines can be executed without the services they connect.
+package mock
@@ -0,0 +1,83 @@
+package mock
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+
+	"github.com/DuarteMRAlves/maestro/internal/message"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+)
+
+// Generator creates the messages returned by mocked methods.
+type Generator interface {
+	Generate(t message.Type) message.Instance
+}
+
+// GenerateFunc is a function that implements the Generator interface.
+type GenerateFunc func(t message.Type) message.Instance
+
+func (fn GenerateFunc) Generate(t message.Type) message.Instance { return fn(t) }
+
+// EmptyGenerator generates messages with all fields set to their default
+// values.
+func EmptyGenerator() Generator {
+	return GenerateFunc(func(t message.Type) message.Instance {
+		return t.Build()
+	})
+}
+
+// RandomGenerator generates messages with randomly populated fields. Types
+// that do not implement message.RandomBuilder are built with default values.
+func RandomGenerator(seed int64) Generator {
+	var (
+		mu sync.Mutex
+		r  = rand.New(rand.NewSource(seed))
+	)
+	return GenerateFunc(func(t message.Type) message.Instance {
+		rb, ok := t.(message.RandomBuilder)
+		if !ok {
+			return t.Build()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return rb.BuildRandom(r)
+	})
+}
+
+// NewResolver wraps a resolver so that the resolved methods keep their
+// input and output types but, when dialed, return connections that never
+// contact the remote method. Instead, each call replies with a message
+// created by gen for the method output type.
+func NewResolver(r method.Resolver, gen Generator) method.Resolver {
+	return method.ResolveFunc(func(ctx context.Context, address string) (method.Desc, error) {
+		desc, err := r.Resolve(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		return &mockDesc{Desc: desc, gen: gen}, nil
+	})
+}
+
+type mockDesc struct {
+	method.Desc
+	gen Generator
+}
+
+func (d *mockDesc) Dial() (method.Conn, error) {
+	return &mockConn{output: d.Output(), gen: d.gen}, nil
+}
+
+type mockConn struct {
+	output message.Type
+	gen    Generator
+}
+
+func (c *mockConn) Call(ctx context.Context, _ message.Instance) (message.Instance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.gen.Generate(c.output), nil
+}
+
+func (c *mockConn) Close() error { return nil }
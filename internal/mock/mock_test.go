@@ -0,0 +1,126 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/DuarteMRAlves/maestro/internal/message"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolver(t *testing.T) {
+	tests := map[string]struct {
+		gen      Generator
+		expected *testMsg
+	}{
+		"empty generator": {
+			gen:      EmptyGenerator(),
+			expected: &testMsg{},
+		},
+		"random generator": {
+			gen:      RandomGenerator(1),
+			expected: &testMsg{Val: rand.New(rand.NewSource(1)).Int63()},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			resolver := NewResolver(testResolver(), tc.gen)
+			desc, err := resolver.Resolve(context.Background(), "address")
+			if err != nil {
+				t.Fatalf("resolve error: %s", err)
+			}
+			if _, ok := desc.Input().(testEmptyType); !ok {
+				t.Fatalf("input type mismatch: expected testEmptyType, got %T", desc.Input())
+			}
+			if _, ok := desc.Output().(testRandomType); !ok {
+				t.Fatalf("output type mismatch: expected testRandomType, got %T", desc.Output())
+			}
+			conn, err := desc.Dial()
+			if err != nil {
+				t.Fatalf("dial error: %s", err)
+			}
+			defer conn.Close()
+			rep, err := conn.Call(context.Background(), &testMsg{})
+			if err != nil {
+				t.Fatalf("call error: %s", err)
+			}
+			if diff := cmp.Diff(tc.expected, rep); diff != "" {
+				t.Fatalf("reply mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResolver_Err(t *testing.T) {
+	expErr := errors.New("resolve error")
+	r := method.ResolveFunc(func(context.Context, string) (method.Desc, error) {
+		return nil, expErr
+	})
+	_, err := NewResolver(r, EmptyGenerator()).Resolve(context.Background(), "address")
+	if !errors.Is(err, expErr) {
+		t.Fatalf("wrong error: expected '%s', got '%s'", expErr, err)
+	}
+}
+
+func TestConn_CanceledContext(t *testing.T) {
+	desc, err := NewResolver(testResolver(), EmptyGenerator()).Resolve(
+		context.Background(), "address",
+	)
+	if err != nil {
+		t.Fatalf("resolve error: %s", err)
+	}
+	conn, err := desc.Dial()
+	if err != nil {
+		t.Fatalf("dial error: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := conn.Call(ctx, &testMsg{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error: expected '%s', got '%s'", context.Canceled, err)
+	}
+}
+
+func testResolver() method.ResolveFunc {
+	return func(context.Context, string) (method.Desc, error) {
+		return testDesc{}, nil
+	}
+}
+
+type testDesc struct{}
+
+func (d testDesc) Dial() (method.Conn, error) {
+	panic("remote method should not be dialed")
+}
+
+func (d testDesc) Input() message.Type { return testEmptyType{} }
+
+func (d testDesc) Output() message.Type { return testRandomType{} }
+
+type testMsg struct{ Val int64 }
+
+func (m *testMsg) Set(_ message.Field, _ message.Instance) error {
+	panic("Should not set field in mock test")
+}
+
+func (m *testMsg) Get(_ message.Field) (message.Instance, error) {
+	panic("Should not get field in mock test")
+}
+
+type testEmptyType struct{}
+
+func (t testEmptyType) Build() message.Instance { return &testMsg{} }
+
+func (t testEmptyType) Subfield(_ message.Field) (message.Type, error) {
+	panic("Should not get subfield in mock test")
+}
+
+func (t testEmptyType) Compatible(_ message.Type) bool { return true }
+
+type testRandomType struct{ testEmptyType }
+
+func (t testRandomType) BuildRandom(r *rand.Rand) message.Instance {
+	return &testMsg{Val: r.Int63()}
+}
@@ -0,0 +1,3 @@
+// Package record stores the traffic exchanged with the methods of a
+// pipeline and replays it in place of the remote methods.
+package record
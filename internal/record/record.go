@@ -0,0 +1,292 @@
+package record
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DuarteMRAlves/maestro/internal/message"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+	"github.com/DuarteMRAlves/maestro/internal/retry"
+)
+
+const indexFile = "index.json"
+
+// Codec serializes the messages and methods to be recorded.
+type Codec interface {
+	MarshalMessage(message.Instance) ([]byte, error)
+	UnmarshalMessage([]byte, message.Type) (message.Instance, error)
+	MarshalMethod(method.Desc) ([]byte, error)
+	UnmarshalMethod([]byte) (method.Desc, error)
+}
+
+// index lists the methods that were resolved during a recording, in the
+// order they were first resolved. Each address, which includes the service
+// and the method, has a single entry.
+type index struct {
+	Methods []indexEntry `json:"methods"`
+}
+
+type indexEntry struct {
+	Address string `json:"address"`
+	// Method is the name of the file with the encoded method.
+	Method string `json:"method"`
+	// Calls is the name of the file with the recorded calls, in the json
+	// lines format.
+	Calls string `json:"calls"`
+}
+
+// call is a request and response pair exchanged with a method.
+type call struct {
+	// Seq orders the calls across all the methods in the recording.
+	Seq uint64 `json:"seq"`
+	// Num orders the calls for a single method.
+	Num      uint64        `json:"num"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	// Correlation is the correlation id of the message of the pipeline
+	// that was sent in the request, if any. It is the same for the calls of
+	// all the stages for the messages that derive from the same source
+	// message.
+	Correlation string          `json:"correlation,omitempty"`
+	Request     json.RawMessage `json:"request"`
+	Response    json.RawMessage `json:"response,omitempty"`
+	// Metadata is the metadata sent with the request, and ReplyMetadata
+	// the metadata received with the reply, such as the grpc headers and
+	// trailers.
+	Metadata      method.Metadata `json:"metadata,omitempty"`
+	ReplyMetadata method.Metadata `json:"reply_metadata,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	// Code is the name of the grpc status code of the error, such as
+	// "Unavailable".
+	Code string `json:"code,omitempty"`
+}
+
+// Logger logs the calls that could not be recorded.
+type Logger interface {
+	Infof(format string, args ...any)
+}
+
+// Recorder is a method.Resolver that writes every request and response
+// exchanged with the resolved methods to a directory.
+type Recorder struct {
+	dir      string
+	codec    Codec
+	resolver method.Resolver
+	logger   Logger
+
+	seq uint64
+
+	mu    sync.Mutex
+	index index
+	files []*os.File
+	// writers are the writers of the calls of each recorded address.
+	writers map[string]*callWriter
+}
+
+// NewRecorder creates a Recorder that resolves methods with r and stores the
+// recording in dir, which is created if it does not exist. The calls that
+// cannot be recorded are logged, and do not change the result of the calls.
+func NewRecorder(dir string, codec Codec, r method.Resolver, logger Logger) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create recorder: %w", err)
+	}
+	rec := &Recorder{
+		dir:      dir,
+		codec:    codec,
+		resolver: r,
+		logger:   logger,
+		writers:  make(map[string]*callWriter),
+	}
+	if err := rec.writeIndex(); err != nil {
+		return nil, fmt.Errorf("create recorder: %w", err)
+	}
+	return rec, nil
+}
+
+// Resolve resolves the method at address and records its calls. The calls
+// of all the resolutions of the same address are recorded together, so that
+// the recording does not depend on the order of the resolutions.
+func (r *Recorder) Resolve(ctx context.Context, address string) (method.Desc, error) {
+	desc, err := r.resolver.Resolve(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.codec.MarshalMethod(desc)
+	if err != nil {
+		return nil, fmt.Errorf("record %s: %w", address, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if w, ok := r.writers[address]; ok {
+		return &recordDesc{Desc: desc, rec: r, w: w}, nil
+	}
+	id := len(r.index.Methods)
+	entry := indexEntry{
+		Address: address,
+		Method:  fmt.Sprintf("method-%d.json", id),
+		Calls:   fmt.Sprintf("method-%d.calls.jsonl", id),
+	}
+	err = ioutil.WriteFile(filepath.Join(r.dir, entry.Method), data, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("record %s: %w", address, err)
+	}
+	f, err := os.Create(filepath.Join(r.dir, entry.Calls))
+	if err != nil {
+		return nil, fmt.Errorf("record %s: %w", address, err)
+	}
+	r.files = append(r.files, f)
+	r.index.Methods = append(r.index.Methods, entry)
+	if err := r.writeIndex(); err != nil {
+		return nil, fmt.Errorf("record %s: %w", address, err)
+	}
+	w := &callWriter{f: f}
+	r.writers[address] = w
+	return &recordDesc{Desc: desc, rec: r, w: w}, nil
+}
+
+// Close closes all the files of the recording.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	for _, f := range r.files {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	r.files = nil
+	return err
+}
+
+func (r *Recorder) writeIndex() error {
+	data, err := json.MarshalIndent(r.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(r.dir, indexFile), data, 0644)
+}
+
+func (r *Recorder) nextSeq() uint64 {
+	return atomic.AddUint64(&r.seq, 1)
+}
+
+type callWriter struct {
+	mu  sync.Mutex
+	num uint64
+	f   *os.File
+}
+
+func (w *callWriter) write(c call) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.num++
+	c.Num = w.num
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = w.f.Write(append(data, '\n'))
+	return err
+}
+
+type recordDesc struct {
+	method.Desc
+	rec *Recorder
+	w   *callWriter
+}
+
+func (d *recordDesc) Dial() (method.Conn, error) {
+	conn, err := d.Desc.Dial()
+	if err != nil {
+		return nil, err
+	}
+	return &recordConn{Conn: conn, rec: d.rec, w: d.w}, nil
+}
+
+type recordConn struct {
+	method.Conn
+	rec *Recorder
+	w   *callWriter
+}
+
+func (c *recordConn) Call(ctx context.Context, req message.Instance) (message.Instance, error) {
+	rec := call{
+		Seq:         c.rec.nextSeq(),
+		Correlation: method.CorrelationID(ctx),
+		Start:       time.Now(),
+	}
+	rep, callErr := c.Conn.Call(ctx, req)
+	rec.Duration = time.Since(rec.Start)
+	if err := c.record(rec, req, rep, callErr); err != nil {
+		c.rec.logger.Infof("Record call %d: %s\n", rec.Seq, err)
+	}
+	return rep, callErr
+}
+
+// CallWithMetadata calls the method with the metadata md and records the
+// call as Call, with the sent and received metadata. If the connection does
+// not send metadata, the method is called without it.
+func (c *recordConn) CallWithMetadata(
+	ctx context.Context, req message.Instance, md method.Metadata,
+) (message.Instance, method.Metadata, error) {
+	rec := call{
+		Seq:         c.rec.nextSeq(),
+		Correlation: method.CorrelationID(ctx),
+		Start:       time.Now(),
+		Metadata:    md,
+	}
+	var (
+		rep     message.Instance
+		repMD   method.Metadata
+		callErr error
+	)
+	if caller, ok := c.Conn.(method.MetadataCaller); ok {
+		rep, repMD, callErr = caller.CallWithMetadata(ctx, req, md)
+	} else {
+		rep, callErr = c.Conn.Call(ctx, req)
+	}
+	rec.Duration = time.Since(rec.Start)
+	rec.ReplyMetadata = repMD
+	if err := c.record(rec, req, rep, callErr); err != nil {
+		c.rec.logger.Infof("Record call %d: %s\n", rec.Seq, err)
+	}
+	return rep, repMD, callErr
+}
+
+// record writes the call with its request and outcome.
+func (c *recordConn) record(rec call, req, rep message.Instance, callErr error) error {
+	data, err := c.rec.codec.MarshalMessage(req)
+	if err != nil {
+		return fmt.Errorf("request: %w", err)
+	}
+	rec.Request = data
+	if callErr != nil {
+		rec.Error = callErr.Error()
+		rec.Code = retry.Code(callErr).String()
+	} else {
+		data, err = c.rec.codec.MarshalMessage(rep)
+		if err != nil {
+			return fmt.Errorf("response: %w", err)
+		}
+		rec.Response = data
+	}
+	return c.w.write(rec)
+}
+
+// WatchHealth forwards the health of the recorded connection. It returns a
+// nil channel if the connection does not monitor the health of the server.
+func (c *recordConn) WatchHealth(ctx context.Context) <-chan method.Health {
+	if w, ok := c.Conn.(method.HealthWatcher); ok {
+		return w.WatchHealth(ctx)
+	}
+	return nil
+}
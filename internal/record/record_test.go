@@ -0,0 +1,273 @@
+package record
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/DuarteMRAlves/maestro/internal/message"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	callErr := errors.New("call error")
+
+	rec, err := NewRecorder(dir, testCodec{}, testResolver(callErr), &testLogger{})
+	if err != nil {
+		t.Fatalf("create recorder: %s", err)
+	}
+	desc, err := rec.Resolve(context.Background(), "double")
+	if err != nil {
+		t.Fatalf("resolve error: %s", err)
+	}
+	conn, err := desc.Dial()
+	if err != nil {
+		t.Fatalf("dial error: %s", err)
+	}
+	var expected []*testMsg
+	for i := int64(1); i <= 3; i++ {
+		rep, err := conn.Call(context.Background(), &testMsg{Val: i})
+		if err != nil {
+			t.Fatalf("call error: %s", err)
+		}
+		expected = append(expected, rep.(*testMsg))
+	}
+	if _, err := conn.Call(context.Background(), &testMsg{Val: -1}); !errors.Is(err, callErr) {
+		t.Fatalf("wrong error: expected '%s', got '%s'", callErr, err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatalf("close conn: %s", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("close recorder: %s", err)
+	}
+
+	rep, err := NewReplayer(dir, testCodec{})
+	if err != nil {
+		t.Fatalf("create replayer: %s", err)
+	}
+	if _, err := rep.Resolve(context.Background(), "unknown"); err == nil {
+		t.Fatalf("expected error for unknown address")
+	}
+	desc, err = rep.Resolve(context.Background(), "double")
+	if err != nil {
+		t.Fatalf("resolve error: %s", err)
+	}
+	conn, err = desc.Dial()
+	if err != nil {
+		t.Fatalf("dial error: %s", err)
+	}
+	var actual []*testMsg
+	for i := 0; i < 3; i++ {
+		// Replayed responses do not depend on the request.
+		rep, err := conn.Call(context.Background(), &testMsg{})
+		if err != nil {
+			t.Fatalf("call error: %s", err)
+		}
+		actual = append(actual, rep.(*testMsg))
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("replayed messages mismatch:\n%s", diff)
+	}
+	_, err = conn.Call(context.Background(), &testMsg{})
+	if err == nil || err.Error() != callErr.Error() {
+		t.Fatalf("wrong error: expected '%s', got '%v'", callErr, err)
+	}
+	_, err = conn.Call(context.Background(), &testMsg{})
+	if !errors.Is(err, ErrReplayExhausted) {
+		t.Fatalf("wrong error: expected '%s', got '%v'", ErrReplayExhausted, err)
+	}
+}
+
+func TestReplay_CorrelationAndStatus(t *testing.T) {
+	dir := t.TempDir()
+	callErr := status.Error(codes.Unavailable, "server down")
+
+	rec, err := NewRecorder(dir, testCodec{}, testResolver(callErr), &testLogger{})
+	if err != nil {
+		t.Fatalf("create recorder: %s", err)
+	}
+	// Both resolutions of the address record to the same calls.
+	for i, id := range []string{"1", "2", "3"} {
+		desc, err := rec.Resolve(context.Background(), "double")
+		if err != nil {
+			t.Fatalf("resolve error: %s", err)
+		}
+		conn, err := desc.Dial()
+		if err != nil {
+			t.Fatalf("dial error: %s", err)
+		}
+		ctx := method.WithCorrelationID(context.Background(), id)
+		val := int64(i + 1)
+		if id == "3" {
+			val = -1
+		}
+		_, _ = conn.Call(ctx, &testMsg{Val: val})
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("close recorder: %s", err)
+	}
+
+	rep, err := NewReplayer(dir, testCodec{})
+	if err != nil {
+		t.Fatalf("create replayer: %s", err)
+	}
+	call := func(id string) (message.Instance, error) {
+		desc, err := rep.Resolve(context.Background(), "double")
+		if err != nil {
+			t.Fatalf("resolve error: %s", err)
+		}
+		conn, err := desc.Dial()
+		if err != nil {
+			t.Fatalf("dial error: %s", err)
+		}
+		return conn.Call(method.WithCorrelationID(context.Background(), id), &testMsg{})
+	}
+	// The calls are matched by correlation id, and not by order.
+	_, err = call("3")
+	if !errors.Is(err, method.ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+	if diff := cmp.Diff(codes.Unavailable, status.Code(errors.Unwrap(err))); diff != "" {
+		t.Fatalf("code mismatch:\n%s", diff)
+	}
+	var notRecorded *callNotRecorded
+	if _, err := call("4"); !errors.As(err, &notRecorded) {
+		t.Fatalf("expected not recorded error, got %v", err)
+	}
+	for _, id := range []string{"2", "1"} {
+		rep, err := call(id)
+		if err != nil {
+			t.Fatalf("call %s error: %s", id, err)
+		}
+		expected := &testMsg{Val: 2}
+		if id == "2" {
+			expected.Val = 4
+		}
+		if diff := cmp.Diff(expected, rep); diff != "" {
+			t.Fatalf("call %s mismatch:\n%s", id, diff)
+		}
+	}
+	if _, err := call("1"); !errors.Is(err, ErrReplayExhausted) {
+		t.Fatalf("expected exhausted error, got %v", err)
+	}
+}
+
+func TestRecorder_RecordError(t *testing.T) {
+	logger := &testLogger{}
+	rec, err := NewRecorder(t.TempDir(), failingCodec{}, testResolver(nil), logger)
+	if err != nil {
+		t.Fatalf("create recorder: %s", err)
+	}
+	defer rec.Close()
+	desc, err := rec.Resolve(context.Background(), "double")
+	if err != nil {
+		t.Fatalf("resolve error: %s", err)
+	}
+	conn, err := desc.Dial()
+	if err != nil {
+		t.Fatalf("dial error: %s", err)
+	}
+	// The call succeeds even though it cannot be recorded.
+	rep, err := conn.Call(context.Background(), &testMsg{Val: 2})
+	if err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+	if diff := cmp.Diff(&testMsg{Val: 4}, rep); diff != "" {
+		t.Fatalf("reply mismatch:\n%s", diff)
+	}
+	if diff := cmp.Diff(1, len(logger.msgs)); diff != "" {
+		t.Fatalf("logged messages mismatch:\n%s", diff)
+	}
+}
+
+func testResolver(callErr error) method.ResolveFunc {
+	return func(_ context.Context, address string) (method.Desc, error) {
+		return testDesc{address: address, err: callErr}, nil
+	}
+}
+
+type testDesc struct {
+	address string
+	err     error
+}
+
+func (d testDesc) Dial() (method.Conn, error) { return testConn{err: d.err}, nil }
+
+func (d testDesc) Input() message.Type { return testType{} }
+
+func (d testDesc) Output() message.Type { return testType{} }
+
+type testConn struct{ err error }
+
+func (c testConn) Call(_ context.Context, req message.Instance) (message.Instance, error) {
+	msg := req.(*testMsg)
+	if msg.Val < 0 {
+		return nil, c.err
+	}
+	return &testMsg{Val: 2 * msg.Val}, nil
+}
+
+func (c testConn) Close() error { return nil }
+
+type testMsg struct{ Val int64 }
+
+func (m *testMsg) Set(_ message.Field, _ message.Instance) error {
+	panic("Should not set field in record test")
+}
+
+func (m *testMsg) Get(_ message.Field) (message.Instance, error) {
+	panic("Should not get field in record test")
+}
+
+type testType struct{}
+
+func (t testType) Build() message.Instance { return &testMsg{} }
+
+func (t testType) Subfield(_ message.Field) (message.Type, error) {
+	panic("Should not get subfield in record test")
+}
+
+func (t testType) Compatible(_ message.Type) bool { return true }
+
+type testCodec struct{}
+
+func (c testCodec) MarshalMessage(m message.Instance) ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (c testCodec) UnmarshalMessage(data []byte, t message.Type) (message.Instance, error) {
+	m := t.Build()
+	return m, json.Unmarshal(data, m)
+}
+
+func (c testCodec) MarshalMethod(desc method.Desc) ([]byte, error) {
+	return json.Marshal(desc.(testDesc).address)
+}
+
+func (c testCodec) UnmarshalMethod(data []byte) (method.Desc, error) {
+	var address string
+	if err := json.Unmarshal(data, &address); err != nil {
+		return nil, err
+	}
+	return testDesc{address: address}, nil
+}
+
+// failingCodec fails to marshal the messages.
+type failingCodec struct{ testCodec }
+
+func (c failingCodec) MarshalMessage(message.Instance) ([]byte, error) {
+	return nil, errors.New("marshal error")
+}
+
+type testLogger struct{ msgs []string }
+
+func (l *testLogger) Infof(format string, args ...any) {
+	l.msgs = append(l.msgs, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,241 @@
+package record
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/DuarteMRAlves/maestro/internal/message"
+	"github.com/DuarteMRAlves/maestro/internal/method"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrReplayExhausted is returned by replayed methods after all the recorded
+// calls were served.
+var ErrReplayExhausted = errors.New("replay exhausted")
+
+type addressNotRecorded struct{ address string }
+
+func (err *addressNotRecorded) Error() string {
+	return fmt.Sprintf("address not recorded: %q", err.address)
+}
+
+// Replayer is a method.Resolver that serves the methods from a recording.
+// The returned methods do not contact the remote servers and reply with the
+// recorded responses.
+//
+// Methods are matched by address, which includes the service and the
+// method. All the resolutions of the same address share the recorded calls,
+// so that each call is replayed once. A call is matched with the recorded
+// call with the same correlation id or, if the calls do not have one, with
+// the next recorded call.
+type Replayer struct {
+	dir   string
+	codec Codec
+
+	mu      sync.Mutex
+	entries map[string][]indexEntry
+	calls   map[string]*callQueue
+}
+
+// NewReplayer creates a Replayer for the recording stored in dir.
+func NewReplayer(dir string, codec Codec) (*Replayer, error) {
+	var idx index
+	data, err := ioutil.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil {
+		return nil, fmt.Errorf("create replayer: %w", err)
+	}
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("create replayer: %w", err)
+	}
+	entries := make(map[string][]indexEntry)
+	for _, e := range idx.Methods {
+		entries[e.Address] = append(entries[e.Address], e)
+	}
+	r := &Replayer{
+		dir:     dir,
+		codec:   codec,
+		entries: entries,
+		calls:   make(map[string]*callQueue),
+	}
+	return r, nil
+}
+
+func (r *Replayer) Resolve(_ context.Context, address string) (method.Desc, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.entries[address]
+	if len(entries) == 0 {
+		return nil, &addressNotRecorded{address: address}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(r.dir, entries[0].Method))
+	if err != nil {
+		return nil, fmt.Errorf("replay %s: %w", address, err)
+	}
+	desc, err := r.codec.UnmarshalMethod(data)
+	if err != nil {
+		return nil, fmt.Errorf("replay %s: %w", address, err)
+	}
+	queue, ok := r.calls[address]
+	if !ok {
+		// Recordings may have several entries for the same address, whose
+		// calls are replayed in the order they were recorded.
+		var calls []call
+		for _, e := range entries {
+			c, err := readCalls(filepath.Join(r.dir, e.Calls))
+			if err != nil {
+				return nil, fmt.Errorf("replay %s: %w", address, err)
+			}
+			calls = append(calls, c...)
+		}
+		sort.SliceStable(calls, func(i, j int) bool { return calls[i].Seq < calls[j].Seq })
+		queue = &callQueue{calls: calls}
+		r.calls[address] = queue
+	}
+	return &replayDesc{Desc: desc, codec: r.codec, calls: queue}, nil
+}
+
+func readCalls(file string) ([]call, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var calls []call
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		var c call
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, err
+		}
+		calls = append(calls, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// callQueue has the recorded calls of an address that were not replayed.
+type callQueue struct {
+	mu    sync.Mutex
+	calls []call
+}
+
+// next removes and returns the first call with the correlation id or, if
+// there is none, the first call without a correlation id.
+func (q *callQueue) next(correlation string) (call, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.calls) == 0 {
+		return call{}, ErrReplayExhausted
+	}
+	found := -1
+	for i, c := range q.calls {
+		if c.Correlation == correlation {
+			found = i
+			break
+		}
+		if found < 0 && c.Correlation == "" {
+			found = i
+		}
+	}
+	if found < 0 {
+		if correlation == "" {
+			found = 0
+		} else {
+			return call{}, &callNotRecorded{correlation: correlation}
+		}
+	}
+	c := q.calls[found]
+	q.calls = append(q.calls[:found:found], q.calls[found+1:]...)
+	return c, nil
+}
+
+type callNotRecorded struct{ correlation string }
+
+func (err *callNotRecorded) Error() string {
+	return fmt.Sprintf("call not recorded: correlation id %s", err.correlation)
+}
+
+type replayDesc struct {
+	method.Desc
+	codec Codec
+	calls *callQueue
+}
+
+func (d *replayDesc) Dial() (method.Conn, error) {
+	return &replayConn{output: d.Output(), codec: d.codec, calls: d.calls}, nil
+}
+
+type replayConn struct {
+	output message.Type
+	codec  Codec
+	calls  *callQueue
+}
+
+func (c *replayConn) Call(ctx context.Context, req message.Instance) (message.Instance, error) {
+	rep, _, err := c.CallWithMetadata(ctx, req, nil)
+	return rep, err
+}
+
+// CallWithMetadata replies with the recorded response and the metadata
+// received with it.
+func (c *replayConn) CallWithMetadata(
+	ctx context.Context, _ message.Instance, _ method.Metadata,
+) (message.Instance, method.Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	next, err := c.calls.next(method.CorrelationID(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	if next.Error != "" {
+		return nil, next.ReplyMetadata, replayError(next)
+	}
+	rep, err := c.codec.UnmarshalMessage(next.Response, c.output)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rep, next.ReplyMetadata, nil
+}
+
+func (c *replayConn) Close() error { return nil }
+
+// replayedError is the error of a recorded call. It has the grpc status of
+// the recorded error and, as the errors of the grpc methods, it matches
+// method.ErrUnavailable if the server was unavailable.
+type replayedError struct {
+	msg string
+	err error
+}
+
+func replayError(c call) error {
+	// Recordings without the code have errors with an unknown status.
+	code := codes.Unknown
+	for cand := codes.OK; cand <= codes.Unauthenticated; cand++ {
+		if cand.String() == c.Code {
+			code = cand
+		}
+	}
+	return &replayedError{msg: c.Error, err: status.Error(code, c.Error)}
+}
+
+func (err *replayedError) Error() string { return err.msg }
+
+func (err *replayedError) Unwrap() error { return err.err }
+
+func (err *replayedError) Is(target error) bool {
+	return target == method.ErrUnavailable && status.Code(err.err) == codes.Unavailable
+}
@@ -3,6 +3,7 @@ package repr
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/DuarteMRAlves/maestro/internal/api"
 )
@@ -26,6 +27,24 @@ func writePipeline(b *strings.Builder, p *api.Pipeline) {
 
 	b.WriteString("\nLinks: ")
 	writeLinks(b, p.Links...)
+
+	b.WriteRune('\n')
+	writeDeadLetter(b, p.DeadLetter, 0)
+
+	b.WriteRune('\n')
+	writeStringsField(b, "PropagateMetadata", p.PropagateMetadata, 0)
+}
+
+func writeDeadLetter(b *strings.Builder, d *api.DeadLetter, indent uint) {
+	if d == nil {
+		writeNilField(b, "DeadLetter", indent)
+		return
+	}
+	writeObjectField(b, "DeadLetter", indent, func(indent uint) {
+		writeStringField(b, "File", d.File, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "Address", d.Address, indent)
+	})
 }
 
 func writeStages(b *strings.Builder, ss ...*api.Stage) {
@@ -56,6 +75,165 @@ func writeStage(b *strings.Builder, s *api.Stage, indent uint) {
 	writeStringField(b, "Service", s.Service, indent)
 	b.WriteRune('\n')
 	writeStringField(b, "Method", s.Method, indent)
+	b.WriteRune('\n')
+	writeDurationField(b, "Timeout", s.Timeout, indent)
+	b.WriteRune('\n')
+	writeTLS(b, s.TLS, indent)
+	b.WriteRune('\n')
+	writeStringField(b, "OnError", s.OnError, indent)
+	b.WriteRune('\n')
+	writeCircuitBreaker(b, s.CircuitBreaker, indent)
+	b.WriteRune('\n')
+	writeRetry(b, s.Retry, indent)
+	b.WriteRune('\n')
+	writeMetadata(b, s.Metadata, indent)
+	b.WriteRune('\n')
+	writeAuth(b, s.Auth, indent)
+}
+
+func writeAuth(b *strings.Builder, a *api.Auth, indent uint) {
+	if a == nil {
+		writeNilField(b, "Auth", indent)
+		return
+	}
+	writeObjectField(b, "Auth", indent, func(indent uint) {
+		writeOAuth2(b, a.OAuth2, indent)
+		b.WriteRune('\n')
+		writeJWT(b, a.JWT, indent)
+		b.WriteRune('\n')
+		writeDurationField(b, "RefreshBefore", a.RefreshBefore, indent)
+		b.WriteRune('\n')
+		writeBoolField(b, "Insecure", a.Insecure, indent)
+	})
+}
+
+func writeOAuth2(b *strings.Builder, o *api.OAuth2, indent uint) {
+	if o == nil {
+		writeNilField(b, "OAuth2", indent)
+		return
+	}
+	// The client secret is not written, as the config is logged.
+	secret := ""
+	if o.ClientSecret != "" {
+		secret = "<redacted>"
+	}
+	writeObjectField(b, "OAuth2", indent, func(indent uint) {
+		writeStringField(b, "TokenURL", o.TokenURL, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "ClientID", o.ClientID, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "ClientSecret", secret, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "ClientSecretEnv", o.ClientSecretEnv, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "ClientSecretFile", o.ClientSecretFile, indent)
+		b.WriteRune('\n')
+		writeStringsField(b, "Scopes", o.Scopes, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "Audience", o.Audience, indent)
+	})
+}
+
+func writeJWT(b *strings.Builder, j *api.JWT, indent uint) {
+	if j == nil {
+		writeNilField(b, "JWT", indent)
+		return
+	}
+	writeObjectField(b, "JWT", indent, func(indent uint) {
+		writeStringField(b, "KeyFile", j.KeyFile, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "KeyID", j.KeyID, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "Issuer", j.Issuer, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "Subject", j.Subject, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "Audience", j.Audience, indent)
+		b.WriteRune('\n')
+		writeDurationField(b, "Lifetime", j.Lifetime, indent)
+	})
+}
+
+func writeCircuitBreaker(b *strings.Builder, c *api.CircuitBreaker, indent uint) {
+	if c == nil {
+		writeNilField(b, "CircuitBreaker", indent)
+		return
+	}
+	writeObjectField(b, "CircuitBreaker", indent, func(indent uint) {
+		writeUIntegerField(b, "ConsecutiveFailures", c.ConsecutiveFailures, indent)
+		b.WriteRune('\n')
+		writeFloatField(b, "ErrorRate", c.ErrorRate, indent)
+		b.WriteRune('\n')
+		writeUIntegerField(b, "Window", c.Window, indent)
+		b.WriteRune('\n')
+		writeDurationField(b, "OpenTimeout", c.OpenTimeout, indent)
+		b.WriteRune('\n')
+		writeUIntegerField(b, "HalfOpenProbes", c.HalfOpenProbes, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "WhileOpen", c.WhileOpen, indent)
+	})
+}
+
+func writeTLS(b *strings.Builder, t *api.TLS, indent uint) {
+	if t == nil {
+		writeNilField(b, "TLS", indent)
+		return
+	}
+	writeObjectField(b, "TLS", indent, func(indent uint) {
+		writeStringField(b, "CAFile", t.CAFile, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "CertFile", t.CertFile, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "KeyFile", t.KeyFile, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "ServerName", t.ServerName, indent)
+		b.WriteRune('\n')
+		writeBoolField(b, "InsecureSkipVerify", t.InsecureSkipVerify, indent)
+	})
+}
+
+func writeRetry(b *strings.Builder, r *api.Retry, indent uint) {
+	if r == nil {
+		writeNilField(b, "Retry", indent)
+		return
+	}
+	writeObjectField(b, "Retry", indent, func(indent uint) {
+		writeUIntegerField(b, "MaxAttempts", r.MaxAttempts, indent)
+		b.WriteRune('\n')
+		writeDurationField(b, "InitialBackoff", r.InitialBackoff, indent)
+		b.WriteRune('\n')
+		writeDurationField(b, "MaxBackoff", r.MaxBackoff, indent)
+		b.WriteRune('\n')
+		writeStringField(b, "Jitter", r.Jitter, indent)
+		b.WriteRune('\n')
+		writeStringsField(b, "Codes", r.Codes, indent)
+	})
+}
+
+func writeMetadata(b *strings.Builder, hh []*api.Header, indent uint) {
+	writeIdent(b, indent)
+	b.WriteString("Metadata: [")
+	if len(hh) == 0 {
+		b.WriteRune(']')
+		return
+	}
+	b.WriteRune('\n')
+	for _, h := range hh {
+		writeIdent(b, indent+1)
+		b.WriteString("{\n")
+		writeStringField(b, "Name", h.Name, indent+2)
+		b.WriteRune('\n')
+		writeStringField(b, "Value", h.Value, indent+2)
+		b.WriteRune('\n')
+		writeStringField(b, "Env", h.Env, indent+2)
+		b.WriteRune('\n')
+		writeStringField(b, "File", h.File, indent+2)
+		b.WriteRune('\n')
+		writeIdent(b, indent+1)
+		b.WriteString("}\n")
+	}
+	writeIdent(b, indent)
+	b.WriteRune(']')
 }
 
 func writeLinks(b *strings.Builder, ll ...*api.Link) {
@@ -90,6 +268,12 @@ func writeLink(b *strings.Builder, l *api.Link, indent uint) {
 	writeStringField(b, "TargetField", l.TargetField, indent)
 	b.WriteRune('\n')
 	writeUIntegerField(b, "NumEmptyMessages", l.NumEmptyMessages, indent)
+	b.WriteRune('\n')
+	writeBoolField(b, "Strict", l.Strict, indent)
+	b.WriteRune('\n')
+	writeStringField(b, "Match", l.Match, indent)
+	b.WriteRune('\n')
+	writeStringField(b, "SourceType", l.SourceType, indent)
 }
 
 func writeStringField(b *strings.Builder, field, val string, indent uint) {
@@ -98,12 +282,61 @@ func writeStringField(b *strings.Builder, field, val string, indent uint) {
 	b.WriteString(v)
 }
 
+func writeStringsField(b *strings.Builder, field string, vals []string, indent uint) {
+	writeIdent(b, indent)
+	b.WriteString(field)
+	b.WriteString(": [")
+	for i, val := range vals {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(fmt.Sprintf("%q", val))
+	}
+	b.WriteRune(']')
+}
+
 func writeUIntegerField(b *strings.Builder, field string, val uint, indent uint) {
 	writeIdent(b, indent)
 	v := fmt.Sprintf("%s: %d", field, val)
 	b.WriteString(v)
 }
 
+func writeFloatField(b *strings.Builder, field string, val float64, indent uint) {
+	writeIdent(b, indent)
+	v := fmt.Sprintf("%s: %g", field, val)
+	b.WriteString(v)
+}
+
+func writeDurationField(b *strings.Builder, field string, val time.Duration, indent uint) {
+	writeIdent(b, indent)
+	v := fmt.Sprintf("%s: %s", field, val)
+	b.WriteString(v)
+}
+
+func writeBoolField(b *strings.Builder, field string, val bool, indent uint) {
+	writeIdent(b, indent)
+	v := fmt.Sprintf("%s: %t", field, val)
+	b.WriteString(v)
+}
+
+func writeNilField(b *strings.Builder, field string, indent uint) {
+	writeIdent(b, indent)
+	v := fmt.Sprintf("%s: nil", field)
+	b.WriteString(v)
+}
+
+// writeObjectField writes a field with nested fields, which are written by
+// writeFields with the given indentation.
+func writeObjectField(b *strings.Builder, field string, indent uint, writeFields func(uint)) {
+	writeIdent(b, indent)
+	b.WriteString(field)
+	b.WriteString(": {\n")
+	writeFields(indent + 1)
+	b.WriteRune('\n')
+	writeIdent(b, indent)
+	b.WriteRune('}')
+}
+
 func writeIdent(b *strings.Builder, indent uint) {
 	for i := uint(0); i < indent; i++ {
 		b.WriteRune('\t')
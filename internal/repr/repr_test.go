@@ -2,6 +2,7 @@ package repr
 
 import (
 	"testing"
+	"time"
 
 	"github.com/DuarteMRAlves/maestro/internal/api"
 	"github.com/google/go-cmp/cmp"
@@ -18,7 +19,9 @@ func TestPipeline(t *testing.T) {
 			},
 			expected: `Name: "Pipeline"
 Stages: []
-Links: []`,
+Links: []
+DeadLetter: nil
+PropagateMetadata: []`,
 		},
 		"non empty stages and empty links": {
 			input: &api.Pipeline{
@@ -43,15 +46,31 @@ Stages: [
 		Address: "address-1"
 		Service: ""
 		Method: ""
+		Timeout: 0s
+		TLS: nil
+		OnError: ""
+		CircuitBreaker: nil
+		Retry: nil
+		Metadata: []
+		Auth: nil
 	}
 	{
 		Name: "Stage-2"
 		Address: "address-2"
 		Service: "Service2"
 		Method: "Method2"
+		Timeout: 0s
+		TLS: nil
+		OnError: ""
+		CircuitBreaker: nil
+		Retry: nil
+		Metadata: []
+		Auth: nil
 	}
 ]
-Links: []`,
+Links: []
+DeadLetter: nil
+PropagateMetadata: []`,
 		},
 		"non empty stages and links": {
 			input: &api.Pipeline{
@@ -81,6 +100,9 @@ Links: []`,
 						TargetStage:      "Stage-1",
 						TargetField:      "Field1",
 						NumEmptyMessages: 1,
+						Strict:           true,
+						Match:            "by_name",
+						SourceType:       "events.Created",
 					},
 				},
 			},
@@ -91,12 +113,26 @@ Stages: [
 		Address: "address-1"
 		Service: ""
 		Method: ""
+		Timeout: 0s
+		TLS: nil
+		OnError: ""
+		CircuitBreaker: nil
+		Retry: nil
+		Metadata: []
+		Auth: nil
 	}
 	{
 		Name: "Stage-2"
 		Address: "address-2"
 		Service: "Service2"
 		Method: "Method2"
+		Timeout: 0s
+		TLS: nil
+		OnError: ""
+		CircuitBreaker: nil
+		Retry: nil
+		Metadata: []
+		Auth: nil
 	}
 ]
 Links: [
@@ -107,6 +143,9 @@ Links: [
 		TargetStage: "Stage-2"
 		TargetField: ""
 		NumEmptyMessages: 0
+		Strict: false
+		Match: ""
+		SourceType: ""
 	}
 	{
 		Name: "Stage-2-to-Stage-1"
@@ -115,8 +154,126 @@ Links: [
 		TargetStage: "Stage-1"
 		TargetField: "Field1"
 		NumEmptyMessages: 1
+		Strict: true
+		Match: "by_name"
+		SourceType: "events.Created"
 	}
-]`,
+]
+DeadLetter: nil
+PropagateMetadata: []`,
+		},
+		"stage options": {
+			input: &api.Pipeline{
+				Name: "Pipeline",
+				Stages: []*api.Stage{
+					{
+						Name:    "Stage-1",
+						Address: "address-1",
+						Timeout: 5 * time.Second,
+						TLS: &api.TLS{
+							CAFile:     "ca.pem",
+							ServerName: "server",
+						},
+						OnError: "dead_letter",
+						CircuitBreaker: &api.CircuitBreaker{
+							ErrorRate:      0.5,
+							Window:         20,
+							OpenTimeout:    30 * time.Second,
+							HalfOpenProbes: 1,
+							WhileOpen:      "wait",
+						},
+						Retry: &api.Retry{
+							MaxAttempts:    3,
+							InitialBackoff: 100 * time.Millisecond,
+							MaxBackoff:     10 * time.Second,
+							Jitter:         "full",
+							Codes:          []string{"UNAVAILABLE", "RESOURCE_EXHAUSTED"},
+						},
+						Metadata: []*api.Header{
+							{Name: "x-tenant", Value: "tenant-1"},
+							{Name: "x-api-key", Env: "API_KEY"},
+						},
+						Auth: &api.Auth{
+							OAuth2: &api.OAuth2{
+								TokenURL:     "https://auth/token",
+								ClientID:     "client",
+								ClientSecret: "secret",
+								Scopes:       []string{"read", "write"},
+							},
+							RefreshBefore: time.Minute,
+						},
+					},
+				},
+				DeadLetter:        &api.DeadLetter{File: "dead.jsonl"},
+				PropagateMetadata: []string{"x-request-id"},
+			},
+			expected: `Name: "Pipeline"
+Stages: [
+	{
+		Name: "Stage-1"
+		Address: "address-1"
+		Service: ""
+		Method: ""
+		Timeout: 5s
+		TLS: {
+			CAFile: "ca.pem"
+			CertFile: ""
+			KeyFile: ""
+			ServerName: "server"
+			InsecureSkipVerify: false
+		}
+		OnError: "dead_letter"
+		CircuitBreaker: {
+			ConsecutiveFailures: 0
+			ErrorRate: 0.5
+			Window: 20
+			OpenTimeout: 30s
+			HalfOpenProbes: 1
+			WhileOpen: "wait"
+		}
+		Retry: {
+			MaxAttempts: 3
+			InitialBackoff: 100ms
+			MaxBackoff: 10s
+			Jitter: "full"
+			Codes: ["UNAVAILABLE", "RESOURCE_EXHAUSTED"]
+		}
+		Metadata: [
+			{
+				Name: "x-tenant"
+				Value: "tenant-1"
+				Env: ""
+				File: ""
+			}
+			{
+				Name: "x-api-key"
+				Value: ""
+				Env: "API_KEY"
+				File: ""
+			}
+		]
+		Auth: {
+			OAuth2: {
+				TokenURL: "https://auth/token"
+				ClientID: "client"
+				ClientSecret: "<redacted>"
+				ClientSecretEnv: ""
+				ClientSecretFile: ""
+				Scopes: ["read", "write"]
+				Audience: ""
+			}
+			JWT: nil
+			RefreshBefore: 1m0s
+			Insecure: false
+		}
+	}
+]
+Links: []
+DeadLetter: {
+	File: "dead.jsonl"
+	Address: ""
+}
+PropagateMetadata: ["x-request-id"]`,
 		},
 	}
 	for name, tc := range tests {
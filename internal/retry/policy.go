@@ -0,0 +1,169 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Clock measures the time between retries, so that tests control its
+// passage.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// RealClock is the Clock of the system time.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Jitter specifies how the backoffs of a Policy are randomized.
+type Jitter string
+
+const (
+	// JitterNone uses the backoffs of the exponential backoff.
+	JitterNone Jitter = "none"
+	// JitterFull waits a random duration between zero and the exponential
+	// backoff.
+	JitterFull Jitter = "full"
+	// JitterDecorrelated waits a random duration between the initial backoff
+	// and three times the previous backoff.
+	JitterDecorrelated Jitter = "decorrelated"
+)
+
+// Policy specifies how a failed operation is retried.
+type Policy struct {
+	// MaxAttempts is the maximum number of times the operation is executed,
+	// including the first. If zero, there is no limit.
+	MaxAttempts int
+	// Backoff computes the time between the attempts.
+	Backoff ExponentialBackoff
+	// Jitter randomizes the backoffs. If empty, no jitter is added beyond
+	// the one of Backoff.
+	Jitter Jitter
+	// Codes are the grpc status codes of the errors that are retried. Errors
+	// without a status have the Unknown code.
+	Codes []codes.Code
+}
+
+// Retryable reports whether the error has one of the codes of the policy.
+func (p Policy) Retryable(err error) bool {
+	c := Code(err)
+	for _, retryable := range p.Codes {
+		if c == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+// Do executes the operation until it succeeds, fails with an error that is
+// not retryable, the attempts are exhausted or the context is done. It
+// returns the number of attempts and the last error.
+func (p Policy) Do(ctx context.Context, clock Clock, op func() error) (int, error) {
+	r := p.NewRetrier(clock)
+	for attempts := 1; ; attempts++ {
+		err := op()
+		if err == nil || !r.Wait(ctx, attempts, err) {
+			return attempts, err
+		}
+	}
+}
+
+// Retrier waits between the attempts of a single operation.
+type Retrier struct {
+	policy Policy
+	clock  Clock
+	next   func() time.Duration
+}
+
+// NewRetrier creates a Retrier that starts with the initial backoff.
+func (p Policy) NewRetrier(clock Clock) *Retrier {
+	return &Retrier{policy: p, clock: clock, next: p.backoffs()}
+}
+
+// Wait waits for the backoff after the given attempt failed with err. It
+// reports whether the operation should be retried, which does not happen if
+// the error is not retryable, the attempts are exhausted or the context is
+// done while waiting.
+func (r *Retrier) Wait(ctx context.Context, attempt int, err error) bool {
+	if !r.policy.Retryable(err) || ctx.Err() != nil {
+		return false
+	}
+	if r.policy.MaxAttempts > 0 && attempt >= r.policy.MaxAttempts {
+		return false
+	}
+	select {
+	case <-r.clock.After(r.next()):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// backoffs returns a function that computes the successive backoffs.
+func (p Policy) backoffs() func() time.Duration {
+	b := p.Backoff
+	switch p.Jitter {
+	case JitterFull:
+		return func() time.Duration {
+			// The jitter of the backoff may move it out of the limits.
+			next := b.Next()
+			if next < 0 {
+				next = 0
+			}
+			if next > b.limit() {
+				next = b.limit()
+			}
+			return time.Duration(rand.Int63n(int64(next) + 1))
+		}
+	case JitterDecorrelated:
+		initial := b.Initial()
+		if initial > b.limit() {
+			initial = b.limit()
+		}
+		prev := initial
+		return func() time.Duration {
+			next := initial + time.Duration(rand.Int63n(int64(3*prev-initial)+1))
+			if next > b.limit() {
+				next = b.limit()
+			}
+			prev = next
+			return next
+		}
+	default:
+		return b.Next
+	}
+}
+
+// Code returns the grpc status code of the error, or codes.Unknown if the
+// error does not have a status.
+func Code(err error) codes.Code {
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		return grpcErr.GRPCStatus().Code()
+	}
+	return codes.Unknown
+}
+
+// ParseCode parses the name of a grpc status code, such as "UNAVAILABLE" or
+// "deadline_exceeded".
+func ParseCode(name string) (codes.Code, error) {
+	var c codes.Code
+	quoted := fmt.Sprintf("%q", strings.ToUpper(name))
+	if err := c.UnmarshalJSON([]byte(quoted)); err != nil {
+		return c, fmt.Errorf("parse code: %w", err)
+	}
+	return c, nil
+}
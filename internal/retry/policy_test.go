@@ -0,0 +1,208 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPolicy_Do(t *testing.T) {
+	unavailable := fmt.Errorf("call: %w", status.Error(codes.Unavailable, "down"))
+	notFound := status.Error(codes.NotFound, "not found")
+	tests := map[string]struct {
+		policy           Policy
+		errs             []error
+		expectedAttempts int
+		expectedErr      error
+		expectedWaits    []time.Duration
+	}{
+		"success": {
+			policy:           Policy{MaxAttempts: 3, Codes: []codes.Code{codes.Unavailable}},
+			errs:             []error{nil},
+			expectedAttempts: 1,
+		},
+		"retry until success": {
+			policy: Policy{
+				MaxAttempts: 3,
+				Backoff:     *NewExponentialBackoff(10*time.Millisecond, 2),
+				Codes:       []codes.Code{codes.Unavailable},
+			},
+			errs:             []error{unavailable, unavailable, nil},
+			expectedAttempts: 3,
+			expectedWaits:    []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+		},
+		"max attempts": {
+			policy: Policy{
+				MaxAttempts: 2,
+				Backoff:     *NewExponentialBackoff(10*time.Millisecond, 2),
+				Codes:       []codes.Code{codes.Unavailable},
+			},
+			errs:             []error{unavailable, unavailable, nil},
+			expectedAttempts: 2,
+			expectedErr:      unavailable,
+			expectedWaits:    []time.Duration{10 * time.Millisecond},
+		},
+		"not retryable": {
+			policy:           Policy{MaxAttempts: 3, Codes: []codes.Code{codes.Unavailable}},
+			errs:             []error{notFound, nil},
+			expectedAttempts: 1,
+			expectedErr:      notFound,
+		},
+		"max backoff": {
+			policy: Policy{
+				MaxAttempts: 4,
+				Backoff:     NewExponentialBackoff(10*time.Millisecond, 2).WithMax(15 * time.Millisecond),
+				Codes:       []codes.Code{codes.Unavailable, codes.NotFound},
+			},
+			errs:             []error{unavailable, notFound, unavailable, nil},
+			expectedAttempts: 4,
+			expectedWaits: []time.Duration{
+				10 * time.Millisecond, 15 * time.Millisecond, 15 * time.Millisecond,
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			clock := &testClock{}
+			calls := 0
+			attempts, err := tc.policy.Do(context.Background(), clock, func() error {
+				calls++
+				return tc.errs[calls-1]
+			})
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectedErr, err)
+			}
+			if diff := cmp.Diff(tc.expectedAttempts, attempts); diff != "" {
+				t.Fatalf("attempts mismatch:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedAttempts, calls); diff != "" {
+				t.Fatalf("calls mismatch:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedWaits, clock.waits); diff != "" {
+				t.Fatalf("waits mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPolicy_DoCanceled(t *testing.T) {
+	policy := Policy{Codes: []codes.Code{codes.Unavailable}}
+	ctx, cancel := context.WithCancel(context.Background())
+	unavailable := status.Error(codes.Unavailable, "down")
+	attempts, err := policy.Do(ctx, &testClock{}, func() error {
+		cancel()
+		return unavailable
+	})
+	if !errors.Is(err, unavailable) {
+		t.Fatalf("expected error %v, got %v", unavailable, err)
+	}
+	if diff := cmp.Diff(1, attempts); diff != "" {
+		t.Fatalf("attempts mismatch:\n%s", diff)
+	}
+}
+
+func TestPolicy_Jitter(t *testing.T) {
+	backoff := NewExponentialBackoff(100*time.Millisecond, 2).WithMax(time.Second)
+	tests := map[string]struct {
+		jitter Jitter
+		// bounds returns the bounds of backoff i given the previous one.
+		bounds func(i int, prev time.Duration) (time.Duration, time.Duration)
+	}{
+		"full": {
+			jitter: JitterFull,
+			bounds: func(i int, _ time.Duration) (time.Duration, time.Duration) {
+				max := 100 * time.Millisecond << i
+				if max > time.Second {
+					max = time.Second
+				}
+				return 0, max
+			},
+		},
+		"decorrelated": {
+			jitter: JitterDecorrelated,
+			bounds: func(_ int, prev time.Duration) (time.Duration, time.Duration) {
+				max := 3 * prev
+				if max > time.Second {
+					max = time.Second
+				}
+				return 100 * time.Millisecond, max
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			next := Policy{Backoff: backoff, Jitter: tc.jitter}.backoffs()
+			prev := 100 * time.Millisecond
+			for i := 0; i < 10; i++ {
+				actual := next()
+				low, high := tc.bounds(i, prev)
+				if actual < low || actual > high {
+					t.Fatalf("backoff %d: expected between %s and %s, got %s", i, low, high, actual)
+				}
+				prev = actual
+			}
+		})
+	}
+}
+
+func TestPolicy_JitterUnbounded(t *testing.T) {
+	for _, jitter := range []Jitter{JitterNone, JitterFull, JitterDecorrelated} {
+		t.Run(string(jitter), func(t *testing.T) {
+			backoff := NewExponentialBackoff(time.Hour, 10).WithJitter(0.5)
+			next := Policy{Backoff: backoff, Jitter: jitter}.backoffs()
+			for i := 0; i < 100; i++ {
+				if actual := next(); actual < 0 {
+					t.Fatalf("backoff %d: expected non negative, got %s", i, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCode(t *testing.T) {
+	for name, expected := range map[string]codes.Code{
+		"UNAVAILABLE":       codes.Unavailable,
+		"deadline_exceeded": codes.DeadlineExceeded,
+	} {
+		actual, err := ParseCode(name)
+		if err != nil {
+			t.Fatalf("parse %s: %s", name, err)
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Fatalf("code %s mismatch:\n%s", name, diff)
+		}
+	}
+	if _, err := ParseCode("unknown_code"); err == nil {
+		t.Fatalf("expected error for unknown code")
+	}
+}
+
+// testClock records the waits and returns immediately.
+type testClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
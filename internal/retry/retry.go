@@ -1,6 +1,8 @@
 package retry
 
 import (
+	"math"
+	"math/rand"
 	"time"
 )
 
@@ -23,11 +25,20 @@ func WhileTrue(f Retryable, strat BackoffStrategy) {
 const (
 	defaultInitBackoff = 1 * time.Millisecond
 	defaultFact        = 2
+	// maxBackoff bounds the backoffs without a maximum, so that they do not
+	// overflow when multiplied or randomized.
+	maxBackoff = time.Duration(math.MaxInt64 / 4)
 )
 
+// ExponentialBackoff multiplies the backoff by a factor after each retry.
+// If max is set, the backoff never exceeds it. If jitter is set, each
+// backoff is randomly increased or decreased by up to that fraction of its
+// value, so that multiple clients do not retry at the same time.
 type ExponentialBackoff struct {
-	curr time.Duration
-	fact int
+	curr   time.Duration
+	fact   int
+	max    time.Duration
+	jitter float64
 }
 
 func NewExponentialBackoff(initBackoff time.Duration, fact int) *ExponentialBackoff {
@@ -37,14 +48,66 @@ func NewExponentialBackoff(initBackoff time.Duration, fact int) *ExponentialBack
 	}
 }
 
-func (b *ExponentialBackoff) Next() time.Duration {
+// WithMax returns a copy of the backoff that never exceeds max.
+func (b ExponentialBackoff) WithMax(max time.Duration) ExponentialBackoff {
+	b.max = max
+	return b
+}
+
+// WithJitter returns a copy of the backoff where each value is randomly
+// changed by up to the jitter fraction.
+func (b ExponentialBackoff) WithJitter(jitter float64) ExponentialBackoff {
+	b.jitter = jitter
+	return b
+}
+
+// Initial returns the next backoff, without jitter.
+func (b ExponentialBackoff) Initial() time.Duration {
 	if b.curr == 0 {
-		b.curr = defaultInitBackoff
+		return defaultInitBackoff
 	}
+	return b.curr
+}
+
+// Factor returns the factor that multiplies the backoff after each retry.
+func (b ExponentialBackoff) Factor() int {
 	if b.fact == 0 {
-		b.fact = defaultFact
+		return defaultFact
+	}
+	return b.fact
+}
+
+// Max returns the maximum backoff, or 0 if unbounded.
+func (b ExponentialBackoff) Max() time.Duration { return b.max }
+
+// Jitter returns the fraction by which each backoff is randomly changed.
+func (b ExponentialBackoff) Jitter() float64 { return b.jitter }
+
+// limit returns the maximum backoff, or maxBackoff if unbounded.
+func (b ExponentialBackoff) limit() time.Duration {
+	if b.max == 0 || b.max > maxBackoff {
+		return maxBackoff
 	}
+	return b.max
+}
+
+func (b *ExponentialBackoff) Next() time.Duration {
+	b.curr = b.Initial()
+	b.fact = b.Factor()
+	limit := b.limit()
 	backoff := b.curr
-	b.curr = b.curr * time.Duration(b.fact)
+	if backoff > limit {
+		backoff = limit
+	}
+	// Stop growing once the limit is reached to avoid overflows.
+	if b.curr > limit/time.Duration(b.fact) {
+		b.curr = limit
+	} else {
+		b.curr = b.curr * time.Duration(b.fact)
+	}
+	if b.jitter > 0 {
+		delta := (rand.Float64()*2 - 1) * b.jitter * float64(backoff)
+		backoff += time.Duration(delta)
+	}
 	return backoff
 }
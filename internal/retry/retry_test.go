@@ -23,6 +23,17 @@ func TestExponentialBackoff_Next(t *testing.T) {
 			strat:    NewExponentialBackoff(2, 3),
 			expected: []time.Duration{2, 2 * 3, 2 * 3 * 3},
 		},
+		"max": {
+			strat: func() *ExponentialBackoff {
+				b := NewExponentialBackoff(2, 3).WithMax(10)
+				return &b
+			}(),
+			expected: []time.Duration{2, 2 * 3, 10, 10},
+		},
+		"unbounded": {
+			strat:    NewExponentialBackoff(maxBackoff/2, 3),
+			expected: []time.Duration{maxBackoff / 2, maxBackoff, maxBackoff},
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -36,3 +47,15 @@ func TestExponentialBackoff_Next(t *testing.T) {
 		})
 	}
 }
+
+func TestExponentialBackoff_NextJitter(t *testing.T) {
+	b := NewExponentialBackoff(100*time.Millisecond, 2).WithJitter(0.5)
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}
+	for i, exp := range expected {
+		actual := b.Next()
+		low, high := exp/2, exp+exp/2
+		if actual < low || actual > high {
+			t.Fatalf("backoff %d: expected between %s and %s, got %s", i, low, high, actual)
+		}
+	}
+}
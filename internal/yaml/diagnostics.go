@@ -0,0 +1,184 @@
+package yaml
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Position identifies where a resource, or an error, is in the
+// configuration files. The lines refer to the source files, and the columns
+// to the lines after the templates are expanded.
+type Position struct {
+	File string
+	// Document is the index of the resource in the file, starting at 1. For
+	// yaml files, this is the index of the yaml document and for json files
+	// the index in the array of resources. It is 0 if unknown.
+	Document int
+	// Line and Column start at 1 and are 0 if unknown.
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	var b strings.Builder
+	b.WriteString(p.File)
+	if p.Line > 0 {
+		fmt.Fprintf(&b, ":%d", p.Line)
+		if p.Column > 0 {
+			fmt.Fprintf(&b, ":%d", p.Column)
+		}
+	}
+	if p.Document > 0 {
+		fmt.Fprintf(&b, " (document %d)", p.Document)
+	}
+	return b.String()
+}
+
+// Diagnostic is an error found at a given position of the configuration
+// files.
+type Diagnostic struct {
+	Pos Position
+	Err error
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Err)
+}
+
+func (d *Diagnostic) Unwrap() error { return d.Err }
+
+// Diagnostics lists all the errors found in the configuration files, sorted
+// by their position.
+type Diagnostics []*Diagnostic
+
+func (ds Diagnostics) Error() string {
+	if len(ds) == 1 {
+		return ds[0].Error()
+	}
+	msgs := make([]string, 0, len(ds))
+	for _, d := range ds {
+		msgs = append(msgs, d.Error())
+	}
+	return fmt.Sprintf("%d errors:\n  %s", len(ds), strings.Join(msgs, "\n  "))
+}
+
+// Is reports whether any of the diagnostics matches target.
+func (ds Diagnostics) Is(target error) bool {
+	for _, d := range ds {
+		if errors.Is(d, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first diagnostic that matches target.
+func (ds Diagnostics) As(target interface{}) bool {
+	for _, d := range ds {
+		if errors.As(d, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortDiagnostics orders the diagnostics by the order of the files and then
+// by their position in each file.
+func sortDiagnostics(ds Diagnostics, files []string) {
+	order := make(map[string]int, len(files))
+	for i, f := range files {
+		if _, ok := order[f]; !ok {
+			order[f] = i
+		}
+	}
+	sort.SliceStable(ds, func(i, j int) bool {
+		a, b := ds[i].Pos, ds[j].Pos
+		if order[a.File] != order[b.File] {
+			return order[a.File] < order[b.File]
+		}
+		if a.Document != b.Document {
+			return a.Document < b.Document
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// ResourceID identifies a resource in the read pipelines.
+type ResourceID struct {
+	Kind     string
+	Pipeline string
+	Name     string
+}
+
+// Positions maps the resources read from the configuration files to the
+// positions where they are specified.
+type Positions map[ResourceID]Position
+
+// Pipeline returns the position of the pipeline with the given name.
+func (p Positions) Pipeline(name string) (Position, bool) {
+	pos, ok := p[ResourceID{Kind: pipelineKind, Name: name}]
+	return pos, ok
+}
+
+// Stage returns the position of a stage in the given pipeline.
+func (p Positions) Stage(pipeline, name string) (Position, bool) {
+	pos, ok := p[ResourceID{Kind: stageKind, Pipeline: pipeline, Name: name}]
+	return pos, ok
+}
+
+// Link returns the position of a link in the given pipeline.
+func (p Positions) Link(pipeline, name string) (Position, bool) {
+	pos, ok := p[ResourceID{Kind: linkKind, Pipeline: pipeline, Name: name}]
+	return pos, ok
+}
+
+var lineRegExp = regexp.MustCompile(`line (?P<line>\d+): `)
+
+// errorLine returns the first line reported in a yaml error message, or 0 if
+// the message has no line.
+func errorLine(err error) int {
+	match := lineRegExp.FindStringSubmatch(err.Error())
+	if len(match) == 0 {
+		return 0
+	}
+	line, _ := strconv.Atoi(match[lineRegExp.SubexpIndex("line")])
+	return line
+}
+
+// invalidDocument is an error reported by the yaml or json decoders, without
+// the positions of the original message, as those are set in the diagnostic.
+type invalidDocument struct {
+	Msg string
+}
+
+func (err *invalidDocument) Error() string {
+	return err.Msg
+}
+
+func newInvalidDocument(err error) *invalidDocument {
+	return &invalidDocument{Msg: lineRegExp.ReplaceAllString(err.Error(), "")}
+}
+
+// offsetToLineCol converts a byte offset in data to a line and column.
+func offsetToLineCol(data []byte, offset int) (int, int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line, col := 1, 1
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
@@ -0,0 +1,128 @@
+package yaml
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadV1WithPositions_Diagnostics(t *testing.T) {
+	tests := map[string]struct {
+		file     string
+		expected []Position
+	}{
+		"yaml": {
+			file: "../../test/data/unit/read/v1/err_multiple.yml",
+			expected: []Position{
+				{Document: 2, Line: 8, Column: 3},
+				{Document: 3, Line: 11, Column: 1},
+				{Document: 4, Line: 15, Column: 1},
+			},
+		},
+		"json": {
+			file: "../../test/data/unit/read/v1/err_multiple.json",
+			expected: []Position{
+				{Document: 2, Line: 7, Column: 7},
+				{Document: 3, Line: 11, Column: 3},
+				{Document: 4, Line: 12, Column: 3},
+			},
+		},
+	}
+	expErrs := []string{
+		"unknown fields 'unknown'",
+		"unknown kind 'unknown'",
+		"link link-1: pipeline 'pipeline-2' not found",
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			pipelines, positions, err := ReadV1WithPositions(nil, tc.file)
+			if pipelines != nil || positions != nil {
+				t.Fatalf("pipelines or positions not nil")
+			}
+			var diags Diagnostics
+			if !errors.As(err, &diags) {
+				t.Fatalf("Wrong error type: expected Diagnostics, got %T", err)
+			}
+			var (
+				actual     []Position
+				actualErrs []string
+			)
+			for _, d := range diags {
+				if d.Pos.File != tc.file {
+					t.Fatalf("wrong file: expected %s, got %s", tc.file, d.Pos.File)
+				}
+				d.Pos.File = ""
+				actual = append(actual, d.Pos)
+				actualErrs = append(actualErrs, d.Err.Error())
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Fatalf("positions mismatch:\n%s", diff)
+			}
+			if diff := cmp.Diff(expErrs, actualErrs); diff != "" {
+				t.Fatalf("errors mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadV1WithPositions(t *testing.T) {
+	file := "../../test/data/unit/read/v1/read_single_file.yml"
+	_, positions, err := ReadV1WithPositions(nil, file)
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+	tests := map[string]struct {
+		lookup   func() (Position, bool)
+		expected Position
+	}{
+		"pipeline": {
+			lookup:   func() (Position, bool) { return positions.Pipeline("pipeline-1") },
+			expected: Position{File: file, Document: 7, Line: 45, Column: 1},
+		},
+		"stage": {
+			lookup:   func() (Position, bool) { return positions.Stage("pipeline-1", "stage-2") },
+			expected: Position{File: file, Document: 3, Line: 17, Column: 1},
+		},
+		"link": {
+			lookup: func() (Position, bool) {
+				return positions.Link("pipeline-1", "link-stage-2-stage-1")
+			},
+			expected: Position{File: file, Document: 2, Line: 9, Column: 1},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, ok := tc.lookup()
+			if !ok {
+				t.Fatalf("position not found")
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Fatalf("position mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadV1WithPositions_DiagnosticsNestedKeys(t *testing.T) {
+	// The documents define nested keys with the same names as the keys
+	// that cause the errors.
+	file := "../../test/data/unit/read/v1/err_nested_keys.yml"
+	_, _, err := ReadV1WithPositions(nil, file)
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("Wrong error type: expected Diagnostics, got %T", err)
+	}
+	expected := []Position{
+		{File: file, Document: 1, Line: 7, Column: 5},
+		{File: file, Document: 2, Line: 12, Column: 1},
+		{File: file, Document: 3, Line: 19, Column: 7},
+	}
+	var actual []Position
+	for _, d := range diags {
+		actual = append(actual, d.Pos)
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("positions mismatch:\n%s", diff)
+	}
+}
@@ -0,0 +1,163 @@
+package yaml
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+)
+
+var docSeparatorRegExp = regexp.MustCompile(`^---(\s|$)`)
+
+// yamlDocument is a single document in a yaml file, with the information
+// required to convert the positions in the document to the file.
+type yamlDocument struct {
+	// index of the document in the file, starting at 1.
+	index int
+	// first is the line in the file where the document starts.
+	first int
+	lines [][]byte
+	// line and column of the first content in the document.
+	line   int
+	column int
+}
+
+func (d *yamlDocument) data() []byte {
+	return bytes.Join(d.lines, nil)
+}
+
+// keyPosition returns the line and column, in the file, of the key at the
+// given path of nested mappings, or the start of the document if the path
+// is not defined. Sequence items do not add an element to the path.
+func (d *yamlDocument) keyPosition(path ...string) (int, int) {
+	type entry struct {
+		key    string
+		column int
+	}
+	var (
+		parents []entry
+		// block is the column of the key with a block scalar value, whose
+		// more indented lines are not keys.
+		block int
+	)
+	for i, l := range d.lines {
+		key, column, ok := lineKey(l)
+		if !ok || (block > 0 && column > block) {
+			continue
+		}
+		block = 0
+		for len(parents) > 0 && parents[len(parents)-1].column >= column {
+			parents = parents[:len(parents)-1]
+		}
+		parents = append(parents, entry{key: key, column: column})
+		if len(parents) == len(path) {
+			matches := true
+			for j, p := range parents {
+				matches = matches && p.key == path[j]
+			}
+			if matches {
+				return d.first + i, column
+			}
+		}
+		value := bytes.TrimSpace(l[column-1+len(key)+1:])
+		if len(value) > 0 && (value[0] == '|' || value[0] == '>') {
+			block = column
+		}
+	}
+	return d.line, d.column
+}
+
+// linePosition returns the line and column, in the file, of the given
+// document line, pointing to the key it defines if there is one.
+func (d *yamlDocument) linePosition(line int) (int, int) {
+	l := bytes.TrimRight(d.lines[line-1], "\n")
+	column := len(l) - len(bytes.TrimLeft(l, " \t")) + 1
+	if _, keyColumn, ok := lineKey(l); ok {
+		column = keyColumn
+	}
+	return d.first + line - 1, column
+}
+
+var lineKeyRegExp = regexp.MustCompile(`^((?:[ \t]*-[ \t]+)*[ \t]*)([^\s#:'"\-][^:]*?)[ \t]*:(?:\s|$)`)
+
+// lineKey returns the mapping key defined in a line and its column, skipping
+// the indentation and the sequence item indicators before it.
+func lineKey(l []byte) (string, int, bool) {
+	match := lineKeyRegExp.FindSubmatch(l)
+	if match == nil {
+		return "", 0, false
+	}
+	return string(match[2]), len(match[1]) + 1, true
+}
+
+// diagnostic creates the diagnostic for an error decoding the document,
+// pointing to the field that caused the error when it is known.
+func (d *yamlDocument) diagnostic(pos Position, err error) *Diagnostic {
+	var (
+		kindErr   *unknownKind
+		fieldErr  *missingRequiredField
+		exclErr   *exclusiveFields
+		typeErr   *yaml.TypeError
+		unkFields *unknownFields
+	)
+	switch {
+	case errors.Is(err, ErrMissingKind), errors.As(err, &kindErr):
+		pos.Line, pos.Column = d.keyPosition("kind")
+		return &Diagnostic{Pos: pos, Err: err}
+	case errors.Is(err, ErrEmptySpec), errors.As(err, &fieldErr), errors.As(err, &exclErr):
+		pos.Line, pos.Column = d.keyPosition("spec")
+		return &Diagnostic{Pos: pos, Err: err}
+	case errors.As(err, &typeErr):
+		converted := typeErrorToError(typeErr)
+		if errors.As(converted, &unkFields) {
+			if line := unknownFieldLine(typeErr, unkFields.Fields[0]); line > 0 && line <= len(d.lines) {
+				pos.Line, pos.Column = d.linePosition(line)
+			}
+			return &Diagnostic{Pos: pos, Err: converted}
+		}
+	}
+	// The lines in the yaml errors are relative to the document.
+	if line := errorLine(err); line > 0 && line <= len(d.lines) {
+		pos.Line, pos.Column = d.linePosition(line)
+	}
+	return &Diagnostic{Pos: pos, Err: newInvalidDocument(err)}
+}
+
+// splitYAMLDocuments splits yaml data into its documents, delimited by
+// "---". Documents without content are not returned, but still count for
+// the indexes of the following ones, except if they are before the first
+// separator.
+func splitYAMLDocuments(data []byte) []*yamlDocument {
+	chunks := []*yamlDocument{{first: 1}}
+	for i, l := range bytes.SplitAfter(data, []byte("\n")) {
+		lineNum := i + 1
+		if docSeparatorRegExp.Match(l) {
+			chunks = append(chunks, &yamlDocument{first: lineNum})
+		}
+		curr := chunks[len(chunks)-1]
+		curr.lines = append(curr.lines, l)
+		if curr.line > 0 || docSeparatorRegExp.Match(l) {
+			continue
+		}
+		trimmed := bytes.TrimLeft(l, " \t")
+		content := bytes.TrimSpace(trimmed)
+		if len(content) > 0 && content[0] != '#' && string(content) != "..." {
+			curr.line = lineNum
+			curr.column = len(l) - len(trimmed) + 1
+		}
+	}
+	var docs []*yamlDocument
+	index := 0
+	for i, c := range chunks {
+		if i == 0 && c.line == 0 {
+			continue
+		}
+		index++
+		c.index = index
+		if c.line > 0 {
+			docs = append(docs, c)
+		}
+	}
+	return docs
+}
@@ -5,6 +5,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -16,6 +17,14 @@ func (err *missingRequiredField) Error() string {
 	return fmt.Sprintf("missing required field '%s'", err.Field)
 }
 
+type exclusiveFields struct {
+	A, B string
+}
+
+func (err *exclusiveFields) Error() string {
+	return fmt.Sprintf("fields '%s' and '%s' are exclusive", err.A, err.B)
+}
+
 type unknownFields struct {
 	Fields []string
 }
@@ -24,11 +33,12 @@ func (err *unknownFields) Error() string {
 	return fmt.Sprintf("unknown fields '%s'", strings.Join(err.Fields, ","))
 }
 
+var unkRegex = regexp.MustCompile(
+	`line (?P<line>\d+): field (?P<field>[\w\W_]+) not found in type [\w\W_.]+`,
+)
+
 func typeErrorToError(typeErr *yaml.TypeError) error {
 	var unkFields []string
-	unkRegex := regexp.MustCompile(
-		`line \d+: field (?P<field>[\w\W_]+) not found in type [\w\W_.]+`,
-	)
 	for _, errMsg := range typeErr.Errors {
 		match := unkRegex.FindStringSubmatch(errMsg)
 		if len(match) > 0 {
@@ -41,3 +51,26 @@ func typeErrorToError(typeErr *yaml.TypeError) error {
 	}
 	return typeErr
 }
+
+// unknownFieldLine returns the line where the yaml error reports the given
+// unknown field, or 0 if it is not reported.
+func unknownFieldLine(typeErr *yaml.TypeError, field string) int {
+	for _, errMsg := range typeErr.Errors {
+		match := unkRegex.FindStringSubmatch(errMsg)
+		if len(match) > 0 && match[unkRegex.SubexpIndex("field")] == field {
+			line, _ := strconv.Atoi(match[unkRegex.SubexpIndex("line")])
+			return line
+		}
+	}
+	return 0
+}
+
+var jsonUnkRegex = regexp.MustCompile(`json: unknown field "(?P<field>[^"]+)"`)
+
+func jsonErrorToError(err error) error {
+	match := jsonUnkRegex.FindStringSubmatch(err.Error())
+	if len(match) > 0 {
+		return &unknownFields{Fields: []string{match[jsonUnkRegex.SubexpIndex("field")]}}
+	}
+	return err
+}
@@ -0,0 +1,323 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Values specifies the variables available to the templates in
+// configuration files. Nested values are accessed with the dot notation,
+// such as {{ .stage.address }}.
+type Values map[string]interface{}
+
+type undefinedVariable struct {
+	Name string
+}
+
+func (err *undefinedVariable) Error() string {
+	return fmt.Sprintf("undefined variable '%s'", err.Name)
+}
+
+type undefinedEnvVariable struct {
+	Name string
+}
+
+func (err *undefinedEnvVariable) Error() string {
+	return fmt.Sprintf("undefined environment variable '%s'", err.Name)
+}
+
+type invalidSetValue struct {
+	Value string
+}
+
+func (err *invalidSetValue) Error() string {
+	return fmt.Sprintf("invalid set value '%s': expected key=value", err.Value)
+}
+
+var (
+	envRegExp = regexp.MustCompile(
+		`\$\$\{|\$\{(?P<name>[A-Za-z_][A-Za-z0-9_]*)(?P<hasDefault>:-(?P<default>[^}]*))?\}`,
+	)
+	missingKeyRegExp = regexp.MustCompile(`map has no entry for key "(?P<key>[^"]*)"`)
+)
+
+// ReadValues reads the values defined in yaml files. If multiple files
+// define the same value, the one in the last file is kept.
+func ReadValues(files ...string) (Values, error) {
+	values := Values{}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read values: %w", err)
+		}
+		var fileValues map[string]interface{}
+		if err := yaml.Unmarshal(data, &fileValues); err != nil {
+			return nil, fmt.Errorf("read values %s: %w", f, err)
+		}
+		values = values.Merge(normalizeValues(fileValues))
+	}
+	return values, nil
+}
+
+// ParseSetValues parses values in the key=value format. Keys with dots
+// define nested values, such that a.b=c is accessed with {{ .a.b }}.
+func ParseSetValues(sets ...string) (Values, error) {
+	values := Values{}
+	for _, s := range sets {
+		key, val, ok := strings.Cut(s, "=")
+		if !ok || key == "" {
+			return nil, &invalidSetValue{Value: s}
+		}
+		parts := strings.Split(key, ".")
+		curr := values
+		for _, p := range parts[:len(parts)-1] {
+			next, ok := curr[p].(Values)
+			if !ok {
+				next = Values{}
+				curr[p] = next
+			}
+			curr = next
+		}
+		curr[parts[len(parts)-1]] = val
+	}
+	return values, nil
+}
+
+// Merge returns new values with the contents of v and other. Nested values
+// are merged recursively, and other takes precedence over v.
+func (v Values) Merge(other Values) Values {
+	merged := make(Values, len(v)+len(other))
+	for k, val := range v {
+		merged[k] = val
+	}
+	for k, val := range other {
+		prev, prevOk := merged[k].(Values)
+		next, nextOk := val.(Values)
+		if prevOk && nextOk {
+			merged[k] = prev.Merge(next)
+		} else {
+			merged[k] = val
+		}
+	}
+	return merged
+}
+
+// normalizeValues converts the maps decoded by yaml to Values so that they
+// can be merged.
+func normalizeValues(m map[string]interface{}) Values {
+	values := make(Values, len(m))
+	for k, v := range m {
+		values[k] = normalizeValue(v)
+	}
+	return values
+}
+
+func normalizeValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		values := make(Values, len(x))
+		for k, v := range x {
+			values[fmt.Sprint(k)] = normalizeValue(v)
+		}
+		return values
+	case map[string]interface{}:
+		return normalizeValues(x)
+	case []interface{}:
+		for i, e := range x {
+			x[i] = normalizeValue(e)
+		}
+		return x
+	default:
+		return v
+	}
+}
+
+// lineMarker delimits the line numbers appended to the lines of the
+// templates, which map the lines of the expanded files to the lines of the
+// source files.
+const lineMarker = '\x1e'
+
+// expandTemplate replaces the environment variables in the configuration
+// file data, in the ${VAR} and ${VAR:-default} formats, where the default
+// is used if VAR is unset or empty, and then executes the result as a
+// text/template with the given values. A literal "${" is written as "$${",
+// and the variables in comments are not replaced. The values of the
+// variables are not expanded as templates.
+//
+// It also returns, for each line of the expanded data, the line of data it
+// was generated from.
+func expandTemplate(name string, data []byte, values Values) ([]byte, []int, error) {
+	marked, err := expandEnv(markLines(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(marked))
+	if err != nil {
+		return nil, nil, err
+	}
+	if values == nil {
+		values = Values{}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		if match := missingKeyRegExp.FindStringSubmatch(err.Error()); len(match) > 0 {
+			return nil, nil, &undefinedVariable{Name: match[missingKeyRegExp.SubexpIndex("key")]}
+		}
+		return nil, nil, err
+	}
+	expanded, lines := unmarkLines(buf.Bytes())
+	return expanded, lines, nil
+}
+
+// markLines appends its number to each line of data. Lines that end inside
+// a template action are not marked, so that the action is not changed.
+func markLines(data []byte) []byte {
+	var (
+		marked   bytes.Buffer
+		inAction bool
+	)
+	for i, l := range bytes.SplitAfter(data, []byte("\n")) {
+		body := bytes.TrimSuffix(l, []byte("\n"))
+		inAction = endsInAction(body, inAction)
+		marked.Write(body)
+		if !inAction && len(body) > 0 {
+			fmt.Fprintf(&marked, "%c%d%c", lineMarker, i+1, lineMarker)
+		}
+		marked.Write(l[len(body):])
+	}
+	return marked.Bytes()
+}
+
+// endsInAction reports whether a template action is open at the end of the
+// line, given whether one was open at its start.
+func endsInAction(line []byte, open bool) bool {
+	for {
+		delim := []byte("{{")
+		if open {
+			delim = []byte("}}")
+		}
+		i := bytes.Index(line, delim)
+		if i < 0 {
+			return open
+		}
+		line = line[i+len(delim):]
+		open = !open
+	}
+}
+
+// unmarkLines removes the line numbers added by markLines and returns, for
+// each line, the first number found in it. Lines without numbers were
+// generated by actions, and take the number of the next line with one,
+// where the action ends.
+func unmarkLines(data []byte) ([]byte, []int) {
+	var (
+		unmarked bytes.Buffer
+		lines    []int
+	)
+	for _, l := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(l) == 0 {
+			continue
+		}
+		num := 0
+		for {
+			start := bytes.IndexByte(l, lineMarker)
+			if start < 0 {
+				break
+			}
+			end := bytes.IndexByte(l[start+1:], lineMarker)
+			if end < 0 {
+				break
+			}
+			end += start + 1
+			if num == 0 {
+				num, _ = strconv.Atoi(string(l[start+1 : end]))
+			}
+			l = append(l[:start:start], l[end+1:]...)
+		}
+		unmarked.Write(l)
+		lines = append(lines, num)
+	}
+	next := 0
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i] == 0 {
+			lines[i] = next
+		}
+		next = lines[i]
+	}
+	return unmarked.Bytes(), lines
+}
+
+// expandEnv replaces the environment variables outside the comments of
+// each line. Values with template delimiters are escaped, so that they are
+// not executed as templates.
+func expandEnv(data []byte) ([]byte, error) {
+	var (
+		expanded bytes.Buffer
+		err      error
+	)
+	replace := func(m []byte) []byte {
+		if string(m) == "$${" {
+			return []byte("${")
+		}
+		match := envRegExp.FindSubmatch(m)
+		name := string(match[envRegExp.SubexpIndex("name")])
+		hasDefault := len(match[envRegExp.SubexpIndex("hasDefault")]) > 0
+		// As in the shell, the default is also used for empty variables.
+		if val, ok := os.LookupEnv(name); ok && (val != "" || !hasDefault) {
+			return escapeTemplate([]byte(val))
+		}
+		if hasDefault {
+			return escapeTemplate(match[envRegExp.SubexpIndex("default")])
+		}
+		if err == nil {
+			err = &undefinedEnvVariable{Name: name}
+		}
+		return m
+	}
+	for _, l := range bytes.SplitAfter(data, []byte("\n")) {
+		i := commentStart(l)
+		expanded.Write(envRegExp.ReplaceAllFunc(l[:i], replace))
+		expanded.Write(l[i:])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return expanded.Bytes(), nil
+}
+
+// escapeTemplate writes the opening template delimiters in val as string
+// actions.
+func escapeTemplate(val []byte) []byte {
+	return bytes.ReplaceAll(val, []byte("{{"), []byte(`{{"{{"}}`))
+}
+
+// commentStart returns the index where a comment starts in a yaml line, or
+// the length of the line if it has no comment. Comments start with a # at
+// the start of the line or after a space, outside quoted strings.
+func commentStart(line []byte) int {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || bytes.IndexByte([]byte(" \t:[{,-"), line[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return i
+		}
+	}
+	return len(line)
+}
@@ -0,0 +1,199 @@
+package yaml
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadV1WithValues(t *testing.T) {
+	t.Setenv("MAESTRO_TEST_SERVICE", "Service1")
+
+	values, err := ReadValues("../../test/data/unit/read/v1/template_values.yml")
+	if err != nil {
+		t.Fatalf("read values: %s", err)
+	}
+	set, err := ParseSetValues("stage.port=2")
+	if err != nil {
+		t.Fatalf("parse set values: %s", err)
+	}
+	values = values.Merge(set)
+
+	pipelines, err := ReadV1WithValues(values, "../../test/data/unit/read/v1/template.yml")
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+	expected := []*api.Pipeline{
+		{
+			Name: "pipeline-1",
+			Stages: []*api.Stage{
+				{
+					Name:    "stage-1",
+					Address: "host-1:2",
+					Service: "Service1",
+					Method:  "Method1",
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(expected, pipelines); diff != "" {
+		t.Fatalf("read resources mismatch:\n%s", diff)
+	}
+}
+
+func TestReadV1WithValues_SetValuesNotExpanded(t *testing.T) {
+	t.Setenv("MAESTRO_TEST_SERVICE", "Service1")
+
+	values := Values{
+		"pipeline": "pipeline-1",
+		"stage":    Values{"host": "${MAESTRO_TEST_SERVICE}", "port": "{{ .pipeline }}"},
+	}
+	pipelines, err := ReadV1WithValues(values, "../../test/data/unit/read/v1/template.yml")
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+	expected := "${MAESTRO_TEST_SERVICE}:{{ .pipeline }}"
+	if diff := cmp.Diff(expected, pipelines[0].Stages[0].Address); diff != "" {
+		t.Fatalf("address mismatch:\n%s", diff)
+	}
+}
+
+func TestReadV1_NoTemplating(t *testing.T) {
+	pipelines, err := ReadV1("../../test/data/unit/read/v1/literal.yml")
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+	stage := pipelines[0].Stages[0]
+	actual := []string{stage.Address, stage.Service}
+	expected := []string{"localhost:{{port}}", "${SERVICE}"}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("stage mismatch:\n%s", diff)
+	}
+}
+
+func TestReadV1WithValues_SourcePositions(t *testing.T) {
+	file := "../../test/data/unit/read/v1/template_positions.yml"
+	values := Values{"names": []interface{}{"stage-1", "stage-2"}, "field": "other"}
+	_, err := ReadV1WithValues(values, file)
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("expected diagnostics, got %v", err)
+	}
+	// The lines are in the source file, although the range adds lines. The
+	// errors of the generated stages are in the range that creates them.
+	var lines []int
+	for _, d := range diags {
+		lines = append(lines, d.Pos.Line)
+	}
+	if diff := cmp.Diff([]int{11, 11, 18}, lines); diff != "" {
+		t.Fatalf("lines mismatch:\n%s", diff)
+	}
+}
+
+func TestReadV1WithValues_Err(t *testing.T) {
+	tests := map[string]struct {
+		values    Values
+		env       map[string]string
+		verifyErr func(t *testing.T, err error)
+	}{
+		"undefined variable": {
+			values: Values{"pipeline": "pipeline-1", "stage": Values{"host": "host-1"}},
+			env:    map[string]string{"MAESTRO_TEST_SERVICE": "Service1"},
+			verifyErr: func(t *testing.T, err error) {
+				var actual *undefinedVariable
+				if !errors.As(err, &actual) {
+					format := "Wrong error type: expected *undefinedVariable, got %s"
+					t.Fatalf(format, reflect.TypeOf(err))
+				}
+				expected := &undefinedVariable{Name: "port"}
+				if diff := cmp.Diff(expected, actual); diff != "" {
+					t.Fatalf("error mismatch:\n%s", diff)
+				}
+			},
+		},
+		"undefined environment variable": {
+			values: Values{
+				"pipeline": "pipeline-1",
+				"stage":    Values{"host": "host-1", "port": 1},
+			},
+			verifyErr: func(t *testing.T, err error) {
+				var actual *undefinedEnvVariable
+				if !errors.As(err, &actual) {
+					format := "Wrong error type: expected *undefinedEnvVariable, got %s"
+					t.Fatalf(format, reflect.TypeOf(err))
+				}
+				expected := &undefinedEnvVariable{Name: "MAESTRO_TEST_SERVICE"}
+				if diff := cmp.Diff(expected, actual); diff != "" {
+					t.Fatalf("error mismatch:\n%s", diff)
+				}
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			pipelines, err := ReadV1WithValues(tc.values, "../../test/data/unit/read/v1/template.yml")
+			if err == nil {
+				t.Fatalf("expected error but got nil")
+			}
+			if pipelines != nil {
+				t.Fatalf("resources not nil")
+			}
+			tc.verifyErr(t, err)
+		})
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("MAESTRO_TEST_SET", "set")
+	t.Setenv("MAESTRO_TEST_EMPTY", "")
+	t.Setenv("MAESTRO_TEST_BRACES", "{{ .x }}")
+
+	tests := map[string]struct {
+		input    string
+		expected string
+	}{
+		"set variable":       {input: "a: ${MAESTRO_TEST_SET}", expected: "a: set"},
+		"set with default":   {input: "a: ${MAESTRO_TEST_SET:-def}", expected: "a: set"},
+		"unset with default": {input: "a: ${MAESTRO_TEST_UNSET:-def}", expected: "a: def"},
+		"empty with default": {input: "a: ${MAESTRO_TEST_EMPTY:-def}", expected: "a: def"},
+		"empty default":      {input: "a: ${MAESTRO_TEST_UNSET:-}", expected: "a: "},
+		"escaped":            {input: "a: $${MAESTRO_TEST_SET}", expected: "a: ${MAESTRO_TEST_SET}"},
+		"comment":            {input: "a: b # ${MAESTRO_TEST_UNSET}", expected: "a: b # ${MAESTRO_TEST_UNSET}"},
+		"quoted hash":        {input: `a: "#${MAESTRO_TEST_SET}"`, expected: `a: "#set"`},
+		"template value":     {input: "a: ${MAESTRO_TEST_BRACES}", expected: `a: {{"{{"}} .x }}`},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := expandEnv([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("expand error: %s", err)
+			}
+			if diff := cmp.Diff(tc.expected, string(actual)); diff != "" {
+				t.Fatalf("expanded mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseSetValues(t *testing.T) {
+	values, err := ParseSetValues("a=1", "b.c=2", "b.d=x=y")
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	expected := Values{"a": "1", "b": Values{"c": "2", "d": "x=y"}}
+	if diff := cmp.Diff(expected, values); diff != "" {
+		t.Fatalf("values mismatch:\n%s", diff)
+	}
+
+	_, err = ParseSetValues("invalid")
+	var actual *invalidSetValue
+	if !errors.As(err, &actual) {
+		t.Fatalf("Wrong error type: expected *invalidSetValue, got %s", reflect.TypeOf(err))
+	}
+}
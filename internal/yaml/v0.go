@@ -2,7 +2,10 @@ package yaml
 
 import (
 	"fmt"
+	"io/fs"
 	"io/ioutil"
+	"net"
+	"strconv"
 
 	"github.com/DuarteMRAlves/maestro/internal/api"
 	"gopkg.in/yaml.v2"
@@ -61,6 +64,102 @@ func ReadV0(file string) (*api.Pipeline, error) {
 	return pipeline, nil
 }
 
+type unsupportedV0 struct {
+	Feature string
+}
+
+func (err *unsupportedV0) Error() string {
+	return fmt.Sprintf("%s not supported in v0", err.Feature)
+}
+
+// WriteV0 stores the pipeline in a file in the v0 format. The pipeline and
+// link names are not stored, as v0 does not support them, and pipelines with
+// settings that v0 does not support are not written.
+func WriteV0(pipeline *api.Pipeline, file string, perm fs.FileMode) error {
+	spec, err := pipelineToV0FileSpec(pipeline)
+	if err != nil {
+		return fmt.Errorf("write v0: %w", err)
+	}
+	data, err := yaml.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("write v0: %w", err)
+	}
+	if err := ioutil.WriteFile(file, data, perm); err != nil {
+		return fmt.Errorf("write v0: %w", err)
+	}
+	return nil
+}
+
+func pipelineToV0FileSpec(pipeline *api.Pipeline) (v0FileSpec, error) {
+	spec := v0FileSpec{Stages: []v0StageSpec{}, Links: []v0LinkSpec{}}
+	if pipeline.DeadLetter != nil {
+		return spec, &unsupportedV0{Feature: "pipeline dead_letter"}
+	}
+	if len(pipeline.PropagateMetadata) > 0 {
+		return spec, &unsupportedV0{Feature: "pipeline propagate_metadata"}
+	}
+	for _, s := range pipeline.Stages {
+		if s.Timeout != 0 {
+			return spec, &unsupportedV0{Feature: "stage timeout"}
+		}
+		if s.TLS != nil {
+			return spec, &unsupportedV0{Feature: "stage tls"}
+		}
+		if s.OnError != "" && s.OnError != "fail" {
+			return spec, &unsupportedV0{Feature: "stage on_error"}
+		}
+		if s.CircuitBreaker != nil {
+			return spec, &unsupportedV0{Feature: "stage circuit_breaker"}
+		}
+		if s.Retry != nil {
+			return spec, &unsupportedV0{Feature: "stage retry"}
+		}
+		if len(s.Metadata) > 0 {
+			return spec, &unsupportedV0{Feature: "stage metadata"}
+		}
+		if s.Auth != nil {
+			return spec, &unsupportedV0{Feature: "stage auth"}
+		}
+		host, portStr, err := net.SplitHostPort(s.Address)
+		if err != nil {
+			return spec, fmt.Errorf("stage %s: %w", s.Name, err)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return spec, fmt.Errorf("stage %s: port: %w", s.Name, err)
+		}
+		spec.Stages = append(spec.Stages, v0StageSpec{
+			Name:    s.Name,
+			Host:    host,
+			Port:    port,
+			Service: s.Service,
+			Method:  s.Method,
+		})
+	}
+	for _, l := range pipeline.Links {
+		if l.Size != 0 {
+			return spec, &unsupportedV0{Feature: "link size"}
+		}
+		if l.NumEmptyMessages != 0 {
+			return spec, &unsupportedV0{Feature: "link num_empty_messages"}
+		}
+		if l.Strict {
+			return spec, &unsupportedV0{Feature: "link strict"}
+		}
+		if l.Match != "" && l.Match != "by_number" {
+			return spec, &unsupportedV0{Feature: "link match"}
+		}
+		if l.SourceType != "" {
+			return spec, &unsupportedV0{Feature: "link source_type"}
+		}
+		spec.Links = append(spec.Links, v0LinkSpec{
+			Source: v0LinkEndpoint{Stage: l.SourceStage, Field: l.SourceField},
+			Target: v0LinkEndpoint{Stage: l.TargetStage, Field: l.TargetField},
+		})
+	}
+	return spec, nil
+}
+
 func valV0FileSpec(spec v0FileSpec) error {
 	if spec.Stages == nil {
 		return &missingRequiredField{Field: "stages"}
@@ -128,10 +227,10 @@ type v0StageSpec struct {
 	Port int `yaml:"port"`
 	// Service specifies the name of the service to call.
 	// (optional)
-	Service string `yaml:"service"`
+	Service string `yaml:"service,omitempty"`
 	// Method specifies the name of the method to call.
 	// (optional)
-	Method string `yaml:"method"`
+	Method string `yaml:"method,omitempty"`
 }
 
 type v0LinkSpec struct {
@@ -145,5 +244,5 @@ type v0LinkEndpoint struct {
 	Stage string `yaml:"stage"`
 	// Field of the stage message to use. Don't specify for entire message.
 	// (optional)
-	Field string `yaml:"field"`
+	Field string `yaml:"field,omitempty"`
 }
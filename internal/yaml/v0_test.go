@@ -135,3 +135,40 @@ func TestReadV0_Err(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteV0(t *testing.T) {
+	expected, err := ReadV0("../../test/data/unit/read/v0/correct.yml")
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+	outFile := t.TempDir() + "/to_v0.yml"
+	if err := WriteV0(expected, outFile, 0777); err != nil {
+		t.Fatalf("write v0: %s", err)
+	}
+	actual, err := ReadV0(outFile)
+	if err != nil {
+		t.Fatalf("read written file: %s", err)
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("read pipeline mismatch:\n%s", diff)
+	}
+}
+
+func TestWriteV0_Err(t *testing.T) {
+	pipeline := &api.Pipeline{
+		Name:   "pipeline-1",
+		Stages: []*api.Stage{{Name: "stage-1", Address: "host-1:1"}},
+		Links: []*api.Link{
+			{Name: "link-1", SourceStage: "stage-1", TargetStage: "stage-1", Size: 2},
+		},
+	}
+	err := WriteV0(pipeline, t.TempDir()+"/to_v0.yml", 0777)
+	var actual *unsupportedV0
+	if !errors.As(err, &actual) {
+		t.Fatalf("Wrong error type: expected *unsupportedV0, got %s", reflect.TypeOf(err))
+	}
+	expected := &unsupportedV0{Feature: "link size"}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("error mismatch:\n%s", diff)
+	}
+}
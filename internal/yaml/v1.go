@@ -4,9 +4,10 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/DuarteMRAlves/maestro/internal/api"
 	"github.com/DuarteMRAlves/maestro/internal/arrays"
@@ -14,9 +15,10 @@ import (
 )
 
 const (
-	stageKind    = "stage"
-	linkKind     = "link"
-	pipelineKind = "pipeline"
+	stageKind         = "stage"
+	stageTemplateKind = "stage_template"
+	linkKind          = "link"
+	pipelineKind      = "pipeline"
 )
 
 var (
@@ -32,73 +34,230 @@ func (err *unknownKind) Error() string {
 	return fmt.Sprintf("unknown kind '%s'", err.Kind)
 }
 
+type pipelineNotFound struct {
+	Name string
+}
+
+func (err *pipelineNotFound) Error() string {
+	return fmt.Sprintf("pipeline '%s' not found", err.Name)
+}
+
+type duplicateResource struct {
+	Kind string
+	Name string
+}
+
+func (err *duplicateResource) Error() string {
+	return fmt.Sprintf("%s '%s' defined multiple times", err.Kind, err.Name)
+}
+
+type templateNotFound struct {
+	Name string
+}
+
+func (err *templateNotFound) Error() string {
+	return fmt.Sprintf("stage template '%s' not found", err.Name)
+}
+
+type duplicateTemplate struct {
+	Name string
+}
+
+func (err *duplicateTemplate) Error() string {
+	return fmt.Sprintf("stage template '%s' defined multiple times", err.Name)
+}
+
+type cyclicTemplate struct {
+	Name string
+}
+
+func (err *cyclicTemplate) Error() string {
+	return fmt.Sprintf("stage template '%s' extends itself", err.Name)
+}
+
 // ReadV1 reads a set of files in the Maestro V1 format and returns the
 // discovered resources.
 func ReadV1(files ...string) ([]*api.Pipeline, error) {
-	var pipelines []*api.Pipeline
-	for _, f := range files {
-		data, err := ioutil.ReadFile(f)
-		if err != nil {
-			return nil, fmt.Errorf("read v1: %w", err)
-		}
-		reader := bytes.NewReader(data)
+	return ReadV1WithValues(nil, files...)
+}
+
+// ReadV1WithValues is equivalent to ReadV1 but the files are first expanded
+// as templates with the given values and the environment variables. If
+// values is nil, the files are not expanded, as in ReadV1. An empty Values
+// expands the files with the environment variables only.
+func ReadV1WithValues(values Values, files ...string) ([]*api.Pipeline, error) {
+	pipelines, _, err := ReadV1WithPositions(values, files...)
+	return pipelines, err
+}
 
-		dec := yaml.NewDecoder(reader)
-		dec.SetStrict(true)
+// ReadV1WithPositions is equivalent to ReadV1WithValues but also returns the
+// positions of the read resources. All the errors in the files are returned
+// together as Diagnostics.
+func ReadV1WithPositions(
+	values Values, files ...string,
+) ([]*api.Pipeline, Positions, error) {
+	var (
+		resources []v1ReadResource
+		diags     Diagnostics
+	)
+	for _, f := range files {
+		fileResources, fileDiags := readV1File(f, values)
+		resources = append(resources, fileResources...)
+		diags = append(diags, fileDiags...)
+	}
+	report := func(r v1ReadResource, err error) {
+		diags = append(diags, &Diagnostic{Pos: r.pos, Err: err})
+	}
 
-		var resources []v1ReadResource
-		for {
-			var r v1ReadResource
-			if err = dec.Decode(&r); err != nil {
-				break
+	var pipelines []*api.Pipeline
+	positions := make(Positions)
+	defaults := make(map[string]*v1DefaultsSpec)
+	templates := make(map[string]*v1StageTemplateSpec)
+	for _, r := range resources {
+		switch r.Kind {
+		case pipelineKind:
+			o, d, err := resourceToPipeline(r)
+			if err != nil {
+				report(r, err)
+				continue
 			}
-			resources = append(resources, r)
-		}
-		if err != nil && err != io.EOF {
-			switch concreteErr := err.(type) {
-			case *yaml.TypeError:
-				err = typeErrorToError(concreteErr)
-				return nil, fmt.Errorf("read v1: %w", err)
-			default:
-				return nil, fmt.Errorf("read v1: %w", err)
+			id := ResourceID{Kind: pipelineKind, Name: o.Name}
+			if _, exists := positions[id]; exists {
+				report(r, &duplicateResource{Kind: pipelineKind, Name: o.Name})
+				continue
 			}
-		}
-		for _, r := range resources {
-			switch r.Kind {
-			case pipelineKind:
-				o, err := resourceToPipeline(r)
-				if err != nil {
-					return nil, fmt.Errorf("read v1: %w", err)
-				}
-				pipelines = append(pipelines, o)
+			positions[id] = r.pos
+			pipelines = append(pipelines, o)
+			defaults[o.Name] = d
+		case stageTemplateKind:
+			t, ok := r.Spec.(*v1StageTemplateSpec)
+			if !ok {
+				report(r, errors.New("stage template spec cast error"))
+				continue
 			}
+			if _, exists := templates[t.Name]; exists {
+				report(r, &duplicateTemplate{Name: t.Name})
+				continue
+			}
+			templates[t.Name] = t
+			positions[ResourceID{Kind: stageTemplateKind, Name: t.Name}] = r.pos
 		}
-		for _, r := range resources {
-			switch r.Kind {
-			case stageKind:
-				s, n, err := resourceToStage(r)
-				if err != nil {
-					return nil, fmt.Errorf("read v1: %w", err)
-				}
-				p := pipelineWithName(pipelines, n)
-				if p == nil {
-					return nil, fmt.Errorf("read v1: pipeline not found %s", n)
-				}
-				p.Stages = append(p.Stages, s)
-			case linkKind:
-				l, n, err := resourceToLink(r)
-				if err != nil {
-					return nil, fmt.Errorf("read v1: %w", err)
-				}
-				p := pipelineWithName(pipelines, n)
-				if p == nil {
-					return nil, fmt.Errorf("read v1: pipeline not found %s", n)
-				}
-				p.Links = append(p.Links, l)
+	}
+	for _, r := range resources {
+		switch r.Kind {
+		case stageKind:
+			spec, ok := r.Spec.(*v1StageSpec)
+			if !ok {
+				report(r, errors.New("stage spec cast error"))
+				continue
+			}
+			p, err := resourcePipeline(spec.Pipeline, pipelines)
+			if err != nil {
+				report(r, fmt.Errorf("stage %s: %w", spec.Name, err))
+				continue
+			}
+			s, err := specToStage(*spec, templates, defaults[p.Name])
+			if err != nil {
+				report(r, err)
+				continue
+			}
+			p.Stages = append(p.Stages, s)
+			id := ResourceID{Kind: stageKind, Pipeline: p.Name, Name: s.Name}
+			positions[id] = r.pos
+		case linkKind:
+			spec, ok := r.Spec.(*v1LinkSpec)
+			if !ok {
+				report(r, errors.New("link spec cast error"))
+				continue
 			}
+			p, err := resourcePipeline(spec.Pipeline, pipelines)
+			if err != nil {
+				report(r, fmt.Errorf("link %s: %w", spec.Name, err))
+				continue
+			}
+			l := specToLink(*spec, defaults[p.Name])
+			p.Links = append(p.Links, l)
+			id := ResourceID{Kind: linkKind, Pipeline: p.Name, Name: l.Name}
+			positions[id] = r.pos
+		}
+	}
+	if len(diags) > 0 {
+		sortDiagnostics(diags, files)
+		return nil, nil, diags
+	}
+	return pipelines, positions, nil
+}
+
+// readV1File reads the resources in a file, which is expanded as a template
+// if values is not nil. Documents with errors are reported as diagnostics
+// and the remaining ones are still read.
+func readV1File(file string, values Values) ([]v1ReadResource, Diagnostics) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, Diagnostics{{Pos: Position{File: file}, Err: err}}
+	}
+	if values == nil {
+		return decodeV1(file, data)
+	}
+	data, lines, err := expandTemplate(file, data, values)
+	if err != nil {
+		return nil, Diagnostics{{Pos: Position{File: file}, Err: err}}
+	}
+	resources, diags := decodeV1(file, data)
+	// The positions in the expanded data are mapped to the source file.
+	sourceLine := func(pos *Position) {
+		if pos.Line > 0 && pos.Line <= len(lines) {
+			pos.Line = lines[pos.Line-1]
 		}
 	}
-	return pipelines, nil
+	for i := range resources {
+		sourceLine(&resources[i].pos)
+	}
+	for _, d := range diags {
+		sourceLine(&d.Pos)
+	}
+	return resources, diags
+}
+
+func decodeV1(file string, data []byte) ([]v1ReadResource, Diagnostics) {
+	if IsJSONFile(file) {
+		return decodeV1JSON(file, data)
+	}
+	return decodeV1YAML(file, data)
+}
+
+func decodeV1YAML(file string, data []byte) ([]v1ReadResource, Diagnostics) {
+	var (
+		resources []v1ReadResource
+		diags     Diagnostics
+	)
+	for _, doc := range splitYAMLDocuments(data) {
+		pos := Position{File: file, Document: doc.index, Line: doc.line, Column: doc.column}
+		var r v1ReadResource
+		if err := yaml.UnmarshalStrict(doc.data(), &r); err != nil {
+			diags = append(diags, doc.diagnostic(pos, err))
+			continue
+		}
+		r.pos = pos
+		resources = append(resources, r)
+	}
+	return resources, diags
+}
+
+// resourcePipeline returns the pipeline where a resource should be
+// inserted. The pipeline may be omitted if only one pipeline exists.
+func resourcePipeline(name string, pipelines []*api.Pipeline) (*api.Pipeline, error) {
+	if name == "" {
+		if len(pipelines) == 1 {
+			return pipelines[0], nil
+		}
+		return nil, &missingRequiredField{Field: "pipeline"}
+	}
+	p := pipelineWithName(pipelines, name)
+	if p == nil {
+		return nil, &pipelineNotFound{Name: name}
+	}
+	return p, nil
 }
 
 func pipelineWithName(pipelines []*api.Pipeline, name string) *api.Pipeline {
@@ -108,50 +267,273 @@ func pipelineWithName(pipelines []*api.Pipeline, name string) *api.Pipeline {
 	return arrays.FindFirst(filterFn, pipelines...)
 }
 
-func resourceToPipeline(r v1ReadResource) (*api.Pipeline, error) {
+func resourceToPipeline(r v1ReadResource) (*api.Pipeline, *v1DefaultsSpec, error) {
 	s, ok := r.Spec.(*v1PipelineSpec)
 	if !ok {
-		return nil, errors.New("pipeline spec cast error")
+		return nil, nil, errors.New("pipeline spec cast error")
+	}
+	p := &api.Pipeline{Name: s.Name, PropagateMetadata: s.PropagateMetadata}
+	if s.DeadLetter != nil {
+		p.DeadLetter = &api.DeadLetter{File: s.DeadLetter.File, Address: s.DeadLetter.Address}
 	}
-	return &api.Pipeline{Name: s.Name}, nil
+	return p, s.Defaults, nil
 }
 
-func resourceToStage(r v1ReadResource) (*api.Stage, string, error) {
-	stageSpec, ok := r.Spec.(*v1StageSpec)
-	if !ok {
-		return nil, "", errors.New("stage spec cast error")
+func specToStage(
+	spec v1StageSpec,
+	templates map[string]*v1StageTemplateSpec,
+	defaults *v1DefaultsSpec,
+) (*api.Stage, error) {
+	spec, err := extendStageSpec(spec, templates)
+	if err != nil {
+		return nil, fmt.Errorf("stage %s: %w", spec.Name, err)
+	}
+	if defaults != nil {
+		if strings.HasPrefix(spec.Address, ":") && defaults.Host != "" {
+			spec.Address = defaults.Host + spec.Address
+		}
+		if spec.Timeout == "" {
+			spec.Timeout = defaults.Timeout
+		}
+		if spec.TLS == nil {
+			spec.TLS = defaults.TLS
+		}
+		if spec.OnError == "" {
+			spec.OnError = defaults.OnError
+		}
+		if spec.CircuitBreaker == nil {
+			spec.CircuitBreaker = defaults.CircuitBreaker
+		}
+		if spec.Retry == nil {
+			spec.Retry = defaults.Retry
+		}
+		if spec.Metadata == nil {
+			spec.Metadata = defaults.Metadata
+		}
+		if spec.Auth == nil {
+			spec.Auth = defaults.Auth
+		}
+	}
+	if spec.Address == "" {
+		return nil, &missingRequiredField{Field: "address"}
 	}
-
 	s := &api.Stage{
-		Name:    stageSpec.Name,
-		Address: stageSpec.Address,
-		Service: stageSpec.Service,
-		Method:  stageSpec.Method,
+		Name:     spec.Name,
+		Address:  spec.Address,
+		Service:  spec.Service,
+		Method:   spec.Method,
+		TLS:      specToTLS(spec.TLS),
+		OnError:  spec.OnError,
+		Metadata: specToMetadata(spec.Metadata),
+	}
+	if spec.Timeout != "" {
+		s.Timeout, err = time.ParseDuration(spec.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("stage %s: timeout: %w", spec.Name, err)
+		}
+	}
+	s.CircuitBreaker, err = specToCircuitBreaker(spec.CircuitBreaker)
+	if err != nil {
+		return nil, fmt.Errorf("stage %s: circuit_breaker: %w", spec.Name, err)
+	}
+	s.Retry, err = specToRetry(spec.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("stage %s: retry: %w", spec.Name, err)
+	}
+	s.Auth, err = specToAuth(spec.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("stage %s: auth: %w", spec.Name, err)
 	}
-	return s, stageSpec.Pipeline, nil
+	return s, nil
 }
 
-func resourceToLink(r v1ReadResource) (*api.Link, string, error) {
-	linkSpec, ok := r.Spec.(*v1LinkSpec)
-	if !ok {
-		return nil, "", errors.New("link spec cast error")
+// extendStageSpec fills the fields that are not specified in spec with the
+// ones from the template it extends, and the templates that one extends.
+func extendStageSpec(
+	spec v1StageSpec, templates map[string]*v1StageTemplateSpec,
+) (v1StageSpec, error) {
+	seen := make(map[string]bool)
+	for next := spec.Extends; next != ""; {
+		if seen[next] {
+			return spec, &cyclicTemplate{Name: next}
+		}
+		seen[next] = true
+		t, ok := templates[next]
+		if !ok {
+			return spec, &templateNotFound{Name: next}
+		}
+		if spec.Address == "" {
+			spec.Address = t.Address
+		}
+		if spec.Service == "" {
+			spec.Service = t.Service
+		}
+		if spec.Method == "" {
+			spec.Method = t.Method
+		}
+		if spec.Timeout == "" {
+			spec.Timeout = t.Timeout
+		}
+		if spec.TLS == nil {
+			spec.TLS = t.TLS
+		}
+		if spec.OnError == "" {
+			spec.OnError = t.OnError
+		}
+		if spec.CircuitBreaker == nil {
+			spec.CircuitBreaker = t.CircuitBreaker
+		}
+		if spec.Retry == nil {
+			spec.Retry = t.Retry
+		}
+		if spec.Metadata == nil {
+			spec.Metadata = t.Metadata
+		}
+		if spec.Auth == nil {
+			spec.Auth = t.Auth
+		}
+		next = t.Extends
 	}
+	return spec, nil
+}
 
+func specToTLS(spec *v1TLSSpec) *api.TLS {
+	if spec == nil {
+		return nil
+	}
+	return &api.TLS{
+		CAFile:             spec.CAFile,
+		CertFile:           spec.CertFile,
+		KeyFile:            spec.KeyFile,
+		ServerName:         spec.ServerName,
+		InsecureSkipVerify: spec.InsecureSkipVerify,
+	}
+}
+
+func specToCircuitBreaker(spec *v1CircuitBreakerSpec) (*api.CircuitBreaker, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	cb := &api.CircuitBreaker{
+		ConsecutiveFailures: spec.ConsecutiveFailures,
+		ErrorRate:           spec.ErrorRate,
+		Window:              spec.Window,
+		HalfOpenProbes:      spec.HalfOpenProbes,
+		WhileOpen:           spec.WhileOpen,
+	}
+	if spec.OpenTimeout != "" {
+		d, err := time.ParseDuration(spec.OpenTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("open_timeout: %w", err)
+		}
+		cb.OpenTimeout = d
+	}
+	return cb, nil
+}
+
+func specToRetry(spec *v1RetrySpec) (*api.Retry, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	r := &api.Retry{
+		MaxAttempts: spec.MaxAttempts,
+		Jitter:      spec.Jitter,
+		Codes:       spec.Codes,
+	}
+	var err error
+	if spec.InitialBackoff != "" {
+		r.InitialBackoff, err = time.ParseDuration(spec.InitialBackoff)
+		if err != nil {
+			return nil, fmt.Errorf("initial_backoff: %w", err)
+		}
+	}
+	if spec.MaxBackoff != "" {
+		r.MaxBackoff, err = time.ParseDuration(spec.MaxBackoff)
+		if err != nil {
+			return nil, fmt.Errorf("max_backoff: %w", err)
+		}
+	}
+	return r, nil
+}
+
+func specToAuth(spec *v1AuthSpec) (*api.Auth, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	a := &api.Auth{Insecure: spec.Insecure}
+	var err error
+	if spec.RefreshBefore != "" {
+		a.RefreshBefore, err = time.ParseDuration(spec.RefreshBefore)
+		if err != nil {
+			return nil, fmt.Errorf("refresh_before: %w", err)
+		}
+	}
+	if o := spec.OAuth2; o != nil {
+		a.OAuth2 = &api.OAuth2{
+			TokenURL:         o.TokenURL,
+			ClientID:         o.ClientID,
+			ClientSecret:     o.ClientSecret,
+			ClientSecretEnv:  o.ClientSecretEnv,
+			ClientSecretFile: o.ClientSecretFile,
+			Scopes:           o.Scopes,
+			Audience:         o.Audience,
+		}
+	}
+	if j := spec.JWT; j != nil {
+		a.JWT = &api.JWT{
+			KeyFile:  j.KeyFile,
+			KeyID:    j.KeyID,
+			Issuer:   j.Issuer,
+			Subject:  j.Subject,
+			Audience: j.Audience,
+		}
+		if j.Lifetime != "" {
+			a.JWT.Lifetime, err = time.ParseDuration(j.Lifetime)
+			if err != nil {
+				return nil, fmt.Errorf("jwt: lifetime: %w", err)
+			}
+		}
+	}
+	return a, nil
+}
+
+func specToMetadata(spec []v1HeaderSpec) []*api.Header {
+	var headers []*api.Header
+	for _, h := range spec {
+		headers = append(headers, &api.Header{
+			Name:  h.Name,
+			Value: h.Value,
+			Env:   h.Env,
+			File:  h.File,
+		})
+	}
+	return headers
+}
+
+func specToLink(spec v1LinkSpec, defaults *v1DefaultsSpec) *api.Link {
 	l := &api.Link{
-		Name:             linkSpec.Name,
-		SourceStage:      linkSpec.SourceStage,
-		SourceField:      linkSpec.SourceField,
-		TargetStage:      linkSpec.TargetStage,
-		TargetField:      linkSpec.TargetField,
-		Size:             linkSpec.Size,
-		NumEmptyMessages: linkSpec.NumEmptyMessages,
+		Name:             spec.Name,
+		SourceStage:      spec.SourceStage,
+		SourceField:      spec.SourceField,
+		TargetStage:      spec.TargetStage,
+		TargetField:      spec.TargetField,
+		Size:             spec.Size,
+		NumEmptyMessages: spec.NumEmptyMessages,
+		Strict:           spec.Strict,
+		Match:            spec.Match,
+		SourceType:       spec.SourceType,
+	}
+	if l.Size == 0 && defaults != nil {
+		l.Size = defaults.LinkSize
 	}
-	return l, linkSpec.Pipeline, nil
+	return l
 }
 
 type v1ReadResource struct {
 	Kind string      `yaml:"kind"`
 	Spec interface{} `yaml:"-"`
+
+	pos Position
 }
 
 func (r *v1ReadResource) String() string {
@@ -180,23 +562,15 @@ func (r *v1ReadResource) UnmarshalYAML(unmarshal func(interface{}) error) error
 		return err
 	}
 	r.Kind = obj.Kind
-	if r.Kind == "" {
-		return ErrMissingKind
-	}
-	switch r.Kind {
-	case stageKind:
-		r.Spec = new(v1StageSpec)
-	case linkKind:
-		r.Spec = new(v1LinkSpec)
-	case pipelineKind:
-		r.Spec = new(v1PipelineSpec)
-	default:
-		return &unknownKind{Kind: r.Kind}
+	spec, err := newV1Spec(r.Kind)
+	if err != nil {
+		return err
 	}
+	r.Spec = spec
 	if obj.Spec.unmarshal == nil {
 		return ErrEmptySpec
 	}
-	err := obj.Spec.unmarshal(r.Spec)
+	err = obj.Spec.unmarshal(r.Spec)
 	if err != nil {
 		return err
 	}
@@ -204,6 +578,24 @@ func (r *v1ReadResource) UnmarshalYAML(unmarshal func(interface{}) error) error
 	return valV1ReadResource(r)
 }
 
+// newV1Spec creates an empty spec for the given resource kind.
+func newV1Spec(kind string) (interface{}, error) {
+	switch kind {
+	case "":
+		return nil, ErrMissingKind
+	case stageKind:
+		return new(v1StageSpec), nil
+	case stageTemplateKind:
+		return new(v1StageTemplateSpec), nil
+	case linkKind:
+		return new(v1LinkSpec), nil
+	case pipelineKind:
+		return new(v1PipelineSpec), nil
+	default:
+		return nil, &unknownKind{Kind: kind}
+	}
+}
+
 func valV1ReadResource(r *v1ReadResource) error {
 	switch r.Kind {
 	case stageKind:
@@ -212,6 +604,12 @@ func valV1ReadResource(r *v1ReadResource) error {
 			return errors.New("spec not v1StageSpec for stage kind")
 		}
 		return valV1StageSpec(spec)
+	case stageTemplateKind:
+		spec, ok := r.Spec.(*v1StageTemplateSpec)
+		if !ok {
+			return errors.New("spec not v1StageTemplateSpec for stage template kind")
+		}
+		return valV1StageTemplateSpec(spec)
 	case linkKind:
 		spec, ok := r.Spec.(*v1LinkSpec)
 		if !ok {
@@ -233,6 +631,20 @@ func valV1PipelineSpec(spec *v1PipelineSpec) error {
 	if spec.Name == "" {
 		return &missingRequiredField{Field: "name"}
 	}
+	if dl := spec.DeadLetter; dl != nil {
+		if dl.File == "" && dl.Address == "" {
+			return &missingRequiredField{Field: "dead_letter.file"}
+		}
+		if dl.File != "" && dl.Address != "" {
+			return &exclusiveFields{A: "dead_letter.file", B: "dead_letter.address"}
+		}
+	}
+	if spec.Defaults != nil {
+		if err := valV1Metadata(spec.Defaults.Metadata); err != nil {
+			return err
+		}
+		return valV1Auth(spec.Defaults.Auth)
+	}
 	return nil
 }
 
@@ -240,11 +652,93 @@ func valV1StageSpec(spec *v1StageSpec) error {
 	if spec.Name == "" {
 		return &missingRequiredField{Field: "name"}
 	}
-	if spec.Address == "" {
+	// The address may be inherited from a template and so it is only
+	// verified after the templates are applied.
+	if spec.Address == "" && spec.Extends == "" {
 		return &missingRequiredField{Field: "address"}
 	}
-	if spec.Pipeline == "" {
-		return &missingRequiredField{Field: "pipeline"}
+	if err := valV1Metadata(spec.Metadata); err != nil {
+		return err
+	}
+	return valV1Auth(spec.Auth)
+}
+
+func valV1StageTemplateSpec(spec *v1StageTemplateSpec) error {
+	if spec.Name == "" {
+		return &missingRequiredField{Field: "name"}
+	}
+	if err := valV1Metadata(spec.Metadata); err != nil {
+		return err
+	}
+	return valV1Auth(spec.Auth)
+}
+
+// valV1Auth verifies that the auth specifies a single way to obtain the
+// tokens, with its required fields.
+func valV1Auth(spec *v1AuthSpec) error {
+	if spec == nil {
+		return nil
+	}
+	switch {
+	case spec.OAuth2 != nil && spec.JWT != nil:
+		return &exclusiveFields{A: "auth.oauth2", B: "auth.jwt"}
+	case spec.OAuth2 != nil:
+		o := spec.OAuth2
+		if o.TokenURL == "" {
+			return &missingRequiredField{Field: "auth.oauth2.token_url"}
+		}
+		if o.ClientID == "" {
+			return &missingRequiredField{Field: "auth.oauth2.client_id"}
+		}
+		var set []string
+		secrets := []struct{ field, value string }{
+			{"auth.oauth2.client_secret", o.ClientSecret},
+			{"auth.oauth2.client_secret_env", o.ClientSecretEnv},
+			{"auth.oauth2.client_secret_file", o.ClientSecretFile},
+		}
+		for _, src := range secrets {
+			if src.value != "" {
+				set = append(set, src.field)
+			}
+		}
+		if len(set) > 1 {
+			return &exclusiveFields{A: set[0], B: set[1]}
+		}
+	case spec.JWT != nil:
+		if spec.JWT.KeyFile == "" {
+			return &missingRequiredField{Field: "auth.jwt.key_file"}
+		}
+	default:
+		return &missingRequiredField{Field: "auth.oauth2"}
+	}
+	return nil
+}
+
+// valV1Metadata verifies that the headers have a name and a single source
+// for the value.
+func valV1Metadata(headers []v1HeaderSpec) error {
+	for _, h := range headers {
+		if h.Name == "" {
+			return &missingRequiredField{Field: "metadata.name"}
+		}
+		var set []string
+		sources := []struct{ field, value string }{
+			{"metadata.value", h.Value},
+			{"metadata.env", h.Env},
+			{"metadata.file", h.File},
+		}
+		for _, src := range sources {
+			if src.value != "" {
+				set = append(set, src.field)
+			}
+		}
+		switch len(set) {
+		case 0:
+			return &missingRequiredField{Field: "metadata.value"}
+		case 1:
+		default:
+			return &exclusiveFields{A: set[0], B: set[1]}
+		}
 	}
 	return nil
 }
@@ -262,60 +756,58 @@ func valV1LinkSpec(spec *v1LinkSpec) error {
 	return nil
 }
 
-// WriteV1 stores the resources set in a single file as a
-func WriteV1(pipeline *api.Pipeline, file string, perm fs.FileMode) error {
-	var (
-		buf bytes.Buffer
-		err error
-	)
+// WriteV1 stores the pipelines in a single file, with one resource per yaml
+// document.
+func WriteV1(pipelines []*api.Pipeline, file string, perm fs.FileMode) error {
+	var buf bytes.Buffer
 	enc := yaml.NewEncoder(&buf)
-	err = encodeResources(enc, pipelineToResource, pipeline)
-	if err != nil {
-		return fmt.Errorf("write v1: %w", err)
-	}
-	stageEncFunc := func(r *v1WriteResource, s *api.Stage) {
-		stageToResource(r, s, pipeline.Name)
-	}
-	err = encodeResources(enc, stageEncFunc, pipeline.Stages...)
-	if err != nil {
-		return fmt.Errorf("write v1: %w", err)
-	}
-	linkEncFunc := func(r *v1WriteResource, l *api.Link) {
-		linkToResource(r, l, pipeline.Name)
-	}
-	err = encodeResources(enc, linkEncFunc, pipeline.Links...)
-	if err != nil {
-		return fmt.Errorf("write v1: %w", err)
+	for _, r := range pipelinesToResources(pipelines) {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("write v1: %w", err)
+		}
 	}
-	err = ioutil.WriteFile(file, buf.Bytes(), perm)
+	err := ioutil.WriteFile(file, buf.Bytes(), perm)
 	if err != nil {
 		return fmt.Errorf("write v1: %w", err)
 	}
 	return nil
 }
 
-func encodeResources[T any](
-	enc *yaml.Encoder, encodeFn func(*v1WriteResource, T), resources ...T,
-) error {
-	for _, r := range resources {
-		var w v1WriteResource
-		encodeFn(&w, r)
-		err := enc.Encode(w)
-		if err != nil {
-			return err
+// pipelinesToResources creates the resources that specify each pipeline,
+// its stages and its links, in this order.
+func pipelinesToResources(pipelines []*api.Pipeline) []v1WriteResource {
+	var resources []v1WriteResource
+	for _, pipeline := range pipelines {
+		var r v1WriteResource
+		pipelineToResource(&r, pipeline)
+		resources = append(resources, r)
+		for _, s := range pipeline.Stages {
+			stageToResource(&r, s, pipeline.Name)
+			resources = append(resources, r)
+		}
+		for _, l := range pipeline.Links {
+			linkToResource(&r, l, pipeline.Name)
+			resources = append(resources, r)
 		}
 	}
-	return nil
+	return resources
 }
 
 type v1WriteResource struct {
-	Kind string      `yaml:"kind"`
-	Spec interface{} `yaml:"spec"`
+	Kind string      `yaml:"kind" json:"kind"`
+	Spec interface{} `yaml:"spec" json:"spec"`
 }
 
 func pipelineToResource(r *v1WriteResource, p *api.Pipeline) {
 	var pipelineSpec v1PipelineSpec
 	pipelineSpec.Name = p.Name
+	pipelineSpec.PropagateMetadata = p.PropagateMetadata
+	if p.DeadLetter != nil {
+		pipelineSpec.DeadLetter = &v1DeadLetterSpec{
+			File:    p.DeadLetter.File,
+			Address: p.DeadLetter.Address,
+		}
+	}
 
 	r.Kind = pipelineKind
 	r.Spec = pipelineSpec
@@ -327,12 +819,116 @@ func stageToResource(r *v1WriteResource, s *api.Stage, pipelineName string) {
 	stageSpec.Address = s.Address
 	stageSpec.Service = s.Service
 	stageSpec.Method = s.Method
+	if s.Timeout > 0 {
+		stageSpec.Timeout = s.Timeout.String()
+	}
+	stageSpec.TLS = tlsToSpec(s.TLS)
+	stageSpec.OnError = s.OnError
+	stageSpec.CircuitBreaker = circuitBreakerToSpec(s.CircuitBreaker)
+	stageSpec.Retry = retryToSpec(s.Retry)
+	stageSpec.Metadata = metadataToSpec(s.Metadata)
+	stageSpec.Auth = authToSpec(s.Auth)
 	stageSpec.Pipeline = pipelineName
 
 	r.Kind = stageKind
 	r.Spec = stageSpec
 }
 
+func tlsToSpec(t *api.TLS) *v1TLSSpec {
+	if t == nil {
+		return nil
+	}
+	return &v1TLSSpec{
+		CAFile:             t.CAFile,
+		CertFile:           t.CertFile,
+		KeyFile:            t.KeyFile,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+}
+
+func circuitBreakerToSpec(cb *api.CircuitBreaker) *v1CircuitBreakerSpec {
+	if cb == nil {
+		return nil
+	}
+	spec := &v1CircuitBreakerSpec{
+		ConsecutiveFailures: cb.ConsecutiveFailures,
+		ErrorRate:           cb.ErrorRate,
+		Window:              cb.Window,
+		HalfOpenProbes:      cb.HalfOpenProbes,
+		WhileOpen:           cb.WhileOpen,
+	}
+	if cb.OpenTimeout > 0 {
+		spec.OpenTimeout = cb.OpenTimeout.String()
+	}
+	return spec
+}
+
+func retryToSpec(r *api.Retry) *v1RetrySpec {
+	if r == nil {
+		return nil
+	}
+	spec := &v1RetrySpec{
+		MaxAttempts: r.MaxAttempts,
+		Jitter:      r.Jitter,
+		Codes:       r.Codes,
+	}
+	if r.InitialBackoff > 0 {
+		spec.InitialBackoff = r.InitialBackoff.String()
+	}
+	if r.MaxBackoff > 0 {
+		spec.MaxBackoff = r.MaxBackoff.String()
+	}
+	return spec
+}
+
+func authToSpec(a *api.Auth) *v1AuthSpec {
+	if a == nil {
+		return nil
+	}
+	spec := &v1AuthSpec{Insecure: a.Insecure}
+	if a.RefreshBefore > 0 {
+		spec.RefreshBefore = a.RefreshBefore.String()
+	}
+	if o := a.OAuth2; o != nil {
+		spec.OAuth2 = &v1OAuth2Spec{
+			TokenURL:         o.TokenURL,
+			ClientID:         o.ClientID,
+			ClientSecret:     o.ClientSecret,
+			ClientSecretEnv:  o.ClientSecretEnv,
+			ClientSecretFile: o.ClientSecretFile,
+			Scopes:           o.Scopes,
+			Audience:         o.Audience,
+		}
+	}
+	if j := a.JWT; j != nil {
+		spec.JWT = &v1JWTSpec{
+			KeyFile:  j.KeyFile,
+			KeyID:    j.KeyID,
+			Issuer:   j.Issuer,
+			Subject:  j.Subject,
+			Audience: j.Audience,
+		}
+		if j.Lifetime > 0 {
+			spec.JWT.Lifetime = j.Lifetime.String()
+		}
+	}
+	return spec
+}
+
+func metadataToSpec(headers []*api.Header) []v1HeaderSpec {
+	var spec []v1HeaderSpec
+	for _, h := range headers {
+		spec = append(spec, v1HeaderSpec{
+			Name:  h.Name,
+			Value: h.Value,
+			Env:   h.Env,
+			File:  h.File,
+		})
+	}
+	return spec
+}
+
 func linkToResource(r *v1WriteResource, l *api.Link, pipelineName string) {
 	var linkSpec v1LinkSpec
 	linkSpec.Name = l.Name
@@ -342,6 +938,9 @@ func linkToResource(r *v1WriteResource, l *api.Link, pipelineName string) {
 	linkSpec.TargetField = l.TargetField
 	linkSpec.Size = l.Size
 	linkSpec.NumEmptyMessages = l.NumEmptyMessages
+	linkSpec.Strict = l.Strict
+	linkSpec.Match = l.Match
+	linkSpec.SourceType = l.SourceType
 	linkSpec.Pipeline = pipelineName
 
 	r.Kind = linkKind
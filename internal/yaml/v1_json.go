@@ -0,0 +1,163 @@
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+)
+
+// IsJSONFile reports whether a configuration file is in the json format,
+// according to its extension. All other files are read as yaml.
+func IsJSONFile(file string) bool {
+	return strings.EqualFold(filepath.Ext(file), ".json")
+}
+
+// decodeV1JSON decodes the resources in json data. The data is either a
+// single resource object or an array of resource objects.
+func decodeV1JSON(file string, data []byte) ([]v1ReadResource, Diagnostics) {
+	start := skipJSONSeparators(data, 0)
+	if start == len(data) || data[start] != '[' {
+		r, diag := decodeJSONResource(file, data, start, len(data), 1)
+		if diag != nil {
+			return nil, Diagnostics{diag}
+		}
+		return []v1ReadResource{r}, nil
+	}
+
+	var (
+		resources []v1ReadResource
+		diags     Diagnostics
+	)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Consume the opening bracket, already verified above.
+	if _, err := dec.Token(); err != nil {
+		return nil, Diagnostics{jsonDiagnostic(file, data, start, 0, err)}
+	}
+	for doc := 1; dec.More(); doc++ {
+		elemStart := skipJSONSeparators(data, int(dec.InputOffset()))
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			// The remaining data cannot be decoded after a syntax error.
+			diag := jsonDiagnostic(file, data, elemStart, doc, err)
+			return resources, append(diags, diag)
+		}
+		elemEnd := elemStart + len(raw)
+		r, diag := decodeJSONResource(file, data, elemStart, elemEnd, doc)
+		if diag != nil {
+			diags = append(diags, diag)
+			continue
+		}
+		resources = append(resources, r)
+	}
+	return resources, diags
+}
+
+// decodeJSONResource decodes the resource in data[start:end].
+func decodeJSONResource(
+	file string, data []byte, start, end, doc int,
+) (v1ReadResource, *Diagnostic) {
+	var r v1ReadResource
+	if err := r.UnmarshalJSON(data[start:end]); err != nil {
+		return r, jsonDiagnostic(file, data[:end], start, doc, err)
+	}
+	line, col := offsetToLineCol(data, start)
+	r.pos = Position{File: file, Document: doc, Line: line, Column: col}
+	return r, nil
+}
+
+// jsonDiagnostic creates the diagnostic for an error decoding the resource
+// that starts at the given offset of data.
+func jsonDiagnostic(file string, data []byte, start, doc int, err error) *Diagnostic {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		unkFields *unknownFields
+		offset    = start
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = int(syntaxErr.Offset)
+		err = &invalidDocument{Msg: syntaxErr.Error()}
+	case errors.As(err, &typeErr):
+		err = &invalidDocument{Msg: typeErr.Error()}
+	case errors.As(err, &unkFields):
+		field := []byte(fmt.Sprintf("%q", unkFields.Fields[0]))
+		if i := bytes.Index(data[start:], field); i >= 0 {
+			offset = start + i
+		}
+	}
+	line, col := offsetToLineCol(data, offset)
+	return &Diagnostic{
+		Pos: Position{File: file, Document: doc, Line: line, Column: col},
+		Err: err,
+	}
+}
+
+// skipJSONSeparators returns the offset of the first byte in data, after
+// offset, that is not whitespace or a comma.
+func skipJSONSeparators(data []byte, offset int) int {
+	for offset < len(data) {
+		switch data[offset] {
+		case ' ', '\t', '\n', '\r', ',':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// UnmarshalJSON decodes a resource with the spec type defined by its kind.
+// As with yaml, unknown fields are not allowed.
+func (r *v1ReadResource) UnmarshalJSON(data []byte) error {
+	obj := struct {
+		Kind string          `json:"kind"`
+		Spec json.RawMessage `json:"spec"`
+	}{}
+	if err := unmarshalJSONStrict(data, &obj); err != nil {
+		return err
+	}
+	r.Kind = obj.Kind
+	spec, err := newV1Spec(r.Kind)
+	if err != nil {
+		return err
+	}
+	r.Spec = spec
+	if len(obj.Spec) == 0 || string(obj.Spec) == "null" {
+		return ErrEmptySpec
+	}
+	if err := unmarshalJSONStrict(obj.Spec, r.Spec); err != nil {
+		return err
+	}
+	return valV1ReadResource(r)
+}
+
+func unmarshalJSONStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return jsonErrorToError(err)
+	}
+	return nil
+}
+
+// WriteV1JSON stores the pipelines in a single file as an array of v1
+// resources in the json format.
+func WriteV1JSON(pipelines []*api.Pipeline, file string, perm fs.FileMode) error {
+	data, err := json.MarshalIndent(pipelinesToResources(pipelines), "", "  ")
+	if err != nil {
+		return fmt.Errorf("write v1 json: %w", err)
+	}
+	data = append(data, '\n')
+	if err := ioutil.WriteFile(file, data, perm); err != nil {
+		return fmt.Errorf("write v1 json: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package yaml
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/DuarteMRAlves/maestro/internal/api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadV1_JSON(t *testing.T) {
+	expected, err := ReadV1("../../test/data/unit/read/v1/read_single_file.yml")
+	if err != nil {
+		t.Fatalf("read yaml: %s", err)
+	}
+	actual, err := ReadV1("../../test/data/unit/read/v1/read_single_file.json")
+	if err != nil {
+		t.Fatalf("read json: %s", err)
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("read resources mismatch:\n%s", diff)
+	}
+}
+
+func TestReadV1_JSONErr(t *testing.T) {
+	pipelines, err := ReadV1("../../test/data/unit/read/v1/err_unknown_fields.json")
+	if err == nil {
+		t.Fatalf("expected error but got nil")
+	}
+	if pipelines != nil {
+		t.Fatalf("resources not nil")
+	}
+	var actual *unknownFields
+	if !errors.As(err, &actual) {
+		format := "Wrong error type: expected *unknownFields, got %s"
+		t.Fatalf(format, reflect.TypeOf(err))
+	}
+	expected := &unknownFields{Fields: []string{"unknown"}}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("error mismatch:\n%s", diff)
+	}
+}
+
+func TestWriteV1JSON(t *testing.T) {
+	pipeline := api.Pipeline{
+		Name: "pipeline-1",
+		Stages: []*api.Stage{
+			{
+				Name:    "stage-1",
+				Address: "address-1",
+				Service: "Service1",
+				Method:  "Method1",
+			},
+			{
+				Name:    "stage-2",
+				Address: "address-2",
+				Service: "Service2",
+			},
+			{
+				Name:    "stage-3",
+				Address: "address-3",
+				Method:  "Method3",
+			},
+		},
+		Links: []*api.Link{
+			{
+				Name:             "link-stage-2-stage-1",
+				SourceStage:      "stage-2",
+				TargetStage:      "stage-1",
+				Size:             6,
+				NumEmptyMessages: 2,
+			},
+			{
+				Name:        "link-stage-1-stage-2",
+				SourceStage: "stage-1",
+				SourceField: "Field1",
+				TargetStage: "stage-2",
+				TargetField: "Field2",
+			},
+		},
+	}
+	outFile := t.TempDir() + "/to_v1.json"
+	if err := WriteV1JSON([]*api.Pipeline{&pipeline}, outFile, 0777); err != nil {
+		t.Fatalf("write v1 json: %s", err)
+	}
+	writeData, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("read new file: %s", err)
+	}
+	expData, err := ioutil.ReadFile("../../test/data/unit/read/v1/write_single_file.json")
+	if err != nil {
+		t.Fatalf("read v1: %s", err)
+	}
+	if diff := cmp.Diff(string(expData), string(writeData)); diff != "" {
+		t.Fatalf("content mismatch:\n%s", diff)
+	}
+
+	// The written file must be read back to the same pipeline.
+	pipelines, err := ReadV1(outFile)
+	if err != nil {
+		t.Fatalf("read written file: %s", err)
+	}
+	if diff := cmp.Diff([]*api.Pipeline{&pipeline}, pipelines); diff != "" {
+		t.Fatalf("read pipeline mismatch:\n%s", diff)
+	}
+}
+
+// TestV1Schema verifies that the published schema defines the same
+// properties as the resource specs.
+func TestV1Schema(t *testing.T) {
+	data, err := ioutil.ReadFile("../../docs/schema/v1.schema.json")
+	if err != nil {
+		t.Fatalf("read schema: %s", err)
+	}
+	var schema struct {
+		Definitions map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("decode schema: %s", err)
+	}
+	specs := map[string]interface{}{
+		"pipeline":        v1PipelineSpec{},
+		"defaults":        v1DefaultsSpec{},
+		"dead_letter":     v1DeadLetterSpec{},
+		"circuit_breaker": v1CircuitBreakerSpec{},
+		"retry":           v1RetrySpec{},
+		"header":          v1HeaderSpec{},
+		"auth":            v1AuthSpec{},
+		"oauth2":          v1OAuth2Spec{},
+		"jwt":             v1JWTSpec{},
+		"tls":             v1TLSSpec{},
+		"stage":           v1StageSpec{},
+		"stage_template":  v1StageTemplateSpec{},
+		"link":            v1LinkSpec{},
+	}
+	for name, spec := range specs {
+		def, ok := schema.Definitions[name]
+		if !ok {
+			t.Fatalf("schema definition %q not found", name)
+		}
+		var expected, actual []string
+		typ := reflect.TypeOf(spec)
+		for i := 0; i < typ.NumField(); i++ {
+			tag := typ.Field(i).Tag.Get("json")
+			expected = append(expected, strings.Split(tag, ",")[0])
+		}
+		for p := range def.Properties {
+			actual = append(actual, p)
+		}
+		sort.Strings(expected)
+		sort.Strings(actual)
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Fatalf("%s properties mismatch:\n%s", name, diff)
+		}
+	}
+}
@@ -3,65 +3,351 @@ package yaml
 type v1PipelineSpec struct {
 	// Name that should be associated with the pipeline.
 	// (required, unique)
-	Name string `yaml:"name"`
+	Name string `yaml:"name" json:"name"`
+	// Defaults specifies the values for the stages and links of the pipeline
+	// that do not define them.
+	// (optional)
+	Defaults *v1DefaultsSpec `yaml:"defaults,omitempty" json:"defaults,omitempty"`
+	// DeadLetter specifies where to send the messages of the stages that
+	// fail with on_error set to skip.
+	// (optional)
+	DeadLetter *v1DeadLetterSpec `yaml:"dead_letter,omitempty" json:"dead_letter,omitempty"`
+	// PropagateMetadata are the names of the headers and trailers received
+	// from each stage that are sent as request metadata to the next stages.
+	// (optional)
+	PropagateMetadata []string `yaml:"propagate_metadata,omitempty" json:"propagate_metadata,omitempty"`
+}
+
+type v1DeadLetterSpec struct {
+	// File where the failed messages are appended, one json object per line.
+	// (optional, exclusive with address)
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
+	// Address of the grpc method that receives the failed messages, in the
+	// same format as the address of a stage with the service and method,
+	// such as "localhost:8080/dlq.DeadLetters/Put".
+	// (optional, exclusive with file)
+	Address string `yaml:"address,omitempty" json:"address,omitempty"`
+}
+
+type v1DefaultsSpec struct {
+	// Host for the stage addresses that only specify the port, such as
+	// ":8080".
+	// (optional)
+	Host string `yaml:"host,omitempty" json:"host,omitempty"`
+	// LinkSize is the buffer size for the links.
+	// (optional)
+	LinkSize uint `yaml:"link_size,omitempty" json:"link_size,omitempty"`
+	// Timeout for the stage method invocations, such as "30s".
+	// (optional)
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// TLS configures secure connections with the stage servers.
+	// (optional)
+	TLS *v1TLSSpec `yaml:"tls,omitempty" json:"tls,omitempty"`
+	// OnError specifies what happens when the stage methods fail.
+	// (optional)
+	OnError string `yaml:"on_error,omitempty" json:"on_error,omitempty"`
+	// CircuitBreaker stops calling the stage methods while they keep
+	// failing.
+	// (optional)
+	CircuitBreaker *v1CircuitBreakerSpec `yaml:"circuit_breaker,omitempty" json:"circuit_breaker,omitempty"`
+	// Retry retries the failed calls of the grpc method.
+	// (optional)
+	Retry *v1RetrySpec `yaml:"retry,omitempty" json:"retry,omitempty"`
+	// Metadata are the headers sent with every call of the grpc method.
+	// (optional)
+	Metadata []v1HeaderSpec `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	// Auth authenticates the calls of the grpc method and the reflection
+	// requests with tokens.
+	// (optional)
+	Auth *v1AuthSpec `yaml:"auth,omitempty" json:"auth,omitempty"`
+}
+
+type v1AuthSpec struct {
+	// OAuth2 obtains the tokens from a token endpoint with the client
+	// credentials grant.
+	// (optional, exclusive with jwt)
+	OAuth2 *v1OAuth2Spec `yaml:"oauth2,omitempty" json:"oauth2,omitempty"`
+	// JWT signs the tokens with a local private key.
+	// (optional, exclusive with oauth2)
+	JWT *v1JWTSpec `yaml:"jwt,omitempty" json:"jwt,omitempty"`
+	// RefreshBefore is how long before expiring the tokens are refreshed,
+	// such as "1m".
+	// (optional)
+	RefreshBefore string `yaml:"refresh_before,omitempty" json:"refresh_before,omitempty"`
+	// Insecure allows sending the tokens over connections without tls.
+	// (optional)
+	Insecure bool `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+}
+
+type v1OAuth2Spec struct {
+	// TokenURL is the url of the token endpoint.
+	// (required)
+	TokenURL string `yaml:"token_url" json:"token_url"`
+	// ClientID identifies the client with the token endpoint.
+	// (required)
+	ClientID string `yaml:"client_id" json:"client_id"`
+	// ClientSecret is the secret of the client.
+	// (optional, exclusive with client_secret_env and client_secret_file)
+	ClientSecret string `yaml:"client_secret,omitempty" json:"client_secret,omitempty"`
+	// ClientSecretEnv is the environment variable with the secret.
+	// (optional, exclusive with client_secret and client_secret_file)
+	ClientSecretEnv string `yaml:"client_secret_env,omitempty" json:"client_secret_env,omitempty"`
+	// ClientSecretFile is the path of the file with the secret.
+	// (optional, exclusive with client_secret and client_secret_env)
+	ClientSecretFile string `yaml:"client_secret_file,omitempty" json:"client_secret_file,omitempty"`
+	// Scopes are the scopes requested for the tokens.
+	// (optional)
+	Scopes []string `yaml:"scopes,omitempty" json:"scopes,omitempty"`
+	// Audience is the audience requested for the tokens.
+	// (optional)
+	Audience string `yaml:"audience,omitempty" json:"audience,omitempty"`
+}
+
+type v1JWTSpec struct {
+	// KeyFile is the path of the PEM private key that signs the tokens,
+	// either RSA, ECDSA P-256 or Ed25519.
+	// (required)
+	KeyFile string `yaml:"key_file" json:"key_file"`
+	// KeyID is sent in the kid header of the tokens.
+	// (optional)
+	KeyID string `yaml:"key_id,omitempty" json:"key_id,omitempty"`
+	// Issuer is the iss claim of the tokens.
+	// (optional)
+	Issuer string `yaml:"issuer,omitempty" json:"issuer,omitempty"`
+	// Subject is the sub claim of the tokens.
+	// (optional)
+	Subject string `yaml:"subject,omitempty" json:"subject,omitempty"`
+	// Audience is the aud claim of the tokens.
+	// (optional)
+	Audience string `yaml:"audience,omitempty" json:"audience,omitempty"`
+	// Lifetime of the tokens, such as "1h".
+	// (optional)
+	Lifetime string `yaml:"lifetime,omitempty" json:"lifetime,omitempty"`
+}
+
+type v1HeaderSpec struct {
+	// Name of the header, such as "authorization".
+	// (required)
+	Name string `yaml:"name" json:"name"`
+	// Value of the header.
+	// (optional, exclusive with env and file)
+	Value string `yaml:"value,omitempty" json:"value,omitempty"`
+	// Env is the name of the environment variable with the value.
+	// (optional, exclusive with value and file)
+	Env string `yaml:"env,omitempty" json:"env,omitempty"`
+	// File is the path of the file with the value, without the leading and
+	// trailing whitespace.
+	// (optional, exclusive with value and env)
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
+}
+
+type v1RetrySpec struct {
+	// MaxAttempts is the maximum number of calls for each message, including
+	// the first.
+	// (optional)
+	MaxAttempts uint `yaml:"max_attempts,omitempty" json:"max_attempts,omitempty"`
+	// InitialBackoff is the time before the first retry, such as "100ms".
+	// (optional)
+	InitialBackoff string `yaml:"initial_backoff,omitempty" json:"initial_backoff,omitempty"`
+	// MaxBackoff is the maximum time between retries, such as "10s".
+	// (optional)
+	MaxBackoff string `yaml:"max_backoff,omitempty" json:"max_backoff,omitempty"`
+	// Jitter randomizes the time between retries, either "none", "full" or
+	// "decorrelated".
+	// (optional)
+	Jitter string `yaml:"jitter,omitempty" json:"jitter,omitempty"`
+	// Codes are the names of the grpc status codes that are retried, such as
+	// "UNAVAILABLE".
+	// (optional)
+	Codes []string `yaml:"codes,omitempty" json:"codes,omitempty"`
+}
+
+type v1CircuitBreakerSpec struct {
+	// ConsecutiveFailures opens the breaker after this number of calls fail
+	// in a row.
+	// (optional)
+	ConsecutiveFailures uint `yaml:"consecutive_failures,omitempty" json:"consecutive_failures,omitempty"`
+	// ErrorRate opens the breaker when this fraction of the last calls fail,
+	// between 0 and 1.
+	// (optional)
+	ErrorRate float64 `yaml:"error_rate,omitempty" json:"error_rate,omitempty"`
+	// Window is the number of calls used to compute the error rate.
+	// (optional)
+	Window uint `yaml:"window,omitempty" json:"window,omitempty"`
+	// OpenTimeout is how long the breaker stays open, such as "30s".
+	// (optional)
+	OpenTimeout string `yaml:"open_timeout,omitempty" json:"open_timeout,omitempty"`
+	// HalfOpenProbes is the number of successful calls that close a
+	// half-open breaker.
+	// (optional)
+	HalfOpenProbes uint `yaml:"half_open_probes,omitempty" json:"half_open_probes,omitempty"`
+	// WhileOpen specifies what happens to the messages while the breaker is
+	// open, either "wait" or "fail".
+	// (optional)
+	WhileOpen string `yaml:"while_open,omitempty" json:"while_open,omitempty"`
+}
+
+type v1TLSSpec struct {
+	// CAFile is the path of the certificate authority used to verify the
+	// server certificate. If omitted, the host root certificates are used.
+	// (optional)
+	CAFile string `yaml:"ca_file,omitempty" json:"ca_file,omitempty"`
+	// CertFile is the path of the client certificate for mutual
+	// authentication. Requires KeyFile.
+	// (optional)
+	CertFile string `yaml:"cert_file,omitempty" json:"cert_file,omitempty"`
+	// KeyFile is the path of the client key for mutual authentication.
+	// Requires CertFile.
+	// (optional)
+	KeyFile string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
+	// ServerName overrides the name used to verify the server certificate.
+	// (optional)
+	ServerName string `yaml:"server_name,omitempty" json:"server_name,omitempty"`
+	// InsecureSkipVerify disables the verification of the server certificate.
+	// (optional)
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"`
 }
 
 type v1StageSpec struct {
 	// Name that should be associated with the stage.
 	// (required, unique)
-	Name string `yaml:"name"`
+	Name string `yaml:"name" json:"name"`
 	// Address where to connect to the grpc server.
 	// (required)
-	Address string `yaml:"address"`
+	Address string `yaml:"address" json:"address"`
 	// Name of the grpc service that contains the rpc to execute. May be
 	// omitted if the target grpc server only has one service.
 	// (optional)
-	Service string `yaml:"service,omitempty"`
+	Service string `yaml:"service,omitempty" json:"service,omitempty"`
 	// Name of the grpc method to execute. May be omitted if the service has
 	// only a single method.
 	// (optional)
-	Method string `yaml:"method,omitempty"`
+	Method string `yaml:"method,omitempty" json:"method,omitempty"`
+	// Timeout for each invocation of the grpc method, such as "30s".
+	// (optional)
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// TLS configures a secure connection with the grpc server.
+	// (optional)
+	TLS *v1TLSSpec `yaml:"tls,omitempty" json:"tls,omitempty"`
+	// OnError specifies what happens when the grpc method fails, either
+	// "fail" to stop the pipeline or "skip" to send the message to the dead
+	// letter of the pipeline and continue with the next message.
+	// (optional)
+	OnError string `yaml:"on_error,omitempty" json:"on_error,omitempty"`
+	// CircuitBreaker stops calling the grpc method while it keeps failing.
+	// (optional)
+	CircuitBreaker *v1CircuitBreakerSpec `yaml:"circuit_breaker,omitempty" json:"circuit_breaker,omitempty"`
+	// Retry retries the failed calls of the grpc method.
+	// (optional)
+	Retry *v1RetrySpec `yaml:"retry,omitempty" json:"retry,omitempty"`
+	// Metadata are the headers sent with every call of the grpc method.
+	// (optional)
+	Metadata []v1HeaderSpec `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	// Auth authenticates the calls of the grpc method and the reflection
+	// requests with tokens.
+	// (optional)
+	Auth *v1AuthSpec `yaml:"auth,omitempty" json:"auth,omitempty"`
+	// Extends specifies the name of a stage template. Fields that are not
+	// specified in this stage are filled with the ones from the template.
+	// (optional)
+	Extends string `yaml:"extends,omitempty" json:"extends,omitempty"`
 	// Pipeline specifies the name of the Pipeline where this stage
-	// should be inserted.
-	// (required)
-	Pipeline string `yaml:"pipeline"`
+	// should be inserted. May be omitted if a single pipeline is defined.
+	// (optional)
+	Pipeline string `yaml:"pipeline" json:"pipeline"`
+}
+
+type v1StageTemplateSpec struct {
+	// Name that should be associated with the template.
+	// (required, unique)
+	Name string `yaml:"name" json:"name"`
+	// Address where to connect to the grpc server.
+	// (optional)
+	Address string `yaml:"address,omitempty" json:"address,omitempty"`
+	// Name of the grpc service that contains the rpc to execute.
+	// (optional)
+	Service string `yaml:"service,omitempty" json:"service,omitempty"`
+	// Name of the grpc method to execute.
+	// (optional)
+	Method string `yaml:"method,omitempty" json:"method,omitempty"`
+	// Timeout for each invocation of the grpc method, such as "30s".
+	// (optional)
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// TLS configures a secure connection with the grpc server.
+	// (optional)
+	TLS *v1TLSSpec `yaml:"tls,omitempty" json:"tls,omitempty"`
+	// OnError specifies what happens when the grpc method fails.
+	// (optional)
+	OnError string `yaml:"on_error,omitempty" json:"on_error,omitempty"`
+	// CircuitBreaker stops calling the grpc method while it keeps failing.
+	// (optional)
+	CircuitBreaker *v1CircuitBreakerSpec `yaml:"circuit_breaker,omitempty" json:"circuit_breaker,omitempty"`
+	// Retry retries the failed calls of the grpc method.
+	// (optional)
+	Retry *v1RetrySpec `yaml:"retry,omitempty" json:"retry,omitempty"`
+	// Metadata are the headers sent with every call of the grpc method.
+	// (optional)
+	Metadata []v1HeaderSpec `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	// Auth authenticates the calls of the grpc method and the reflection
+	// requests with tokens.
+	// (optional)
+	Auth *v1AuthSpec `yaml:"auth,omitempty" json:"auth,omitempty"`
+	// Extends specifies the name of another stage template to extend.
+	// (optional)
+	Extends string `yaml:"extends,omitempty" json:"extends,omitempty"`
 }
 
 type v1LinkSpec struct {
 	// Name that should be associated with the link.
 	// (required, unique)
-	Name string `yaml:"name"`
+	Name string `yaml:"name" json:"name"`
 	// SourceStage defines the name of the stage that is the source of the link.
 	// The messages returned by the rpc executed in this stage are transferred
 	// through this link to the next stage.
 	// (required)
-	SourceStage string `yaml:"source_stage"`
+	SourceStage string `yaml:"source_stage" json:"source_stage"`
 	// SourceField defines the field of the source message that should be sent
 	// through the link. If specified, the message transferred through this link
 	// is the field with the given name from the message returned by SourceStage.
 	// If not specified, the entire message from SourceStage is used.
 	// (optional)
-	SourceField string `yaml:"source_field,omitempty"`
+	SourceField string `yaml:"source_field,omitempty" json:"source_field,omitempty"`
 	// TargetStage defines the name of the stage that is the target of the link.
 	// The messages that are transferred through this link are used as input for
 	// the rpc method in this stage.
 	// (required)
-	TargetStage string `yaml:"target_stage"`
+	TargetStage string `yaml:"target_stage" json:"target_stage"`
 	// TargetField defines the field of the input of TargetStage that should be
 	// filled with the messages transferred with this link. If specified, the
 	// field TargetField of message that is the input of TargetStage is set to
 	// the messages received through this link. If not specified, the entire
 	// message is sent as input to the TargetStage.
 	// (optional)
-	TargetField string `yaml:"target_field,omitempty"`
+	TargetField string `yaml:"target_field,omitempty" json:"target_field,omitempty"`
 	// Size defines the buffer size for this link.
-	Size uint `yaml:"size,omitempty"`
+	Size uint `yaml:"size,omitempty" json:"size,omitempty"`
 	// NumEmptyMessages specifies the number of empty messages to fill this link with
 	// when the pipeline is starting. It allows for cycles, but providing a mechanism
 	// to send a first empty message for one of the stages.
 	// (optional)
-	NumEmptyMessages uint `yaml:"num_empty_messages,omitempty"`
-	// Pipeline specifies the pipeline where this link is inserted.
-	// (required)
-	Pipeline string `yaml:"pipeline"`
+	NumEmptyMessages uint `yaml:"num_empty_messages,omitempty" json:"num_empty_messages,omitempty"`
+	// Strict specifies that all the fields of the source message must match
+	// a field of the target message, and vice versa. Otherwise, the
+	// unmatched fields are only reported as warnings.
+	// (optional)
+	Strict bool `yaml:"strict,omitempty" json:"strict,omitempty"`
+	// Match specifies how the fields of the source message are matched with
+	// the fields of the target message, either "by_number" or "by_name". With
+	// "by_name", the messages are converted to the target type.
+	// (optional)
+	Match string `yaml:"match,omitempty" json:"match,omitempty"`
+	// SourceType is the full name of the message type packed in the
+	// google.protobuf.Any messages of the source, which are unpacked before
+	// they are sent to the target.
+	// (optional)
+	SourceType string `yaml:"source_type,omitempty" json:"source_type,omitempty"`
+	// Pipeline specifies the pipeline where this link is inserted. May be
+	// omitted if a single pipeline is defined.
+	// (optional)
+	Pipeline string `yaml:"pipeline" json:"pipeline"`
 }
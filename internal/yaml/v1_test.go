@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/DuarteMRAlves/maestro/internal/api"
 	"github.com/google/go-cmp/cmp"
@@ -121,6 +122,88 @@ func TestReadV1(t *testing.T) {
 				},
 			},
 		},
+		"defaults and templates": {
+			files: []string{"../../test/data/unit/read/v1/defaults.yml"},
+			expected: []*api.Pipeline{
+				{
+					Name:              "pipeline-1",
+					DeadLetter:        &api.DeadLetter{File: "dlq.jsonl"},
+					PropagateMetadata: []string{"x-request-id"},
+					Stages: []*api.Stage{
+						{
+							Name:    "stage-1",
+							Address: "host-1:1",
+							Service: "Service1",
+							Method:  "Method1",
+							Timeout: time.Minute,
+							TLS:     &api.TLS{CAFile: "ca.pem"},
+							OnError: "skip",
+							CircuitBreaker: &api.CircuitBreaker{
+								ConsecutiveFailures: 5,
+								OpenTimeout:         10 * time.Second,
+								WhileOpen:           "fail",
+							},
+							Retry: &api.Retry{
+								MaxAttempts: 4,
+								MaxBackoff:  5 * time.Second,
+								Codes:       []string{"UNAVAILABLE", "DEADLINE_EXCEEDED"},
+							},
+							Metadata: []*api.Header{
+								{Name: "x-tenant-id", Value: "tenant-1"},
+							},
+							Auth: &api.Auth{
+								JWT: &api.JWT{
+									KeyFile:  "key.pem",
+									Issuer:   "maestro",
+									Lifetime: 10 * time.Minute,
+								},
+							},
+						},
+						{
+							Name:    "stage-2",
+							Address: "address-2:2",
+							Timeout: 10 * time.Second,
+							TLS: &api.TLS{
+								ServerName:         "server-2",
+								InsecureSkipVerify: true,
+							},
+							OnError: "fail",
+							Retry: &api.Retry{
+								MaxAttempts: 4,
+								MaxBackoff:  5 * time.Second,
+								Codes:       []string{"UNAVAILABLE", "DEADLINE_EXCEEDED"},
+							},
+							Metadata: []*api.Header{
+								{Name: "x-api-key", Env: "API_KEY"},
+							},
+							Auth: &api.Auth{
+								OAuth2: &api.OAuth2{
+									TokenURL:         "http://localhost:8081/token",
+									ClientID:         "maestro",
+									ClientSecretFile: "secret.txt",
+									Scopes:           []string{"pipelines"},
+								},
+								RefreshBefore: 30 * time.Second,
+							},
+						},
+					},
+					Links: []*api.Link{
+						{
+							Name:        "link-stage-1-stage-2",
+							SourceStage: "stage-1",
+							TargetStage: "stage-2",
+							Size:        5,
+						},
+						{
+							Name:        "link-stage-2-stage-1",
+							SourceStage: "stage-2",
+							TargetStage: "stage-1",
+							Size:        2,
+						},
+					},
+				},
+			},
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -200,6 +283,90 @@ func TestReadV1_Err(t *testing.T) {
 				}
 			},
 		},
+		"stage template not found": {
+			files: []string{"../../test/data/unit/read/v1/err_template_not_found.yml"},
+			verifyErr: func(t *testing.T, err error) {
+				var actual *templateNotFound
+				if !errors.As(err, &actual) {
+					format := "Wrong error type: expected *templateNotFound, got %s"
+					t.Fatalf(format, reflect.TypeOf(err))
+				}
+				expected := &templateNotFound{Name: "unknown"}
+				if diff := cmp.Diff(expected, actual); diff != "" {
+					t.Fatalf("error mismatch:\n%s", diff)
+				}
+			},
+		},
+		"cyclic stage template": {
+			files: []string{"../../test/data/unit/read/v1/err_cyclic_template.yml"},
+			verifyErr: func(t *testing.T, err error) {
+				var actual *cyclicTemplate
+				if !errors.As(err, &actual) {
+					format := "Wrong error type: expected *cyclicTemplate, got %s"
+					t.Fatalf(format, reflect.TypeOf(err))
+				}
+				expected := &cyclicTemplate{Name: "template-1"}
+				if diff := cmp.Diff(expected, actual); diff != "" {
+					t.Fatalf("error mismatch:\n%s", diff)
+				}
+			},
+		},
+		"exclusive dead letter fields": {
+			files: []string{"../../test/data/unit/read/v1/err_exclusive_dead_letter.yml"},
+			verifyErr: func(t *testing.T, err error) {
+				var actual *exclusiveFields
+				if !errors.As(err, &actual) {
+					format := "Wrong error type: expected *exclusiveFields, got %s"
+					t.Fatalf(format, reflect.TypeOf(err))
+				}
+				expected := &exclusiveFields{A: "dead_letter.file", B: "dead_letter.address"}
+				if diff := cmp.Diff(expected, actual); diff != "" {
+					t.Fatalf("error mismatch:\n%s", diff)
+				}
+			},
+		},
+		"exclusive metadata fields": {
+			files: []string{"../../test/data/unit/read/v1/err_exclusive_metadata.yml"},
+			verifyErr: func(t *testing.T, err error) {
+				var actual *exclusiveFields
+				if !errors.As(err, &actual) {
+					format := "Wrong error type: expected *exclusiveFields, got %s"
+					t.Fatalf(format, reflect.TypeOf(err))
+				}
+				expected := &exclusiveFields{A: "metadata.value", B: "metadata.file"}
+				if diff := cmp.Diff(expected, actual); diff != "" {
+					t.Fatalf("error mismatch:\n%s", diff)
+				}
+			},
+		},
+		"exclusive auth fields": {
+			files: []string{"../../test/data/unit/read/v1/err_exclusive_auth.yml"},
+			verifyErr: func(t *testing.T, err error) {
+				var actual *exclusiveFields
+				if !errors.As(err, &actual) {
+					format := "Wrong error type: expected *exclusiveFields, got %s"
+					t.Fatalf(format, reflect.TypeOf(err))
+				}
+				expected := &exclusiveFields{A: "auth.oauth2", B: "auth.jwt"}
+				if diff := cmp.Diff(expected, actual); diff != "" {
+					t.Fatalf("error mismatch:\n%s", diff)
+				}
+			},
+		},
+		"missing pipeline with multiple pipelines": {
+			files: []string{"../../test/data/unit/read/v1/err_missing_pipeline.yml"},
+			verifyErr: func(t *testing.T, err error) {
+				var actual *missingRequiredField
+				if !errors.As(err, &actual) {
+					format := "Wrong error type: expected *missingRequiredField, got %s"
+					t.Fatalf(format, reflect.TypeOf(err))
+				}
+				expected := &missingRequiredField{Field: "pipeline"}
+				if diff := cmp.Diff(expected, actual); diff != "" {
+					t.Fatalf("error mismatch:\n%s", diff)
+				}
+			},
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -255,7 +422,7 @@ func TestWriteV1(t *testing.T) {
 	}
 	tempDir := t.TempDir()
 	outFile := tempDir + "/to_v1.yml"
-	err := WriteV1(&pipeline, outFile, 0777)
+	err := WriteV1([]*api.Pipeline{&pipeline}, outFile, 0777)
 	if err != nil {
 		t.Fatalf("write v1: %s", err)
 	}